@@ -49,6 +49,8 @@ const (
 	CommitmentsMap
 	// PoStProofs is an array of proof-of-spacetime proofs
 	PoStProofs
+	// AddressArray is an array of address.Address
+	AddressArray
 )
 
 func (t Type) String() string {
@@ -81,6 +83,8 @@ func (t Type) String() string {
 		return "map[string]types.Commitments"
 	case PoStProofs:
 		return "[]proofs.PoStProof"
+	case AddressArray:
+		return "[]address.Address"
 	default:
 		return "<unknown type>"
 	}
@@ -122,6 +126,8 @@ func (av *Value) String() string {
 		return fmt.Sprint(av.Val.(map[string]types.Commitments))
 	case PoStProofs:
 		return fmt.Sprint(av.Val.([]proofs.PoStProof))
+	case AddressArray:
+		return fmt.Sprint(av.Val.([]address.Address))
 	default:
 		return "<unknown type>"
 	}
@@ -228,6 +234,13 @@ func (av *Value) Serialize() ([]byte, error) {
 		}
 
 		return cbor.DumpObject(m)
+	case AddressArray:
+		addrs, ok := av.Val.([]address.Address)
+		if !ok {
+			return nil, &typeError{[]address.Address{}, av.Val}
+		}
+
+		return cbor.DumpObject(addrs)
 	default:
 		return nil, fmt.Errorf("unrecognized Type: %d", av.Type)
 	}
@@ -269,6 +282,8 @@ func ToValues(i []interface{}) ([]*Value, error) {
 			out = append(out, &Value{Type: CommitmentsMap, Val: v})
 		case []proofs.PoStProof:
 			out = append(out, &Value{Type: PoStProofs, Val: v})
+		case []address.Address:
+			out = append(out, &Value{Type: AddressArray, Val: v})
 		default:
 			return nil, fmt.Errorf("unsupported type: %T", v)
 		}
@@ -381,6 +396,15 @@ func Deserialize(data []byte, t Type) (*Value, error) {
 			Type: t,
 			Val:  slice,
 		}, nil
+	case AddressArray:
+		var addrs []address.Address
+		if err := cbor.DecodeInto(data, &addrs); err != nil {
+			return nil, err
+		}
+		return &Value{
+			Type: t,
+			Val:  addrs,
+		}, nil
 	case Invalid:
 		return nil, ErrInvalidType
 	default:
@@ -402,6 +426,7 @@ var typeTable = map[Type]reflect.Type{
 	SectorID:       reflect.TypeOf(uint64(0)),
 	CommitmentsMap: reflect.TypeOf(map[string]types.Commitments{}),
 	PoStProofs:     reflect.TypeOf([]proofs.PoStProof{}),
+	AddressArray:   reflect.TypeOf([]address.Address{}),
 }
 
 // TypeMatches returns whether or not 'val' is the go type expected for the given ABI type
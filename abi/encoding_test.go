@@ -25,6 +25,7 @@ func TestBasicEncodingRoundTrip(t *testing.T) {
 		"a string":   {"flugzeug"},
 		"mixed":      {big.NewInt(17), []byte("beep"), "mr rogers", addrGetter()},
 		"sector ids": {uint64(1234), uint64(0)},
+		"addr array": {[]address.Address{addrGetter(), addrGetter()}},
 	}
 
 	for tname, tcase := range cases {
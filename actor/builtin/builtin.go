@@ -5,9 +5,12 @@ import (
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/multisig"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/vesting"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -16,11 +19,33 @@ import (
 // They are indexed by their CID.
 var Actors = map[cid.Cid]exec.ExecutableActor{}
 
-func init() {
+// Config parameterizes the behaviour of the builtin actors. The zero value
+// yields the actors the network launched with.
+type Config struct {
+	// ProvingPeriodBlocks overrides miner.ProvingPeriodBlocks when set.
+	ProvingPeriodBlocks *types.BlockHeight
+}
+
+// NewActors returns a registry of the builtin actors configured by cfg, indexed
+// by their CID. Network upgrades use it to change actor behaviour from their
+// activation height on.
+func NewActors(cfg Config) map[cid.Cid]exec.ExecutableActor {
+	actors := map[cid.Cid]exec.ExecutableActor{}
 	// Instance Actors
-	Actors[types.AccountActorCodeCid] = &account.Actor{}
-	Actors[types.StorageMarketActorCodeCid] = &storagemarket.Actor{}
-	Actors[types.PaymentBrokerActorCodeCid] = &paymentbroker.Actor{}
-	Actors[types.MinerActorCodeCid] = &miner.Actor{}
-	Actors[types.BootstrapMinerActorCodeCid] = &miner.Actor{Bootstrap: true}
+	actors[types.AccountActorCodeCid] = &account.Actor{}
+	actors[types.StorageMarketActorCodeCid] = &storagemarket.Actor{}
+	actors[types.PaymentBrokerActorCodeCid] = &paymentbroker.Actor{}
+	actors[types.MinerActorCodeCid] = &miner.Actor{ProvingPeriodBlocks: cfg.ProvingPeriodBlocks}
+	actors[types.BootstrapMinerActorCodeCid] = &miner.Actor{Bootstrap: true, ProvingPeriodBlocks: cfg.ProvingPeriodBlocks}
+	actors[types.MultisigActorCodeCid] = &multisig.Actor{}
+	actors[types.MultisigFactoryActorCodeCid] = &multisig.Factory{}
+	actors[types.VestingActorCodeCid] = &vesting.Actor{}
+	actors[types.GasScheduleActorCodeCid] = &gasschedule.Actor{}
+	return actors
+}
+
+func init() {
+	for c, a := range NewActors(Config{}) {
+		Actors[c] = a
+	}
 }
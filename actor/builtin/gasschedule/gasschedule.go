@@ -0,0 +1,112 @@
+// Package gasschedule implements the actor holding the gas schedule of the
+// network.
+package gasschedule
+
+import (
+	"math"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+func init() {
+	cbor.RegisterCborType(Schedule{})
+}
+
+// Schedule prices the operations performed while executing a message.
+// Each price is the number of gas units charged for one occurrence of the
+// operation (one byte in the case of StoragePutPerByte).
+type Schedule struct {
+	MethodCall        types.GasUnits `json:"methodCall"`
+	Send              types.GasUnits `json:"send"`
+	StoragePutPerByte types.GasUnits `json:"storagePutPerByte"`
+	CreateActor       types.GasUnits `json:"createActor"`
+	VerifySignature   types.GasUnits `json:"verifySignature"`
+	VerifySeal        types.GasUnits `json:"verifySeal"`
+	VerifyPoSt        types.GasUnits `json:"verifyPoSt"`
+}
+
+// DefaultSchedule returns the schedule used when the genesis block does not
+// configure one. It charges only the flat per-method cost that builtin actors
+// have always charged, so chains without a configured schedule keep their
+// existing gas costs.
+func DefaultSchedule() *Schedule {
+	return &Schedule{
+		MethodCall: types.NewGasUnits(actor.DefaultGasCost),
+	}
+}
+
+// Price returns the price of a single occurrence of op.
+func (gs *Schedule) Price(op exec.GasOp) types.GasUnits {
+	switch op {
+	case exec.GasOpMethodCall:
+		return gs.MethodCall
+	case exec.GasOpSend:
+		return gs.Send
+	case exec.GasOpStoragePutByte:
+		return gs.StoragePutPerByte
+	case exec.GasOpCreateActor:
+		return gs.CreateActor
+	case exec.GasOpVerifySignature:
+		return gs.VerifySignature
+	case exec.GasOpVerifySeal:
+		return gs.VerifySeal
+	case exec.GasOpVerifyPoSt:
+		return gs.VerifyPoSt
+	default:
+		return types.NewGasUnits(0)
+	}
+}
+
+// Cost returns the price of count occurrences of op, saturating at the
+// maximum number of gas units instead of overflowing.
+func (gs *Schedule) Cost(op exec.GasOp, count uint64) types.GasUnits {
+	price := uint64(gs.Price(op))
+	if count != 0 && price > math.MaxUint64/count {
+		return types.NewGasUnits(math.MaxUint64)
+	}
+	return types.NewGasUnits(price * count)
+}
+
+// Actor holds the gas schedule configured in the genesis block as its state.
+// The VM reads the schedule directly, the actor has no methods.
+type Actor struct{}
+
+// NewActor returns a new gas schedule actor.
+func NewActor() *actor.Actor {
+	return actor.NewActor(types.GasScheduleActorCodeCid, types.NewZeroAttoFIL())
+}
+
+// InitializeState stores the schedule given as a *Schedule.
+func (ga *Actor) InitializeState(storage exec.Storage, initializerData interface{}) error {
+	schedule, ok := initializerData.(*Schedule)
+	if !ok {
+		return errors.NewFaultError("Initial state to gas schedule actor is not a gasschedule.Schedule struct")
+	}
+
+	stateBytes, err := cbor.DumpObject(schedule)
+	if err != nil {
+		return errors.FaultErrorWrap(err, "failed to cbor marshal object")
+	}
+
+	id, err := storage.Put(stateBytes)
+	if err != nil {
+		return err
+	}
+
+	return storage.Commit(id, cid.Undef)
+}
+
+var _ exec.ExecutableActor = (*Actor)(nil)
+
+// Exports returns the actor's exports.
+func (ga *Actor) Exports() exec.Exports {
+	return gasScheduleExports
+}
+
+var gasScheduleExports = exec.Exports{}
@@ -0,0 +1,25 @@
+package gasschedule
+
+import (
+	"math"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestScheduleCost(t *testing.T) {
+	assert := assert.New(t)
+
+	gs := &Schedule{
+		MethodCall:        types.NewGasUnits(100),
+		StoragePutPerByte: types.NewGasUnits(2),
+	}
+
+	assert.Equal(types.NewGasUnits(100), gs.Cost(exec.GasOpMethodCall, 1))
+	assert.Equal(types.NewGasUnits(20), gs.Cost(exec.GasOpStoragePutByte, 10))
+	assert.Equal(types.NewGasUnits(0), gs.Cost(exec.GasOpSend, 10))
+	assert.Equal(types.NewGasUnits(math.MaxUint64), gs.Cost(exec.GasOpStoragePutByte, math.MaxUint64))
+}
@@ -3,6 +3,7 @@ package miner
 import (
 	"math/big"
 	"os"
+	"sort"
 	"strconv"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -39,6 +40,10 @@ var ProvingPeriodBlocks = types.NewBlockHeight(20000)
 // See https://github.com/filecoin-project/go-filecoin/issues/1887
 var GracePeriodBlocks = types.NewBlockHeight(100)
 
+// MaxMissedPoSts is the number of consecutive proving periods a miner may
+// miss before its sectors are removed.
+const MaxMissedPoSts = 3
+
 const (
 	// ErrPublicKeyTooBig indicates an invalid public key.
 	ErrPublicKeyTooBig = 33
@@ -58,6 +63,22 @@ const (
 	ErrAskNotFound = 40
 	// ErrInvalidSealProof signals that the passed in seal proof was invalid.
 	ErrInvalidSealProof = 41
+	// ErrNoProvingPeriod signals a miner that has not committed a sector yet
+	// and so has no proving period.
+	ErrNoProvingPeriod = 42
+	// ErrPoStTooLate signals a PoSt submitted after the grace period.
+	ErrPoStTooLate = 43
+	// ErrPoStNotDue signals a report of a missed PoSt for a miner with no
+	// sectors or whose grace period has not passed.
+	ErrPoStNotDue = 44
+	// ErrInvalidFaults signals declared faults that are not committed sectors.
+	ErrInvalidFaults = 45
+	// ErrInsufficientCollateral signals collateral below the minimum for the pledge.
+	ErrInsufficientCollateral = 46
+	// ErrInvalidAmount signals an amount that is not positive.
+	ErrInvalidAmount = 47
+	// ErrSectorsCommitted signals an exit by a miner that still has committed sectors.
+	ErrSectorsCommitted = 48
 )
 
 // Errors map error codes to revert errors this actor may return.
@@ -71,6 +92,13 @@ var Errors = map[uint8]error{
 	ErrInvalidPoSt:             errors.NewCodedRevertErrorf(ErrInvalidPoSt, "PoSt proof did not validate"),
 	ErrAskNotFound:             errors.NewCodedRevertErrorf(ErrAskNotFound, "no ask was found"),
 	ErrInvalidSealProof:        errors.NewCodedRevertErrorf(ErrInvalidSealProof, "seal proof was invalid"),
+	ErrNoProvingPeriod:         errors.NewCodedRevertErrorf(ErrNoProvingPeriod, "miner has no proving period before its first commitment"),
+	ErrPoStTooLate:             errors.NewCodedRevertErrorf(ErrPoStTooLate, "PoSt submitted after the grace period"),
+	ErrPoStNotDue:              errors.NewCodedRevertErrorf(ErrPoStNotDue, "miner has no missed PoSt to report"),
+	ErrInvalidFaults:           errors.NewCodedRevertErrorf(ErrInvalidFaults, "faults must be distinct committed sectors"),
+	ErrInsufficientCollateral:  errors.NewCodedRevertErrorf(ErrInsufficientCollateral, "collateral must cover the minimum collateral of the pledge"),
+	ErrInvalidAmount:           errors.NewCodedRevertErrorf(ErrInvalidAmount, "amount must be positive"),
+	ErrSectorsCommitted:        errors.NewCodedRevertErrorf(ErrSectorsCommitted, "miner still has committed sectors"),
 }
 
 // Actor is the miner actor.
@@ -83,8 +111,21 @@ var Errors = map[uint8]error{
 // The `Bootstrap` field must be set to `true` if the miner was created in the
 // genesis block. If the miner was created in any other block, `Bootstrap` must
 // be false.
+//
+// `ProvingPeriodBlocks`, when set, overrides the package level
+// ProvingPeriodBlocks. Network upgrades use it to change the length of the
+// proving period from their activation height on.
 type Actor struct {
-	Bootstrap bool
+	Bootstrap           bool
+	ProvingPeriodBlocks *types.BlockHeight
+}
+
+// ProvingPeriod returns the length of the proving period enforced by ma.
+func (ma *Actor) ProvingPeriod() *types.BlockHeight {
+	if ma.ProvingPeriodBlocks != nil {
+		return ma.ProvingPeriodBlocks
+	}
+	return ProvingPeriodBlocks
 }
 
 // Ask is a price advertisement by the miner
@@ -96,8 +137,13 @@ type Ask struct {
 
 // State is the miner actors storage.
 type State struct {
+	// Owner controls the miner's collateral and receives its funds.
 	Owner address.Address
 
+	// Worker is the address authorized to commit sectors and submit PoSts on
+	// behalf of the miner. It starts out as the owner.
+	Worker address.Address
+
 	// PeerID references the libp2p identity that the miner is operating.
 	PeerID peer.ID
 
@@ -122,11 +168,20 @@ type State struct {
 	// See also: https://github.com/polydawn/refmt/issues/35
 	SectorCommitments map[string]types.Commitments
 
+	// SectorDeals maps the (stringified) id of a committed sector to the ids
+	// of the storage market deals it activated, which fail if the sector is
+	// removed.
+	SectorDeals map[string][]uint64
+
 	LastUsedSectorID uint64
 
 	ProvingPeriodStart *types.BlockHeight
 	LastPoSt           *types.BlockHeight
 
+	// MissedPoSts is the number of consecutive proving periods that were
+	// reported as missed. An on time PoSt resets it.
+	MissedPoSts uint64
+
 	Power *big.Int
 }
 
@@ -139,11 +194,13 @@ func NewActor() *actor.Actor {
 func NewState(owner address.Address, key []byte, pledge *big.Int, pid peer.ID, collateral *types.AttoFIL) *State {
 	return &State{
 		Owner:             owner,
+		Worker:            owner,
 		PeerID:            pid,
 		PublicKey:         key,
 		PledgeSectors:     pledge,
 		Collateral:        collateral,
 		SectorCommitments: make(map[string]types.Commitments),
+		SectorDeals:       make(map[string][]uint64),
 		Power:             big.NewInt(0),
 		NextAskID:         big.NewInt(0),
 	}
@@ -190,16 +247,32 @@ var minerExports = exec.Exports{
 		Params: []abi.Type{abi.Integer},
 		Return: []abi.Type{abi.Bytes},
 	},
+	"getLiveAsks": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.Bytes},
+	},
 	"getOwner": &exec.FunctionSignature{
 		Params: nil,
 		Return: []abi.Type{abi.Address},
 	},
+	"getWorker": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.Address},
+	},
+	"changeWorker": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: nil,
+	},
+	"transferOwnership": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: nil,
+	},
 	"getLastUsedSectorID": &exec.FunctionSignature{
 		Params: nil,
 		Return: []abi.Type{abi.SectorID},
 	},
 	"commitSector": &exec.FunctionSignature{
-		Params: []abi.Type{abi.SectorID, abi.Bytes, abi.Bytes, abi.Bytes, abi.Bytes},
+		Params: []abi.Type{abi.SectorID, abi.Bytes, abi.Bytes, abi.Bytes, abi.Bytes, abi.UintArray},
 		Return: []abi.Type{},
 	},
 	"getKey": &exec.FunctionSignature{
@@ -223,13 +296,45 @@ var minerExports = exec.Exports{
 		Return: []abi.Type{abi.Integer},
 	},
 	"submitPoSt": &exec.FunctionSignature{
-		Params: []abi.Type{abi.PoStProofs},
+		Params: []abi.Type{abi.PoStProofs, abi.UintArray},
 		Return: []abi.Type{},
 	},
+	"reportMissedPoSt": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{},
+	},
+	"getMissedPoSts": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{abi.Integer},
+	},
+	"getCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{abi.AttoFIL},
+	},
+	"addCollateral": &exec.FunctionSignature{
+		Params: nil,
+		Return: nil,
+	},
+	"increasePledge": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Integer},
+		Return: nil,
+	},
+	"withdrawCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{abi.AttoFIL},
+		Return: nil,
+	},
+	"exit": &exec.FunctionSignature{
+		Params: nil,
+		Return: nil,
+	},
 	"getProvingPeriodStart": &exec.FunctionSignature{
 		Params: []abi.Type{},
 		Return: []abi.Type{abi.BlockHeight},
 	},
+	"getProvingPeriodEnd": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{abi.BlockHeight},
+	},
 	"getSectorCommitments": &exec.FunctionSignature{
 		Params: nil,
 		Return: []abi.Type{abi.CommitmentsMap},
@@ -244,7 +349,7 @@ func (ma *Actor) Exports() exec.Exports {
 // AddAsk adds an ask to this miners ask list
 func (ma *Actor) AddAsk(ctx exec.VMContext, price *types.AttoFIL, expiry *big.Int) (*big.Int, uint8,
 	error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -294,7 +399,7 @@ func (ma *Actor) AddAsk(ctx exec.VMContext, price *types.AttoFIL, expiry *big.In
 // GetAsks returns all the asks for this miner. (TODO: this isnt a great function signature, it returns the asks in a
 // serialized array. Consider doing this some other way)
 func (ma *Actor) GetAsks(ctx exec.VMContext) ([]uint64, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 	var state State
@@ -323,7 +428,7 @@ func (ma *Actor) GetAsks(ctx exec.VMContext) ([]uint64, uint8, error) {
 
 // GetAsk returns an ask by ID
 func (ma *Actor) GetAsk(ctx exec.VMContext, askid *big.Int) ([]byte, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -360,9 +465,40 @@ func (ma *Actor) GetAsk(ctx exec.VMContext, askid *big.Int) ([]byte, uint8, erro
 	return ask, 0, nil
 }
 
+// GetLiveAsks returns the asks of this miner that have not expired at the
+// current block height, cbor encoded, so they can be listed with one call
+// instead of a getAsk call per ask.
+func (ma *Actor) GetLiveAsks(ctx exec.VMContext) ([]byte, uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		asks := []*Ask{}
+		for _, a := range state.Asks {
+			if ctx.BlockHeight().LessThan(a.Expiry) {
+				asks = append(asks, a)
+			}
+		}
+
+		return cbor.DumpObject(asks)
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	asks, ok := out.([]byte)
+	if !ok {
+		return nil, 1, errors.NewRevertErrorf("expected a Bytes return value from call, but got %T instead", out)
+	}
+
+	return asks, 0, nil
+}
+
 // GetOwner returns the miners owner.
 func (ma *Actor) GetOwner(ctx exec.VMContext) (address.Address, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return address.Address{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -382,9 +518,79 @@ func (ma *Actor) GetOwner(ctx exec.VMContext) (address.Address, uint8, error) {
 	return a, 0, nil
 }
 
+// GetWorker returns the miners worker.
+func (ma *Actor) GetWorker(ctx exec.VMContext) (address.Address, uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return address.Address{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		return state.Worker, nil
+	})
+	if err != nil {
+		return address.Address{}, errors.CodeError(err), err
+	}
+
+	a, ok := out.(address.Address)
+	if !ok {
+		return address.Address{}, 1, errors.NewFaultErrorf("expected an Address return value from call, but got %T instead", out)
+	}
+
+	return a, 0, nil
+}
+
+// ChangeWorker sets the address authorized to commit sectors and submit
+// PoSts. Only the owner may change the worker.
+func (ma *Actor) ChangeWorker(ctx exec.VMContext, worker address.Address) (uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.Worker = worker
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// TransferOwnership hands control of the miner to a new owner. Only the
+// current owner may transfer ownership. The worker is left unchanged.
+func (ma *Actor) TransferOwnership(ctx exec.VMContext, owner address.Address) (uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.Owner = owner
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
 // GetLastUsedSectorID returns the last used sector id.
 func (ma *Actor) GetLastUsedSectorID(ctx exec.VMContext) (uint64, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return 0, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 	var state State
@@ -405,7 +611,7 @@ func (ma *Actor) GetLastUsedSectorID(ctx exec.VMContext) (uint64, uint8, error)
 
 // GetSectorCommitments returns all sector commitments posted by this miner.
 func (ma *Actor) GetSectorCommitments(ctx exec.VMContext) (map[string]types.Commitments, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -426,9 +632,10 @@ func (ma *Actor) GetSectorCommitments(ctx exec.VMContext) (map[string]types.Comm
 }
 
 // CommitSector adds a commitment to the specified sector. The sector must not
-// already be committed.
-func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR, commRStar, proof []byte) (uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+// already be committed. The storage market deals with the given ids, whose
+// pieces the sector holds, become active.
+func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR, commRStar, proof []byte, dealIDs []uint64) (uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 	if len(commD) != int(proofs.CommitmentBytesLen) {
@@ -454,6 +661,10 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 			sectorStoreType = proofs.Test
 		}
 
+		if err := ctx.ChargeOp(exec.GasOpVerifySeal, 1); err != nil {
+			return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+		}
+
 		req := proofs.VerifySealRequest{}
 		copy(req.CommD[:], commD)
 		copy(req.CommR[:], commR)
@@ -479,7 +690,7 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 	var state State
 	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != state.Owner {
+		if ctx.Message().From != state.Worker {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -510,6 +721,21 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 		if ret != 0 {
 			return nil, Errors[ErrStoragemarketCallFailed]
 		}
+
+		if len(dealIDs) > 0 {
+			_, ret, err = ctx.Send(address.StorageMarketAddress, "activateDeals", nil, []interface{}{sectorID, dealIDs})
+			if err != nil {
+				return nil, err
+			}
+			if ret != 0 {
+				return nil, Errors[ErrStoragemarketCallFailed]
+			}
+
+			if state.SectorDeals == nil {
+				state.SectorDeals = make(map[string][]uint64)
+			}
+			state.SectorDeals[sectorIDstr] = dealIDs
+		}
 		return nil, nil
 	})
 	if err != nil {
@@ -521,7 +747,7 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 
 // GetKey returns the public key for this miner.
 func (ma *Actor) GetKey(ctx exec.VMContext) ([]byte, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -543,7 +769,7 @@ func (ma *Actor) GetKey(ctx exec.VMContext) ([]byte, uint8, error) {
 
 // GetPeerID returns the libp2p peer ID that this miner can be reached at.
 func (ma *Actor) GetPeerID(ctx exec.VMContext) (peer.ID, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return peer.ID(""), exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -563,7 +789,7 @@ func (ma *Actor) GetPeerID(ctx exec.VMContext) (peer.ID, uint8, error) {
 
 // UpdatePeerID is used to update the peerID this miner is operating under.
 func (ma *Actor) UpdatePeerID(ctx exec.VMContext, pid peer.ID) (uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -587,7 +813,7 @@ func (ma *Actor) UpdatePeerID(ctx exec.VMContext, pid peer.ID) (uint8, error) {
 
 // GetPledge returns the number of pledged sectors
 func (ma *Actor) GetPledge(ctx exec.VMContext) (*big.Int, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -609,7 +835,7 @@ func (ma *Actor) GetPledge(ctx exec.VMContext) (*big.Int, uint8, error) {
 
 // GetPower returns the amount of proven sectors for this miner.
 func (ma *Actor) GetPower(ctx exec.VMContext) (*big.Int, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -630,23 +856,48 @@ func (ma *Actor) GetPower(ctx exec.VMContext) (*big.Int, uint8, error) {
 }
 
 // SubmitPoSt is used to submit a coalesced PoST to the chain to convince the chain
-// that you have been actually storing the files you claim to be.
-func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+// that you have been actually storing the files you claim to be. Faults lists
+// the ids of the committed sectors the miner could not prove; they are removed,
+// the collateral backing them is slashed and their storage market deals fail.
+// A PoSt submitted after the end of the proving period but within the grace
+// period is accepted for a fee that grows with its lateness. The miner's power
+// becomes the number of sectors it still has committed.
+func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof, faults []uint64) (uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
 	var state State
 	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != state.Owner {
+		if ctx.Message().From != state.Worker {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
-		// reach in to actor storage to grab comm-r for each committed sector
+		// Check if we submitted it in time
+		provingPeriodEnd := state.ProvingPeriodStart.Add(ma.ProvingPeriod())
+		if ctx.BlockHeight().GreaterThan(provingPeriodEnd.Add(GracePeriodBlocks)) {
+			return nil, Errors[ErrPoStTooLate]
+		}
+
+		// reach in to actor storage to grab comm-r for each committed sector,
+		// in order of sector id, and the index of each faulted sector
+		sectorIDs := committedSectorIDs(&state)
+		indices := make(map[uint64]uint64, len(sectorIDs))
 		var commRs []proofs.CommR
-		for _, v := range state.SectorCommitments {
-			commRs = append(commRs, v.CommR)
+		for i, sectorID := range sectorIDs {
+			indices[sectorID] = uint64(i)
+			commRs = append(commRs, state.SectorCommitments[strconv.FormatUint(sectorID, 10)].CommR)
+		}
+
+		faultIndices := make([]uint64, len(faults))
+		for i, sectorID := range faults {
+			index, ok := indices[sectorID]
+			if !ok {
+				return nil, Errors[ErrInvalidFaults]
+			}
+			delete(indices, sectorID)
+			faultIndices[i] = index
 		}
 
 		// See comment above, in CommitSector.
@@ -659,10 +910,14 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (
 			sectorStoreType = proofs.Test
 		}
 
+		if err := ctx.ChargeOp(exec.GasOpVerifyPoSt, 1); err != nil {
+			return nil, errors.RevertErrorWrap(err, "Insufficient gas")
+		}
+
 		req := proofs.VerifyPoSTRequest{
 			ChallengeSeed: proofs.PoStChallengeSeed{},
 			CommRs:        commRs,
-			Faults:        []uint64{},
+			Faults:        faultIndices,
 			Proofs:        postProofs,
 			StoreType:     sectorStoreType,
 		}
@@ -675,19 +930,73 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (
 			return nil, Errors[ErrInvalidPoSt]
 		}
 
-		// Check if we submitted it in time
-		provingPeriodEnd := state.ProvingPeriodStart.Add(ProvingPeriodBlocks)
+		// charge a fee for a late PoSt and slash the collateral of faulted sectors
+		penalty := types.NewZeroAttoFIL()
+		if ctx.BlockHeight().GreaterThan(provingPeriodEnd) {
+			lateness := ctx.BlockHeight().Sub(provingPeriodEnd)
+			penalty = collateralForSectors(&state, state.Power).
+				MulBigInt(lateness.AsBigInt()).
+				DivBigInt(GracePeriodBlocks.AsBigInt())
+		}
+		if len(faults) > 0 {
+			penalty = penalty.Add(collateralForSectors(&state, big.NewInt(int64(len(faults)))))
+			if err := removeSectors(ctx, &state, faults); err != nil {
+				return nil, err
+			}
+		}
+		if err := slashCollateral(ctx, &state, penalty); err != nil {
+			return nil, err
+		}
+
+		state.ProvingPeriodStart = provingPeriodEnd
+		state.LastPoSt = ctx.BlockHeight()
+		state.MissedPoSts = 0
+
+		return nil, setPower(ctx, &state, big.NewInt(int64(len(state.SectorCommitments))))
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// ReportMissedPoSt may be called by anyone once the grace period following
+// the miner's current proving period has passed without a PoSt. It slashes
+// the collateral backing the miner's committed sectors, takes away its power
+// until it submits a PoSt again and moves it on to the next proving period.
+// The sectors of a miner missing MaxMissedPoSts proving periods in a row are
+// removed and their storage market deals fail.
+func (ma *Actor) ReportMissedPoSt(ctx exec.VMContext) (uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
 
-		if ctx.BlockHeight().LessEqual(provingPeriodEnd) {
-			state.ProvingPeriodStart = provingPeriodEnd
-			state.LastPoSt = ctx.BlockHeight()
-		} else {
-			// Not great.
-			// TODO: charge penalty
-			return nil, errors.NewRevertErrorf("submitted PoSt late, need to pay a fee")
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if len(state.SectorCommitments) == 0 {
+			return nil, Errors[ErrPoStNotDue]
 		}
 
-		return nil, nil
+		provingPeriodEnd := state.ProvingPeriodStart.Add(ma.ProvingPeriod())
+		if ctx.BlockHeight().LessEqual(provingPeriodEnd.Add(GracePeriodBlocks)) {
+			return nil, Errors[ErrPoStNotDue]
+		}
+
+		penalty := collateralForSectors(&state, big.NewInt(int64(len(state.SectorCommitments))))
+		if err := slashCollateral(ctx, &state, penalty); err != nil {
+			return nil, err
+		}
+
+		state.ProvingPeriodStart = provingPeriodEnd
+		state.MissedPoSts++
+		if state.MissedPoSts >= MaxMissedPoSts {
+			if err := removeSectors(ctx, &state, committedSectorIDs(&state)); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, setPower(ctx, &state, big.NewInt(0))
 	})
 	if err != nil {
 		return errors.CodeError(err), err
@@ -696,9 +1005,29 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (
 	return 0, nil
 }
 
+// GetMissedPoSts returns the number of consecutive proving periods the miner
+// has been reported to miss.
+func (ma *Actor) GetMissedPoSts(ctx exec.VMContext) (*big.Int, uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	chunk, err := ctx.ReadStorage()
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	var state State
+	if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	return big.NewInt(0).SetUint64(state.MissedPoSts), 0, nil
+}
+
 // GetProvingPeriodStart returns the current ProvingPeriodStart value.
 func (ma *Actor) GetProvingPeriodStart(ctx exec.VMContext) (*types.BlockHeight, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -714,3 +1043,309 @@ func (ma *Actor) GetProvingPeriodStart(ctx exec.VMContext) (*types.BlockHeight,
 
 	return state.ProvingPeriodStart, 0, nil
 }
+
+// GetProvingPeriodEnd returns the height at which the current proving period
+// ends under the proving period length in effect.
+func (ma *Actor) GetProvingPeriodEnd(ctx exec.VMContext) (*types.BlockHeight, uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	chunk, err := ctx.ReadStorage()
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	var state State
+	if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	if state.ProvingPeriodStart == nil {
+		return nil, ErrNoProvingPeriod, Errors[ErrNoProvingPeriod]
+	}
+	return state.ProvingPeriodStart.Add(ma.ProvingPeriod()), 0, nil
+}
+
+// GetCollateral returns the collateral the miner holds for its pledge.
+func (ma *Actor) GetCollateral(ctx exec.VMContext) (*types.AttoFIL, uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	chunk, err := ctx.ReadStorage()
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	var state State
+	if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	return state.Collateral, 0, nil
+}
+
+// AddCollateral adds the value of the message to the miner's collateral.
+func (ma *Actor) AddCollateral(ctx exec.VMContext) (uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	value := ctx.Message().Value
+	if value == nil || !value.IsPositive() {
+		return errors.CodeError(Errors[ErrInvalidAmount]), Errors[ErrInvalidAmount]
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.Collateral = state.Collateral.Add(value)
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// IncreasePledge pledges the given number of additional sectors. The value of
+// the message is added to the miner's collateral, which must cover the
+// minimum collateral of the new pledge.
+func (ma *Actor) IncreasePledge(ctx exec.VMContext, sectors *big.Int) (uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	if sectors.Sign() <= 0 {
+		return errors.CodeError(Errors[ErrInvalidAmount]), Errors[ErrInvalidAmount]
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		pledge := big.NewInt(0).Add(state.PledgeSectors, sectors)
+		collateral := state.Collateral
+		if ctx.Message().Value != nil {
+			collateral = collateral.Add(ctx.Message().Value)
+		}
+		if err := requireCollateral(ctx, pledge, collateral); err != nil {
+			return nil, err
+		}
+
+		state.PledgeSectors = pledge
+		state.Collateral = collateral
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// WithdrawCollateral sends amount of the miner's collateral to its owner.
+// The collateral left must cover the minimum collateral of the pledge.
+func (ma *Actor) WithdrawCollateral(ctx exec.VMContext, amount *types.AttoFIL) (uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	if !amount.IsPositive() {
+		return errors.CodeError(Errors[ErrInvalidAmount]), Errors[ErrInvalidAmount]
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+		if state.Collateral.LessThan(amount) {
+			return nil, Errors[ErrInsufficientCollateral]
+		}
+
+		collateral := state.Collateral.Sub(amount)
+		if err := requireCollateral(ctx, state.PledgeSectors, collateral); err != nil {
+			return nil, err
+		}
+		state.Collateral = collateral
+
+		_, ret, err := ctx.Send(state.Owner, "", amount, nil)
+		if err != nil {
+			return nil, err
+		}
+		if ret != 0 {
+			return nil, errors.NewRevertErrorf("failed to send collateral to owner, exit code %d", ret)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// Exit removes the miner from the storage market and returns all of its
+// collateral to the owner. The miner must not have committed sectors, so
+// none of its storage deals are active. Deals it published but did not
+// activate fail and their collateral is forfeited. An exited miner cannot commit sectors or
+// take deals.
+func (ma *Actor) Exit(ctx exec.VMContext) (uint8, error) {
+	if err := ctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+		if len(state.SectorCommitments) > 0 {
+			return nil, Errors[ErrSectorsCommitted]
+		}
+
+		_, ret, err := ctx.Send(address.StorageMarketAddress, "removeMiner", nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if ret != 0 {
+			return nil, Errors[ErrStoragemarketCallFailed]
+		}
+
+		refund := state.Collateral
+		state.Collateral = types.NewZeroAttoFIL()
+		state.PledgeSectors = big.NewInt(0)
+		state.Asks = nil
+
+		if refund.IsPositive() {
+			_, ret, err = ctx.Send(state.Owner, "", refund, nil)
+			if err != nil {
+				return nil, err
+			}
+			if ret != 0 {
+				return nil, errors.NewRevertErrorf("failed to send collateral to owner, exit code %d", ret)
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// committedSectorIDs returns the ids of the sectors committed by the miner in
+// ascending order.
+func committedSectorIDs(state *State) []uint64 {
+	sectorIDs := make([]uint64, 0, len(state.SectorCommitments))
+	for k := range state.SectorCommitments {
+		sectorID, err := strconv.ParseUint(k, 10, 64)
+		if err != nil {
+			continue
+		}
+		sectorIDs = append(sectorIDs, sectorID)
+	}
+	sort.Slice(sectorIDs, func(i, j int) bool { return sectorIDs[i] < sectorIDs[j] })
+	return sectorIDs
+}
+
+// removeSectors removes the committed sectors with the given ids and fails
+// the storage market deals they activated, forfeiting the deals' collateral.
+func removeSectors(ctx exec.VMContext, state *State, sectorIDs []uint64) error {
+	var dealIDs []uint64
+	for _, sectorID := range sectorIDs {
+		key := strconv.FormatUint(sectorID, 10)
+		dealIDs = append(dealIDs, state.SectorDeals[key]...)
+		delete(state.SectorCommitments, key)
+		delete(state.SectorDeals, key)
+	}
+	if len(dealIDs) == 0 {
+		return nil
+	}
+
+	_, ret, err := ctx.Send(address.StorageMarketAddress, "failDeals", nil, []interface{}{dealIDs})
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return Errors[ErrStoragemarketCallFailed]
+	}
+	return nil
+}
+
+// collateralForSectors returns the share of the miner's collateral backing
+// the given number of its pledged sectors.
+func collateralForSectors(state *State, sectors *big.Int) *types.AttoFIL {
+	if state.PledgeSectors.Sign() <= 0 || sectors.Sign() <= 0 {
+		return types.NewZeroAttoFIL()
+	}
+	if sectors.Cmp(state.PledgeSectors) >= 0 {
+		return state.Collateral
+	}
+	return state.Collateral.MulBigInt(sectors).DivBigInt(state.PledgeSectors)
+}
+
+// slashCollateral takes amount, at most all of it, from the miner's
+// collateral and sends it to the network.
+func slashCollateral(ctx exec.VMContext, state *State, amount *types.AttoFIL) error {
+	if state.Collateral.LessThan(amount) {
+		amount = state.Collateral
+	}
+	if !amount.IsPositive() {
+		return nil
+	}
+
+	state.Collateral = state.Collateral.Sub(amount)
+	_, ret, err := ctx.Send(address.NetworkAddress, "", amount, nil)
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return errors.NewRevertErrorf("failed to send slashed collateral, exit code %d", ret)
+	}
+	return nil
+}
+
+// requireCollateral returns ErrInsufficientCollateral unless collateral
+// covers the storage market's minimum collateral for pledge.
+func requireCollateral(ctx exec.VMContext, pledge *big.Int, collateral *types.AttoFIL) error {
+	rets, ret, err := ctx.Send(address.StorageMarketAddress, "getMinimumCollateral", nil, []interface{}{pledge})
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return Errors[ErrStoragemarketCallFailed]
+	}
+
+	if collateral.LessThan(types.NewAttoFILFromBytes(rets[0])) {
+		return Errors[ErrInsufficientCollateral]
+	}
+	return nil
+}
+
+// setPower sets the miner's power and reports the change to the storage market.
+func setPower(ctx exec.VMContext, state *State, power *big.Int) error {
+	delta := big.NewInt(0).Sub(power, state.Power)
+	if delta.Sign() == 0 {
+		return nil
+	}
+
+	state.Power = power
+	_, ret, err := ctx.Send(address.StorageMarketAddress, "updatePower", nil, []interface{}{delta})
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return Errors[ErrStoragemarketCallFailed]
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	. "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
@@ -118,6 +119,17 @@ func TestAskFunctions(t *testing.T) {
 	var askids []uint64
 	require.NoError(actor.UnmarshalStorage(result.Receipt.Return[0], &askids))
 	assert.Len(askids, 2)
+
+	// the second ask expired at 203
+	msg = types.NewMessage(address.TestAddress, minerAddr, 6, types.NewZeroAttoFIL(), "getLiveAsks", nil)
+	result, err = th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(300))
+	assert.NoError(err)
+	assert.NoError(result.ExecutionError)
+
+	var liveAsks []Ask
+	require.NoError(actor.UnmarshalStorage(result.Receipt.Return[0], &liveAsks))
+	require.Len(liveAsks, 1)
+	assert.Equal(uint64(0), liveAsks[0].ID.Uint64())
 }
 
 func TestGetKey(t *testing.T) {
@@ -286,7 +298,7 @@ func TestMinerCommitSector(t *testing.T) {
 	commRStar := th.MakeCommitment()
 	commD := th.MakeCommitment()
 
-	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), commD, commR, commRStar, th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), commD, commR, commRStar, th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
@@ -299,7 +311,7 @@ func TestMinerCommitSector(t *testing.T) {
 	require.Equal(types.NewBlockHeight(3), types.NewBlockHeightFromBytes(res.Receipt.Return[0]))
 
 	// fail because commR already exists
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "commitSector", uint64(1), commD, commR, commRStar, th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "commitSector", uint64(1), commD, commR, commRStar, th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
 	require.NoError(err)
 	require.EqualError(res.ExecutionError, "sector already committed")
 	require.Equal(uint8(0x23), res.Receipt.ExitCode)
@@ -314,20 +326,20 @@ func TestMinerSubmitPoSt(t *testing.T) {
 	minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), origPid)
 
 	// add a sector
-	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
 
 	// add another sector
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "commitSector", uint64(2), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "commitSector", uint64(2), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
 
 	// submit post
 	proof := th.MakeRandomPoSTProofForTest()
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", []proofs.PoStProof{proof})
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", []proofs.PoStProof{proof}, []uint64{})
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
@@ -338,9 +350,283 @@ func TestMinerSubmitPoSt(t *testing.T) {
 	require.NoError(res.ExecutionError)
 	require.Equal(types.NewBlockHeightFromBytes(res.Receipt.Return[0]), types.NewBlockHeight(20003))
 
-	// fail to submit inside the proving period
+	// submit within the grace period, paying a fee for being 5 blocks late
 	proof = th.MakeRandomPoSTProofForTest()
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 40008, "submitPoSt", []proofs.PoStProof{proof})
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 40008, "submitPoSt", []proofs.PoStProof{proof}, []uint64{})
 	require.NoError(err)
-	require.EqualError(res.ExecutionError, "submitted PoSt late, need to pay a fee")
+	require.NoError(res.ExecutionError)
+
+	minerState := requireMinerState(t, st, vms, minerAddr)
+	collateral, _ := types.NewAttoFILFromFILString("99.9")
+	require.True(collateral.Equal(minerState.Collateral))
+	require.Equal(types.NewBlockHeight(40003), minerState.ProvingPeriodStart)
+
+	// fail to submit after the grace period
+	proof = th.MakeRandomPoSTProofForTest()
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 60104, "submitPoSt", []proofs.PoStProof{proof}, []uint64{})
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, "PoSt submitted after the grace period")
+	require.Equal(uint8(ErrPoStTooLate), res.Receipt.ExitCode)
+}
+
+func TestMinerSubmitPoStWithFaults(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	minerAddr := createTestMiner(assert, st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+	for sectorID := uint64(1); sectorID <= 3; sectorID++ {
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", sectorID, th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+	}
+	totalStorage := requireTotalStorage(t, st, vms)
+
+	t.Run("faults must be committed sectors", func(t *testing.T) {
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", []proofs.PoStProof{th.MakeRandomPoSTProofForTest()}, []uint64{7})
+		require.NoError(err)
+		assert.Equal(uint8(ErrInvalidFaults), res.Receipt.ExitCode)
+	})
+
+	t.Run("faulted sectors are removed and their collateral slashed", func(t *testing.T) {
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", []proofs.PoStProof{th.MakeRandomPoSTProofForTest()}, []uint64{2})
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		minerState := requireMinerState(t, st, vms, minerAddr)
+		assert.Equal(big.NewInt(2), minerState.Power)
+		assert.Len(minerState.SectorCommitments, 2)
+		assert.NotContains(minerState.SectorCommitments, "2")
+		assert.Equal(types.NewAttoFILFromFIL(99), minerState.Collateral)
+		assert.Equal(types.NewAttoFILFromFIL(99), state.MustGetActor(st, minerAddr).Balance)
+		assert.Equal(big.NewInt(0).Sub(totalStorage, big.NewInt(1)), requireTotalStorage(t, st, vms))
+	})
+}
+
+func TestMinerReportMissedPoSt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	minerAddr := createTestMiner(assert, st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+	for sectorID := uint64(1); sectorID <= 2; sectorID++ {
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 0, "commitSector", sectorID, th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+	}
+	totalStorage := requireTotalStorage(t, st, vms)
+
+	// anyone may report the miner
+	report := func(height uint64) *consensus.ApplicationResult {
+		msg := types.NewMessage(address.TestAddress2, minerAddr, core.MustGetNonce(st, address.TestAddress2), types.NewZeroAttoFIL(), "reportMissedPoSt", nil)
+		res, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(height))
+		require.NoError(err)
+		return res
+	}
+
+	periodEnd := ProvingPeriodBlocks.Add(GracePeriodBlocks).AsBigInt().Uint64()
+
+	t.Run("the miner cannot be reported during its grace period", func(t *testing.T) {
+		res := report(periodEnd)
+		assert.Equal(uint8(ErrPoStNotDue), res.Receipt.ExitCode)
+	})
+
+	t.Run("a missed PoSt slashes collateral and takes away power", func(t *testing.T) {
+		res := report(periodEnd + 1)
+		require.NoError(res.ExecutionError)
+
+		minerState := requireMinerState(t, st, vms, minerAddr)
+		assert.Equal(uint64(1), minerState.MissedPoSts)
+		assert.Equal(big.NewInt(0), minerState.Power)
+		assert.Len(minerState.SectorCommitments, 2)
+		assert.Equal(types.NewAttoFILFromFIL(98), minerState.Collateral)
+		assert.Equal(ProvingPeriodBlocks, minerState.ProvingPeriodStart)
+		assert.Equal(big.NewInt(0).Sub(totalStorage, big.NewInt(2)), requireTotalStorage(t, st, vms))
+	})
+
+	t.Run("an on time PoSt restores power", func(t *testing.T) {
+		height := ProvingPeriodBlocks.Add(types.NewBlockHeight(10)).AsBigInt().Uint64()
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, height, "submitPoSt", []proofs.PoStProof{th.MakeRandomPoSTProofForTest()}, []uint64{})
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		minerState := requireMinerState(t, st, vms, minerAddr)
+		assert.Equal(uint64(0), minerState.MissedPoSts)
+		assert.Equal(big.NewInt(2), minerState.Power)
+		assert.Equal(totalStorage, requireTotalStorage(t, st, vms))
+	})
+
+	t.Run("sectors are removed after too many missed PoSts", func(t *testing.T) {
+		for i := uint64(0); i < MaxMissedPoSts; i++ {
+			minerState := requireMinerState(t, st, vms, minerAddr)
+			end := minerState.ProvingPeriodStart.Add(ProvingPeriodBlocks).Add(GracePeriodBlocks)
+			res := report(end.AsBigInt().Uint64() + 1)
+			require.NoError(res.ExecutionError)
+		}
+
+		minerState := requireMinerState(t, st, vms, minerAddr)
+		assert.Equal(uint64(MaxMissedPoSts), minerState.MissedPoSts)
+		assert.Empty(minerState.SectorCommitments)
+
+		res := report(minerState.ProvingPeriodStart.Add(ProvingPeriodBlocks).Add(GracePeriodBlocks).AsBigInt().Uint64() + 1)
+		assert.Equal(uint8(ErrPoStNotDue), res.Receipt.ExitCode)
+	})
+}
+
+func requireMinerState(t *testing.T, st state.Tree, vms vm.StorageMap, minerAddr address.Address) *State {
+	var minerState State
+	builtin.RequireReadState(t, vms, minerAddr, state.MustGetActor(st, minerAddr), &minerState)
+	return &minerState
+}
+
+func requireTotalStorage(t *testing.T, st state.Tree, vms vm.StorageMap) *big.Int {
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 0, "getTotalStorage")
+	require.NoError(t, err)
+	require.NoError(t, res.ExecutionError)
+	return big.NewInt(0).SetBytes(res.Receipt.Return[0])
+}
+
+func TestMinerCollateral(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	// pledges 100 sectors with 100 FIL of collateral, the minimum is 0.1 FIL
+	minerAddr := createTestMiner(assert, st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	t.Run("only the owner adds collateral", func(t *testing.T) {
+		msg := types.NewMessage(address.TestAddress2, minerAddr, core.MustGetNonce(st, address.TestAddress2), types.NewAttoFILFromFIL(5), "addCollateral", nil)
+		res, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(1))
+		require.NoError(err)
+		assert.Equal(uint8(ErrCallerUnauthorized), res.Receipt.ExitCode)
+
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 5, 1, "addCollateral")
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+		assert.Equal(types.NewAttoFILFromFIL(105), requireMinerState(t, st, vms, minerAddr).Collateral)
+		assert.Equal(types.NewAttoFILFromFIL(105), state.MustGetActor(st, minerAddr).Balance)
+	})
+
+	t.Run("the pledge increases only if collateral covers it", func(t *testing.T) {
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "increasePledge", big.NewInt(200000))
+		require.NoError(err)
+		assert.Equal(uint8(ErrInsufficientCollateral), res.Receipt.ExitCode)
+
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 100, 1, "increasePledge", big.NewInt(199900))
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		minerState := requireMinerState(t, st, vms, minerAddr)
+		assert.Equal(big.NewInt(200000), minerState.PledgeSectors)
+		assert.Equal(types.NewAttoFILFromFIL(205), minerState.Collateral)
+	})
+
+	t.Run("collateral above the minimum can be withdrawn", func(t *testing.T) {
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "withdrawCollateral", types.NewAttoFILFromFIL(6))
+		require.NoError(err)
+		assert.Equal(uint8(ErrInsufficientCollateral), res.Receipt.ExitCode)
+
+		ownerBalance := state.MustGetActor(st, address.TestAddress).Balance
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "withdrawCollateral", types.NewAttoFILFromFIL(5))
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		assert.Equal(types.NewAttoFILFromFIL(200), requireMinerState(t, st, vms, minerAddr).Collateral)
+		assert.Equal(ownerBalance.Add(types.NewAttoFILFromFIL(5)), state.MustGetActor(st, address.TestAddress).Balance)
+	})
+
+	t.Run("a miner with committed sectors cannot exit", func(t *testing.T) {
+		otherMiner := createTestMiner(assert, st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, otherMiner, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, otherMiner, 0, 4, "exit")
+		require.NoError(err)
+		assert.Equal(uint8(ErrSectorsCommitted), res.Receipt.ExitCode)
+	})
+
+	t.Run("exit returns all collateral and leaves the storage market", func(t *testing.T) {
+		ownerBalance := state.MustGetActor(st, address.TestAddress).Balance
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 5, "exit")
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		minerState := requireMinerState(t, st, vms, minerAddr)
+		assert.True(minerState.Collateral.IsZero())
+		assert.Equal(0, minerState.PledgeSectors.Sign())
+		assert.Equal(ownerBalance.Add(types.NewAttoFILFromFIL(200)), state.MustGetActor(st, address.TestAddress).Balance)
+
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 6, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+		require.NoError(err)
+		assert.Equal(uint8(storagemarket.ErrUnknownMiner), res.Receipt.ExitCode)
+	})
+}
+
+func TestMinerOwnerAndWorker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	minerAddr := createTestMiner(assert, st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	sendFrom := func(from address.Address, height uint64, method string, params ...interface{}) *consensus.ApplicationResult {
+		msg := types.NewMessage(from, minerAddr, core.MustGetNonce(st, from), types.NewZeroAttoFIL(), method, actor.MustConvertParams(params...))
+		res, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(height))
+		require.NoError(err)
+		return res
+	}
+
+	t.Run("the worker starts out as the owner", func(t *testing.T) {
+		worker, err := address.NewFromBytes(callQueryMethodSuccess("getWorker", ctx, t, st, vms, address.TestAddress, minerAddr)[0])
+		require.NoError(err)
+		assert.Equal(address.TestAddress, worker)
+	})
+
+	t.Run("only the owner changes the worker", func(t *testing.T) {
+		res := sendFrom(address.TestAddress2, 1, "changeWorker", address.TestAddress2)
+		assert.Equal(uint8(ErrCallerUnauthorized), res.Receipt.ExitCode)
+
+		res = sendFrom(address.TestAddress, 1, "changeWorker", address.TestAddress2)
+		require.NoError(res.ExecutionError)
+		assert.Equal(address.TestAddress2, requireMinerState(t, st, vms, minerAddr).Worker)
+	})
+
+	t.Run("only the worker commits sectors and submits PoSts", func(t *testing.T) {
+		res := sendFrom(address.TestAddress, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+		assert.Equal(uint8(ErrCallerUnauthorized), res.Receipt.ExitCode)
+
+		res = sendFrom(address.TestAddress2, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+		require.NoError(res.ExecutionError)
+
+		res = sendFrom(address.TestAddress, 8, "submitPoSt", []proofs.PoStProof{th.MakeRandomPoSTProofForTest()}, []uint64{})
+		assert.Equal(uint8(ErrCallerUnauthorized), res.Receipt.ExitCode)
+
+		res = sendFrom(address.TestAddress2, 8, "submitPoSt", []proofs.PoStProof{th.MakeRandomPoSTProofForTest()}, []uint64{})
+		require.NoError(res.ExecutionError)
+	})
+
+	t.Run("the worker cannot take over the miner", func(t *testing.T) {
+		res := sendFrom(address.TestAddress2, 9, "transferOwnership", address.TestAddress2)
+		assert.Equal(uint8(ErrCallerUnauthorized), res.Receipt.ExitCode)
+
+		res = sendFrom(address.TestAddress2, 9, "addAsk", types.NewAttoFILFromFIL(1), big.NewInt(10))
+		assert.Equal(uint8(ErrCallerUnauthorized), res.Receipt.ExitCode)
+	})
+
+	t.Run("the owner transfers ownership", func(t *testing.T) {
+		res := sendFrom(address.TestAddress, 9, "transferOwnership", address.TestAddress2)
+		require.NoError(res.ExecutionError)
+
+		owner, err := address.NewFromBytes(callQueryMethodSuccess("getOwner", ctx, t, st, vms, address.TestAddress, minerAddr)[0])
+		require.NoError(err)
+		assert.Equal(address.TestAddress2, owner)
+
+		res = sendFrom(address.TestAddress, 9, "changeWorker", address.TestAddress)
+		assert.Equal(uint8(ErrCallerUnauthorized), res.Receipt.ExitCode)
+	})
 }
@@ -0,0 +1,69 @@
+package multisig
+
+import (
+	"math/big"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+// Factory creates multisig wallets. It lives at address.MultisigAddress and
+// creates each wallet as an Actor at an address of its own, the way the
+// storage market creates miners.
+type Factory struct{}
+
+// NewFactory returns a new multisig factory actor.
+func NewFactory() (*actor.Actor, error) {
+	return actor.NewActor(types.MultisigFactoryActorCodeCid, types.NewZeroAttoFIL()), nil
+}
+
+// InitializeState for the factory does nothing, as it keeps no state.
+func (mf *Factory) InitializeState(_ exec.Storage, _ interface{}) error {
+	return nil
+}
+
+var _ exec.ExecutableActor = (*Factory)(nil)
+
+// Exports returns the actor's exports.
+func (mf *Factory) Exports() exec.Exports {
+	return factoryExports
+}
+
+var factoryExports = exec.Exports{
+	"create": &exec.FunctionSignature{
+		Params: []abi.Type{abi.AddressArray, abi.Integer},
+		Return: []abi.Type{abi.Address},
+	},
+}
+
+// Create creates a new wallet spendable by threshold of the given signers and
+// returns its address. The value attached to the invocation is the wallet's
+// initial balance.
+func (mf *Factory) Create(vmctx exec.VMContext, signers []address.Address, threshold *big.Int) (address.Address, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return address.Address{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	if !threshold.IsUint64() {
+		return address.Address{}, ErrInvalidThreshold, Errors[ErrInvalidThreshold]
+	}
+
+	addr, err := vmctx.AddressForNewActor()
+	if err != nil {
+		return address.Address{}, 1, errors.FaultErrorWrap(err, "could not get address for new actor")
+	}
+
+	if err := vmctx.CreateNewActor(addr, types.MultisigActorCodeCid, NewState(signers, threshold.Uint64())); err != nil {
+		return address.Address{}, errors.CodeError(err), err
+	}
+
+	if _, _, err := vmctx.Send(addr, "", vmctx.Message().Value, nil); err != nil {
+		return address.Address{}, errors.CodeError(err), err
+	}
+
+	return addr, 0, nil
+}
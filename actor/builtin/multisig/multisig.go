@@ -0,0 +1,511 @@
+package multisig
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+const (
+	// ErrInvalidThreshold indicates a threshold of zero or above the number of signers.
+	ErrInvalidThreshold = 33
+	// ErrDuplicateSigner indicates an address that is already a signer of the wallet.
+	ErrDuplicateSigner = 34
+	// ErrNotSigner indicates an address that is not a signer of the wallet.
+	ErrNotSigner = 35
+	// ErrUnknownTransaction indicates an invalid transaction id.
+	ErrUnknownTransaction = 36
+	// ErrAlreadyApproved indicates a signer approving a transaction twice.
+	ErrAlreadyApproved = 37
+	// ErrNotProposer indicates an attempt to cancel someone else's transaction.
+	ErrNotProposer = 38
+	// ErrInsufficientFunds indicates a transaction sending more than the wallet holds.
+	ErrInsufficientFunds = 39
+	// ErrInvalidChange indicates malformed parameters to a change of the wallet itself.
+	ErrInvalidChange = 40
+	// ErrSendToSelf indicates a transaction to the wallet itself that is not
+	// a change of the wallet.
+	ErrSendToSelf = 41
+)
+
+// Errors map error codes to revert errors this actor may return.
+var Errors = map[uint8]error{
+	ErrInvalidThreshold:   errors.NewCodedRevertError(ErrInvalidThreshold, "threshold must be between one and the number of signers"),
+	ErrDuplicateSigner:    errors.NewCodedRevertError(ErrDuplicateSigner, "address is already a signer"),
+	ErrNotSigner:          errors.NewCodedRevertError(ErrNotSigner, "address is not a signer of the wallet"),
+	ErrUnknownTransaction: errors.NewCodedRevertError(ErrUnknownTransaction, "transaction is unknown"),
+	ErrAlreadyApproved:    errors.NewCodedRevertError(ErrAlreadyApproved, "transaction already approved by signer"),
+	ErrNotProposer:        errors.NewCodedRevertError(ErrNotProposer, "only the proposer may cancel a transaction"),
+	ErrInsufficientFunds:  errors.NewCodedRevertError(ErrInsufficientFunds, "transaction value exceeds the wallet balance"),
+	ErrInvalidChange:      errors.NewCodedRevertError(ErrInvalidChange, "invalid change to the wallet"),
+	ErrSendToSelf:         errors.NewCodedRevertError(ErrSendToSelf, "transaction to the wallet itself must change the wallet"),
+}
+
+// Methods a transaction sent to the wallet itself may call to change the
+// wallet. They are applied by the actor once the transaction is approved
+// rather than sent as messages.
+const (
+	// AddSigner adds the address given as parameter to the signers.
+	AddSigner = "addSigner"
+	// RemoveSigner removes the address given as parameter from the signers.
+	RemoveSigner = "removeSigner"
+	// ChangeThreshold sets the threshold to the integer given as parameter.
+	ChangeThreshold = "changeThreshold"
+)
+
+var changeParams = map[string][]abi.Type{
+	AddSigner:       {abi.Address},
+	RemoveSigner:    {abi.Address},
+	ChangeThreshold: {abi.Integer},
+}
+
+func init() {
+	cbor.RegisterCborType(State{})
+	cbor.RegisterCborType(Transaction{})
+}
+
+// State is the storage of a multisig wallet. The funds of the wallet are the
+// balance of its actor.
+type State struct {
+	Signers   []address.Address       `json:"signers"`
+	Threshold uint64                  `json:"threshold"`
+	NextTxID  uint64                  `json:"nextTxId"`
+	Pending   map[string]*Transaction `json:"pending"`
+}
+
+// NewState returns the initial state of a wallet spendable by threshold of
+// the given signers.
+func NewState(signers []address.Address, threshold uint64) *State {
+	return &State{
+		Signers:   signers,
+		Threshold: threshold,
+		Pending:   map[string]*Transaction{},
+	}
+}
+
+// Transaction is a message proposed by a signer of a wallet. It is sent, or
+// applied to the wallet if addressed to the wallet itself, once enough
+// signers approve it.
+type Transaction struct {
+	Proposer  address.Address   `json:"proposer"`
+	To        address.Address   `json:"to"`
+	Value     *types.AttoFIL    `json:"value"`
+	Method    string            `json:"method"`
+	Params    []byte            `json:"params"`
+	Approvals []address.Address `json:"approvals"`
+}
+
+// Actor is a wallet shared by several signers. It allows any signer to
+// propose a transaction and executes it once enough of the other signers
+// approve it. Wallets are created by the Factory.
+type Actor struct{}
+
+// InitializeState stores the initial state of the wallet, which must be a
+// *State with a valid threshold and distinct signers.
+func (ma *Actor) InitializeState(storage exec.Storage, initializerData interface{}) error {
+	walletState, ok := initializerData.(*State)
+	if !ok {
+		return errors.NewFaultError("Initial state to multisig actor is not a multisig.State struct")
+	}
+
+	if !validThreshold(walletState.Threshold, len(walletState.Signers)) {
+		return Errors[ErrInvalidThreshold]
+	}
+	for i, signer := range walletState.Signers {
+		if indexOf(walletState.Signers[:i], signer) >= 0 {
+			return Errors[ErrDuplicateSigner]
+		}
+	}
+
+	stateBytes, err := cbor.DumpObject(walletState)
+	if err != nil {
+		return errors.FaultErrorWrap(err, "failed to cbor marshal object")
+	}
+
+	id, err := storage.Put(stateBytes)
+	if err != nil {
+		return err
+	}
+
+	return storage.Commit(id, cid.Undef)
+}
+
+var _ exec.ExecutableActor = (*Actor)(nil)
+
+// Exports returns the actor's exports.
+func (ma *Actor) Exports() exec.Exports {
+	return multisigExports
+}
+
+var multisigExports = exec.Exports{
+	"approve": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Integer},
+		Return: nil,
+	},
+	"cancel": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Integer},
+		Return: nil,
+	},
+	"get": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.Bytes},
+	},
+	"propose": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address, abi.AttoFIL, abi.String, abi.Bytes},
+		Return: []abi.Type{abi.Integer},
+	},
+}
+
+// Propose records a transaction sending value to the given address and
+// calling method with params, which are abi encoded. The proposer, who must
+// be a signer of the wallet, approves the transaction by proposing it. A
+// transaction to the wallet itself calling AddSigner, RemoveSigner or
+// ChangeThreshold changes the wallet instead. It returns the id of the
+// transaction.
+func (ma *Actor) Propose(vmctx exec.VMContext, to address.Address, value *types.AttoFIL, method string, params []byte) (*big.Int, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	self := vmctx.Message().To
+	proposer := vmctx.Message().From
+	tx := &Transaction{
+		Proposer:  proposer,
+		To:        to,
+		Value:     value,
+		Method:    method,
+		Params:    params,
+		Approvals: []address.Address{proposer},
+	}
+	if sendsToSelf(tx, self) {
+		return nil, ErrSendToSelf, Errors[ErrSendToSelf]
+	}
+	if isChange(tx, self) {
+		if _, err := changeValues(tx); err != nil {
+			return nil, errors.CodeError(err), err
+		}
+	}
+
+	var txID uint64
+	var ready []*Transaction
+	err := withState(vmctx, func(state *State) error {
+		if indexOf(state.Signers, proposer) < 0 {
+			return Errors[ErrNotSigner]
+		}
+
+		txID = state.NextTxID
+		state.NextTxID++
+		if state.Pending == nil {
+			state.Pending = map[string]*Transaction{}
+		}
+		state.Pending[idKey(txID)] = tx
+
+		var err error
+		ready, err = state.applyIfApproved(idKey(txID), self, vmctx.MyBalance())
+		return err
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	if err := send(vmctx, ready); err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	return big.NewInt(0).SetUint64(txID), 0, nil
+}
+
+// Approve adds the approval of the caller, who must be a signer of the
+// wallet, to a pending transaction. The transaction is executed as soon as
+// it has the approvals of a threshold of the signers.
+func (ma *Actor) Approve(vmctx exec.VMContext, txID *big.Int) (uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	self := vmctx.Message().To
+	signer := vmctx.Message().From
+	var ready []*Transaction
+	err := withState(vmctx, func(state *State) error {
+		if indexOf(state.Signers, signer) < 0 {
+			return Errors[ErrNotSigner]
+		}
+		tx, ok := state.Pending[txID.String()]
+		if !ok {
+			return Errors[ErrUnknownTransaction]
+		}
+		if indexOf(tx.Approvals, signer) >= 0 {
+			return Errors[ErrAlreadyApproved]
+		}
+		tx.Approvals = append(tx.Approvals, signer)
+
+		var err error
+		ready, err = state.applyIfApproved(txID.String(), self, vmctx.MyBalance())
+		return err
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	if err := send(vmctx, ready); err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// Cancel removes a pending transaction. Only its proposer may cancel it,
+// unless the proposer has since been removed from the signers, in which case
+// any signer may.
+func (ma *Actor) Cancel(vmctx exec.VMContext, txID *big.Int) (uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	from := vmctx.Message().From
+	err := withState(vmctx, func(state *State) error {
+		tx, ok := state.Pending[txID.String()]
+		if !ok {
+			return Errors[ErrUnknownTransaction]
+		}
+		if from != tx.Proposer {
+			if indexOf(state.Signers, tx.Proposer) >= 0 {
+				return Errors[ErrNotProposer]
+			}
+			if indexOf(state.Signers, from) < 0 {
+				return Errors[ErrNotSigner]
+			}
+		}
+		delete(state.Pending, txID.String())
+		return nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// Get returns the cbor encoded state of the wallet.
+func (ma *Actor) Get(vmctx exec.VMContext) ([]byte, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	chunk, err := vmctx.ReadStorage()
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "could not read actor storage")
+	}
+
+	return chunk, 0, nil
+}
+
+// applyIfApproved removes the pending transaction with the given key if it
+// has enough approvals and applies it: a change is made to the wallet and
+// any other transaction is checked against funds. Since a change may leave
+// other pending transactions approved, they are then applied as well. It
+// returns the transactions that still need to be sent, in order.
+func (s *State) applyIfApproved(key string, self address.Address, funds *types.AttoFIL) ([]*Transaction, error) {
+	tx := s.Pending[key]
+	if uint64(len(tx.Approvals)) < s.Threshold {
+		return nil, nil
+	}
+	delete(s.Pending, key)
+
+	if isChange(tx, self) {
+		if err := s.applyChange(tx); err != nil {
+			return nil, err
+		}
+		return s.applyApprovedPending(self, funds), nil
+	}
+
+	if funds.LessThan(tx.Value) {
+		return nil, Errors[ErrInsufficientFunds]
+	}
+	return []*Transaction{tx}, nil
+}
+
+// applyApprovedPending applies the pending transactions that have enough
+// approvals, in the order they were proposed, until none is left. A
+// transaction that cannot be applied, such as a send beyond the funds left,
+// stays pending for its signers to cancel or retry. It returns the
+// transactions that need to be sent.
+func (s *State) applyApprovedPending(self address.Address, funds *types.AttoFIL) []*Transaction {
+	var sends []*Transaction
+	for applied := true; applied; {
+		applied = false
+		for _, key := range pendingKeys(s.Pending) {
+			tx := s.Pending[key]
+			if uint64(len(tx.Approvals)) < s.Threshold {
+				continue
+			}
+
+			if isChange(tx, self) {
+				if err := s.applyChange(tx); err != nil {
+					continue
+				}
+			} else {
+				if funds.LessThan(tx.Value) {
+					continue
+				}
+				funds = funds.Sub(tx.Value)
+				sends = append(sends, tx)
+			}
+			delete(s.Pending, key)
+
+			// A change may alter the threshold, so start over.
+			applied = true
+			break
+		}
+	}
+	return sends
+}
+
+// applyChange makes the change tx calls for to the wallet.
+func (s *State) applyChange(tx *Transaction) error {
+	vals, err := changeValues(tx)
+	if err != nil {
+		return err
+	}
+
+	switch tx.Method {
+	case AddSigner:
+		signer := vals[0].(address.Address)
+		if indexOf(s.Signers, signer) >= 0 {
+			return Errors[ErrDuplicateSigner]
+		}
+		s.Signers = append(s.Signers, signer)
+	case RemoveSigner:
+		signer := vals[0].(address.Address)
+		i := indexOf(s.Signers, signer)
+		if i < 0 {
+			return Errors[ErrNotSigner]
+		}
+		if len(s.Signers) == 1 {
+			return Errors[ErrInvalidThreshold]
+		}
+		s.Signers = append(s.Signers[:i:i], s.Signers[i+1:]...)
+		// The threshold never exceeds the signers left to reach it.
+		if s.Threshold > uint64(len(s.Signers)) {
+			s.Threshold = uint64(len(s.Signers))
+		}
+		// The approvals of a former signer no longer count.
+		for _, pending := range s.Pending {
+			if j := indexOf(pending.Approvals, signer); j >= 0 {
+				pending.Approvals = append(pending.Approvals[:j:j], pending.Approvals[j+1:]...)
+			}
+		}
+	case ChangeThreshold:
+		threshold := vals[0].(*big.Int)
+		if !threshold.IsUint64() || !validThreshold(threshold.Uint64(), len(s.Signers)) {
+			return Errors[ErrInvalidThreshold]
+		}
+		s.Threshold = threshold.Uint64()
+	}
+	return nil
+}
+
+// send sends the approved transactions from the wallet.
+func send(vmctx exec.VMContext, txs []*Transaction) error {
+	for _, tx := range txs {
+		var params []interface{}
+		if len(tx.Params) > 0 {
+			// Params are the abi encoding of a list of values. Passing each
+			// encoded value on as bytes reproduces the same encoding.
+			var encoded [][]byte
+			if err := cbor.DecodeInto(tx.Params, &encoded); err != nil {
+				return errors.RevertErrorWrap(err, "malformed transaction params")
+			}
+			for _, p := range encoded {
+				params = append(params, p)
+			}
+		}
+
+		if _, _, err := vmctx.Send(tx.To, tx.Method, tx.Value, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isChange returns true if tx changes the wallet at address self rather than
+// sending a message.
+func isChange(tx *Transaction, self address.Address) bool {
+	_, ok := changeParams[tx.Method]
+	return ok && tx.To == self
+}
+
+// sendsToSelf returns true if tx would have the wallet at address self send
+// a message to itself, which the vm does not allow.
+func sendsToSelf(tx *Transaction, self address.Address) bool {
+	return tx.To == self && !isChange(tx, self)
+}
+
+// changeValues decodes the params of a change to the wallet.
+func changeValues(tx *Transaction) ([]interface{}, error) {
+	if !tx.Value.IsZero() {
+		return nil, Errors[ErrInvalidChange]
+	}
+	vals, err := abi.DecodeValues(tx.Params, changeParams[tx.Method])
+	if err != nil {
+		return nil, Errors[ErrInvalidChange]
+	}
+	return abi.FromValues(vals), nil
+}
+
+// withState loads the state of the wallet, lets f update it and stores it
+// again.
+func withState(vmctx exec.VMContext, f func(*State) error) error {
+	var state State
+	_, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		return nil, f(&state)
+	})
+	return err
+}
+
+// pendingKeys returns the keys of the pending transactions in the order
+// they were proposed.
+func pendingKeys(pending map[string]*Transaction) []string {
+	ids := make([]uint64, 0, len(pending))
+	for key := range pending {
+		id, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = idKey(id)
+	}
+	return keys
+}
+
+func validThreshold(threshold uint64, signers int) bool {
+	return threshold > 0 && threshold <= uint64(signers)
+}
+
+func indexOf(addrs []address.Address, addr address.Address) int {
+	for i, a := range addrs {
+		if a == addr {
+			return i
+		}
+	}
+	return -1
+}
+
+func idKey(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
@@ -0,0 +1,340 @@
+package multisig_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	. "github.com/filecoin-project/go-filecoin/actor/builtin/multisig"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+func TestMultisigCreate(t *testing.T) {
+	assert := assert.New(t)
+	sys := setup(t)
+
+	walletState := sys.requireGetState(sys.wallet)
+	assert.Equal(sys.signers, walletState.Signers)
+	assert.Equal(uint64(2), walletState.Threshold)
+	assert.Empty(walletState.Pending)
+
+	wallet := state.MustGetActor(sys.st, sys.wallet)
+	assert.Equal(types.MultisigActorCodeCid, wallet.Code)
+	assert.Equal(types.NewAttoFILFromFIL(1000), wallet.Balance)
+	assert.Equal(types.NewZeroAttoFIL(), state.MustGetActor(sys.st, address.MultisigAddress).Balance)
+
+	t.Run("each wallet is an actor of its own", func(t *testing.T) {
+		other := sys.requireCreate(sys.signers[0], types.NewAttoFILFromFIL(10), sys.signers, 1)
+		assert.NotEqual(sys.wallet, other)
+		assert.Equal(types.NewAttoFILFromFIL(10), state.MustGetActor(sys.st, other).Balance)
+		assert.Equal(uint64(1), sys.requireGetState(other).Threshold)
+	})
+
+	t.Run("threshold must not exceed the signers", func(t *testing.T) {
+		result := sys.apply(sys.signers[0], address.MultisigAddress, types.NewZeroAttoFIL(), "create", sys.signers, big.NewInt(4))
+		assert.Equal(uint8(ErrInvalidThreshold), result.Receipt.ExitCode)
+
+		result = sys.apply(sys.signers[0], address.MultisigAddress, types.NewZeroAttoFIL(), "create", sys.signers, big.NewInt(0))
+		assert.Equal(uint8(ErrInvalidThreshold), result.Receipt.ExitCode)
+	})
+
+	t.Run("signers must be distinct", func(t *testing.T) {
+		signers := []address.Address{sys.signers[0], sys.signers[0]}
+		result := sys.apply(sys.signers[0], address.MultisigAddress, types.NewZeroAttoFIL(), "create", signers, big.NewInt(1))
+		assert.Equal(uint8(ErrDuplicateSigner), result.Receipt.ExitCode)
+	})
+}
+
+func TestMultisigDeposit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	result := sys.apply(sys.outsider, sys.wallet, types.NewAttoFILFromFIL(50), "")
+	require.NoError(result.ExecutionError)
+	assert.Equal(types.NewAttoFILFromFIL(1050), state.MustGetActor(sys.st, sys.wallet).Balance)
+}
+
+func TestMultisigProposeAndApprove(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	txID := sys.requirePropose(sys.signers[0], sys.outsider, types.NewAttoFILFromFIL(100), "", nil)
+
+	walletState := sys.requireGetState(sys.wallet)
+	require.Len(walletState.Pending, 1)
+	tx := walletState.Pending[txID.String()]
+	assert.Equal(sys.signers[0], tx.Proposer)
+	assert.Equal([]address.Address{sys.signers[0]}, tx.Approvals)
+	assert.Equal(types.NewAttoFILFromFIL(10000), state.MustGetActor(sys.st, sys.outsider).Balance)
+
+	t.Run("signers approve once", func(t *testing.T) {
+		result := sys.apply(sys.signers[0], sys.wallet, types.NewZeroAttoFIL(), "approve", txID)
+		assert.Equal(uint8(ErrAlreadyApproved), result.Receipt.ExitCode)
+	})
+
+	t.Run("only signers approve", func(t *testing.T) {
+		result := sys.apply(sys.outsider, sys.wallet, types.NewZeroAttoFIL(), "approve", txID)
+		assert.Equal(uint8(ErrNotSigner), result.Receipt.ExitCode)
+	})
+
+	t.Run("threshold executes the transaction", func(t *testing.T) {
+		result := sys.apply(sys.signers[1], sys.wallet, types.NewZeroAttoFIL(), "approve", txID)
+		require.NoError(result.ExecutionError)
+
+		assert.Empty(sys.requireGetState(sys.wallet).Pending)
+		assert.Equal(types.NewAttoFILFromFIL(900), state.MustGetActor(sys.st, sys.wallet).Balance)
+		assert.Equal(types.NewAttoFILFromFIL(10100), state.MustGetActor(sys.st, sys.outsider).Balance)
+	})
+
+	t.Run("only signers propose", func(t *testing.T) {
+		params := core.MustConvertParams(sys.outsider, types.NewAttoFILFromFIL(1), "", []byte{})
+		result := sys.apply(sys.outsider, sys.wallet, types.NewZeroAttoFIL(), "propose", params)
+		assert.Equal(uint8(ErrNotSigner), result.Receipt.ExitCode)
+	})
+}
+
+func TestMultisigApproveFailsWithoutFunds(t *testing.T) {
+	assert := assert.New(t)
+	sys := setup(t)
+
+	txID := sys.requirePropose(sys.signers[0], sys.outsider, types.NewAttoFILFromFIL(5000), "", nil)
+
+	result := sys.apply(sys.signers[1], sys.wallet, types.NewZeroAttoFIL(), "approve", txID)
+	assert.Equal(uint8(ErrInsufficientFunds), result.Receipt.ExitCode)
+
+	// The failed approval leaves the transaction pending.
+	assert.Len(sys.requireGetState(sys.wallet).Pending[txID.String()].Approvals, 1)
+	assert.Equal(types.NewAttoFILFromFIL(1000), state.MustGetActor(sys.st, sys.wallet).Balance)
+}
+
+func TestMultisigExecutesMethodCalls(t *testing.T) {
+	require := require.New(t)
+	sys := setup(t)
+
+	// With a threshold of one proposing executes right away.
+	wallet := sys.requireCreate(sys.signers[0], types.NewAttoFILFromFIL(10), sys.signers, 1)
+
+	params := core.MustConvertParams(address.PaymentBrokerAddress, types.NewZeroAttoFIL(), "ls", core.MustConvertParams(sys.outsider))
+	result := sys.apply(sys.signers[0], wallet, types.NewZeroAttoFIL(), "propose", params)
+	require.NoError(result.ExecutionError)
+	require.Empty(sys.requireGetState(wallet).Pending)
+
+	// A method rejecting its params reverts the proposal.
+	params = core.MustConvertParams(address.PaymentBrokerAddress, types.NewZeroAttoFIL(), "ls", core.MustConvertParams(big.NewInt(3), "x"))
+	result = sys.apply(sys.signers[0], wallet, types.NewZeroAttoFIL(), "propose", params)
+	require.Error(result.ExecutionError)
+}
+
+func TestMultisigRejectsSendToSelf(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	wallet := sys.requireCreate(sys.signers[0], types.NewAttoFILFromFIL(10), sys.signers, 1)
+
+	// A method of the wallet that is not a change would be sent by the
+	// wallet to itself, which must revert rather than fault.
+	params := core.MustConvertParams(wallet, types.NewAttoFILFromFIL(1), "approve", core.MustConvertParams(big.NewInt(0)))
+	result := sys.apply(sys.signers[0], wallet, types.NewZeroAttoFIL(), "propose", params)
+	require.Error(result.ExecutionError)
+	assert.Equal(uint8(ErrSendToSelf), result.Receipt.ExitCode)
+
+	assert.Empty(sys.requireGetState(wallet).Pending)
+	assert.Equal(types.NewAttoFILFromFIL(10), state.MustGetActor(sys.st, wallet).Balance)
+}
+
+func TestMultisigCancel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	txID := sys.requirePropose(sys.signers[0], sys.outsider, types.NewAttoFILFromFIL(100), "", nil)
+
+	result := sys.apply(sys.signers[1], sys.wallet, types.NewZeroAttoFIL(), "cancel", txID)
+	assert.Equal(uint8(ErrNotProposer), result.Receipt.ExitCode)
+
+	result = sys.apply(sys.signers[0], sys.wallet, types.NewZeroAttoFIL(), "cancel", txID)
+	require.NoError(result.ExecutionError)
+	assert.Empty(sys.requireGetState(sys.wallet).Pending)
+
+	result = sys.apply(sys.signers[1], sys.wallet, types.NewZeroAttoFIL(), "approve", txID)
+	assert.Equal(uint8(ErrUnknownTransaction), result.Receipt.ExitCode)
+}
+
+func TestMultisigChanges(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	change := func(method string, param interface{}, approvers ...address.Address) {
+		txID := sys.requirePropose(sys.signers[0], sys.wallet, types.NewZeroAttoFIL(), method, core.MustConvertParams(param))
+		for _, approver := range approvers {
+			result := sys.apply(approver, sys.wallet, types.NewZeroAttoFIL(), "approve", txID)
+			require.NoError(result.ExecutionError)
+		}
+	}
+
+	change(AddSigner, sys.outsider, sys.signers[1])
+	assert.Equal(append(sys.signers, sys.outsider), sys.requireGetState(sys.wallet).Signers)
+	assert.Equal(types.NewAttoFILFromFIL(1000), state.MustGetActor(sys.st, sys.wallet).Balance)
+
+	change(ChangeThreshold, big.NewInt(4), sys.signers[1])
+	assert.Equal(uint64(4), sys.requireGetState(sys.wallet).Threshold)
+
+	t.Run("removing a signer lowers a threshold it would exceed", func(t *testing.T) {
+		change(RemoveSigner, sys.outsider, sys.signers[1], sys.signers[2], sys.outsider)
+
+		walletState := sys.requireGetState(sys.wallet)
+		assert.Equal(sys.signers, walletState.Signers)
+		assert.Equal(uint64(3), walletState.Threshold)
+	})
+
+	t.Run("changes carry no value", func(t *testing.T) {
+		params := core.MustConvertParams(sys.wallet, types.NewAttoFILFromFIL(1), ChangeThreshold, core.MustConvertParams(big.NewInt(1)))
+		result := sys.apply(sys.signers[0], sys.wallet, types.NewZeroAttoFIL(), "propose", params)
+		assert.Equal(uint8(ErrInvalidChange), result.Receipt.ExitCode)
+	})
+
+	t.Run("changes need well formed params", func(t *testing.T) {
+		params := core.MustConvertParams(sys.wallet, types.NewZeroAttoFIL(), AddSigner, core.MustConvertParams(big.NewInt(1), big.NewInt(2)))
+		result := sys.apply(sys.signers[0], sys.wallet, types.NewZeroAttoFIL(), "propose", params)
+		assert.Equal(uint8(ErrInvalidChange), result.Receipt.ExitCode)
+	})
+}
+
+func TestMultisigChangesExecuteApprovedTransactions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	approve := func(txID *big.Int, approvers ...address.Address) {
+		for _, approver := range approvers {
+			result := sys.apply(approver, sys.wallet, types.NewZeroAttoFIL(), "approve", txID)
+			require.NoError(result.ExecutionError)
+		}
+	}
+
+	// Raise the threshold so that a send with two approvals stays pending.
+	txID := sys.requirePropose(sys.signers[0], sys.wallet, types.NewZeroAttoFIL(), ChangeThreshold, core.MustConvertParams(big.NewInt(3)))
+	approve(txID, sys.signers[1])
+
+	sendID := sys.requirePropose(sys.signers[0], sys.outsider, types.NewAttoFILFromFIL(100), "", nil)
+	approve(sendID, sys.signers[1])
+	require.Len(sys.requireGetState(sys.wallet).Pending, 1)
+
+	// Removing a signer lowers the threshold to two, which the send meets.
+	txID = sys.requirePropose(sys.signers[0], sys.wallet, types.NewZeroAttoFIL(), RemoveSigner, core.MustConvertParams(sys.signers[2]))
+	approve(txID, sys.signers[1], sys.signers[2])
+
+	walletState := sys.requireGetState(sys.wallet)
+	assert.Equal(sys.signers[:2], walletState.Signers)
+	assert.Empty(walletState.Pending)
+	assert.Equal(types.NewAttoFILFromFIL(900), state.MustGetActor(sys.st, sys.wallet).Balance)
+	assert.Equal(types.NewAttoFILFromFIL(10100), state.MustGetActor(sys.st, sys.outsider).Balance)
+}
+
+// system holds a state with a 2-of-3 wallet holding 1000 FIL and an account
+// that is not one of its signers.
+type system struct {
+	t        *testing.T
+	ctx      context.Context
+	st       state.Tree
+	vms      vm.StorageMap
+	signers  []address.Address
+	outsider address.Address
+	wallet   address.Address
+}
+
+func setup(t *testing.T) *system {
+	t.Helper()
+	require := require.New(t)
+	ctx := context.Background()
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	vms := vm.NewStorageMap(bs)
+	cst := hamt.NewCborStore()
+	blk, err := consensus.DefaultGenesis(cst, bs)
+	require.NoError(err)
+	st, err := state.LoadStateTree(ctx, cst, blk.StateRoot, builtin.Actors)
+	require.NoError(err)
+
+	addrGetter := address.NewForTestGetter()
+	sys := &system{t: t, ctx: ctx, st: st, vms: vms}
+	for i := 0; i < 4; i++ {
+		addr := addrGetter()
+		state.MustSetActor(st, addr, th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(10000)))
+		if i < 3 {
+			sys.signers = append(sys.signers, addr)
+		} else {
+			sys.outsider = addr
+		}
+	}
+
+	sys.wallet = sys.requireCreate(sys.signers[0], types.NewAttoFILFromFIL(1000), sys.signers, 2)
+	return sys
+}
+
+// apply sends a message from the given address to the given actor. A single
+// []byte parameter is taken to hold already encoded params.
+func (sys *system) apply(from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) *consensus.ApplicationResult {
+	sys.t.Helper()
+
+	pdata, ok := []byte(nil), false
+	if len(params) == 1 {
+		pdata, ok = params[0].([]byte)
+	}
+	if !ok {
+		pdata = core.MustConvertParams(params...)
+	}
+
+	msg := types.NewMessage(from, to, core.MustGetNonce(sys.st, from), value, method, pdata)
+	result, err := th.ApplyTestMessage(sys.st, sys.vms, msg, types.NewBlockHeight(0))
+	require.NoError(sys.t, err)
+	return result
+}
+
+func (sys *system) requireCreate(from address.Address, value *types.AttoFIL, signers []address.Address, threshold int64) address.Address {
+	sys.t.Helper()
+
+	result := sys.apply(from, address.MultisigAddress, value, "create", signers, big.NewInt(threshold))
+	require.NoError(sys.t, result.ExecutionError)
+	wallet, err := address.NewFromBytes(result.Receipt.Return[0])
+	require.NoError(sys.t, err)
+	return wallet
+}
+
+func (sys *system) requirePropose(from, to address.Address, value *types.AttoFIL, method string, params []byte) *big.Int {
+	sys.t.Helper()
+
+	result := sys.apply(from, sys.wallet, types.NewZeroAttoFIL(), "propose", core.MustConvertParams(to, value, method, params))
+	require.NoError(sys.t, result.ExecutionError)
+	return big.NewInt(0).SetBytes(result.Receipt.Return[0])
+}
+
+func (sys *system) requireGetState(wallet address.Address) *State {
+	sys.t.Helper()
+
+	values, ec, err := consensus.CallQueryMethod(sys.ctx, sys.st, sys.vms, wallet, "get", nil, sys.outsider, types.NewBlockHeight(0))
+	require.NoError(sys.t, err)
+	require.Zero(sys.t, ec)
+
+	var walletState State
+	require.NoError(sys.t, actor.UnmarshalStorage(values[0], &walletState))
+	return &walletState
+}
@@ -1,6 +1,8 @@
 package paymentbroker
 
 import (
+	"math/big"
+
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 	"gx/ipfs/QmekxXDhCxCJRNuzmHreuaT3BsuJcsjcXWNrtV9C8DRHtd/go-multibase"
 
@@ -10,18 +12,39 @@ import (
 
 func init() {
 	cbor.RegisterCborType(PaymentVoucher{})
+	cbor.RegisterCborType(Merge{})
 }
 
 // PaymentVoucher is a voucher for a payment channel that can be transferred off-chain but guarantees a future payment.
+//
+// A channel holds any number of independent lanes. The Amount of a voucher is
+// the total paid on its Lane, and a voucher can only be redeemed if its Nonce
+// is greater than the nonce of the last voucher redeemed on that lane. A
+// voucher may also settle other lanes by listing them in Merges, in which
+// case its Amount is the total paid across all of them.
+//
+// A voucher with a HashLock can only be redeemed by revealing a preimage of
+// it, which is then recorded in the channel for the payer to see.
 type PaymentVoucher struct {
 	Channel   types.ChannelID   `json:"channel"`
 	Payer     address.Address   `json:"payer"`
 	Target    address.Address   `json:"target"`
 	Amount    types.AttoFIL     `json:"amount"`
 	ValidAt   types.BlockHeight `json:"valid_at"`
+	Lane      uint64            `json:"lane"`
+	Nonce     uint64            `json:"nonce"`
+	Merges    []Merge           `json:"merges"`
+	HashLock  []byte            `json:"hash_lock"`
 	Signature types.Signature   `json:"signature"`
 }
 
+// Merge names a lane settled by a merged voucher, and the nonce that lane
+// moves to.
+type Merge struct {
+	Lane  uint64 `json:"lane"`
+	Nonce uint64 `json:"nonce"`
+}
+
 // DecodeVoucher creates a *PaymentVoucher from a base58, Cbor-encoded one
 func DecodeVoucher(voucherRaw string) (*PaymentVoucher, error) {
 	_, cborVoucher, err := multibase.Decode(voucherRaw)
@@ -47,3 +70,26 @@ func (voucher *PaymentVoucher) Encode() (string, error) {
 
 	return multibase.Encode(multibase.Base58BTC, cborVoucher)
 }
+
+// RedeemParams returns the parameters of the redeem or close message that
+// submits the voucher to the payment broker. The preimage is only needed for
+// hash-locked vouchers.
+func (voucher *PaymentVoucher) RedeemParams(preimage []byte) ([]interface{}, error) {
+	merges, err := cbor.DumpObject(voucher.Merges)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{
+		voucher.Payer,
+		&voucher.Channel,
+		&voucher.Amount,
+		&voucher.ValidAt,
+		big.NewInt(0).SetUint64(voucher.Lane),
+		big.NewInt(0).SetUint64(voucher.Nonce),
+		merges,
+		voucher.HashLock,
+		[]byte(voucher.Signature),
+		preimage,
+	}, nil
+}
@@ -1,10 +1,16 @@
 package paymentbroker
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"strconv"
 
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmcTzQXRcU2vf8yX5EEboz1BSvWC7wWmeYAKVQmhp8WZYU/sha256-simd"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
 	"github.com/filecoin-project/go-filecoin/abi"
@@ -38,8 +44,25 @@ const (
 	ErrInvalidSignature = 42
 	//ErrTooEarly indicates that the block height is too low to satisfy a voucher
 	ErrTooEarly = 43
+	// ErrStaleNonce indicates a voucher whose nonce is not above the nonce of its lane.
+	ErrStaleNonce = 44
+	// ErrInvalidMerge indicates a merged voucher that does not list distinct other lanes.
+	ErrInvalidMerge = 45
+	// ErrInvalidPreimage indicates a hash-locked voucher submitted without a preimage of its hash lock.
+	ErrInvalidPreimage = 46
+	// ErrInvalidHashLock indicates a voucher with a hash lock that is not a sha256 hash.
+	ErrInvalidHashLock = 47
+	// ErrUnknownPreimage indicates no preimage of the hash lock was revealed.
+	ErrUnknownPreimage = 48
 )
 
+// HashLockLen is the length of the hash lock of a voucher, a sha256 hash.
+const HashLockLen = sha256.Size
+
+// preimagesKey is the key of the lookup of revealed preimages in the lookup
+// of payer channels. No address string equals it.
+const preimagesKey = "preimages"
+
 // Errors map error codes to revert errors this actor may return.
 var Errors = map[uint8]error{
 	ErrTooEarly:                 errors.NewCodedRevertError(ErrTooEarly, "block height too low to redeem voucher"),
@@ -53,10 +76,16 @@ var Errors = map[uint8]error{
 	ErrExpired:                  errors.NewCodedRevertError(ErrExpired, "block height has exceeded channel's end of life"),
 	ErrAlreadyWithdrawn:         errors.NewCodedRevertError(ErrAlreadyWithdrawn, "update amount has already been redeemed"),
 	ErrInvalidSignature:         errors.NewCodedRevertErrorf(ErrInvalidSignature, "signature failed to validate"),
+	ErrStaleNonce:               errors.NewCodedRevertError(ErrStaleNonce, "voucher nonce must be greater than the last nonce redeemed on its lane"),
+	ErrInvalidMerge:             errors.NewCodedRevertError(ErrInvalidMerge, "merged lanes must be distinct and differ from the voucher's lane"),
+	ErrInvalidPreimage:          errors.NewCodedRevertError(ErrInvalidPreimage, "preimage does not match the voucher's hash lock"),
+	ErrInvalidHashLock:          errors.NewCodedRevertError(ErrInvalidHashLock, "hash lock must be a 32 byte sha256 hash"),
+	ErrUnknownPreimage:          errors.NewCodedRevertError(ErrUnknownPreimage, "no preimage of the hash lock was revealed"),
 }
 
 func init() {
 	cbor.RegisterCborType(PaymentChannel{})
+	cbor.RegisterCborType(LaneState{})
 }
 
 // PaymentChannel records the intent to pay funds to a target account.
@@ -65,6 +94,37 @@ type PaymentChannel struct {
 	Amount         *types.AttoFIL     `json:"amount"`
 	AmountRedeemed *types.AttoFIL     `json:"amount_redeemed"`
 	Eol            *types.BlockHeight `json:"eol"`
+
+	// Lanes maps lane id to the state of the lane, for all lanes vouchers
+	// were redeemed on. Due to a bug in refmt, the lane id-keys need to be
+	// stringified.
+	//
+	// See also: https://github.com/polydawn/refmt/issues/35
+	Lanes map[string]*LaneState `json:"lanes"`
+}
+
+// LaneState is the state of a lane of a payment channel.
+type LaneState struct {
+	// Redeemed is the amount redeemed with vouchers on this lane.
+	Redeemed *types.AttoFIL `json:"redeemed"`
+	// Nonce is the nonce of the last voucher redeemed on this lane.
+	Nonce uint64 `json:"nonce"`
+}
+
+// Lane returns the state of the given lane of the channel, creating it if no
+// voucher was redeemed on the lane yet.
+func (channel *PaymentChannel) Lane(lane uint64) *LaneState {
+	if channel.Lanes == nil {
+		channel.Lanes = make(map[string]*LaneState)
+	}
+
+	key := strconv.FormatUint(lane, 10)
+	state, ok := channel.Lanes[key]
+	if !ok {
+		state = &LaneState{Redeemed: types.NewZeroAttoFIL()}
+		channel.Lanes[key] = state
+	}
+	return state
 }
 
 // Actor provides a mechanism for off chain payments.
@@ -88,7 +148,7 @@ var _ exec.ExecutableActor = (*Actor)(nil)
 
 var paymentBrokerExports = exec.Exports{
 	"close": &exec.FunctionSignature{
-		Params: []abi.Type{abi.Address, abi.ChannelID, abi.AttoFIL, abi.BlockHeight, abi.Bytes},
+		Params: []abi.Type{abi.Address, abi.ChannelID, abi.AttoFIL, abi.BlockHeight, abi.Integer, abi.Integer, abi.Bytes, abi.Bytes, abi.Bytes, abi.Bytes},
 		Return: nil,
 	},
 	"createChannel": &exec.FunctionSignature{
@@ -99,6 +159,10 @@ var paymentBrokerExports = exec.Exports{
 		Params: []abi.Type{abi.ChannelID, abi.BlockHeight},
 		Return: nil,
 	},
+	"getPreimage": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Bytes},
+		Return: []abi.Type{abi.Bytes},
+	},
 	"ls": &exec.FunctionSignature{
 		Params: []abi.Type{abi.Address},
 		Return: []abi.Type{abi.Bytes},
@@ -108,11 +172,11 @@ var paymentBrokerExports = exec.Exports{
 		Return: nil,
 	},
 	"redeem": &exec.FunctionSignature{
-		Params: []abi.Type{abi.Address, abi.ChannelID, abi.AttoFIL, abi.BlockHeight, abi.Bytes},
+		Params: []abi.Type{abi.Address, abi.ChannelID, abi.AttoFIL, abi.BlockHeight, abi.Integer, abi.Integer, abi.Bytes, abi.Bytes, abi.Bytes, abi.Bytes},
 		Return: nil,
 	},
 	"voucher": &exec.FunctionSignature{
-		Params: []abi.Type{abi.ChannelID, abi.AttoFIL, abi.BlockHeight},
+		Params: []abi.Type{abi.ChannelID, abi.AttoFIL, abi.BlockHeight, abi.Integer},
 		Return: []abi.Type{abi.Bytes},
 	},
 }
@@ -121,7 +185,7 @@ var paymentBrokerExports = exec.Exports{
 // The value attached to the invocation is used as the deposit, and the channel
 // will expire and return all of its money to the owner after the given block height.
 func (pb *Actor) CreateChannel(vmctx exec.VMContext, target address.Address, eol *types.BlockHeight) (*types.ChannelID, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -182,19 +246,35 @@ func (pb *Actor) CreateChannel(vmctx exec.VMContext, target address.Address, eol
 // target Redeem(200)          -> Payer: 1000, Target: 200, Channel: 800
 // target Close(500)           -> Payer: 1500, Target: 500, Channel: 0
 //
-func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, sig []byte) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+// Amounts are tracked per lane: the voucher must carry a nonce greater than
+// that of the last voucher redeemed on its lane, and a merged voucher settles
+// the lanes it lists along with its own. A hash-locked voucher also requires a
+// preimage of its hash lock, which is recorded for the payer to look up with
+// getPreimage.
+func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, lane, nonce *big.Int, merges, hashLock, sig, preimage []byte) (uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
-	if !VerifyVoucherSignature(payer, chid, amt, validAt, sig) {
+	voucher, err := decodeRedeemedVoucher(payer, chid, amt, validAt, lane, nonce, merges, hashLock, sig)
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	if err := vmctx.ChargeOp(exec.GasOpVerifySignature, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+	if !VerifyVoucherSignature(payer, voucher) {
 		return errors.CodeError(Errors[ErrInvalidSignature]), Errors[ErrInvalidSignature]
 	}
+	if !VerifyHashLockPreimage(voucher.HashLock, preimage) {
+		return errors.CodeError(Errors[ErrInvalidPreimage]), Errors[ErrInvalidPreimage]
+	}
 
 	ctx := context.Background()
 	storage := vmctx.Storage()
 
-	err := withPayerChannels(ctx, storage, payer, func(byChannelID exec.Lookup) error {
+	err = withPayerChannels(ctx, storage, payer, func(byChannelID exec.Lookup) error {
 		var channel *PaymentChannel
 
 		chInt, err := byChannelID.Find(ctx, chid.KeyString())
@@ -211,7 +291,7 @@ func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types
 		}
 
 		// validate the amount can be sent to the target and send payment to that address.
-		err = updateChannel(vmctx, vmctx.Message().From, channel, amt, validAt)
+		err = updateChannel(vmctx, vmctx.Message().From, channel, voucher)
 		if err != nil {
 			return err
 		}
@@ -219,6 +299,10 @@ func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types
 		return byChannelID.Set(ctx, chid.KeyString(), channel)
 	})
 
+	if err == nil {
+		err = recordPreimage(ctx, storage, voucher.HashLock, preimage)
+	}
+
 	if err != nil {
 		// ensure error is properly wrapped
 		if !errors.IsFault(err) && !errors.ShouldRevert(err) {
@@ -232,19 +316,33 @@ func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types
 
 // Close first executes the logic performed in the the Update method, then returns all
 // funds remaining in the channel to the payer account and deletes the channel.
-func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, sig []byte) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+// A preimage revealed to close the channel is recorded like one revealed to
+// redeem a voucher, so the payer can still look it up after the channel is
+// gone.
+func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, lane, nonce *big.Int, merges, hashLock, sig, preimage []byte) (uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
-	if !VerifyVoucherSignature(payer, chid, amt, validAt, sig) {
+	voucher, err := decodeRedeemedVoucher(payer, chid, amt, validAt, lane, nonce, merges, hashLock, sig)
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	if err := vmctx.ChargeOp(exec.GasOpVerifySignature, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+	if !VerifyVoucherSignature(payer, voucher) {
 		return errors.CodeError(Errors[ErrInvalidSignature]), Errors[ErrInvalidSignature]
 	}
+	if !VerifyHashLockPreimage(voucher.HashLock, preimage) {
+		return errors.CodeError(Errors[ErrInvalidPreimage]), Errors[ErrInvalidPreimage]
+	}
 
 	ctx := context.Background()
 	storage := vmctx.Storage()
 
-	err := withPayerChannels(ctx, storage, payer, func(byChannelID exec.Lookup) error {
+	err = withPayerChannels(ctx, storage, payer, func(byChannelID exec.Lookup) error {
 		chInt, err := byChannelID.Find(ctx, chid.KeyString())
 		if err != nil {
 			if err == hamt.ErrNotFound {
@@ -259,7 +357,7 @@ func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.
 		}
 
 		// validate the amount can be sent to the target and send payment to that address.
-		err = updateChannel(vmctx, vmctx.Message().From, channel, amt, validAt)
+		err = updateChannel(vmctx, vmctx.Message().From, channel, voucher)
 		if err != nil {
 			return err
 		}
@@ -273,6 +371,10 @@ func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.
 		return reclaim(ctx, vmctx, byChannelID, payer, chid, channel)
 	})
 
+	if err == nil {
+		err = recordPreimage(ctx, storage, voucher.HashLock, preimage)
+	}
+
 	if err != nil {
 		// ensure error is properly wrapped
 		if !errors.IsFault(err) && !errors.ShouldRevert(err) {
@@ -287,7 +389,7 @@ func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.
 // Extend can be used by the owner of a channel to add more funds to it and
 // extend the Channel's lifespan.
 func (pb *Actor) Extend(vmctx exec.VMContext, chid *types.ChannelID, eol *types.BlockHeight) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -337,7 +439,7 @@ func (pb *Actor) Extend(vmctx exec.VMContext, chid *types.ChannelID, eol *types.
 // Reclaim is used by the owner of a channel to reclaim unspent funds in timed
 // out payment Channels they own.
 func (pb *Actor) Reclaim(vmctx exec.VMContext, chid *types.ChannelID) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -383,9 +485,10 @@ func (pb *Actor) Reclaim(vmctx exec.VMContext, chid *types.ChannelID) (uint8, er
 // against the given channel.  It also takes a block height parameter "validAt"
 // enforcing that the voucher is not reclaimed until the given block height
 // Voucher errors if the channel doesn't exist or contains less than request
-// amount.
-func (pb *Actor) Voucher(vmctx exec.VMContext, chid *types.ChannelID, amount *types.AttoFIL, validAt *types.BlockHeight) ([]byte, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+// amount. The voucher is for the given lane and carries the nonce following
+// the last one redeemed on it.
+func (pb *Actor) Voucher(vmctx exec.VMContext, chid *types.ChannelID, amount *types.AttoFIL, validAt *types.BlockHeight, lane *big.Int) ([]byte, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return []byte{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -415,6 +518,11 @@ func (pb *Actor) Voucher(vmctx exec.VMContext, chid *types.ChannelID, amount *ty
 			return Errors[ErrInsufficientChannelFunds]
 		}
 
+		if !lane.IsUint64() {
+			return errors.NewRevertError("invalid lane")
+		}
+		laneState := channel.Lane(lane.Uint64())
+
 		// set voucher
 		voucher = PaymentVoucher{
 			Channel: *chid,
@@ -422,6 +530,8 @@ func (pb *Actor) Voucher(vmctx exec.VMContext, chid *types.ChannelID, amount *ty
 			Target:  channel.Target,
 			Amount:  *amount,
 			ValidAt: *validAt,
+			Lane:    lane.Uint64(),
+			Nonce:   laneState.Nonce + 1,
 		}
 
 		return nil
@@ -443,10 +553,58 @@ func (pb *Actor) Voucher(vmctx exec.VMContext, chid *types.ChannelID, amount *ty
 	return voucherBytes, 0, nil
 }
 
+// GetPreimage returns the preimage revealed to redeem or close a voucher
+// with the given hash lock.
+func (pb *Actor) GetPreimage(vmctx exec.VMContext, hashLock []byte) ([]byte, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	ctx := context.Background()
+	storage := vmctx.Storage()
+	var preimage []byte
+
+	err := actor.WithLookupForReading(ctx, storage, storage.Head(), func(byPayer exec.Lookup) error {
+		preimagesCid, err := findPreimagesCid(ctx, byPayer)
+		if err != nil {
+			return err
+		}
+		if !preimagesCid.Defined() {
+			return Errors[ErrUnknownPreimage]
+		}
+
+		return actor.WithLookupForReading(ctx, storage, preimagesCid, func(preimages exec.Lookup) error {
+			value, err := preimages.Find(ctx, hex.EncodeToString(hashLock))
+			if err == hamt.ErrNotFound {
+				return Errors[ErrUnknownPreimage]
+			}
+			if err != nil {
+				return err
+			}
+
+			var ok bool
+			preimage, ok = value.([]byte)
+			if !ok {
+				return errors.NewFaultError("Paymentbroker preimage is not bytes")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		// ensure error is properly wrapped
+		if !errors.IsFault(err) && !errors.ShouldRevert(err) {
+			return nil, 1, errors.FaultErrorWrap(err, "Error retrieving preimage")
+		}
+		return nil, errors.CodeError(err), err
+	}
+
+	return preimage, 0, nil
+}
+
 // Ls returns all payment channels for a given payer address.
 // The slice of channels will be returned as cbor encoded map from string channelId to PaymentChannel.
 func (pb *Actor) Ls(vmctx exec.VMContext, payer address.Address) ([]byte, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return []byte{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -487,12 +645,12 @@ func (pb *Actor) Ls(vmctx exec.VMContext, payer address.Address) ([]byte, uint8,
 	return channelsBytes, 0, nil
 }
 
-func updateChannel(ctx exec.VMContext, target address.Address, channel *PaymentChannel, amt *types.AttoFIL, validAt *types.BlockHeight) error {
+func updateChannel(ctx exec.VMContext, target address.Address, channel *PaymentChannel, voucher *PaymentVoucher) error {
 	if target != channel.Target {
 		return Errors[ErrWrongTarget]
 	}
 
-	if ctx.BlockHeight().LessThan(validAt) {
+	if ctx.BlockHeight().LessThan(&voucher.ValidAt) {
 		return Errors[ErrTooEarly]
 	}
 
@@ -500,27 +658,130 @@ func updateChannel(ctx exec.VMContext, target address.Address, channel *PaymentC
 		return Errors[ErrExpired]
 	}
 
-	if amt.GreaterThan(channel.Amount) {
+	if voucher.Amount.GreaterThan(channel.Amount) {
 		return Errors[ErrInsufficientChannelFunds]
 	}
 
-	if amt.LessEqual(channel.AmountRedeemed) {
+	lane := channel.Lane(voucher.Lane)
+	if voucher.Nonce <= lane.Nonce {
+		return Errors[ErrStaleNonce]
+	}
+
+	// the amounts already redeemed on merged lanes count towards the voucher
+	mergedRedeemed := types.NewZeroAttoFIL()
+	merged := map[uint64]bool{voucher.Lane: true}
+	for _, merge := range voucher.Merges {
+		if merged[merge.Lane] {
+			return Errors[ErrInvalidMerge]
+		}
+		merged[merge.Lane] = true
+
+		mergedLane := channel.Lane(merge.Lane)
+		if merge.Nonce <= mergedLane.Nonce {
+			return Errors[ErrStaleNonce]
+		}
+		mergedLane.Nonce = merge.Nonce
+		mergedRedeemed = mergedRedeemed.Add(mergedLane.Redeemed)
+	}
+
+	alreadyRedeemed := lane.Redeemed.Add(mergedRedeemed)
+	if voucher.Amount.LessEqual(alreadyRedeemed) {
 		return Errors[ErrAlreadyWithdrawn]
 	}
 
+	updateAmount := voucher.Amount.Sub(alreadyRedeemed)
+	if channel.AmountRedeemed.Add(updateAmount).GreaterThan(channel.Amount) {
+		return Errors[ErrInsufficientChannelFunds]
+	}
+
 	// transfer funds to sender
-	updateAmount := amt.Sub(channel.AmountRedeemed)
 	_, _, err := ctx.Send(ctx.Message().From, "", updateAmount, nil)
 	if err != nil {
 		return err
 	}
 
-	// update amount redeemed from this channel
-	channel.AmountRedeemed = amt
+	// update amounts redeemed from the lane and the channel
+	lane.Redeemed = voucher.Amount.Sub(mergedRedeemed)
+	lane.Nonce = voucher.Nonce
+	channel.AmountRedeemed = channel.AmountRedeemed.Add(updateAmount)
 
 	return nil
 }
 
+// recordPreimage records the preimage revealed for the hash lock, outside of
+// the payer's channels so it outlives them, for the payer to learn it.
+func recordPreimage(ctx context.Context, storage exec.Storage, hashLock, preimage []byte) error {
+	if len(hashLock) == 0 {
+		return nil
+	}
+
+	stateCid, err := actor.WithLookup(ctx, storage, storage.Head(), func(byPayer exec.Lookup) error {
+		preimagesCid, err := findPreimagesCid(ctx, byPayer)
+		if err != nil {
+			return err
+		}
+
+		preimagesCid, err = actor.SetKeyValue(ctx, storage, preimagesCid, hex.EncodeToString(hashLock), preimage)
+		if err != nil {
+			return err
+		}
+
+		return byPayer.Set(ctx, preimagesKey, preimagesCid)
+	})
+	if err != nil {
+		return err
+	}
+
+	return storage.Commit(stateCid, storage.Head())
+}
+
+// findPreimagesCid returns the cid of the lookup of revealed preimages,
+// cid.Undef if none was revealed yet.
+func findPreimagesCid(ctx context.Context, byPayer exec.Lookup) (cid.Cid, error) {
+	preimages, err := byPayer.Find(ctx, preimagesKey)
+	if err == hamt.ErrNotFound {
+		return cid.Undef, nil
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	preimagesCid, ok := preimages.(cid.Cid)
+	if !ok {
+		return cid.Undef, errors.NewFaultError("Paymentbroker preimages are not a Cid")
+	}
+	return preimagesCid, nil
+}
+
+// decodeRedeemedVoucher assembles the voucher submitted to redeem or close
+// from the message parameters.
+func decodeRedeemedVoucher(payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, lane, nonce *big.Int, merges, hashLock, sig []byte) (*PaymentVoucher, error) {
+	if !lane.IsUint64() || !nonce.IsUint64() {
+		return nil, errors.NewRevertError("invalid lane or nonce")
+	}
+	if len(hashLock) != 0 && len(hashLock) != HashLockLen {
+		return nil, Errors[ErrInvalidHashLock]
+	}
+
+	voucher := &PaymentVoucher{
+		Channel:   *chid,
+		Payer:     payer,
+		Amount:    *amt,
+		ValidAt:   *validAt,
+		Lane:      lane.Uint64(),
+		Nonce:     nonce.Uint64(),
+		HashLock:  hashLock,
+		Signature: sig,
+	}
+	if len(merges) > 0 {
+		if err := cbor.DecodeInto(merges, &voucher.Merges); err != nil {
+			return nil, Errors[ErrInvalidMerge]
+		}
+	}
+
+	return voucher, nil
+}
+
 func reclaim(ctx context.Context, vmctx exec.VMContext, byChannelID exec.Lookup, payer address.Address, chid *types.ChannelID, channel *PaymentChannel) error {
 	amt := channel.Amount.Sub(channel.AmountRedeemed)
 	if amt.LessEqual(types.ZeroAttoFIL) {
@@ -546,25 +807,64 @@ func reclaim(ctx context.Context, vmctx exec.VMContext, byChannelID exec.Lookup,
 // voucher signature.
 const separator = 0x0
 
-// SignVoucher creates the signature for the given combination of
-// channel, amount, validAt (earliest block height for redeem) and from address.
-// It does so by signing the following bytes: (channelID | 0x0 | amount | 0x0 | validAt)
-func SignVoucher(channelID *types.ChannelID, amount *types.AttoFIL, validAt *types.BlockHeight, addr address.Address, signer types.Signer) (types.Signature, error) {
-	data := createVoucherSignatureData(channelID, amount, validAt)
+// SignVoucher creates the signature for the given voucher with the key of
+// addr. It signs the following bytes:
+// (channelID | 0x0 | amount | 0x0 | validAt | 0x0 | lane | 0x0 | nonce)
+// followed by (0x0 | lane | 0x0 | nonce) for each merged lane and, for a
+// hash-locked voucher, by (0x0 | hashLock).
+func SignVoucher(voucher *PaymentVoucher, addr address.Address, signer types.Signer) (types.Signature, error) {
+	data := createVoucherSignatureData(voucher)
 	return signer.SignBytes(data, addr)
 }
 
 // VerifyVoucherSignature returns whether the voucher's signature is valid
-func VerifyVoucherSignature(payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, sig []byte) bool {
-	data := createVoucherSignatureData(chid, amt, validAt)
-	return types.IsValidSignature(data, payer, sig)
+// for the given payer.
+func VerifyVoucherSignature(payer address.Address, voucher *PaymentVoucher) bool {
+	data := createVoucherSignatureData(voucher)
+	return types.IsValidSignature(data, payer, voucher.Signature)
+}
+
+// NewHashLock returns the hash lock of a voucher that can only be redeemed by
+// revealing the given preimage.
+func NewHashLock(preimage []byte) []byte {
+	hash := sha256.Sum256(preimage)
+	return hash[:]
+}
+
+// VerifyHashLockPreimage returns whether the preimage unlocks the hash lock.
+// A voucher without a hash lock needs no preimage, and a hash lock that is
+// not HashLockLen bytes long is never unlocked.
+func VerifyHashLockPreimage(hashLock, preimage []byte) bool {
+	if len(hashLock) == 0 {
+		return true
+	}
+	return len(hashLock) == HashLockLen && bytes.Equal(NewHashLock(preimage), hashLock)
 }
 
-func createVoucherSignatureData(channelID *types.ChannelID, amount *types.AttoFIL, validAt *types.BlockHeight) []byte {
-	data := append(channelID.Bytes(), separator)
-	data = append(data, amount.Bytes()...)
+func createVoucherSignatureData(voucher *PaymentVoucher) []byte {
+	data := append(voucher.Channel.Bytes(), separator)
+	data = append(data, voucher.Amount.Bytes()...)
+	data = append(data, separator)
+	data = append(data, voucher.ValidAt.Bytes()...)
+	data = appendLaneSignatureData(data, voucher.Lane, voucher.Nonce)
+	for _, merge := range voucher.Merges {
+		data = appendLaneSignatureData(data, merge.Lane, merge.Nonce)
+	}
+	if len(voucher.HashLock) > 0 {
+		data = append(data, separator)
+		data = append(data, voucher.HashLock...)
+	}
+	return data
+}
+
+func appendLaneSignatureData(data []byte, lane, nonce uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, lane)
+	data = append(data, separator)
+	data = append(data, buf...)
+	binary.BigEndian.PutUint64(buf, nonce)
 	data = append(data, separator)
-	return append(data, validAt.Bytes()...)
+	return append(data, buf...)
 }
 
 func withPayerChannels(ctx context.Context, storage exec.Storage, payer address.Address, f func(exec.Lookup) error) error {
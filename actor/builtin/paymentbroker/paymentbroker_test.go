@@ -230,6 +230,185 @@ func TestPaymentBrokerUpdateSuccessWithValidAt(t *testing.T) {
 	assert.Equal(sys.target, channel.Target)
 }
 
+func TestPaymentBrokerRedeemLanes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	redeem := func(voucher *PaymentVoucher) *consensus.ApplicationResult {
+		result, err := sys.ApplyVoucherMessage(sys.target, voucher, 0, "redeem", 0)
+		require.NoError(err)
+		return result
+	}
+
+	// lanes are redeemed independently
+	result := redeem(sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0))
+	require.NoError(result.ExecutionError)
+	result = redeem(sys.Voucher(types.NewAttoFILFromFIL(50), sys.defaultValidAt, 1))
+	require.NoError(result.ExecutionError)
+
+	assert.Equal(types.NewAttoFILFromFIL(150), state.MustGetActor(sys.st, sys.target).Balance)
+
+	channel := sys.retrieveChannel(state.MustGetActor(sys.st, address.PaymentBrokerAddress))
+	assert.Equal(types.NewAttoFILFromFIL(150), channel.AmountRedeemed)
+	assert.Equal(types.NewAttoFILFromFIL(100), channel.Lane(0).Redeemed)
+	assert.Equal(uint64(1), channel.Lane(0).Nonce)
+	assert.Equal(types.NewAttoFILFromFIL(50), channel.Lane(1).Redeemed)
+
+	// a voucher with a nonce that was already redeemed on its lane is rejected
+	stale := sys.Voucher(types.NewAttoFILFromFIL(200), sys.defaultValidAt, 0)
+	stale.Nonce = 1
+	sig, err := SignVoucher(stale, sys.payer, mockSigner)
+	require.NoError(err)
+	stale.Signature = sig
+
+	result = redeem(stale)
+	assert.Equal(uint8(ErrStaleNonce), result.Receipt.ExitCode)
+
+	// the next voucher on the lane only pays the difference
+	result = redeem(sys.Voucher(types.NewAttoFILFromFIL(120), sys.defaultValidAt, 0))
+	require.NoError(result.ExecutionError)
+	assert.Equal(types.NewAttoFILFromFIL(170), state.MustGetActor(sys.st, sys.target).Balance)
+}
+
+func TestPaymentBrokerRedeemMergedVoucher(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	redeem := func(voucher *PaymentVoucher) *consensus.ApplicationResult {
+		result, err := sys.ApplyVoucherMessage(sys.target, voucher, 0, "redeem", 0)
+		require.NoError(err)
+		return result
+	}
+
+	result := redeem(sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 1))
+	require.NoError(result.ExecutionError)
+	result = redeem(sys.Voucher(types.NewAttoFILFromFIL(50), sys.defaultValidAt, 2))
+	require.NoError(result.ExecutionError)
+
+	t.Run("merged lanes must differ from the voucher's lane", func(t *testing.T) {
+		result := redeem(sys.Voucher(types.NewAttoFILFromFIL(300), sys.defaultValidAt, 0, Merge{Lane: 0, Nonce: 5}))
+		assert.Equal(uint8(ErrInvalidMerge), result.Receipt.ExitCode)
+
+		result = redeem(sys.Voucher(types.NewAttoFILFromFIL(300), sys.defaultValidAt, 0, Merge{Lane: 1, Nonce: 5}, Merge{Lane: 1, Nonce: 6}))
+		assert.Equal(uint8(ErrInvalidMerge), result.Receipt.ExitCode)
+	})
+
+	t.Run("merged lanes must advance their nonce", func(t *testing.T) {
+		result := redeem(sys.Voucher(types.NewAttoFILFromFIL(300), sys.defaultValidAt, 0, Merge{Lane: 1, Nonce: 1}))
+		assert.Equal(uint8(ErrStaleNonce), result.Receipt.ExitCode)
+	})
+
+	t.Run("a merged voucher settles several lanes at once", func(t *testing.T) {
+		result := redeem(sys.Voucher(types.NewAttoFILFromFIL(300), sys.defaultValidAt, 0, Merge{Lane: 1, Nonce: 5}, Merge{Lane: 2, Nonce: 5}))
+		require.NoError(result.ExecutionError)
+
+		// only the amount not yet redeemed on the merged lanes is paid
+		assert.Equal(types.NewAttoFILFromFIL(300), state.MustGetActor(sys.st, sys.target).Balance)
+
+		channel := sys.retrieveChannel(state.MustGetActor(sys.st, address.PaymentBrokerAddress))
+		assert.Equal(types.NewAttoFILFromFIL(300), channel.AmountRedeemed)
+		assert.Equal(types.NewAttoFILFromFIL(150), channel.Lane(0).Redeemed)
+		assert.Equal(uint64(5), channel.Lane(1).Nonce)
+		assert.Equal(uint64(5), channel.Lane(2).Nonce)
+	})
+}
+
+func TestPaymentBrokerRedeemHashLockedVoucher(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	preimage := []byte("decryption key")
+	voucher := sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0)
+	voucher.HashLock = NewHashLock(preimage)
+	sig, err := SignVoucher(voucher, sys.payer, mockSigner)
+	require.NoError(err)
+	voucher.Signature = sig
+
+	redeem := func(voucher *PaymentVoucher, preimage []byte) *consensus.ApplicationResult {
+		msg := types.NewMessage(sys.target, address.PaymentBrokerAddress, 0, types.NewAttoFILFromFIL(0), "redeem", sys.redeemParams(voucher, preimage))
+		result, err := sys.ApplyMessage(msg, 0)
+		require.NoError(err)
+		return result
+	}
+
+	t.Run("the hash lock is covered by the signature", func(t *testing.T) {
+		unlocked := *voucher
+		unlocked.HashLock = nil
+
+		result := redeem(&unlocked, nil)
+		assert.Equal(uint8(ErrInvalidSignature), result.Receipt.ExitCode)
+	})
+
+	t.Run("redeeming requires the preimage", func(t *testing.T) {
+		result := redeem(voucher, nil)
+		assert.Equal(uint8(ErrInvalidPreimage), result.Receipt.ExitCode)
+
+		result = redeem(voucher, []byte("wrong key"))
+		assert.Equal(uint8(ErrInvalidPreimage), result.Receipt.ExitCode)
+	})
+
+	t.Run("the hash lock must be a sha256 hash", func(t *testing.T) {
+		short := *voucher
+		short.HashLock = voucher.HashLock[:HashLockLen-1]
+		sig, err := SignVoucher(&short, sys.payer, mockSigner)
+		require.NoError(err)
+		short.Signature = sig
+
+		result := redeem(&short, preimage)
+		assert.Equal(uint8(ErrInvalidHashLock), result.Receipt.ExitCode)
+		assert.False(VerifyHashLockPreimage(short.HashLock, preimage))
+	})
+
+	t.Run("the preimage is recorded", func(t *testing.T) {
+		_, exitCode, _ := sys.CallQueryMethod("getPreimage", 0, voucher.HashLock)
+		assert.Equal(uint8(ErrUnknownPreimage), exitCode)
+
+		result := redeem(voucher, preimage)
+		require.NoError(result.ExecutionError)
+
+		assert.Equal(types.NewAttoFILFromFIL(100), state.MustGetActor(sys.st, sys.target).Balance)
+
+		values, exitCode, err := sys.CallQueryMethod("getPreimage", 0, voucher.HashLock)
+		require.NoError(err)
+		require.Equal(uint8(0), exitCode)
+		assert.Equal(preimage, values[0])
+	})
+}
+
+func TestPaymentBrokerCloseKeepsThePreimage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	sys := setup(t)
+
+	preimage := []byte("decryption key")
+	voucher := sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0)
+	voucher.HashLock = NewHashLock(preimage)
+	sig, err := SignVoucher(voucher, sys.payer, mockSigner)
+	require.NoError(err)
+	voucher.Signature = sig
+
+	msg := types.NewMessage(sys.target, address.PaymentBrokerAddress, 0, types.NewAttoFILFromFIL(0), "close", sys.redeemParams(voucher, preimage))
+	result, err := sys.ApplyMessage(msg, 0)
+	require.NoError(err)
+	require.NoError(result.ExecutionError)
+
+	// the channel is gone, the preimage is not
+	values, exitCode, err := sys.CallQueryMethod("ls", 0, sys.payer)
+	require.NoError(err)
+	require.Equal(uint8(0), exitCode)
+	var channels map[string]*PaymentChannel
+	require.NoError(actor.UnmarshalStorage(values[0], &channels))
+	assert.NotContains(channels, sys.channelID.KeyString())
+
+	values, exitCode, err = sys.CallQueryMethod("getPreimage", 0, voucher.HashLock)
+	require.NoError(err)
+	require.Equal(uint8(0), exitCode)
+	assert.Equal(preimage, values[0])
+}
+
 func TestPaymentBrokerClose(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -273,14 +452,12 @@ func TestPaymentBrokerCloseInvalidSig(t *testing.T) {
 	require := require.New(t)
 	sys := setup(t)
 
-	amt := types.NewAttoFILFromFIL(100)
-	signature, err := sys.Signature(amt, sys.defaultValidAt)
-	require.NoError(err)
+	voucher := sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0)
 	// make the signature invalid
-	signature[0] = 0
-	signature[1] = 1
+	voucher.Signature[0] = 0
+	voucher.Signature[1] = 1
 
-	pdata := core.MustConvertParams(sys.payer, sys.channelID, amt, sys.defaultValidAt, signature)
+	pdata := sys.redeemParams(voucher, nil)
 	msg := types.NewMessage(sys.target, address.PaymentBrokerAddress, 0, types.NewAttoFILFromFIL(0), "close", pdata)
 	res, err := sys.ApplyMessage(msg, 0)
 	require.EqualError(res.ExecutionError, Errors[ErrInvalidSignature].Error())
@@ -291,14 +468,12 @@ func TestPaymentBrokerRedeemInvalidSig(t *testing.T) {
 	require := require.New(t)
 	sys := setup(t)
 
-	amt := types.NewAttoFILFromFIL(100)
-	signature, err := sys.Signature(amt, sys.defaultValidAt)
-	require.NoError(err)
+	voucher := sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0)
 	// make the signature invalid
-	signature[0] = 0
-	signature[1] = 1
+	voucher.Signature[0] = 0
+	voucher.Signature[1] = 1
 
-	pdata := core.MustConvertParams(sys.payer, sys.channelID, amt, sys.defaultValidAt, signature)
+	pdata := sys.redeemParams(voucher, nil)
 	msg := types.NewMessage(sys.target, address.PaymentBrokerAddress, 0, types.NewAttoFILFromFIL(0), "redeem", pdata)
 	res, err := sys.ApplyMessage(msg, 0)
 	require.EqualError(res.ExecutionError, Errors[ErrInvalidSignature].Error())
@@ -492,7 +667,7 @@ func TestNewPaymentBrokerVoucher(t *testing.T) {
 
 		// create voucher
 		voucherAmount := types.NewAttoFILFromFIL(100)
-		pdata := core.MustConvertParams(sys.channelID, voucherAmount, sys.defaultValidAt)
+		pdata := core.MustConvertParams(sys.channelID, voucherAmount, sys.defaultValidAt, big.NewInt(3))
 		msg := types.NewMessage(sys.payer, address.PaymentBrokerAddress, 1, nil, "voucher", pdata)
 		res, err := sys.ApplyMessage(msg, 9)
 		assert.NoError(err)
@@ -507,6 +682,8 @@ func TestNewPaymentBrokerVoucher(t *testing.T) {
 		assert.Equal(sys.payer, voucher.Payer)
 		assert.Equal(sys.target, voucher.Target)
 		assert.Equal(*voucherAmount, voucher.Amount)
+		assert.Equal(uint64(3), voucher.Lane)
+		assert.Equal(uint64(1), voucher.Nonce)
 	})
 
 	t.Run("Errors when channel does not exist", func(t *testing.T) {
@@ -516,7 +693,7 @@ func TestNewPaymentBrokerVoucher(t *testing.T) {
 
 		// create voucher
 		voucherAmount := types.NewAttoFILFromFIL(100)
-		_, exitCode, err := sys.CallQueryMethod("voucher", 9, notChannelID, voucherAmount, sys.defaultValidAt)
+		_, exitCode, err := sys.CallQueryMethod("voucher", 9, notChannelID, voucherAmount, sys.defaultValidAt, big.NewInt(0))
 		assert.NotEqual(uint8(0), exitCode)
 		assert.Contains(fmt.Sprintf("%v", err), "unknown")
 	})
@@ -526,7 +703,7 @@ func TestNewPaymentBrokerVoucher(t *testing.T) {
 
 		// create voucher
 		voucherAmount := types.NewAttoFILFromFIL(2000)
-		args := core.MustConvertParams(sys.channelID, voucherAmount, sys.defaultValidAt)
+		args := core.MustConvertParams(sys.channelID, voucherAmount, sys.defaultValidAt, big.NewInt(0))
 
 		msg := types.NewMessage(sys.payer, address.PaymentBrokerAddress, 1, nil, "voucher", args)
 		res, err := sys.ApplyMessage(msg, 9)
@@ -585,6 +762,9 @@ type system struct {
 	st             state.Tree
 	vms            vm.StorageMap
 	addressGetter  func() address.Address
+
+	// voucherNonces holds the nonce of the last voucher created on each lane.
+	voucherNonces map[uint64]uint64
 }
 
 func setup(t *testing.T) system {
@@ -612,15 +792,48 @@ func setup(t *testing.T) system {
 		defaultValidAt: defaultValidAt,
 		st:             st,
 		vms:            vms,
+		voucherNonces:  make(map[uint64]uint64),
 	}
 }
 
-func (sys *system) Signature(amt *types.AttoFIL, validAt *types.BlockHeight) ([]byte, error) {
-	sig, err := SignVoucher(sys.channelID, amt, validAt, sys.payer, mockSigner)
-	if err != nil {
-		return nil, err
+// Voucher creates a voucher signed by the payer for the given lane, with the
+// nonce following the last voucher created on that lane.
+func (sys *system) Voucher(amt *types.AttoFIL, validAt *types.BlockHeight, lane uint64, merges ...Merge) *PaymentVoucher {
+	sys.t.Helper()
+
+	sys.voucherNonces[lane]++
+	voucher := &PaymentVoucher{
+		Channel: *sys.channelID,
+		Payer:   sys.payer,
+		Target:  sys.target,
+		Amount:  *amt,
+		ValidAt: *validAt,
+		Lane:    lane,
+		Nonce:   sys.voucherNonces[lane],
+		Merges:  merges,
 	}
-	return ([]byte)(sig), nil
+
+	sig, err := SignVoucher(voucher, sys.payer, mockSigner)
+	require.NoError(sys.t, err)
+	voucher.Signature = sig
+
+	return voucher
+}
+
+func (sys *system) redeemParams(voucher *PaymentVoucher, preimage []byte) []byte {
+	sys.t.Helper()
+
+	params, err := voucher.RedeemParams(preimage)
+	require.NoError(sys.t, err)
+	return core.MustConvertParams(params...)
+}
+
+// ApplyVoucherMessage submits the voucher to redeem or close from target.
+func (sys *system) ApplyVoucherMessage(target address.Address, voucher *PaymentVoucher, nonce uint64, method string, height uint64) (*consensus.ApplicationResult, error) {
+	sys.t.Helper()
+
+	msg := types.NewMessage(target, address.PaymentBrokerAddress, nonce, types.NewAttoFILFromFIL(0), method, sys.redeemParams(voucher, nil))
+	return sys.ApplyMessage(msg, height)
 }
 
 func (sys *system) CallQueryMethod(method string, height uint64, params ...interface{}) ([][]byte, uint8, error) {
@@ -683,16 +896,8 @@ func (sys *system) retrieveChannel(paymentBroker *actor.Actor) *PaymentChannel {
 func (sys *system) applySignatureMessage(target address.Address, amtInt uint64, validAt *types.BlockHeight, nonce uint64, method string, height uint64) (*consensus.ApplicationResult, error) {
 	sys.t.Helper()
 
-	require := require.New(sys.t)
-
-	amt := types.NewAttoFILFromFIL(amtInt)
-	signature, err := sys.Signature(amt, validAt)
-	require.NoError(err)
-
-	pdata := core.MustConvertParams(sys.payer, sys.channelID, amt, validAt, signature)
-	msg := types.NewMessage(target, address.PaymentBrokerAddress, nonce, types.NewAttoFILFromFIL(0), method, pdata)
-
-	return sys.ApplyMessage(msg, height)
+	voucher := sys.Voucher(types.NewAttoFILFromFIL(amtInt), validAt, 0)
+	return sys.ApplyVoucherMessage(target, voucher, nonce, method, height)
 }
 
 func (sys *system) ApplyMessage(msg *types.Message, height uint64) (*consensus.ApplicationResult, error) {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"sort"
+	"strconv"
 
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -30,19 +32,48 @@ const (
 	ErrPledgeTooLow = 33
 	// ErrUnknownMiner indicates a pledge under the MinimumPledge.
 	ErrUnknownMiner = 34
+	// ErrUnknownDeal indicates an invalid deal id.
+	ErrUnknownDeal = 35
+	// ErrInvalidDeal indicates malformed deal terms.
+	ErrInvalidDeal = 36
+	// ErrInvalidDealSignature indicates deal terms not signed by the client.
+	ErrInvalidDealSignature = 37
+	// ErrCallerUnauthorized signals an unauthorized caller.
+	ErrCallerUnauthorized = 38
+	// ErrInvalidDealState indicates a deal not in the state an operation requires.
+	ErrInvalidDealState = 39
+	// ErrMinerCallFailed indicates a call to a miner actor failed.
+	ErrMinerCallFailed = 40
 	// ErrInsufficientCollateral indicates the collateral is too low.
 	ErrInsufficientCollateral = 43
+	// ErrDealNonceUsed indicates the client already made a deal with the nonce.
+	ErrDealNonceUsed = 44
+	// ErrDealsActive indicates a miner leaving the market with active deals.
+	ErrDealsActive = 45
 )
 
 // Errors map error codes to revert errors this actor may return.
 var Errors = map[uint8]error{
 	ErrPledgeTooLow:           errors.NewCodedRevertErrorf(ErrPledgeTooLow, "pledge must be at least %s sectors", MinimumPledge),
 	ErrUnknownMiner:           errors.NewCodedRevertErrorf(ErrUnknownMiner, "unknown miner"),
+	ErrUnknownDeal:            errors.NewCodedRevertErrorf(ErrUnknownDeal, "unknown deal"),
+	ErrInvalidDeal:            errors.NewCodedRevertErrorf(ErrInvalidDeal, "invalid deal terms"),
+	ErrInvalidDealSignature:   errors.NewCodedRevertErrorf(ErrInvalidDealSignature, "deal terms are not signed by the client"),
+	ErrCallerUnauthorized:     errors.NewCodedRevertErrorf(ErrCallerUnauthorized, "not authorized to call the method"),
+	ErrInvalidDealState:       errors.NewCodedRevertErrorf(ErrInvalidDealState, "deal is not in a state allowing this"),
+	ErrMinerCallFailed:        errors.NewCodedRevertErrorf(ErrMinerCallFailed, "call to miner actor failed"),
 	ErrInsufficientCollateral: errors.NewCodedRevertErrorf(ErrInsufficientCollateral, "collateral must be more than %s FIL per sector", MinimumCollateralPerSector),
+	ErrDealNonceUsed:          errors.NewCodedRevertErrorf(ErrDealNonceUsed, "client nonce was already used in a deal"),
+	ErrDealsActive:            errors.NewCodedRevertErrorf(ErrDealsActive, "miner has active deals"),
 }
 
+// separator is the separator used when concatenating deal terms in a
+// signature.
+const separator = 0x0
+
 func init() {
 	cbor.RegisterCborType(State{})
+	cbor.RegisterCborType(Deal{})
 	cbor.RegisterCborType(struct{}{})
 }
 
@@ -57,6 +88,80 @@ type State struct {
 	// TotalCommitedStorage is the number of sectors that are currently committed
 	// in the whole network.
 	TotalCommittedStorage *big.Int
+
+	// Deals maps deal ids to published deals.
+	Deals cid.Cid `refmt:",omitempty"`
+
+	// NextDealID is the id the next published deal will get. Ids start at
+	// one so that zero can stand for no deal.
+	NextDealID uint64
+
+	// DealNonces maps the client nonces used by published deals to the ids
+	// of the deals, so that the client's signature over a deal cannot be
+	// replayed.
+	DealNonces cid.Cid `refmt:",omitempty"`
+
+	// MinerDeals maps the addresses of miners to the ids of the deals they
+	// published, so that the deals of a miner leaving the market can be
+	// found without walking all deals.
+	MinerDeals cid.Cid `refmt:",omitempty"`
+}
+
+// DealState is the state of a deal published to the storage market.
+type DealState uint64
+
+const (
+	// DealPublished means the deal is recorded but no committed sector holds
+	// its piece yet.
+	DealPublished = DealState(iota)
+
+	// DealActive means the miner committed a sector holding the deal's piece.
+	DealActive
+
+	// DealComplete means the deal's duration has passed and its collateral
+	// was returned to the miner's owner.
+	DealComplete
+
+	// DealFailed means the sector holding the deal's piece was lost before
+	// the deal completed and its collateral was forfeited.
+	DealFailed
+)
+
+func (s DealState) String() string {
+	switch s {
+	case DealPublished:
+		return "published"
+	case DealActive:
+		return "active"
+	case DealComplete:
+		return "complete"
+	case DealFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("<unrecognized %d>", s)
+	}
+}
+
+// Deal is a storage deal between a client and a miner as recorded on chain.
+type Deal struct {
+	Client   address.Address    `json:"client"`
+	Miner    address.Address    `json:"miner"`
+	PieceRef cid.Cid            `json:"pieceRef"`
+	Size     *types.BytesAmount `json:"size"`
+	// ClientNonce makes the client's signature over the deal unique.
+	ClientNonce uint64 `json:"clientNonce"`
+	// Duration is the number of blocks the piece is stored for once the
+	// deal is active.
+	Duration uint64 `json:"duration"`
+	// Price is the total price the client pays for the deal.
+	Price *types.AttoFIL `json:"price"`
+	// Collateral is the amount the miner locked up when publishing the deal.
+	Collateral *types.AttoFIL `json:"collateral"`
+	State      DealState      `json:"state"`
+	// SectorID is the sector holding the piece once the deal is active.
+	SectorID uint64 `json:"sectorId"`
+	// Start is the block height the deal became active at, zero before.
+	Start *types.BlockHeight `json:"start"`
 }
 
 // NewActor returns a new storage market actor.
@@ -68,6 +173,7 @@ func NewActor() (*actor.Actor, error) {
 func (sma *Actor) InitializeState(storage exec.Storage, _ interface{}) error {
 	initStorage := &State{
 		TotalCommittedStorage: big.NewInt(0),
+		NextDealID:            1,
 	}
 	stateBytes, err := cbor.DumpObject(initStorage)
 	if err != nil {
@@ -102,12 +208,48 @@ var storageMarketExports = exec.Exports{
 		Params: []abi.Type{},
 		Return: []abi.Type{abi.Integer},
 	},
+	"getMiners": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.AddressArray},
+	},
+	"publishDeal": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address, abi.Address, abi.Bytes, abi.BytesAmount, abi.Integer, abi.AttoFIL, abi.Integer, abi.Bytes},
+		Return: []abi.Type{abi.Integer},
+	},
+	"activateDeals": &exec.FunctionSignature{
+		Params: []abi.Type{abi.SectorID, abi.UintArray},
+		Return: nil,
+	},
+	"completeDeal": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Integer},
+		Return: nil,
+	},
+	"failDeals": &exec.FunctionSignature{
+		Params: []abi.Type{abi.UintArray},
+		Return: nil,
+	},
+	"getDeal": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Integer},
+		Return: []abi.Type{abi.Bytes},
+	},
+	"getPublishedDealID": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address, abi.Integer},
+		Return: []abi.Type{abi.Integer},
+	},
+	"getMinimumCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Integer},
+		Return: []abi.Type{abi.AttoFIL},
+	},
+	"removeMiner": &exec.FunctionSignature{
+		Params: nil,
+		Return: nil,
+	},
 }
 
 // CreateMiner creates a new miner with the a pledge of the given amount of sectors. The
 // miners collateral is set by the value in the message.
 func (sma *Actor) CreateMiner(vmctx exec.VMContext, pledge *big.Int, publicKey []byte, pid peer.ID) (address.Address, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return address.Address{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -163,7 +305,7 @@ func (sma *Actor) CreateMiner(vmctx exec.VMContext, pledge *big.Int, publicKey [
 // This occurs either when a miner adds a new commitment, or when one is removed
 // (via slashing or willful removal). The delta is in number of sectors.
 func (sma *Actor) UpdatePower(vmctx exec.VMContext, delta *big.Int) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -196,9 +338,106 @@ func (sma *Actor) UpdatePower(vmctx exec.VMContext, delta *big.Int) (uint8, erro
 	return 0, nil
 }
 
+// GetMinimumCollateral returns the minimum collateral for a pledge of the
+// given number of sectors. Miner actors use it to check their collateral.
+func (sma *Actor) GetMinimumCollateral(vmctx exec.VMContext, sectors *big.Int) (*types.AttoFIL, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	return MinimumCollateral(sectors), 0, nil
+}
+
+// RemoveMiner is called by a miner actor exiting the storage market. The
+// miner must not have active deals. Its published deals fail, forfeiting
+// their collateral, as it can no longer commit sectors or publish deals
+// afterwards.
+func (sma *Actor) RemoveMiner(vmctx exec.VMContext) (uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		ctx := context.Background()
+		minerAddr := vmctx.Message().From
+		if err := requireMiner(ctx, vmctx.Storage(), state.Miners, minerAddr); err != nil {
+			return nil, err
+		}
+
+		minerDeals, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.MinerDeals, []uint64{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load miner deals with CID: %s", state.MinerDeals)
+		}
+		dealIDs, err := findMinerDeals(ctx, minerDeals, minerAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		deals, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.Deals, &Deal{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load deals with CID: %s", state.Deals)
+		}
+
+		forfeited := types.NewZeroAttoFIL()
+		for _, id := range dealIDs {
+			deal, err := findDeal(ctx, deals, id)
+			if err != nil {
+				return nil, err
+			}
+			if deal.State == DealActive {
+				return nil, Errors[ErrDealsActive]
+			}
+			if deal.State != DealPublished {
+				continue
+			}
+
+			deal.State = DealFailed
+			forfeited = forfeited.Add(deal.Collateral)
+			if err := deals.Set(ctx, dealKey(id), deal); err != nil {
+				return nil, errors.FaultErrorWrapf(err, "could not store deal %d", id)
+			}
+		}
+		state.Deals, err = deals.Commit(ctx)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not commit deals")
+		}
+
+		if len(dealIDs) > 0 {
+			if err := minerDeals.Delete(ctx, minerAddr.String()); err != nil {
+				return nil, errors.FaultErrorWrapf(err, "could not remove deals of miner %s", minerAddr)
+			}
+			state.MinerDeals, err = minerDeals.Commit(ctx)
+			if err != nil {
+				return nil, errors.FaultErrorWrap(err, "could not commit miner deals")
+			}
+		}
+
+		miners, err := actor.WithLookup(ctx, vmctx.Storage(), state.Miners, func(lookup exec.Lookup) error {
+			return lookup.Delete(ctx, minerAddr.String())
+		})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not remove miner %s", minerAddr)
+		}
+		state.Miners = miners
+
+		if forfeited.IsPositive() {
+			if _, _, err := vmctx.Send(address.NetworkAddress, "", forfeited, nil); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
 // GetTotalStorage returns the total amount of proven storage in the system.
 func (sma *Actor) GetTotalStorage(vmctx exec.VMContext) (*big.Int, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -218,6 +457,537 @@ func (sma *Actor) GetTotalStorage(vmctx exec.VMContext) (*big.Int, uint8, error)
 	return count, 0, nil
 }
 
+// GetMiners returns the addresses of all miners in the storage market, in
+// ascending order.
+func (sma *Actor) GetMiners(vmctx exec.VMContext) ([]address.Address, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	ctx := context.Background()
+	var state State
+	ret, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		miners := []address.Address{}
+		err := actor.WithLookupForReading(ctx, vmctx.Storage(), state.Miners, func(lookup exec.Lookup) error {
+			kvs, err := lookup.Values(ctx)
+			if err != nil {
+				return err
+			}
+			for _, kv := range kvs {
+				addr, err := address.NewFromString(kv.Key)
+				if err != nil {
+					return err
+				}
+				miners = append(miners, addr)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load lookup for miners with CID: %s", state.Miners)
+		}
+
+		sort.Slice(miners, func(i, j int) bool {
+			return miners[i].String() < miners[j].String()
+		})
+		return miners, nil
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	miners, ok := ret.([]address.Address)
+	if !ok {
+		return nil, 1, fmt.Errorf("expected []address.Address to be returned, but got %T instead", ret)
+	}
+
+	return miners, 0, nil
+}
+
+// PublishDeal records a deal between client and miner storing the piece
+// with cid pieceRef. It must be sent by the worker of the miner, with the
+// miner's collateral for the deal as value, and carry the client's signature
+// over the deal terms and a nonce the client did not use in another deal. It
+// returns the id of the deal.
+func (sma *Actor) PublishDeal(vmctx exec.VMContext, client, minerAddr address.Address, pieceRef []byte, size *types.BytesAmount, duration *big.Int, price *types.AttoFIL, nonce *big.Int, sig []byte) (*big.Int, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	ref, err := cid.Cast(pieceRef)
+	if err != nil || !duration.IsUint64() || !size.IsPositive() || price.IsNegative() || !nonce.IsUint64() {
+		return nil, errors.CodeError(Errors[ErrInvalidDeal]), Errors[ErrInvalidDeal]
+	}
+	if !VerifyDealSignature(client, minerAddr, ref, size, duration.Uint64(), price, nonce.Uint64(), sig) {
+		return nil, errors.CodeError(Errors[ErrInvalidDealSignature]), Errors[ErrInvalidDealSignature]
+	}
+
+	ctx := context.Background()
+	var state State
+	ret, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		if err := requireMiner(ctx, vmctx.Storage(), state.Miners, minerAddr); err != nil {
+			return nil, err
+		}
+
+		worker, err := minerWorker(vmctx, minerAddr)
+		if err != nil {
+			return nil, err
+		}
+		if vmctx.Message().From != worker {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		nonceKey := dealNonceKey(client, nonce.Uint64())
+		nonces, err := actor.LoadLookup(ctx, vmctx.Storage(), state.DealNonces)
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load deal nonces with CID: %s", state.DealNonces)
+		}
+		if _, err := nonces.Find(ctx, nonceKey); err != hamt.ErrNotFound {
+			if err != nil {
+				return nil, errors.FaultErrorWrapf(err, "could not look up deal nonce %s", nonceKey)
+			}
+			return nil, Errors[ErrDealNonceUsed]
+		}
+
+		id := state.NextDealID
+		state.DealNonces, err = actor.SetKeyValue(ctx, vmctx.Storage(), state.DealNonces, nonceKey, id)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not store deal nonce")
+		}
+
+		deal := &Deal{
+			Client:      client,
+			Miner:       minerAddr,
+			PieceRef:    ref,
+			Size:        size,
+			ClientNonce: nonce.Uint64(),
+			Duration:    duration.Uint64(),
+			Price:       price,
+			Collateral:  vmctx.Message().Value,
+			State:       DealPublished,
+			Start:       types.NewBlockHeight(0),
+		}
+
+		state.Deals, err = actor.SetKeyValue(ctx, vmctx.Storage(), state.Deals, dealKey(id), deal)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not store deal")
+		}
+		state.NextDealID++
+
+		minerDeals, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.MinerDeals, []uint64{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load miner deals with CID: %s", state.MinerDeals)
+		}
+		dealIDs, err := findMinerDeals(ctx, minerDeals, minerAddr)
+		if err != nil {
+			return nil, err
+		}
+		if err := minerDeals.Set(ctx, minerAddr.String(), append(dealIDs, id)); err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not store deals of miner %s", minerAddr)
+		}
+		state.MinerDeals, err = minerDeals.Commit(ctx)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not commit miner deals")
+		}
+
+		return big.NewInt(0).SetUint64(id), nil
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	return ret.(*big.Int), 0, nil
+}
+
+// ActivateDeals is called by a miner actor committing the sector with the
+// given id, which holds the pieces of the published deals with the given
+// ids. The deals become active at the current block height.
+func (sma *Actor) ActivateDeals(vmctx exec.VMContext, sectorID uint64, dealIDs []uint64) (uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	ctx := context.Background()
+	var state State
+	_, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		minerAddr := vmctx.Message().From
+		if err := requireMiner(ctx, vmctx.Storage(), state.Miners, minerAddr); err != nil {
+			return nil, err
+		}
+
+		deals, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.Deals, &Deal{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load deals with CID: %s", state.Deals)
+		}
+
+		for _, id := range dealIDs {
+			deal, err := findDeal(ctx, deals, id)
+			if err != nil {
+				return nil, err
+			}
+			if deal.Miner != minerAddr {
+				return nil, Errors[ErrCallerUnauthorized]
+			}
+			if deal.State != DealPublished {
+				return nil, Errors[ErrInvalidDealState]
+			}
+
+			deal.State = DealActive
+			deal.SectorID = sectorID
+			deal.Start = vmctx.BlockHeight()
+			if err := deals.Set(ctx, dealKey(id), deal); err != nil {
+				return nil, errors.FaultErrorWrapf(err, "could not store deal %d", id)
+			}
+		}
+
+		state.Deals, err = deals.Commit(ctx)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not commit deals")
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// CompleteDeal marks an active deal whose duration has passed as complete
+// and returns its collateral to the owner of the miner. If the miner no
+// longer has the sector holding the piece committed, the deal fails instead
+// and its collateral is forfeited. Anyone may call it.
+func (sma *Actor) CompleteDeal(vmctx exec.VMContext, dealID *big.Int) (uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+	if !dealID.IsUint64() {
+		return errors.CodeError(Errors[ErrUnknownDeal]), Errors[ErrUnknownDeal]
+	}
+
+	ctx := context.Background()
+	var state State
+	_, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		deals, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.Deals, &Deal{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load deals with CID: %s", state.Deals)
+		}
+
+		deal, err := findDeal(ctx, deals, dealID.Uint64())
+		if err != nil {
+			return nil, err
+		}
+		end := deal.Start.Add(types.NewBlockHeight(deal.Duration))
+		if deal.State != DealActive || vmctx.BlockHeight().LessThan(end) {
+			return nil, Errors[ErrInvalidDealState]
+		}
+
+		committed, err := sectorCommitted(vmctx, deal.Miner, deal.SectorID)
+		if err != nil {
+			return nil, err
+		}
+
+		deal.State = DealComplete
+		if !committed {
+			deal.State = DealFailed
+		}
+		if err := deals.Set(ctx, dealKey(dealID.Uint64()), deal); err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not store deal %s", dealID)
+		}
+		state.Deals, err = deals.Commit(ctx)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not commit deals")
+		}
+
+		if deal.Collateral.IsPositive() {
+			to := address.NetworkAddress
+			if committed {
+				to, err = minerOwner(vmctx, deal.Miner)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if _, _, err := vmctx.Send(to, "", deal.Collateral, nil); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// FailDeals is called by a miner actor removing sectors that activated the
+// deals with the given ids. The active deals among them fail and their
+// collateral is forfeited.
+func (sma *Actor) FailDeals(vmctx exec.VMContext, dealIDs []uint64) (uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	ctx := context.Background()
+	var state State
+	_, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		minerAddr := vmctx.Message().From
+		if err := requireMiner(ctx, vmctx.Storage(), state.Miners, minerAddr); err != nil {
+			return nil, err
+		}
+
+		deals, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.Deals, &Deal{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load deals with CID: %s", state.Deals)
+		}
+
+		forfeited := types.NewZeroAttoFIL()
+		for _, id := range dealIDs {
+			deal, err := findDeal(ctx, deals, id)
+			if err != nil {
+				return nil, err
+			}
+			if deal.Miner != minerAddr {
+				return nil, Errors[ErrCallerUnauthorized]
+			}
+			if deal.State != DealActive {
+				continue
+			}
+
+			deal.State = DealFailed
+			forfeited = forfeited.Add(deal.Collateral)
+			if err := deals.Set(ctx, dealKey(id), deal); err != nil {
+				return nil, errors.FaultErrorWrapf(err, "could not store deal %d", id)
+			}
+		}
+
+		state.Deals, err = deals.Commit(ctx)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not commit deals")
+		}
+
+		if forfeited.IsPositive() {
+			if _, _, err := vmctx.Send(address.NetworkAddress, "", forfeited, nil); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// GetDeal returns the cbor encoded deal with the given id.
+func (sma *Actor) GetDeal(vmctx exec.VMContext, dealID *big.Int) ([]byte, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+	if !dealID.IsUint64() {
+		return nil, errors.CodeError(Errors[ErrUnknownDeal]), Errors[ErrUnknownDeal]
+	}
+
+	chunk, err := vmctx.ReadStorage()
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "could not read actor storage")
+	}
+	var state State
+	if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "could not unmarshal actor storage")
+	}
+
+	ctx := context.Background()
+	deals, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.Deals, &Deal{})
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrapf(err, "could not load deals with CID: %s", state.Deals)
+	}
+	deal, err := findDeal(ctx, deals, dealID.Uint64())
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	dealBytes, err := actor.MarshalStorage(deal)
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "could not marshal deal")
+	}
+
+	return dealBytes, 0, nil
+}
+
+// GetPublishedDealID returns the id of the deal the client's nonce was used
+// in, or zero if it was not used, which lets a miner find out whether its
+// publishDeal message for the deal made it to chain.
+func (sma *Actor) GetPublishedDealID(vmctx exec.VMContext, client address.Address, nonce *big.Int) (*big.Int, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+	if !nonce.IsUint64() {
+		return big.NewInt(0), 0, nil
+	}
+
+	chunk, err := vmctx.ReadStorage()
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "could not read actor storage")
+	}
+	var state State
+	if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "could not unmarshal actor storage")
+	}
+
+	ctx := context.Background()
+	nonces, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.DealNonces, uint64(0))
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrapf(err, "could not load deal nonces with CID: %s", state.DealNonces)
+	}
+	nonceKey := dealNonceKey(client, nonce.Uint64())
+	value, err := nonces.Find(ctx, nonceKey)
+	if err == hamt.ErrNotFound {
+		return big.NewInt(0), 0, nil
+	}
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrapf(err, "could not look up deal nonce %s", nonceKey)
+	}
+
+	return big.NewInt(0).SetUint64(value.(uint64)), 0, nil
+}
+
+// SignDeal returns the client's signature over the terms of a deal, which
+// the miner needs to publish the deal. The client must not sign two deals
+// with the same nonce.
+func SignDeal(client, minerAddr address.Address, pieceRef cid.Cid, size *types.BytesAmount, duration uint64, price *types.AttoFIL, nonce uint64, signer types.Signer) (types.Signature, error) {
+	data := createDealSignatureData(client, minerAddr, pieceRef, size, duration, price, nonce)
+	return signer.SignBytes(data, client)
+}
+
+// VerifyDealSignature returns whether sig is the client's signature over the
+// terms of a deal.
+func VerifyDealSignature(client, minerAddr address.Address, pieceRef cid.Cid, size *types.BytesAmount, duration uint64, price *types.AttoFIL, nonce uint64, sig []byte) bool {
+	data := createDealSignatureData(client, minerAddr, pieceRef, size, duration, price, nonce)
+	return types.IsValidSignature(data, client, sig)
+}
+
+func createDealSignatureData(client, minerAddr address.Address, pieceRef cid.Cid, size *types.BytesAmount, duration uint64, price *types.AttoFIL, nonce uint64) []byte {
+	data := append(client.Bytes(), separator)
+	data = append(data, minerAddr.Bytes()...)
+	data = append(data, separator)
+	data = append(data, pieceRef.Bytes()...)
+	data = append(data, separator)
+	data = append(data, size.Bytes()...)
+	data = append(data, separator)
+	data = append(data, strconv.FormatUint(duration, 10)...)
+	data = append(data, separator)
+	data = append(data, price.Bytes()...)
+	data = append(data, separator)
+	return append(data, strconv.FormatUint(nonce, 10)...)
+}
+
+// requireMiner returns ErrUnknownMiner unless minerAddr was created by the
+// storage market.
+func requireMiner(ctx context.Context, storage exec.Storage, miners cid.Cid, minerAddr address.Address) error {
+	lookup, err := actor.LoadLookup(ctx, storage, miners)
+	if err != nil {
+		return errors.FaultErrorWrapf(err, "could not load lookup for miner with CID: %s", miners)
+	}
+
+	_, err = lookup.Find(ctx, minerAddr.String())
+	if err != nil {
+		if err == hamt.ErrNotFound {
+			return Errors[ErrUnknownMiner]
+		}
+		return errors.FaultErrorWrapf(err, "could not load lookup for miner with address: %s", minerAddr)
+	}
+	return nil
+}
+
+// minerOwner asks the miner actor at minerAddr for its owner.
+func minerOwner(vmctx exec.VMContext, minerAddr address.Address) (address.Address, error) {
+	return minerAddress(vmctx, minerAddr, "getOwner")
+}
+
+// minerWorker asks the miner actor at minerAddr for its worker.
+func minerWorker(vmctx exec.VMContext, minerAddr address.Address) (address.Address, error) {
+	return minerAddress(vmctx, minerAddr, "getWorker")
+}
+
+// sectorCommitted asks the miner actor at minerAddr whether it has the
+// sector with the given id committed.
+func sectorCommitted(vmctx exec.VMContext, minerAddr address.Address, sectorID uint64) (bool, error) {
+	ret, code, err := vmctx.Send(minerAddr, "getSectorCommitments", nil, nil)
+	if err != nil {
+		return false, err
+	}
+	if code != 0 {
+		return false, Errors[ErrMinerCallFailed]
+	}
+
+	val, err := abi.Deserialize(ret[0], abi.CommitmentsMap)
+	if err != nil {
+		return false, errors.FaultErrorWrap(err, "could not decode sector commitments")
+	}
+	commitments, ok := val.Val.(map[string]types.Commitments)
+	if !ok {
+		return false, errors.NewFaultErrorf("expected map[string]types.Commitments but got %T", val.Val)
+	}
+	_, ok = commitments[strconv.FormatUint(sectorID, 10)]
+	return ok, nil
+}
+
+// minerAddress calls the getter method of the miner actor at minerAddr that
+// returns an address.
+func minerAddress(vmctx exec.VMContext, minerAddr address.Address, method string) (address.Address, error) {
+	ret, code, err := vmctx.Send(minerAddr, method, nil, nil)
+	if err != nil {
+		return address.Address{}, err
+	}
+	if code != 0 {
+		return address.Address{}, Errors[ErrMinerCallFailed]
+	}
+	return address.NewFromBytes(ret[0])
+}
+
+func findDeal(ctx context.Context, deals exec.Lookup, id uint64) (*Deal, error) {
+	value, err := deals.Find(ctx, dealKey(id))
+	if err != nil {
+		if err == hamt.ErrNotFound {
+			return nil, Errors[ErrUnknownDeal]
+		}
+		return nil, errors.FaultErrorWrapf(err, "could not retrieve deal %d", id)
+	}
+
+	deal, ok := value.(*Deal)
+	if !ok {
+		return nil, errors.NewFaultErrorf("expected *Deal but got %T", value)
+	}
+	return deal, nil
+}
+
+// findMinerDeals returns the ids of the deals the miner published, in the
+// order they were published.
+func findMinerDeals(ctx context.Context, minerDeals exec.Lookup, minerAddr address.Address) ([]uint64, error) {
+	value, err := minerDeals.Find(ctx, minerAddr.String())
+	if err != nil {
+		if err == hamt.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.FaultErrorWrapf(err, "could not retrieve deals of miner %s", minerAddr)
+	}
+
+	dealIDs, ok := value.([]uint64)
+	if !ok {
+		return nil, errors.NewFaultErrorf("expected []uint64 but got %T", value)
+	}
+	return dealIDs, nil
+}
+
+func dealKey(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
+
+func dealNonceKey(client address.Address, nonce uint64) string {
+	return client.String() + "/" + strconv.FormatUint(nonce, 10)
+}
+
 // MinimumCollateral returns the minimum required amount of collateral for a given pledge
 func MinimumCollateral(sectors *big.Int) *types.AttoFIL {
 	return MinimumCollateralPerSector.MulBigInt(sectors)
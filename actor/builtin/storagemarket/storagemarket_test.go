@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	"math/big"
+	"sort"
 	"testing"
 
 	"github.com/filecoin-project/go-filecoin/actor"
@@ -12,11 +13,15 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	. "github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/state"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	"github.com/filecoin-project/go-filecoin/types"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 )
 
 func TestStorageMarketCreateMiner(t *testing.T) {
@@ -53,6 +58,41 @@ func TestStorageMarketCreateMiner(t *testing.T) {
 	assert.Equal(mstor.PeerID, pid)
 }
 
+func TestStorageMarketGetMiners(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	getMiners := func() []address.Address {
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 0, "getMiners")
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		var miners []address.Address
+		require.NoError(cbor.DecodeInto(result.Receipt.Return[0], &miners))
+		return miners
+	}
+	assert.Empty(getMiners())
+
+	var created []address.Address
+	for i := 0; i < 2; i++ {
+		pdata := actor.MustConvertParams(big.NewInt(10), []byte{}, th.RequireRandomPeerID())
+		msg := types.NewMessage(address.TestAddress, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(100), "createMiner", pdata)
+		result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		addr, err := address.NewFromBytes(result.Receipt.Return[0])
+		require.NoError(err)
+		created = append(created, addr)
+	}
+
+	// miners are returned in ascending order
+	sort.Slice(created, func(i, j int) bool {
+		return created[i].String() < created[j].String()
+	})
+	assert.Equal(created, getMiners())
+}
+
 func TestStorageMarketCreateMinerPledgeTooLow(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -146,6 +186,175 @@ func TestMinimumCollateral(t *testing.T) {
 	assert.Equal(MinimumCollateral(numSectors), expected)
 }
 
+func TestStorageMarketDeals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st, vms := core.CreateStorages(ctx, t)
+
+	// a miner created at height 0 is a bootstrap miner that commits without seal proofs
+	pdata := actor.MustConvertParams(big.NewInt(10), []byte{}, th.RequireRandomPeerID())
+	msg := types.NewMessage(address.TestAddress, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(100), "createMiner", pdata)
+	result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+	require.NoError(err)
+	require.NoError(result.ExecutionError)
+	minerAddr, err := address.NewFromBytes(result.Receipt.Return[0])
+	require.NoError(err)
+
+	ki := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+	signer := types.NewMockSigner(ki)
+	client := signer.Addresses[0]
+
+	pieceRef := types.NewCidForTestGetter()()
+	size := types.NewBytesAmount(1000)
+	price := types.NewAttoFILFromFIL(10)
+	sign := func(minerAddr address.Address, nonce uint64) []byte {
+		sig, err := SignDeal(client, minerAddr, pieceRef, size, 20, price, nonce, signer)
+		require.NoError(err)
+		return sig
+	}
+	sig := sign(minerAddr, 1)
+
+	publish := func(from, minerAddr address.Address, nonce uint64, sig []byte) *big.Int {
+		pdata := actor.MustConvertParams(client, minerAddr, pieceRef.Bytes(), size, big.NewInt(20), price, big.NewInt(0).SetUint64(nonce), sig)
+		msg := types.NewMessage(from, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(5), "publishDeal", pdata)
+		result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(1))
+		require.NoError(err)
+		if result.Receipt.ExitCode != 0 {
+			return big.NewInt(int64(result.Receipt.ExitCode))
+		}
+		return big.NewInt(0).SetBytes(result.Receipt.Return[0])
+	}
+
+	getDeal := func(dealID uint64) *Deal {
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 1, "getDeal", big.NewInt(0).SetUint64(dealID))
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		var deal Deal
+		require.NoError(cbor.DecodeInto(result.Receipt.Return[0], &deal))
+		return &deal
+	}
+
+	commit := func(sectorID, height, dealID uint64) *consensus.ApplicationResult {
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, height, "commitSector",
+			sectorID, th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{dealID})
+		require.NoError(err)
+		return result
+	}
+
+	t.Run("publishing requires the client's signature", func(t *testing.T) {
+		assert.Equal(big.NewInt(ErrInvalidDealSignature), publish(address.TestAddress, minerAddr, 1, []byte("bad signature")))
+
+		// the signature covers the nonce
+		assert.Equal(big.NewInt(ErrInvalidDealSignature), publish(address.TestAddress, minerAddr, 2, sig))
+	})
+
+	t.Run("publishing requires the miner worker", func(t *testing.T) {
+		assert.Equal(big.NewInt(ErrCallerUnauthorized), publish(address.TestAddress2, minerAddr, 1, sig))
+	})
+
+	t.Run("publishing requires a known miner", func(t *testing.T) {
+		otherMiner := address.NewForTestGetter()()
+		assert.Equal(big.NewInt(ErrUnknownMiner), publish(address.TestAddress, otherMiner, 1, sign(otherMiner, 1)))
+	})
+
+	t.Run("a published deal is activated by committing its sector and completed after its duration", func(t *testing.T) {
+		dealID := publish(address.TestAddress, minerAddr, 1, sig).Uint64()
+		assert.Equal(uint64(1), dealID)
+
+		deal := getDeal(dealID)
+		assert.Equal(DealPublished, deal.State)
+		assert.Equal(client, deal.Client)
+		assert.Equal(minerAddr, deal.Miner)
+		assert.Equal(pieceRef, deal.PieceRef)
+		assert.Equal(types.NewAttoFILFromFIL(5), deal.Collateral)
+
+		result := commit(1, 3, dealID)
+		require.NoError(result.ExecutionError)
+
+		deal = getDeal(dealID)
+		assert.Equal(DealActive, deal.State)
+		assert.Equal(uint64(1), deal.SectorID)
+		assert.Equal(types.NewBlockHeight(3), deal.Start)
+
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 22, "completeDeal", big.NewInt(0).SetUint64(dealID))
+		require.NoError(err)
+		assert.Equal(uint8(ErrInvalidDealState), result.Receipt.ExitCode)
+
+		ownerBalance := state.MustGetActor(st, address.TestAddress).Balance
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 23, "completeDeal", big.NewInt(0).SetUint64(dealID))
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		assert.Equal(DealComplete, getDeal(dealID).State)
+		assert.Equal(ownerBalance.Add(types.NewAttoFILFromFIL(5)), state.MustGetActor(st, address.TestAddress).Balance)
+	})
+
+	t.Run("a client nonce cannot be used twice", func(t *testing.T) {
+		assert.Equal(big.NewInt(ErrDealNonceUsed), publish(address.TestAddress, minerAddr, 1, sig))
+
+		// the deal the nonce was used in can be looked up
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 1, "getPublishedDealID", client, big.NewInt(1))
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		assert.Equal(big.NewInt(1), big.NewInt(0).SetBytes(result.Receipt.Return[0]))
+
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 1, "getPublishedDealID", client, big.NewInt(2))
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		assert.Equal(big.NewInt(0), big.NewInt(0).SetBytes(result.Receipt.Return[0]))
+	})
+
+	t.Run("only a published deal can be activated", func(t *testing.T) {
+		result := commit(2, 4, 1)
+		assert.Equal(uint8(miner.ErrStoragemarketCallFailed), result.Receipt.ExitCode)
+		assert.Equal(DealComplete, getDeal(1).State)
+	})
+
+	t.Run("a deal whose sector is removed fails and forfeits its collateral", func(t *testing.T) {
+		dealID := publish(address.TestAddress, minerAddr, 2, sign(minerAddr, 2)).Uint64()
+		result := commit(3, 5, dealID)
+		require.NoError(result.ExecutionError)
+		marketBalance := state.MustGetActor(st, address.StorageMarketAddress).Balance
+
+		// the miner misses enough PoSts to have its sectors removed
+		periodStart := types.NewBlockHeight(3)
+		for i := 0; i < miner.MaxMissedPoSts; i++ {
+			periodStart = periodStart.Add(miner.ProvingPeriodBlocks)
+			height := periodStart.Add(miner.GracePeriodBlocks).Add(types.NewBlockHeight(1))
+			result, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, height.AsBigInt().Uint64(), "reportMissedPoSt")
+			require.NoError(err)
+			require.NoError(result.ExecutionError)
+		}
+
+		assert.Equal(DealFailed, getDeal(dealID).State)
+		assert.Equal(marketBalance.Sub(types.NewAttoFILFromFIL(5)), state.MustGetActor(st, address.StorageMarketAddress).Balance)
+
+		// the completed deal of the removed sector is left alone
+		assert.Equal(DealComplete, getDeal(1).State)
+
+		height := periodStart.Add(miner.ProvingPeriodBlocks).AsBigInt().Uint64()
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, height, "completeDeal", big.NewInt(0).SetUint64(dealID))
+		require.NoError(err)
+		assert.Equal(uint8(ErrInvalidDealState), result.Receipt.ExitCode)
+	})
+
+	t.Run("an exiting miner forfeits the collateral of the deals it did not activate", func(t *testing.T) {
+		dealID := publish(address.TestAddress, minerAddr, 3, sign(minerAddr, 3)).Uint64()
+		require.Equal(DealPublished, getDeal(dealID).State)
+		marketBalance := state.MustGetActor(st, address.StorageMarketAddress).Balance
+
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 100000, "exit")
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		assert.Equal(DealFailed, getDeal(dealID).State)
+		assert.Equal(marketBalance.Sub(types.NewAttoFILFromFIL(5)), state.MustGetActor(st, address.StorageMarketAddress).Balance)
+	})
+}
+
 // this is used to simulate an attack where someone derives the likely address of another miner's
 // minerActor and sends some FIL. If that FIL creates an actor tha cannot be upgraded to a miner
 // actor, this action will block the other user. Another possibility is that the miner actor will
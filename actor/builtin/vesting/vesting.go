@@ -0,0 +1,249 @@
+package vesting
+
+import (
+	"math/big"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+const (
+	// ErrCallerUnauthorized indicates a caller other than the beneficiary.
+	ErrCallerUnauthorized = 33
+	// ErrInsufficientVested indicates a withdrawal of more than has vested.
+	ErrInsufficientVested = 34
+	// ErrInvalidAmount indicates a negative withdrawal.
+	ErrInvalidAmount = 35
+)
+
+// Errors map error codes to revert errors this actor may return.
+var Errors = map[uint8]error{
+	ErrCallerUnauthorized: errors.NewCodedRevertError(ErrCallerUnauthorized, "only the beneficiary may withdraw"),
+	ErrInsufficientVested: errors.NewCodedRevertError(ErrInsufficientVested, "amount exceeds the vested balance"),
+	ErrInvalidAmount:      errors.NewCodedRevertError(ErrInvalidAmount, "amount must not be negative"),
+}
+
+func init() {
+	cbor.RegisterCborType(State{})
+}
+
+// State is the vesting actor's storage. It describes a schedule releasing
+// Total to the beneficiary between Start and Start+Duration.
+type State struct {
+	// Beneficiary is the only address funds can be withdrawn to.
+	Beneficiary address.Address
+
+	// Total is the amount locked at Start.
+	Total *types.AttoFIL
+
+	// Start is the block height at which vesting starts.
+	Start *types.BlockHeight
+
+	// Duration is the number of blocks after Start at which Total has
+	// fully vested.
+	Duration uint64
+
+	// Step is the number of blocks between releases. Funds vest linearly,
+	// block by block, if it is zero or one and in equal steps otherwise.
+	Step uint64
+}
+
+// NewState returns the state of a vesting actor releasing total to
+// beneficiary over duration blocks after start, step blocks at a time.
+func NewState(beneficiary address.Address, total *types.AttoFIL, start *types.BlockHeight, duration, step uint64) *State {
+	return &State{
+		Beneficiary: beneficiary,
+		Total:       total,
+		Start:       start,
+		Duration:    duration,
+		Step:        step,
+	}
+}
+
+// Vested returns the amount that has vested at block height h.
+func (s *State) Vested(h *types.BlockHeight) *types.AttoFIL {
+	if h.LessThan(s.Start) {
+		return types.NewZeroAttoFIL()
+	}
+
+	elapsed := h.Sub(s.Start).AsBigInt()
+	duration := big.NewInt(0).SetUint64(s.Duration)
+	if elapsed.Cmp(duration) >= 0 {
+		return s.Total
+	}
+	if s.Step > 1 {
+		step := big.NewInt(0).SetUint64(s.Step)
+		elapsed.Sub(elapsed, big.NewInt(0).Mod(elapsed, step))
+	}
+
+	return s.Total.MulBigInt(elapsed).DivBigInt(duration)
+}
+
+// Withdrawable returns the amount the beneficiary may withdraw at block
+// height h from an actor holding balance: all of it but the part of Total
+// that has not vested yet. Funds sent to the actor on top of Total are never
+// locked.
+func (s *State) Withdrawable(h *types.BlockHeight, balance *types.AttoFIL) *types.AttoFIL {
+	locked := s.Total.Sub(s.Vested(h))
+	if balance.LessThan(locked) {
+		return types.NewZeroAttoFIL()
+	}
+	return balance.Sub(locked)
+}
+
+// Actor holds a balance that is released to a beneficiary over time.
+// Vesting actors are created in the genesis block, funded with the Total of
+// their schedule.
+type Actor struct{}
+
+// NewActor returns a new vesting actor holding balance.
+func NewActor(balance *types.AttoFIL) *actor.Actor {
+	return actor.NewActor(types.VestingActorCodeCid, balance)
+}
+
+// InitializeState stores the vesting schedule given as a *State.
+func (va *Actor) InitializeState(storage exec.Storage, initializerData interface{}) error {
+	state, ok := initializerData.(*State)
+	if !ok {
+		return errors.NewFaultError("Initial state to vesting actor is not a vesting.State struct")
+	}
+	if state.Total.IsNegative() {
+		return errors.NewFaultError("vesting total must not be negative")
+	}
+
+	stateBytes, err := cbor.DumpObject(state)
+	if err != nil {
+		return errors.FaultErrorWrap(err, "failed to cbor marshal object")
+	}
+
+	id, err := storage.Put(stateBytes)
+	if err != nil {
+		return err
+	}
+
+	return storage.Commit(id, cid.Undef)
+}
+
+var _ exec.ExecutableActor = (*Actor)(nil)
+
+// Exports returns the actor's exports.
+func (va *Actor) Exports() exec.Exports {
+	return vestingExports
+}
+
+var vestingExports = exec.Exports{
+	"getBeneficiary": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.Address},
+	},
+	"getVested": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.AttoFIL},
+	},
+	"getWithdrawable": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.AttoFIL},
+	},
+	"withdraw": &exec.FunctionSignature{
+		Params: []abi.Type{abi.AttoFIL},
+		Return: nil,
+	},
+}
+
+// Withdraw sends amount to the beneficiary, who must be the caller. It fails
+// if amount exceeds the actor's balance less what has not vested yet at the
+// current block height.
+func (va *Actor) Withdraw(vmctx exec.VMContext, amount *types.AttoFIL) (uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	if amount.IsNegative() {
+		return errors.CodeError(Errors[ErrInvalidAmount]), Errors[ErrInvalidAmount]
+	}
+
+	state, err := readState(vmctx)
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+	if vmctx.Message().From != state.Beneficiary {
+		return errors.CodeError(Errors[ErrCallerUnauthorized]), Errors[ErrCallerUnauthorized]
+	}
+	// What has been withdrawn already has left the balance, so the balance
+	// alone tells what is left to withdraw.
+	if state.Withdrawable(vmctx.BlockHeight(), vmctx.MyBalance()).LessThan(amount) {
+		return errors.CodeError(Errors[ErrInsufficientVested]), Errors[ErrInsufficientVested]
+	}
+
+	if _, _, err := vmctx.Send(state.Beneficiary, "", amount, nil); err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// GetBeneficiary returns the address funds are released to.
+func (va *Actor) GetBeneficiary(vmctx exec.VMContext) (address.Address, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return address.Address{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	state, err := readState(vmctx)
+	if err != nil {
+		return address.Address{}, errors.CodeError(err), err
+	}
+
+	return state.Beneficiary, 0, nil
+}
+
+// GetVested returns the amount that has vested at the current block height,
+// including what has been withdrawn.
+func (va *Actor) GetVested(vmctx exec.VMContext) (*types.AttoFIL, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	state, err := readState(vmctx)
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	return state.Vested(vmctx.BlockHeight()), 0, nil
+}
+
+// GetWithdrawable returns the amount the beneficiary may withdraw at the
+// current block height, including funds sent to the actor on top of its
+// Total.
+func (va *Actor) GetWithdrawable(vmctx exec.VMContext) (*types.AttoFIL, uint8, error) {
+	if err := vmctx.ChargeOp(exec.GasOpMethodCall, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	state, err := readState(vmctx)
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	return state.Withdrawable(vmctx.BlockHeight(), vmctx.MyBalance()), 0, nil
+}
+
+func readState(vmctx exec.VMContext) (*State, error) {
+	chunk, err := vmctx.ReadStorage()
+	if err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not read actor storage")
+	}
+
+	var state State
+	if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not unmarshal actor storage")
+	}
+
+	return &state, nil
+}
@@ -0,0 +1,168 @@
+package vesting_test
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	. "github.com/filecoin-project/go-filecoin/actor/builtin/vesting"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+func TestVested(t *testing.T) {
+	assert := assert.New(t)
+	beneficiary := address.NewForTestGetter()()
+
+	t.Run("linear", func(t *testing.T) {
+		s := NewState(beneficiary, types.NewAttoFILFromFIL(1000), types.NewBlockHeight(100), 100, 0)
+
+		assert.True(s.Vested(types.NewBlockHeight(50)).IsZero())
+		assert.True(s.Vested(types.NewBlockHeight(100)).IsZero())
+		assert.Equal(types.NewAttoFILFromFIL(10), s.Vested(types.NewBlockHeight(101)))
+		assert.Equal(types.NewAttoFILFromFIL(550), s.Vested(types.NewBlockHeight(155)))
+		assert.Equal(types.NewAttoFILFromFIL(1000), s.Vested(types.NewBlockHeight(200)))
+		assert.Equal(types.NewAttoFILFromFIL(1000), s.Vested(types.NewBlockHeight(1000)))
+	})
+
+	t.Run("in steps", func(t *testing.T) {
+		s := NewState(beneficiary, types.NewAttoFILFromFIL(1000), types.NewBlockHeight(100), 100, 25)
+
+		assert.True(s.Vested(types.NewBlockHeight(124)).IsZero())
+		assert.Equal(types.NewAttoFILFromFIL(250), s.Vested(types.NewBlockHeight(125)))
+		assert.Equal(types.NewAttoFILFromFIL(500), s.Vested(types.NewBlockHeight(174)))
+		assert.Equal(types.NewAttoFILFromFIL(1000), s.Vested(types.NewBlockHeight(200)))
+	})
+
+	t.Run("without duration", func(t *testing.T) {
+		s := NewState(beneficiary, types.NewAttoFILFromFIL(1000), types.NewBlockHeight(100), 0, 0)
+
+		assert.True(s.Vested(types.NewBlockHeight(99)).IsZero())
+		assert.Equal(types.NewAttoFILFromFIL(1000), s.Vested(types.NewBlockHeight(100)))
+	})
+}
+
+func TestWithdraw(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	vms := vm.NewStorageMap(bs)
+	cst := hamt.NewCborStore()
+	blk, err := consensus.DefaultGenesis(cst, bs)
+	require.NoError(err)
+	st, err := state.LoadStateTree(ctx, cst, blk.StateRoot, builtin.Actors)
+	require.NoError(err)
+
+	addrGetter := address.NewForTestGetter()
+	beneficiary, outsider, vestingAddr := addrGetter(), addrGetter(), addrGetter()
+	state.MustSetActor(st, beneficiary, th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(100)))
+	state.MustSetActor(st, outsider, th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(100)))
+
+	total := types.NewAttoFILFromFIL(1000)
+	act := NewActor(total)
+	initState := NewState(beneficiary, total, types.NewBlockHeight(10), 100, 10)
+	require.NoError((&Actor{}).InitializeState(vms.NewStorage(vestingAddr, act), initState))
+	state.MustSetActor(st, vestingAddr, act)
+
+	withdraw := func(from address.Address, amount *types.AttoFIL, height uint64) *consensus.ApplicationResult {
+		msg := types.NewMessage(from, vestingAddr, core.MustGetNonce(st, from), types.NewZeroAttoFIL(), "withdraw", core.MustConvertParams(amount))
+		result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(height))
+		require.NoError(err)
+		return result
+	}
+
+	query := func(method string, height uint64) *types.AttoFIL {
+		values, ec, err := consensus.CallQueryMethod(ctx, st, vms, vestingAddr, method, nil, outsider, types.NewBlockHeight(height))
+		require.NoError(err)
+		require.Zero(ec)
+		return types.NewAttoFILFromBytes(values[0])
+	}
+
+	t.Run("nothing is withdrawable before a step vests", func(t *testing.T) {
+		assert.True(query("getWithdrawable", 19).IsZero())
+
+		result := withdraw(beneficiary, types.NewAttoFILFromFIL(1), 19)
+		assert.Equal(uint8(ErrInsufficientVested), result.Receipt.ExitCode)
+	})
+
+	t.Run("only the beneficiary withdraws", func(t *testing.T) {
+		result := withdraw(outsider, types.NewAttoFILFromFIL(1), 50)
+		assert.Equal(uint8(ErrCallerUnauthorized), result.Receipt.ExitCode)
+	})
+
+	t.Run("the beneficiary withdraws vested funds", func(t *testing.T) {
+		assert.Equal(types.NewAttoFILFromFIL(400), query("getVested", 50))
+
+		result := withdraw(beneficiary, types.NewAttoFILFromFIL(300), 50)
+		require.NoError(result.ExecutionError)
+		assert.Equal(types.NewAttoFILFromFIL(400), state.MustGetActor(st, beneficiary).Balance)
+		assert.Equal(types.NewAttoFILFromFIL(700), state.MustGetActor(st, vestingAddr).Balance)
+		assert.Equal(types.NewAttoFILFromFIL(100), query("getWithdrawable", 50))
+
+		result = withdraw(beneficiary, types.NewAttoFILFromFIL(101), 50)
+		assert.Equal(uint8(ErrInsufficientVested), result.Receipt.ExitCode)
+	})
+
+	t.Run("everything is withdrawable once vested", func(t *testing.T) {
+		assert.Equal(types.NewAttoFILFromFIL(700), query("getWithdrawable", 110))
+
+		result := withdraw(beneficiary, types.NewAttoFILFromFIL(700), 110)
+		require.NoError(result.ExecutionError)
+		assert.True(state.MustGetActor(st, vestingAddr).Balance.IsZero())
+	})
+}
+
+func TestWithdrawFundsAboveTotal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	vms := vm.NewStorageMap(bs)
+	cst := hamt.NewCborStore()
+	blk, err := consensus.DefaultGenesis(cst, bs)
+	require.NoError(err)
+	st, err := state.LoadStateTree(ctx, cst, blk.StateRoot, builtin.Actors)
+	require.NoError(err)
+
+	addrGetter := address.NewForTestGetter()
+	beneficiary, sender, vestingAddr := addrGetter(), addrGetter(), addrGetter()
+	state.MustSetActor(st, beneficiary, th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(0)))
+	state.MustSetActor(st, sender, th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(100)))
+
+	total := types.NewAttoFILFromFIL(1000)
+	act := NewActor(total)
+	require.NoError((&Actor{}).InitializeState(vms.NewStorage(vestingAddr, act), NewState(beneficiary, total, types.NewBlockHeight(10), 100, 0)))
+	state.MustSetActor(st, vestingAddr, act)
+
+	// Funds sent to the actor on top of its total are not locked.
+	msg := types.NewMessage(sender, vestingAddr, 0, types.NewAttoFILFromFIL(50), "", nil)
+	result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(5))
+	require.NoError(err)
+	require.NoError(result.ExecutionError)
+
+	msg = types.NewMessage(beneficiary, vestingAddr, 0, types.NewZeroAttoFIL(), "withdraw", core.MustConvertParams(types.NewAttoFILFromFIL(50)))
+	result, err = th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(5))
+	require.NoError(err)
+	require.NoError(result.ExecutionError)
+	assert.Equal(types.NewAttoFILFromFIL(50), state.MustGetActor(st, beneficiary).Balance)
+
+	// The rest still vests on schedule.
+	msg = types.NewMessage(beneficiary, vestingAddr, 1, types.NewZeroAttoFIL(), "withdraw", core.MustConvertParams(types.NewAttoFILFromFIL(1)))
+	result, err = th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(5))
+	require.NoError(err)
+	assert.Equal(uint8(ErrInsufficientVested), result.Receipt.ExitCode)
+}
@@ -74,6 +74,10 @@ var FakeActorExports = exec.Exports{
 		Params: nil,
 		Return: nil,
 	},
+	"ignoreRevertedSend": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: nil,
+	},
 }
 
 // InitializeState stores this actors
@@ -217,6 +221,13 @@ func (ma *FakeActor) BlockLimitTestMethod(ctx exec.VMContext) (uint8, error) {
 	return 0, nil
 }
 
+// IgnoreRevertedSend sends 100 to the given address along with a call to
+// returnRevertError, and succeeds whatever the outcome of the send.
+func (ma *FakeActor) IgnoreRevertedSend(ctx exec.VMContext, target address.Address) (uint8, error) {
+	ctx.Send(target, "returnRevertError", types.NewAttoFILFromFIL(100), nil) // nolint: errcheck
+	return 0, nil
+}
+
 // MustConvertParams encodes the given params and panics if it fails to do so.
 func MustConvertParams(params ...interface{}) []byte {
 	vals, err := abi.ToValues(params)
@@ -42,6 +42,12 @@ var (
 	StorageMarketAddress Address
 	// PaymentBrokerAddress is the hard-coded address of the filecoin storage market
 	PaymentBrokerAddress Address
+	// MultisigAddress is the hard-coded address of the filecoin actor creating
+	// multisig wallets
+	MultisigAddress Address
+	// GasScheduleAddress is the hard-coded address of the gas schedule actor
+	// holding the gas schedule configured in the genesis block
+	GasScheduleAddress Address
 )
 
 func init() {
@@ -59,4 +65,10 @@ func init() {
 
 	p := Hash([]byte("payments"))
 	PaymentBrokerAddress = NewMainnet(p)
+
+	m := Hash([]byte("multisig"))
+	MultisigAddress = NewMainnet(m)
+
+	g := Hash([]byte("gas"))
+	GasScheduleAddress = NewMainnet(g)
 }
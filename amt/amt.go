@@ -0,0 +1,193 @@
+// Package amt implements an array mapped trie: an immutable, merkleized array
+// stored as a tree of IPLD nodes. Any element can be proven to be part of the
+// array given its root CID and the nodes on the path from the root to it.
+package amt
+
+import (
+	"context"
+	"fmt"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+)
+
+func init() {
+	cbor.RegisterCborType(node{})
+}
+
+// Width is the number of values held by a leaf and the number of children of
+// an interior node.
+const Width = 8
+
+// node is a node of the trie. Leaves (height 0) hold cbor encoded values,
+// interior nodes hold links to the nodes one level down. Count is the number
+// of values in the subtree rooted at the node.
+type node struct {
+	Height uint64
+	Count  uint64
+	Links  []cid.Cid
+	Values [][]byte
+}
+
+// Proof is an inclusion proof for a single value of an array. It holds the
+// raw bytes of the nodes on the path from the root to the leaf holding the
+// value, root first.
+type Proof struct {
+	Nodes [][]byte `json:"nodes"`
+}
+
+// Build stores each of values in a new array and returns the CID of its root.
+// Values must be cbor encodable. The empty array has a root too.
+func Build(ctx context.Context, cst *hamt.CborIpldStore, values []interface{}) (cid.Cid, error) {
+	level := []*node{}
+	for i := 0; i < len(values); i += Width {
+		leaf := &node{}
+		for _, v := range values[i:min(i+Width, len(values))] {
+			raw, err := cbor.DumpObject(v)
+			if err != nil {
+				return cid.Undef, errors.Wrapf(err, "failed to encode value %d", i+len(leaf.Values))
+			}
+			leaf.Values = append(leaf.Values, raw)
+			leaf.Count++
+		}
+		level = append(level, leaf)
+	}
+	if len(level) == 0 {
+		level = append(level, &node{})
+	}
+
+	for len(level) > 1 {
+		var parents []*node
+		for i := 0; i < len(level); i += Width {
+			parent := &node{Height: level[i].Height + 1}
+			for _, child := range level[i:min(i+Width, len(level))] {
+				c, err := cst.Put(ctx, child)
+				if err != nil {
+					return cid.Undef, errors.Wrap(err, "failed to store node")
+				}
+				parent.Links = append(parent.Links, c)
+				parent.Count += child.Count
+			}
+			parents = append(parents, parent)
+		}
+		level = parents
+	}
+
+	return cst.Put(ctx, level[0])
+}
+
+// Load returns the cbor encoded values of the array rooted at root, in order.
+func Load(ctx context.Context, cst *hamt.CborIpldStore, root cid.Cid) ([][]byte, error) {
+	var n node
+	if err := cst.Get(ctx, root, &n); err != nil {
+		return nil, errors.Wrapf(err, "failed to load node %s", root)
+	}
+	if n.Height == 0 {
+		return n.Values, nil
+	}
+
+	values := make([][]byte, 0, n.Count)
+	for _, link := range n.Links {
+		vs, err := Load(ctx, cst, link)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, vs...)
+	}
+	return values, nil
+}
+
+// Prove returns a proof that the value at index is part of the array rooted
+// at root, along with the cbor encoded value.
+func Prove(ctx context.Context, cst *hamt.CborIpldStore, root cid.Cid, index uint64) ([]byte, *Proof, error) {
+	proof := &Proof{}
+	c := root
+	for {
+		blk, err := cst.Blocks.GetBlock(ctx, c)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to load node %s", c)
+		}
+		proof.Nodes = append(proof.Nodes, blk.RawData())
+
+		var n node
+		if err := cbor.DecodeInto(blk.RawData(), &n); err != nil {
+			return nil, nil, errors.Wrapf(err, "malformed node %s", c)
+		}
+		next, value, err := step(&n, &index)
+		if err != nil {
+			return nil, nil, err
+		}
+		if next == cid.Undef {
+			return value, proof, nil
+		}
+		c = next
+	}
+}
+
+// Verify checks that proof proves a value to be at index in the array rooted
+// at root and returns that value. It needs nothing but its arguments.
+func Verify(root cid.Cid, index uint64, proof *Proof) ([]byte, error) {
+	expected := root
+	for i, raw := range proof.Nodes {
+		c, err := root.Prefix().Sum(raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to hash proof node")
+		}
+		if !c.Equals(expected) {
+			return nil, fmt.Errorf("proof node %d has cid %s, expected %s", i, c, expected)
+		}
+
+		var n node
+		if err := cbor.DecodeInto(raw, &n); err != nil {
+			return nil, errors.Wrapf(err, "malformed proof node %d", i)
+		}
+		next, value, err := step(&n, &index)
+		if err != nil {
+			return nil, err
+		}
+		if next == cid.Undef {
+			if i != len(proof.Nodes)-1 {
+				return nil, fmt.Errorf("proof has %d extra nodes", len(proof.Nodes)-1-i)
+			}
+			return value, nil
+		}
+		expected = next
+	}
+	return nil, fmt.Errorf("proof ends before reaching a leaf")
+}
+
+// step descends from n towards the value at *index, where *index is relative
+// to the first value under n. It returns either the link to follow, having
+// made *index relative to the linked node, or, at a leaf, the value itself.
+func step(n *node, index *uint64) (cid.Cid, []byte, error) {
+	if *index >= n.Count {
+		return cid.Undef, nil, fmt.Errorf("index %d out of range for a node of %d values", *index, n.Count)
+	}
+	if n.Height == 0 {
+		if *index >= uint64(len(n.Values)) {
+			return cid.Undef, nil, fmt.Errorf("malformed leaf: count %d but %d values", n.Count, len(n.Values))
+		}
+		return cid.Undef, n.Values[*index], nil
+	}
+
+	// Every subtree but the last is full.
+	span := uint64(1)
+	for i := uint64(0); i < n.Height; i++ {
+		span *= Width
+	}
+	child := *index / span
+	if child >= uint64(len(n.Links)) {
+		return cid.Undef, nil, fmt.Errorf("malformed node: no child %d", child)
+	}
+	*index %= span
+	return n.Links[child], nil, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
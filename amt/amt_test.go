@@ -0,0 +1,113 @@
+package amt
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+)
+
+func testValues(n int) []interface{} {
+	var values []interface{}
+	for i := 0; i < n; i++ {
+		values = append(values, string(rune('a'+i%26))+string(rune('a'+i/26)))
+	}
+	return values
+}
+
+func TestBuildAndLoad(t *testing.T) {
+	ctx := context.Background()
+
+	for _, n := range []int{0, 1, Width, Width + 1, Width*Width + 3} {
+		assert := assert.New(t)
+		require := require.New(t)
+		cst := hamt.NewCborStore()
+
+		values := testValues(n)
+		root, err := Build(ctx, cst, values)
+		require.NoError(err)
+
+		raw, err := Load(ctx, cst, root)
+		require.NoError(err)
+		require.Len(raw, n)
+		for i, r := range raw {
+			var s string
+			require.NoError(cbor.DecodeInto(r, &s))
+			assert.Equal(values[i], s)
+		}
+
+		// The root only depends on the values.
+		again, err := Build(ctx, cst, values)
+		require.NoError(err)
+		assert.True(root.Equals(again))
+	}
+}
+
+func TestProveAndVerify(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+
+	values := testValues(Width*Width + 3)
+	root, err := Build(ctx, cst, values)
+	require.NoError(err)
+
+	t.Run("every value can be proven", func(t *testing.T) {
+		for i := range values {
+			value, proof, err := Prove(ctx, cst, root, uint64(i))
+			require.NoError(err)
+			assert.Len(proof.Nodes, 3)
+
+			verified, err := Verify(root, uint64(i), proof)
+			require.NoError(err)
+			assert.Equal(value, verified)
+
+			var s string
+			require.NoError(cbor.DecodeInto(verified, &s))
+			assert.Equal(values[i], s)
+		}
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		_, _, err := Prove(ctx, cst, root, uint64(len(values)))
+		assert.Error(err)
+	})
+
+	t.Run("proof for another index", func(t *testing.T) {
+		_, proof, err := Prove(ctx, cst, root, 0)
+		require.NoError(err)
+		_, err = Verify(root, Width, proof)
+		assert.Error(err)
+	})
+
+	t.Run("proof against another root", func(t *testing.T) {
+		other, err := Build(ctx, cst, values[1:])
+		require.NoError(err)
+		_, proof, err := Prove(ctx, cst, root, 0)
+		require.NoError(err)
+		_, err = Verify(other, 0, proof)
+		assert.Error(err)
+	})
+
+	t.Run("tampered proof", func(t *testing.T) {
+		_, proof, err := Prove(ctx, cst, root, 0)
+		require.NoError(err)
+		leaf := append([]byte{}, proof.Nodes[len(proof.Nodes)-1]...)
+		leaf[len(leaf)-1] ^= 0xff
+		proof.Nodes[len(proof.Nodes)-1] = leaf
+		_, err = Verify(root, 0, proof)
+		assert.Error(err)
+	})
+
+	t.Run("truncated proof", func(t *testing.T) {
+		_, proof, err := Prove(ctx, cst, root, 0)
+		require.NoError(err)
+		proof.Nodes = proof.Nodes[:len(proof.Nodes)-1]
+		_, err = Verify(root, 0, proof)
+		assert.Error(err)
+	})
+}
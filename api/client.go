@@ -28,8 +28,11 @@ type Ask struct {
 type Client interface {
 	Cat(ctx context.Context, c cid.Cid) (uio.DagReader, error)
 	ImportData(ctx context.Context, data io.Reader) (ipld.Node, error)
-	ProposeStorageDeal(ctx context.Context, data cid.Cid, miner address.Address, ask uint64, duration uint64, allowDuplicates bool) (*storagedeal.Response, error)
+	ProposeStorageDeal(ctx context.Context, data cid.Cid, miner address.Address, ask uint64, duration uint64, transferMode storagedeal.TransferMode, allowDuplicates bool) (*storagedeal.Response, error)
 	QueryStorageDeal(ctx context.Context, prop cid.Cid) (*storagedeal.Response, error)
+	StoreData(ctx context.Context, data cid.Cid, replicas uint64, maxPrice *types.AttoFIL, duration uint64) (*storagedeal.Replication, error)
+	QueryReplication(ctx context.Context, data cid.Cid) (*storagedeal.Replication, error)
+	WatchStorageDeal(ctx context.Context, prop cid.Cid) (<-chan *storagedeal.Event, error)
 	ListAsks(ctx context.Context) (<-chan Ask, error)
 	Payments(ctx context.Context, dealCid cid.Cid) ([]*paymentbroker.PaymentVoucher, error)
 }
@@ -7,9 +7,12 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/multisig"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/vesting"
 	"github.com/filecoin-project/go-filecoin/api"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/node"
@@ -53,6 +56,14 @@ func ls(ctx context.Context, fcn *node.Node, actorGetter state.GetAllActorsFunc)
 			res[i] = makeActorView(a, addrs[i], &miner.Actor{})
 		case a.Code.Equals(types.BootstrapMinerActorCodeCid):
 			res[i] = makeActorView(a, addrs[i], &miner.Actor{})
+		case a.Code.Equals(types.MultisigActorCodeCid):
+			res[i] = makeActorView(a, addrs[i], &multisig.Actor{})
+		case a.Code.Equals(types.MultisigFactoryActorCodeCid):
+			res[i] = makeActorView(a, addrs[i], &multisig.Factory{})
+		case a.Code.Equals(types.VestingActorCodeCid):
+			res[i] = makeActorView(a, addrs[i], &vesting.Actor{})
+		case a.Code.Equals(types.GasScheduleActorCodeCid):
+			res[i] = makeActorView(a, addrs[i], &gasschedule.Actor{})
 		default:
 			res[i] = makeActorView(a, addrs[i], nil)
 		}
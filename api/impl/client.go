@@ -60,17 +60,38 @@ func (api *nodeClient) ImportData(ctx context.Context, data io.Reader) (ipld.Nod
 	if err != nil {
 		return nil, err
 	}
-	return nd, bufds.Commit()
+	if err := bufds.Commit(); err != nil {
+		return nil, err
+	}
+
+	// the piece commitment is computed once, at import, for the deals storing
+	// the data. Proposing a deal computes it if this fails.
+	if _, err := api.api.node.StorageMinerClient.ImportPiece(ctx, nd.Cid()); err != nil {
+		api.api.logger.Warningf("failed to record the piece commitment of %s: %s", nd.Cid(), err)
+	}
+	return nd, nil
 }
 
-func (api *nodeClient) ProposeStorageDeal(ctx context.Context, data cid.Cid, miner address.Address, askid uint64, duration uint64, allowDuplicates bool) (*storagedeal.Response, error) {
-	return api.api.node.StorageMinerClient.ProposeDeal(ctx, miner, data, askid, duration, allowDuplicates)
+func (api *nodeClient) ProposeStorageDeal(ctx context.Context, data cid.Cid, miner address.Address, askid uint64, duration uint64, transferMode storagedeal.TransferMode, allowDuplicates bool) (*storagedeal.Response, error) {
+	return api.api.node.StorageMinerClient.ProposeDeal(ctx, miner, data, askid, duration, transferMode, allowDuplicates)
 }
 
 func (api *nodeClient) QueryStorageDeal(ctx context.Context, prop cid.Cid) (*storagedeal.Response, error) {
 	return api.api.node.StorageMinerClient.QueryDeal(ctx, prop)
 }
 
+func (api *nodeClient) StoreData(ctx context.Context, data cid.Cid, replicas uint64, maxPrice *types.AttoFIL, duration uint64) (*storagedeal.Replication, error) {
+	return api.api.node.StorageMinerClient.Store(ctx, data, replicas, maxPrice, duration)
+}
+
+func (api *nodeClient) QueryReplication(ctx context.Context, data cid.Cid) (*storagedeal.Replication, error) {
+	return api.api.node.StorageMinerClient.QueryReplication(data)
+}
+
+func (api *nodeClient) WatchStorageDeal(ctx context.Context, prop cid.Cid) (<-chan *storagedeal.Event, error) {
+	return api.api.node.StorageMinerClient.WatchDeal(ctx, prop)
+}
+
 func (api *nodeClient) ListAsks(ctx context.Context) (<-chan mapi.Ask, error) {
 	nd := api.api.node
 
@@ -90,7 +111,7 @@ func (api *nodeClient) ListAsks(ctx context.Context) (<-chan mapi.Ask, error) {
 
 			// TODO: at some point, we will need to check that the miners are actually part of the storage market
 			// for now, its impossible for them not to be.
-			queryer := msg.NewQueryer(nd.Repo, nd.Wallet, nd.ChainReader, nd.CborStore(), nd.Blockstore)
+			queryer := msg.NewQueryer(nd.Repo, nd.Wallet, nd.ChainReader, nd.CborStore(), nd.Blockstore, nd.Upgrades)
 			ret, _, err := queryer.Query(ctx, (address.Address{}), addr, "getAsks")
 			if err != nil {
 				return err
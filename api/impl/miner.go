@@ -2,12 +2,15 @@ package impl
 
 import (
 	"context"
+	"io"
 
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -38,3 +41,48 @@ func (nm *nodeMiner) Create(ctx context.Context, fromAddr address.Address, gasPr
 
 	return *res, nil
 }
+
+func (nm *nodeMiner) ImportDealData(ctx context.Context, proposalCid cid.Cid, data io.Reader, isCar bool) error {
+	storageMiner := nm.api.node.StorageMiner
+	if storageMiner == nil {
+		return errors.New("mining is not started, start mining to import deal data")
+	}
+
+	return storageMiner.ImportDealData(ctx, proposalCid, data, isCar)
+}
+
+func (nm *nodeMiner) WatchDeals(ctx context.Context) (<-chan *storagedeal.Event, error) {
+	storageMiner := nm.api.node.StorageMiner
+	if storageMiner == nil {
+		return nil, errors.New("mining is not started, start mining to watch deals")
+	}
+
+	return storageMiner.WatchDeals(ctx), nil
+}
+
+func (nm *nodeMiner) Deals(ctx context.Context, filter storagedeal.DealFilter) ([]*storagedeal.MinerDeal, error) {
+	storageMiner := nm.api.node.StorageMiner
+	if storageMiner == nil {
+		return nil, errors.New("mining is not started, start mining to list deals")
+	}
+
+	return storageMiner.Deals(filter)
+}
+
+func (nm *nodeMiner) Deal(ctx context.Context, proposalCid cid.Cid) (*storagedeal.MinerDeal, error) {
+	storageMiner := nm.api.node.StorageMiner
+	if storageMiner == nil {
+		return nil, errors.New("mining is not started, start mining to show deals")
+	}
+
+	return storageMiner.Deal(proposalCid)
+}
+
+func (nm *nodeMiner) RejectDeal(ctx context.Context, proposalCid cid.Cid, reason string) error {
+	storageMiner := nm.api.node.StorageMiner
+	if storageMiner == nil {
+		return errors.New("mining is not started, start mining to reject deals")
+	}
+
+	return storageMiner.RejectDeal(proposalCid, reason)
+}
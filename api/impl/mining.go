@@ -58,11 +58,6 @@ func (api *nodeMining) Once(ctx context.Context) (*types.Block, error) {
 		return nil, err
 	}
 	miningAddr := miningAddrIf.(address.Address)
-	miningOwnerAddr, err := nd.PorcelainAPI.MinerGetOwnerAddress(ctx, miningAddr)
-	if err != nil {
-		return nil, err
-	}
-
 	blockSignerAddrIf, err := nd.PorcelainAPI.ConfigGet("mining.blockSignerAddress")
 	if err != nil {
 		return nil, err
@@ -70,10 +65,10 @@ func (api *nodeMining) Once(ctx context.Context) (*types.Block, error) {
 	blockSignerAddr := blockSignerAddrIf.(address.Address)
 
 	getAncestors := func(ctx context.Context, ts types.TipSet, newBlockHeight *types.BlockHeight) ([]types.TipSet, error) {
-		return chain.GetRecentAncestors(ctx, ts, nd.ChainReader, newBlockHeight, consensus.AncestorRoundsNeeded, consensus.LookBackParameter)
+		return chain.GetRecentAncestors(ctx, ts, nd.ChainReader, newBlockHeight, nd.Upgrades.AncestorRoundsNeeded(newBlockHeight), consensus.LookBackParameter)
 	}
-	worker := mining.NewDefaultWorker(nd.MsgPool, getState, getWeight, getAncestors, consensus.NewDefaultProcessor(),
-		nd.PowerTable, nd.Blockstore, nd.CborStore(), miningAddr, miningOwnerAddr, blockSignerAddr, nd.Wallet, blockTime)
+	worker := mining.NewDefaultWorker(nd.MsgPool, getState, getWeight, getAncestors, consensus.NewProcessorWithUpgrades(nd.Upgrades),
+		nd.PowerTable, nd.Blockstore, nd.CborStore(), miningAddr, consensus.MinerOwnerAddress, blockSignerAddr, nd.Wallet, blockTime)
 
 	res, err := mining.MineOnce(ctx, worker, mineDelay, ts)
 	if err != nil {
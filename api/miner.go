@@ -2,14 +2,22 @@ package api
 
 import (
 	"context"
+	"io"
 
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
 // Miner is the interface that defines methods to manage miner operations.
 type Miner interface {
 	Create(ctx context.Context, fromAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, pledge uint64, pid peer.ID, collateral *types.AttoFIL) (address.Address, error)
+	ImportDealData(ctx context.Context, proposalCid cid.Cid, data io.Reader, isCar bool) error
+	WatchDeals(ctx context.Context) (<-chan *storagedeal.Event, error)
+	Deals(ctx context.Context, filter storagedeal.DealFilter) ([]*storagedeal.MinerDeal, error)
+	Deal(ctx context.Context, proposalCid cid.Cid) (*storagedeal.MinerDeal, error)
+	RejectDeal(ctx context.Context, proposalCid cid.Cid, reason string) error
 }
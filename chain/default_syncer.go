@@ -10,7 +10,6 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 
-	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -57,6 +56,9 @@ type DefaultSyncer struct {
 	cstOnline *hamt.CborIpldStore
 	// cstOffline is the node's shared offline storage.
 	cstOffline *hamt.CborIpldStore
+	// messages loads the messages and receipts of blocks, from the network
+	// if need be.
+	messages *MessageStore
 	// badTipSetCache is used to filter out collections of invalid blocks.
 	badTipSets *badTipSetCache
 	consensus  consensus.Protocol
@@ -70,6 +72,7 @@ func NewDefaultSyncer(online, offline *hamt.CborIpldStore, c consensus.Protocol,
 	return &DefaultSyncer{
 		cstOnline:  online,
 		cstOffline: offline,
+		messages:   NewMessageStore(online),
 		badTipSets: &badTipSetCache{
 			bad: make(map[string]struct{}),
 		},
@@ -169,8 +172,10 @@ func (syncer *DefaultSyncer) collectChain(ctx context.Context, blkCids []cid.Cid
 }
 
 // tipSetState returns the state resulting from applying the input tipset to
-// the chain.  Precondition: the tipset must be in the store
-func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey string) (state.Tree, error) {
+// the chain, with the builtin actors of the rules in effect at height bh, the
+// height of the tipset processed on top of it.  Precondition: the tipset must
+// be in the store
+func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey string, bh *types.BlockHeight) (state.Tree, error) {
 	if !syncer.chainStore.HasTipSetAndState(ctx, tsKey) {
 		return nil, errors.Wrap(ErrUnexpectedStoreState, "parent tipset must be in the store")
 	}
@@ -178,7 +183,7 @@ func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey string) (sta
 	if err != nil {
 		return nil, err
 	}
-	st, err := state.LoadStateTree(ctx, syncer.cstOffline, tsas.TipSetStateRoot, builtin.Actors)
+	st, err := state.LoadStateTree(ctx, syncer.cstOffline, tsas.TipSetStateRoot, syncer.consensus.BuiltinActors(bh))
 	if err != nil {
 		return nil, err
 	}
@@ -194,27 +199,33 @@ func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey string) (sta
 // Precondition: the caller of syncOne must hold the syncer's lock (syncer.mu) to
 // ensure head is not modified by another goroutine during run.
 func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.TipSet) error {
+	h, err := next.Height()
+	if err != nil {
+		return err
+	}
+	newBlockHeight := types.NewBlockHeight(h)
+
 	// Lookup parent state. It is guaranteed by the syncer that it is in
 	// the store
-	st, err := syncer.tipSetState(ctx, parent.String())
+	st, err := syncer.tipSetState(ctx, parent.String(), newBlockHeight)
 	if err != nil {
 		return err
 	}
 
 	// Gather ancestor chain needed to process state transition.
-	h, err := next.Height()
+	ancestors, err := GetRecentAncestors(ctx, parent, syncer.chainStore, newBlockHeight, syncer.consensus.AncestorRoundsNeeded(newBlockHeight), consensus.LookBackParameter)
 	if err != nil {
 		return err
 	}
-	newBlockHeight := types.NewBlockHeight(h)
-	ancestors, err := GetRecentAncestors(ctx, parent, syncer.chainStore, newBlockHeight, consensus.AncestorRoundsNeeded, consensus.LookBackParameter)
+
+	msgs, receipts, err := syncer.messages.LoadTipSetMessages(ctx, next)
 	if err != nil {
 		return err
 	}
 
 	// Run a state transition to validate the tipset and compute
 	// a new state to add to the store.
-	st, err = syncer.consensus.RunStateTransition(ctx, next, ancestors, st)
+	st, err = syncer.consensus.RunStateTransition(ctx, next, msgs, receipts, ancestors, st)
 	if err != nil {
 		return err
 	}
@@ -233,7 +244,7 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 
 	// TipSet is validated and added to store, now check if it is the heaviest.
 	// If it is the heaviest update the chainStore.
-	nextParentSt, err := syncer.tipSetState(ctx, parent.String()) // call again to get a copy
+	nextParentSt, err := syncer.tipSetState(ctx, parent.String(), newBlockHeight) // call again to get a copy
 	if err != nil {
 		return err
 	}
@@ -243,7 +254,11 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 	}
 	var headParentSt state.Tree
 	if headParentCids.Len() != 0 { // head is not genesis
-		headParentSt, err = syncer.tipSetState(ctx, headParentCids.String())
+		headHeight, err := syncer.chainStore.Head().Height()
+		if err != nil {
+			return err
+		}
+		headParentSt, err = syncer.tipSetState(ctx, headParentCids.String(), types.NewBlockHeight(headHeight))
 		if err != nil {
 			return err
 		}
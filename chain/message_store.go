@@ -0,0 +1,203 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/amt"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// MessageStore stores and loads the message and receipt collections blocks
+// reference through their Messages and MessageReceipts roots.
+type MessageStore struct {
+	cst *hamt.CborIpldStore
+}
+
+// NewMessageStore returns a MessageStore backed by cst.
+func NewMessageStore(cst *hamt.CborIpldStore) *MessageStore {
+	return &MessageStore{cst: cst}
+}
+
+// StoreMessages stores msgs as an array and returns its root.
+func (ms *MessageStore) StoreMessages(ctx context.Context, msgs []*types.SignedMessage) (cid.Cid, error) {
+	values := make([]interface{}, len(msgs))
+	for i, msg := range msgs {
+		values[i] = msg
+	}
+	return amt.Build(ctx, ms.cst, values)
+}
+
+// LoadMessages loads the messages of the array rooted at root.
+func (ms *MessageStore) LoadMessages(ctx context.Context, root cid.Cid) ([]*types.SignedMessage, error) {
+	if !root.Defined() {
+		return nil, nil
+	}
+	raw, err := amt.Load(ctx, ms.cst, root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load messages %s", root)
+	}
+	msgs := make([]*types.SignedMessage, len(raw))
+	for i, r := range raw {
+		msgs[i] = &types.SignedMessage{}
+		if err := cbor.DecodeInto(r, msgs[i]); err != nil {
+			return nil, errors.Wrapf(err, "malformed message %d of %s", i, root)
+		}
+	}
+	return msgs, nil
+}
+
+// StoreReceipts stores receipts as an array and returns its root.
+func (ms *MessageStore) StoreReceipts(ctx context.Context, receipts []*types.MessageReceipt) (cid.Cid, error) {
+	values := make([]interface{}, len(receipts))
+	for i, r := range receipts {
+		values[i] = r
+	}
+	return amt.Build(ctx, ms.cst, values)
+}
+
+// LoadReceipts loads the receipts of the array rooted at root.
+func (ms *MessageStore) LoadReceipts(ctx context.Context, root cid.Cid) ([]*types.MessageReceipt, error) {
+	if !root.Defined() {
+		return nil, nil
+	}
+	raw, err := amt.Load(ctx, ms.cst, root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load receipts %s", root)
+	}
+	receipts := make([]*types.MessageReceipt, len(raw))
+	for i, r := range raw {
+		receipts[i] = &types.MessageReceipt{}
+		if err := cbor.DecodeInto(r, receipts[i]); err != nil {
+			return nil, errors.Wrapf(err, "malformed receipt %d of %s", i, root)
+		}
+	}
+	return receipts, nil
+}
+
+// LoadTipSetMessages loads the messages and receipts of every block of ts.
+// The i-th entries of the results belong to the i-th block of ts.ToSlice().
+func (ms *MessageStore) LoadTipSetMessages(ctx context.Context, ts types.TipSet) ([][]*types.SignedMessage, [][]*types.MessageReceipt, error) {
+	blks := ts.ToSlice()
+	msgs := make([][]*types.SignedMessage, len(blks))
+	receipts := make([][]*types.MessageReceipt, len(blks))
+	for i, blk := range blks {
+		var err error
+		if msgs[i], err = ms.LoadMessages(ctx, blk.Messages); err != nil {
+			return nil, nil, err
+		}
+		if receipts[i], err = ms.LoadReceipts(ctx, blk.MessageReceipts); err != nil {
+			return nil, nil, err
+		}
+	}
+	return msgs, receipts, nil
+}
+
+// MessageProof proves that a message and its receipt are included in a
+// block. It can be checked with VerifyMessageProof knowing nothing but the
+// block's CID.
+type MessageProof struct {
+	// Header is the cbor encoded block.
+	Header []byte `json:"header"`
+	// Index is the position of the message in the block.
+	Index uint64 `json:"index"`
+	// Message proves the message to be at Index in the block's messages.
+	Message *amt.Proof `json:"message"`
+	// Receipt proves the receipt to be at Index in the block's receipts.
+	Receipt *amt.Proof `json:"receipt"`
+}
+
+// ProveMessage returns a proof that the message with cid msgCid is included,
+// along with its receipt, in the block with cid blkCid.
+func (ms *MessageStore) ProveMessage(ctx context.Context, blkCid cid.Cid, msgCid cid.Cid) (*MessageProof, error) {
+	header, err := ms.cst.Blocks.GetBlock(ctx, blkCid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load block %s", blkCid)
+	}
+	var blk types.Block
+	if err := cbor.DecodeInto(header.RawData(), &blk); err != nil {
+		return nil, errors.Wrapf(err, "malformed block %s", blkCid)
+	}
+
+	msgs, err := ms.LoadMessages(ctx, blk.Messages)
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	for i, msg := range msgs {
+		c, err := msg.Cid()
+		if err != nil {
+			return nil, err
+		}
+		if c.Equals(msgCid) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("message %s is not in block %s", msgCid, blkCid)
+	}
+
+	proof := &MessageProof{Header: header.RawData(), Index: uint64(index)}
+	if _, proof.Message, err = amt.Prove(ctx, ms.cst, blk.Messages, proof.Index); err != nil {
+		return nil, errors.Wrap(err, "failed to prove message")
+	}
+	if _, proof.Receipt, err = amt.Prove(ctx, ms.cst, blk.MessageReceipts, proof.Index); err != nil {
+		return nil, errors.Wrap(err, "failed to prove receipt")
+	}
+	return proof, nil
+}
+
+// VerifyMessageProof checks that proof shows the message with cid msgCid to
+// be included in the block with cid blkCid and returns the message and its
+// receipt.
+func VerifyMessageProof(blkCid cid.Cid, msgCid cid.Cid, proof *MessageProof) (*types.SignedMessage, *types.MessageReceipt, error) {
+	c, err := blkCid.Prefix().Sum(proof.Header)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to hash block header")
+	}
+	if !c.Equals(blkCid) {
+		return nil, nil, fmt.Errorf("block header has cid %s, expected %s", c, blkCid)
+	}
+	var blk types.Block
+	if err := cbor.DecodeInto(proof.Header, &blk); err != nil {
+		return nil, nil, errors.Wrap(err, "malformed block header")
+	}
+	if !blk.Messages.Defined() || !blk.MessageReceipts.Defined() {
+		return nil, nil, fmt.Errorf("block %s has no messages", blkCid)
+	}
+
+	if proof.Message == nil || proof.Receipt == nil {
+		return nil, nil, fmt.Errorf("incomplete proof")
+	}
+	raw, err := amt.Verify(blk.Messages, proof.Index, proof.Message)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid message proof")
+	}
+	var msg types.SignedMessage
+	if err := cbor.DecodeInto(raw, &msg); err != nil {
+		return nil, nil, errors.Wrap(err, "malformed message")
+	}
+	c, err = msg.Cid()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.Equals(msgCid) {
+		return nil, nil, fmt.Errorf("proof is for message %s, not %s", c, msgCid)
+	}
+
+	raw, err = amt.Verify(blk.MessageReceipts, proof.Index, proof.Receipt)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid receipt proof")
+	}
+	var receipt types.MessageReceipt
+	if err := cbor.DecodeInto(raw, &receipt); err != nil {
+		return nil, nil, errors.Wrap(err, "malformed receipt")
+	}
+	return &msg, &receipt, nil
+}
@@ -0,0 +1,136 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var msgSigner = types.NewMockSigner(types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed()))
+
+func TestMessageStoreRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	ms := chain.NewMessageStore(cst)
+
+	msgs := types.NewSignedMsgs(20, msgSigner)
+	root, err := ms.StoreMessages(ctx, msgs)
+	require.NoError(err)
+	loaded, err := ms.LoadMessages(ctx, root)
+	require.NoError(err)
+	require.Len(loaded, len(msgs))
+	for i := range msgs {
+		assert.True(types.SmsgCidsEqual(msgs[i], loaded[i]))
+	}
+
+	receipts := []*types.MessageReceipt{{ExitCode: 1}, {ExitCode: 0, Return: [][]byte{{1, 2}}}}
+	root, err = ms.StoreReceipts(ctx, receipts)
+	require.NoError(err)
+	loadedReceipts, err := ms.LoadReceipts(ctx, root)
+	require.NoError(err)
+	require.Len(loadedReceipts, 2)
+	assert.Equal(uint8(1), loadedReceipts[0].ExitCode)
+	assert.Equal([][]byte{{1, 2}}, loadedReceipts[1].Return)
+
+	t.Run("undefined roots are empty", func(t *testing.T) {
+		msgs, err := ms.LoadMessages(ctx, cid.Undef)
+		require.NoError(err)
+		assert.Empty(msgs)
+
+		receipts, err := ms.LoadReceipts(ctx, cid.Undef)
+		require.NoError(err)
+		assert.Empty(receipts)
+	})
+}
+
+func TestMessageStoreLoadTipSetMessages(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+
+	msgs := types.NewSignedMsgs(3, msgSigner)
+	blk1 := &types.Block{Nonce: 1, Messages: chain.RequirePutMessages(require, cst, msgs[0])}
+	blk2 := &types.Block{Nonce: 2, Messages: chain.RequirePutMessages(require, cst, msgs[1], msgs[2])}
+	blk3 := &types.Block{Nonce: 3}
+	ts := types.RequireNewTipSet(require, blk1, blk2, blk3)
+
+	tsMessages, tsReceipts, err := chain.NewMessageStore(cst).LoadTipSetMessages(ctx, ts)
+	require.NoError(err)
+	require.Len(tsMessages, 3)
+	require.Len(tsReceipts, 3)
+
+	want := map[cid.Cid]int{blk1.Cid(): 1, blk2.Cid(): 2, blk3.Cid(): 0}
+	for i, blk := range ts.ToSlice() {
+		assert.Len(tsMessages[i], want[blk.Cid()])
+		assert.Empty(tsReceipts[i])
+	}
+}
+
+func TestProveAndVerifyMessage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	ms := chain.NewMessageStore(cst)
+
+	msgs := types.NewSignedMsgs(10, msgSigner)
+	var receipts []*types.MessageReceipt
+	for i := range msgs {
+		receipts = append(receipts, &types.MessageReceipt{ExitCode: uint8(i)})
+	}
+	blk := &types.Block{
+		Height:          1,
+		Messages:        chain.RequirePutMessages(require, cst, msgs...),
+		MessageReceipts: chain.RequirePutReceipts(require, cst, receipts...),
+	}
+	blkCid := core.MustPut(cst, blk)
+
+	msgCid, err := msgs[9].Cid()
+	require.NoError(err)
+	proof, err := ms.ProveMessage(ctx, blkCid, msgCid)
+	require.NoError(err)
+
+	t.Run("valid proof", func(t *testing.T) {
+		msg, receipt, err := chain.VerifyMessageProof(blkCid, msgCid, proof)
+		require.NoError(err)
+		assert.True(types.SmsgCidsEqual(msgs[9], msg))
+		assert.Equal(uint8(9), receipt.ExitCode)
+	})
+
+	t.Run("message not in block", func(t *testing.T) {
+		other, err := types.NewSignedMsgs(11, msgSigner)[10].Cid()
+		require.NoError(err)
+		_, err = ms.ProveMessage(ctx, blkCid, other)
+		assert.Error(err)
+	})
+
+	t.Run("proof for another message", func(t *testing.T) {
+		other, err := msgs[0].Cid()
+		require.NoError(err)
+		_, _, err = chain.VerifyMessageProof(blkCid, other, proof)
+		assert.Error(err)
+	})
+
+	t.Run("proof for another block", func(t *testing.T) {
+		_, _, err := chain.VerifyMessageProof(types.SomeCid(), msgCid, proof)
+		assert.Error(err)
+	})
+
+	t.Run("proof with the wrong index", func(t *testing.T) {
+		wrong := *proof
+		wrong.Index = 8
+		_, _, err := chain.VerifyMessageProof(blkCid, msgCid, &wrong)
+		assert.Error(err)
+	})
+}
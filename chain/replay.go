@@ -0,0 +1,242 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// ReplayResult records the outcome of re-running the state transition of a
+// single tipset of the canonical chain.
+type ReplayResult struct {
+	Height uint64 `json:"height"`
+	TipSet string `json:"tipSet"`
+	// StoredStateRoot is the state root recorded in the chain store.
+	StoredStateRoot cid.Cid `json:"storedStateRoot"`
+	// ComputedStateRoot is the state root produced by replaying the tipset.
+	// It is undefined if the state transition itself failed.
+	ComputedStateRoot cid.Cid `json:"computedStateRoot"`
+	// ReceiptsMatch is true when every block's recomputed receipts equal
+	// the receipts stored in the block.
+	ReceiptsMatch bool `json:"receiptsMatch"`
+	// Error describes why the tipset diverged, if it did.
+	Error string `json:"error,omitempty"`
+	// Duration is the time spent replaying the tipset.
+	Duration time.Duration `json:"duration"`
+}
+
+// Diverged returns true if replaying the tipset did not reproduce the stored
+// state root and receipts.
+func (r *ReplayResult) Diverged() bool {
+	return r.Error != "" || !r.ReceiptsMatch || !r.ComputedStateRoot.Equals(r.StoredStateRoot)
+}
+
+// Replayer re-runs the consensus state transition over tipsets already in a
+// chain store in order to verify that the stored state roots and receipts are
+// what the current rules produce.  It never writes to the chain store.
+type Replayer struct {
+	chainReader ReadStore
+	cstore      *hamt.CborIpldStore
+	bstore      bstore.Blockstore
+	messages    *MessageStore
+	consensus   consensus.Protocol
+	processor   consensus.Processor
+	upgrades    consensus.Upgrades
+}
+
+// NewReplayer returns a Replayer over the given chain.  The processor and
+// upgrades must be the ones used by con so that recomputed receipts are
+// comparable.
+func NewReplayer(chainReader ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore, con consensus.Protocol, processor consensus.Processor, upgrades consensus.Upgrades) *Replayer {
+	return &Replayer{
+		chainReader: chainReader,
+		cstore:      cst,
+		bstore:      bs,
+		messages:    NewMessageStore(cst),
+		consensus:   con,
+		processor:   processor,
+		upgrades:    upgrades,
+	}
+}
+
+// Replay replays every tipset of the canonical chain with a height in
+// [from, to] in ascending height order, calling cb with the result of each.
+// Replay stops at the first divergence, after reporting it to cb.  The genesis
+// tipset has no parent state and is skipped.
+func (r *Replayer) Replay(ctx context.Context, from, to uint64, cb func(*ReplayResult) error) error {
+	if from > to {
+		return fmt.Errorf("from height %d is above to height %d", from, to)
+	}
+	if from == 0 {
+		from = 1
+	}
+
+	tipsets, err := r.canonicalTipSets(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, ts := range tipsets {
+		res, err := r.replayTipSet(ctx, ts)
+		if err != nil {
+			return err
+		}
+		if err := cb(res); err != nil {
+			return err
+		}
+		if res.Diverged() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// canonicalTipSets returns the tipsets of the chain ending at the store's head
+// with heights in [from, to], lowest first.
+func (r *Replayer) canonicalTipSets(ctx context.Context, from, to uint64) ([]types.TipSet, error) {
+	// Cancelling stops the history walk once we are below from.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var tipsets []types.TipSet
+loop:
+	for raw := range r.chainReader.BlockHistory(ctx, r.chainReader.Head()) {
+		switch v := raw.(type) {
+		case error:
+			return nil, errors.Wrap(v, "failed to walk chain")
+		case types.TipSet:
+			h, err := v.Height()
+			if err != nil {
+				return nil, err
+			}
+			if h < from {
+				break loop
+			}
+			if h <= to {
+				tipsets = append(tipsets, v)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected type in chain history")
+		}
+	}
+
+	for i, j := 0, len(tipsets)-1; i < j; i, j = i+1, j-1 {
+		tipsets[i], tipsets[j] = tipsets[j], tipsets[i]
+	}
+	return tipsets, nil
+}
+
+// replayTipSet re-runs the state transition of ts on top of its stored parent
+// state.  Divergences are recorded in the result; only errors that prevent the
+// replay from being attempted at all are returned.
+func (r *Replayer) replayTipSet(ctx context.Context, ts types.TipSet) (*ReplayResult, error) {
+	h, err := ts.Height()
+	if err != nil {
+		return nil, err
+	}
+	tsas, err := r.chainReader.GetTipSetAndState(ctx, ts.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get stored state of tipset %s", ts.String())
+	}
+	parentIDs, err := ts.Parents()
+	if err != nil {
+		return nil, err
+	}
+	parentTsas, err := r.chainReader.GetTipSetAndState(ctx, parentIDs.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get stored state of parent tipset %s", parentIDs.String())
+	}
+	ancestors, err := GetRecentAncestors(ctx, parentTsas.TipSet, r.chainReader, types.NewBlockHeight(h), r.consensus.AncestorRoundsNeeded(types.NewBlockHeight(h)), consensus.LookBackParameter)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ReplayResult{
+		Height:          h,
+		TipSet:          ts.String(),
+		StoredStateRoot: tsas.TipSetStateRoot,
+	}
+
+	start := time.Now()
+	defer func() {
+		res.Duration = time.Since(start)
+	}()
+
+	actors := r.upgrades.RulesAt(types.NewBlockHeight(h)).Actors
+	pSt, err := state.LoadStateTree(ctx, r.cstore, parentTsas.TipSetStateRoot, actors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load parent state")
+	}
+	msgs, receipts, err := r.messages.LoadTipSetMessages(ctx, ts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load tipset messages")
+	}
+	st, err := r.consensus.RunStateTransition(ctx, ts, msgs, receipts, ancestors, pSt)
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil
+	}
+	res.ComputedStateRoot, err = st.Flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res.ReceiptsMatch = true
+	for i, blk := range ts.ToSlice() {
+		match, err := r.blockReceiptsMatch(ctx, blk, msgs[i], receipts[i], parentTsas.TipSetStateRoot, actors, ancestors)
+		if err != nil {
+			res.Error = err.Error()
+			return res, nil
+		}
+		if !match {
+			res.ReceiptsMatch = false
+			res.Error = fmt.Sprintf("receipts of block %s do not match", blk.Cid())
+			return res, nil
+		}
+	}
+	return res, nil
+}
+
+// blockReceiptsMatch recomputes the receipts of blk's messages, msgs, on a
+// fresh copy of its parent state and compares them to the stored receipts.
+func (r *Replayer) blockReceiptsMatch(ctx context.Context, blk *types.Block, msgs []*types.SignedMessage, stored []*types.MessageReceipt, parentRoot cid.Cid, actors map[cid.Cid]exec.ExecutableActor, ancestors []types.TipSet) (bool, error) {
+	st, err := state.LoadStateTree(ctx, r.cstore, parentRoot, actors)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to load parent state")
+	}
+	// The storage map is never flushed so nothing is written back.
+	results, err := r.processor.ProcessBlock(ctx, st, vm.NewStorageMap(r.bstore), blk, msgs, ancestors)
+	if err != nil {
+		return false, err
+	}
+	if len(results) != len(stored) {
+		return false, nil
+	}
+	for i, res := range results {
+		computed, err := cbor.DumpObject(res.Receipt)
+		if err != nil {
+			return false, err
+		}
+		want, err := cbor.DumpObject(stored[i])
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(computed, want) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,107 @@
+package chain_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+// initReplayTest syncs the whole test chain and returns a replayer over it
+// along with the chain store it reads from.
+func initReplayTest(require *require.Assertions) (*chain.Replayer, chain.Store) {
+	ctx := context.Background()
+	processor := testhelpers.NewTestProcessor()
+	powerTable := &testhelpers.TestView{}
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := hamt.NewCborStore()
+	verifier := proofs.NewFakeVerifier(true, nil)
+	con := consensus.NewExpected(cst, bs, processor, powerTable, genCid, verifier)
+	requireSetTestChain(require, con, false)
+	syncer, chainStore, cst, _ := initSyncTest(require, con, initGenesis, cst, bs, r)
+
+	requirePutBlocks(require, cst, link1.ToSlice()...)
+	requirePutBlocks(require, cst, link2.ToSlice()...)
+	requirePutBlocks(require, cst, link3.ToSlice()...)
+	cids4 := requirePutBlocks(require, cst, link4.ToSlice()...)
+	require.NoError(syncer.HandleNewBlocks(ctx, cids4))
+	requireHead(require, chainStore, link4)
+
+	return chain.NewReplayer(chainStore, cst, bs, con, processor, consensus.DefaultUpgrades()), chainStore
+}
+
+func requireReplay(require *require.Assertions, replayer *chain.Replayer, from, to uint64) []*chain.ReplayResult {
+	var results []*chain.ReplayResult
+	err := replayer.Replay(context.Background(), from, to, func(res *chain.ReplayResult) error {
+		results = append(results, res)
+		return nil
+	})
+	require.NoError(err)
+	return results
+}
+
+func TestReplayMatchesStoredChain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	replayer, _ := initReplayTest(require)
+
+	results := requireReplay(require, replayer, 0, math.MaxUint64)
+	require.Len(results, 4)
+
+	var heights []uint64
+	for _, res := range results {
+		assert.False(res.Diverged(), res.Error)
+		assert.True(res.ReceiptsMatch)
+		assert.Equal(res.StoredStateRoot, res.ComputedStateRoot)
+		heights = append(heights, res.Height)
+	}
+	assert.Equal([]uint64{1, 2, 3, 6}, heights)
+}
+
+func TestReplayRange(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	replayer, _ := initReplayTest(require)
+
+	results := requireReplay(require, replayer, 2, 3)
+	require.Len(results, 2)
+	assert.Equal(link2.String(), results[0].TipSet)
+	assert.Equal(link3.String(), results[1].TipSet)
+
+	err := replayer.Replay(context.Background(), 3, 2, func(*chain.ReplayResult) error { return nil })
+	assert.Error(err)
+}
+
+func TestReplayStopsAtFirstDivergence(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	replayer, chainStore := initReplayTest(require)
+
+	// Corrupt the stored state root of link2.
+	badRoot := types.NewCidForTestGetter()()
+	chain.RequirePutTsas(ctx, require, chainStore, &chain.TipSetAndState{
+		TipSet:          link2,
+		TipSetStateRoot: badRoot,
+	})
+
+	results := requireReplay(require, replayer, 0, math.MaxUint64)
+	require.Len(results, 2)
+	assert.False(results[0].Diverged())
+	assert.True(results[1].Diverged())
+	assert.Equal(badRoot, results[1].StoredStateRoot)
+	assert.Equal(link2State, results[1].ComputedStateRoot)
+}
@@ -161,6 +161,22 @@ func RequirePutTsas(ctx context.Context, require *require.Assertions, chain Stor
 	require.NoError(err)
 }
 
+// RequirePutMessages stores msgs as a block's message collection in cst and
+// returns its root.
+func RequirePutMessages(require *require.Assertions, cst *hamt.CborIpldStore, msgs ...*types.SignedMessage) cid.Cid {
+	root, err := NewMessageStore(cst).StoreMessages(context.Background(), msgs)
+	require.NoError(err)
+	return root
+}
+
+// RequirePutReceipts stores receipts as a block's receipt collection in cst
+// and returns its root.
+func RequirePutReceipts(require *require.Assertions, cst *hamt.CborIpldStore, receipts ...*types.MessageReceipt) cid.Cid {
+	root, err := NewMessageStore(cst).StoreReceipts(context.Background(), receipts)
+	require.NoError(err)
+	return root
+}
+
 // MakeProofAndWinningTicket generates a proof and ticket that will pass validateMining.
 func MakeProofAndWinningTicket(minerAddr address.Address, minerPower uint64, totalPower uint64) (proofs.PoStProof, types.Signature, error) {
 	var postProof proofs.PoStProof
@@ -3,10 +3,15 @@ package commands
 import (
 	"encoding/json"
 	"io"
+	"strings"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
 
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 )
 
@@ -15,7 +20,8 @@ var actorCmd = &cmds.Command{
 		Tagline: "Interact with actors. Actors are built-in smart contracts.",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"ls": actorLsCmd,
+		"ls":    actorLsCmd,
+		"prove": actorProveCmd,
 	},
 }
 
@@ -49,3 +55,58 @@ var actorLsCmd = &cmds.Command{
 		}),
 	},
 }
+
+// ActorProofResult is the output of the actor prove command.
+type ActorProofResult struct {
+	StateRoot cid.Cid           `json:"stateRoot"`
+	Proof     *state.ActorProof `json:"proof"`
+}
+
+var actorProveCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Prove that an actor is part of the state of a tipset",
+		ShortDescription: `
+Prints a proof that the actor is in the state tree of the tipset, along with
+the root of that tree. The proof holds the state tree nodes on the path to the
+actor so it can be checked knowing only the state root. With --field the proof
+also holds the actor's storage head and the nodes under the named field.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("address", true, false, "address of the actor to prove"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("tipset", "comma separated CIDs of the tipset's blocks, defaults to the head"),
+		cmdkit.StringOption("field", "name of a field of the actor's storage to include in the proof"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		addr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		var tsKey types.SortedCidSet
+		if tipset, ok := req.Options["tipset"].(string); ok && tipset != "" {
+			for _, s := range strings.Split(tipset, ",") {
+				c, err := cid.Decode(strings.TrimSpace(s))
+				if err != nil {
+					return err
+				}
+				tsKey.Add(c)
+			}
+		}
+		field, _ := req.Options["field"].(string)
+
+		root, proof, err := GetPorcelainAPI(env).ActorProve(req.Context, addr, tsKey, field)
+		if err != nil {
+			return err
+		}
+		return re.Emit(&ActorProofResult{StateRoot: root, Proof: proof})
+	},
+	Type: ActorProofResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *ActorProofResult) error {
+			return json.NewEncoder(w).Encode(res)
+		}),
+	},
+}
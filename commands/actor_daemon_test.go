@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/state"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
@@ -40,7 +42,7 @@ func TestActorDaemon(t *testing.T) {
 		// The order of actors is consistent, but only within builds of genesis.car.
 		// We just want to make sure the views have something valid in them.
 		for _, av := range avs {
-			assert.Contains([]string{"StoragemarketActor", "AccountActor", "PaymentbrokerActor", "MinerActor", "BootstrapMinerActor"}, av.ActorType)
+			assert.Contains([]string{"StoragemarketActor", "AccountActor", "PaymentbrokerActor", "MinerActor", "BootstrapMinerActor", "MultisigActor", "MultisigFactoryActor"}, av.ActorType)
 			if av.ActorType == "AccountActor" {
 				assert.Zero(len(av.Exports))
 			} else {
@@ -48,4 +50,29 @@ func TestActorDaemon(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("actor prove returns a proof that verifies against the state root", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		d := th.NewDaemon(t).Start()
+		defer d.ShutdownSuccess()
+
+		head := d.RunSuccess("chain", "head", "--enc", "json").ReadStdoutTrimNewlines()
+		var blks []map[string]string
+		require.NoError(json.Unmarshal([]byte(head), &blks))
+		require.Len(blks, 1)
+
+		op := d.RunSuccess("actor", "prove", address.StorageMarketAddress.String(), "--tipset", blks[0]["/"], "--field", "Miners")
+		var res ActorProofResult
+		require.NoError(json.Unmarshal([]byte(op.ReadStdout()), &res))
+		require.NotNil(res.Proof)
+		assert.NotEmpty(res.Proof.Storage)
+
+		act, err := state.VerifyActorProof(res.StateRoot, address.StorageMarketAddress, res.Proof)
+		require.NoError(err)
+		assert.True(act.Head.Defined())
+
+		d.RunFail("has no field", "actor", "prove", address.StorageMarketAddress.String(), "--field", "NoSuchField")
+	})
 }
@@ -2,15 +2,20 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/node"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -19,8 +24,10 @@ var chainCmd = &cmds.Command{
 		Tagline: "Inspect the filecoin blockchain",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"head": chainHeadCmd,
-		"ls":   chainLsCmd,
+		"head":          chainHeadCmd,
+		"ls":            chainLsCmd,
+		"prove-message": chainProveMessageCmd,
+		"replay":        chainReplayCmd,
 	},
 }
 
@@ -42,7 +49,7 @@ var chainLsCmd = &cmds.Command{
 		ShortDescription: `Provides a list of blocks in order from head to genesis. By default, only CIDs are returned for each block.`,
 	},
 	Options: []cmdkit.Option{
-		cmdkit.BoolOption("long", "l", "List blocks in long format, including CID, Miner, StateRoot, block height and message count respectively"),
+		cmdkit.BoolOption("long", "l", "List blocks in long format, including CID, Miner, StateRoot, block height and messages root respectively"),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		for raw := range GetPorcelainAPI(env).ChainLs(req.Context) {
@@ -80,7 +87,11 @@ var chainLsCmd = &cmds.Command{
 					output.WriteString("\t")
 					output.WriteString(strconv.FormatUint(uint64(block.Height), 10))
 					output.WriteString("\t")
-					output.WriteString(strconv.Itoa(len(block.Messages)))
+					if block.Messages.Defined() {
+						output.WriteString(block.Messages.String())
+					} else {
+						output.WriteString("-")
+					}
 				} else {
 					output.WriteString(block.Cid().String())
 				}
@@ -95,3 +106,94 @@ var chainLsCmd = &cmds.Command{
 		}),
 	},
 }
+
+var chainProveMessageCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Prove that a message and its receipt are included in a block",
+		ShortDescription: `
+Prints a proof that the message is included in the block along with its
+receipt. The proof holds the block header and the collection nodes on the path
+to the message and receipt, so it can be checked knowing only the block CID.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("block", true, false, "CID of the block including the message"),
+		cmdkit.StringArg("message", true, false, "CID of the message to prove"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		blkCid, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		msgCid, err := cid.Decode(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+
+		proof, err := GetPorcelainAPI(env).ChainProveMessage(req.Context, blkCid, msgCid)
+		if err != nil {
+			return err
+		}
+		return re.Emit(proof)
+	},
+	Type: chain.MessageProof{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, proof *chain.MessageProof) error {
+			return json.NewEncoder(w).Encode(proof)
+		}),
+	},
+}
+
+var chainReplayCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Re-run the state transitions of the stored chain and compare the results",
+		ShortDescription: `
+Replays every tipset of the canonical chain between --from and --to against its
+stored parent state and compares the resulting state root and receipts with
+the stored ones. Replay stops at the first divergence. This command works on
+the repo directly, so the daemon must not be running.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option("from", "height of the first tipset to replay").WithDefault(uint64(1)),
+		cmdkit.Uint64Option("to", "height of the last tipset to replay, defaults to the head"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		from, _ := req.Options["from"].(uint64)
+		to, ok := req.Options["to"].(uint64)
+		if !ok {
+			to = math.MaxUint64
+		}
+
+		rep, err := getRepo(req)
+		if err != nil {
+			return err
+		}
+		defer rep.Close() // nolint: errcheck
+
+		replayer, err := node.NewReplayer(req.Context, rep)
+		if err != nil {
+			return err
+		}
+
+		return replayer.Replay(req.Context, from, to, func(res *chain.ReplayResult) error {
+			return re.Emit(res)
+		})
+	},
+	Type: chain.ReplayResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *chain.ReplayResult) error {
+			status := "ok"
+			if res.Diverged() {
+				status = "DIVERGED"
+			}
+			_, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", res.Height, status, res.Duration.Round(time.Millisecond), res.TipSet)
+			if err != nil || !res.Diverged() {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "  stored state root:   %s\n  computed state root: %s\n  receipts match:      %t\n  error:               %s\n",
+				res.StoredStateRoot, res.ComputedStateRoot, res.ReceiptsMatch, res.Error)
+			return err
+		}),
+	},
+}
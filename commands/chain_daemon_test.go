@@ -94,7 +94,7 @@ func TestChainDaemon(t *testing.T) {
 		assert.Equal(chainLsResult, expectedOutput)
 	})
 
-	t.Run("chain ls --long returns CIDs, Miner, block height and message count", func(t *testing.T) {
+	t.Run("chain ls --long returns CIDs, Miner, block height and messages root", func(t *testing.T) {
 		t.Parallel()
 		assert := assert.New(t)
 
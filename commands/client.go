@@ -4,16 +4,21 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"gx/ipfs/QmQmhotPUzVrMEWNK3x1R5jQ5ZHWyL7tVUrmRPjrBrvyCb/go-ipfs-files"
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/api"
+	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 var clientCmd = &cmds.Command{
@@ -25,7 +30,12 @@ var clientCmd = &cmds.Command{
 		"import":               clientImportDataCmd,
 		"propose-storage-deal": clientProposeStorageDealCmd,
 		"query-storage-deal":   clientQueryStorageDealCmd,
+		"store":                clientStoreCmd,
+		"query-replication":    clientQueryReplicationCmd,
+		"watch-deal":           clientWatchDealCmd,
+		"query-chain-deal":     clientQueryChainDealCmd,
 		"list-asks":            clientListAsksCmd,
+		"asks":                 clientAsksCmd,
 		"payments":             paymentsCmd,
 	},
 }
@@ -111,6 +121,16 @@ Duration should be specified with the number of blocks for which to store the
 data. New blocks are generated about every 30 seconds, so the time given should
 be represented as a count of 30 second intervals. For example, 1 minute would
 be 2, 1 hour would be 120, and 1 day would be 2880.
+
+Once the deal is accepted, the miner pulls the data from this node. With
+--push this node pushes the data to the miner instead. The progress of the
+transfer is shown by query-storage-deal.
+
+With --manual-transfer the data is not sent over the network at all. Get the
+data to the miner some other way, for instance on a disk, along with the
+proposal cid, for the miner to load it with:
+
+$ go-filecoin miner import-deal-data <proposal-cid> <file-or-car>
 `,
 	},
 	Arguments: []cmdkit.Argument{
@@ -121,10 +141,25 @@ be 2, 1 hour would be 120, and 1 day would be 2880.
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption("allow-duplicates", "Allows duplicate proposals to be created. Unless this flag is set, you will not be able to make more than one deal per piece per miner. This protection exists to prevent erroneous duplicate deals."),
+		cmdkit.BoolOption("push", "Push the data to the miner instead of letting the miner pull it"),
+		cmdkit.BoolOption("manual-transfer", "Transfer the data to the miner out of band, the miner imports it"),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		allowDuplicates, _ := req.Options["allow-duplicates"].(bool)
 
+		push, _ := req.Options["push"].(bool)
+		manualTransfer, _ := req.Options["manual-transfer"].(bool)
+		if push && manualTransfer {
+			return errors.New("--push and --manual-transfer are mutually exclusive")
+		}
+		transferMode := storagedeal.TransferPull
+		if push {
+			transferMode = storagedeal.TransferPush
+		}
+		if manualTransfer {
+			transferMode = storagedeal.TransferManual
+		}
+
 		miner, err := address.NewFromString(req.Arguments[0])
 		if err != nil {
 			return err
@@ -145,7 +180,7 @@ be 2, 1 hour would be 120, and 1 day would be 2880.
 			return err
 		}
 
-		resp, err := GetAPI(env).Client().ProposeStorageDeal(req.Context, data, miner, askid, duration, allowDuplicates)
+		resp, err := GetAPI(env).Client().ProposeStorageDeal(req.Context, data, miner, askid, duration, transferMode, allowDuplicates)
 		if err != nil {
 			return err
 		}
@@ -193,6 +228,217 @@ format is specified with the --enc flag.
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, resp *storagedeal.Response) error {
 			fmt.Fprintf(w, "Status: %s\n", resp.State.String()) // nolint: errcheck
 			fmt.Fprintf(w, "Message: %s\n", resp.Message)       // nolint: errcheck
+			if resp.DealID != 0 {
+				fmt.Fprintf(w, "Deal ID: %d\n", resp.DealID) // nolint: errcheck
+			}
+			if resp.Transfer != nil {
+				fmt.Fprintf(w, "Transfer: %d/%d blocks, %d bytes\n", resp.Transfer.Blocks, resp.Transfer.TotalBlocks, resp.Transfer.Bytes) // nolint: errcheck
+			}
+			return nil
+		}),
+	},
+}
+
+var clientStoreCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Store data with several storage miners",
+		ShortDescription: `
+Stores the data with the given number of miners, picked from the live asks at
+or below the max price, cheapest first. Miners that reject or fail the
+proposal are replaced by the next ones.
+`,
+		LongDescription: `
+Stores the data with the given number of miners. Miners are picked from the
+live asks in the storage market at or below the max price, cheapest first, and
+are proposed deals in parallel. Miners that cannot be reached, reject or fail
+the proposal are replaced by the next ones until enough miners accepted.
+
+A record of the replication is kept, it can be shown with:
+
+$ go-filecoin client query-replication <data>
+
+Running the command again for the same data only proposes deals for the
+replicas that were lost, to miners that were not tried yet.
+
+Duration should be specified with the number of blocks for which to store the
+data, about 30 seconds per block.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("data", true, false, "CID of the data to be stored"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option("replicas", "Number of miners to store the data with").WithDefault(uint64(1)),
+		cmdkit.StringOption("max-price", "Only pick asks priced at most this many FIL per byte per block"),
+		cmdkit.Uint64Option("duration", "Time in blocks (about 30 seconds per block) to store data"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		data, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		duration, ok := req.Options["duration"].(uint64)
+		if !ok || duration == 0 {
+			return errors.New("--duration is required")
+		}
+
+		var maxPrice *types.AttoFIL
+		if p, ok := req.Options["max-price"].(string); ok {
+			maxPrice, ok = types.NewAttoFILFromFILString(p)
+			if !ok {
+				return ErrInvalidPrice
+			}
+		}
+
+		r, err := GetAPI(env).Client().StoreData(req.Context, data, req.Options["replicas"].(uint64), maxPrice, duration)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(r)
+	},
+	Type: storagedeal.Replication{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(printReplication),
+	},
+}
+
+var clientQueryReplicationCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the replication of data stored with client store",
+		ShortDescription: `
+Shows the deals holding the replicas of the data and the miners that did not
+take one. The states of the deals are as last known by this node, query-storage-deal
+asks the miner.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("data", true, false, "CID of the stored data"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		data, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		r, err := GetAPI(env).Client().QueryReplication(req.Context, data)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(r)
+	},
+	Type: storagedeal.Replication{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(printReplication),
+	},
+}
+
+func printReplication(req *cmds.Request, w io.Writer, r *storagedeal.Replication) error {
+	fmt.Fprintf(w, "Data:     %s\n", r.PieceRef)                      // nolint: errcheck
+	fmt.Fprintf(w, "Replicas: %d/%d\n", r.LiveReplicas(), r.Replicas) // nolint: errcheck
+	for _, d := range r.Deals {
+		fmt.Fprintf(w, "%s %s %s\n", d.Miner, d.ProposalCid, d.State) // nolint: errcheck
+	}
+	for _, f := range r.Failures {
+		fmt.Fprintf(w, "%s failed: %s\n", f.Miner, f.Error) // nolint: errcheck
+	}
+	return nil
+}
+
+var clientWatchDealCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Stream the events of a storage deal",
+		ShortDescription: `
+Outputs the current state of the storage deal proposal specified by the id,
+then its state changes, sector assignment, commitment, proven PoSts and
+redeemed payments as the miner reports them.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("id", true, false, "CID of deal to watch"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		propcid, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		events, err := GetAPI(env).Client().WatchStorageDeal(req.Context, propcid)
+		if err != nil {
+			return err
+		}
+
+		for e := range events {
+			if err := re.Emit(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: storagedeal.Event{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(printDealEvent),
+	},
+}
+
+func printDealEvent(req *cmds.Request, w io.Writer, e *storagedeal.Event) error {
+	var details []string
+	details = append(details, fmt.Sprintf("state: %s", e.State))
+	if e.SectorID != 0 {
+		details = append(details, fmt.Sprintf("sector: %d", e.SectorID))
+	}
+	if e.Amount != nil {
+		details = append(details, fmt.Sprintf("amount: %s", e.Amount))
+	}
+	if e.Message != "" {
+		details = append(details, fmt.Sprintf("message: %s", e.Message))
+	}
+	_, err := fmt.Fprintf(w, "%s %s: %s\n", e.ProposalCid, e.Kind, strings.Join(details, ", "))
+	return err
+}
+
+var clientQueryChainDealCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Query a deal published to the storage market",
+		ShortDescription: `
+Shows the terms and state of the deal the storage market actor holds under the
+given deal id. The deal id is reported by query-storage-deal once the miner has
+published the deal.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("deal-id", true, false, "id of the deal in the storage market"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		dealID, err := strconv.ParseUint(req.Arguments[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid deal id: %s", req.Arguments[0])
+		}
+
+		deal, err := GetPorcelainAPI(env).StorageMarketGetDeal(req.Context, dealID)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(deal)
+	},
+	Type: storagemarket.Deal{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, deal *storagemarket.Deal) error {
+			fmt.Fprintf(w, "State: %s\n", deal.State)           // nolint: errcheck
+			fmt.Fprintf(w, "Client: %s\n", deal.Client)         // nolint: errcheck
+			fmt.Fprintf(w, "Miner: %s\n", deal.Miner)           // nolint: errcheck
+			fmt.Fprintf(w, "Piece: %s\n", deal.PieceRef)        // nolint: errcheck
+			fmt.Fprintf(w, "Size: %s\n", deal.Size)             // nolint: errcheck
+			fmt.Fprintf(w, "Duration: %d\n", deal.Duration)     // nolint: errcheck
+			fmt.Fprintf(w, "Price: %s\n", deal.Price)           // nolint: errcheck
+			fmt.Fprintf(w, "Collateral: %s\n", deal.Collateral) // nolint: errcheck
+			if deal.State != storagemarket.DealPublished {
+				fmt.Fprintf(w, "Sector: %d\n", deal.SectorID) // nolint: errcheck
+				fmt.Fprintf(w, "Start: %s\n", deal.Start)     // nolint: errcheck
+			}
 			return nil
 		}),
 	},
@@ -232,6 +478,55 @@ respectively.
 	},
 }
 
+var clientAsksCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the order book of live asks in the storage market",
+		ShortDescription: `
+Lists the unexpired asks of the miners in the storage market, cheapest first.
+Results will be returned as a space separated table with miner, id, price,
+expiration and the number of free sectors of the miner respectively.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("max-price", "Only show asks priced at most this many FIL per byte per block"),
+		cmdkit.Uint64Option("min-free-sectors", "Only show asks of miners with at least this many pledged sectors free").WithDefault(uint64(0)),
+		cmdkit.IntOption("limit", "Show at most this many asks").WithDefault(0),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		filter := porcelain.AskFilter{
+			MinFreeSectors: req.Options["min-free-sectors"].(uint64),
+			Limit:          req.Options["limit"].(int),
+		}
+
+		if maxPrice, ok := req.Options["max-price"].(string); ok {
+			price, ok := types.NewAttoFILFromFILString(maxPrice)
+			if !ok {
+				return ErrInvalidPrice
+			}
+			filter.MaxPrice = price
+		}
+
+		asks, err := GetPorcelainAPI(env).StorageMarketAsks(req.Context, filter)
+		if err != nil {
+			return err
+		}
+
+		for _, ask := range asks {
+			if err := re.Emit(ask); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: porcelain.StorageAsk{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ask *porcelain.StorageAsk) error {
+			_, err := fmt.Fprintf(w, "%s %.3d %s %s %d\n", ask.Miner, ask.ID, ask.Price, ask.Expiry, ask.FreeSectors)
+			return err
+		}),
+	},
+}
+
 var paymentsCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline:          "List payments for a given deal",
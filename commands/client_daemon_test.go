@@ -29,6 +29,34 @@ func TestListAsks(t *testing.T) {
 	assert.Equal(fixtures.TestMiners[0]+" 000 20 11", listAsksOutput)
 }
 
+func TestClientAsks(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	minerDaemon := th.NewDaemon(t,
+		th.WithMiner(fixtures.TestMiners[0]),
+		th.KeyFile(fixtures.KeyFilePaths()[0]),
+		th.DefaultAddress(fixtures.TestAddresses[0]),
+	).Start()
+	defer minerDaemon.ShutdownSuccess()
+
+	minerDaemon.RunSuccess("mining start")
+	minerDaemon.MinerSetPrice(fixtures.TestMiners[0], fixtures.TestAddresses[0], "20", "10")
+	minerDaemon.MinerSetPrice(fixtures.TestMiners[0], fixtures.TestAddresses[0], "10", "10")
+
+	asks := strings.Split(minerDaemon.RunSuccess("client", "asks").ReadStdoutTrimNewlines(), "\n")
+	assert.Len(asks, 2)
+	assert.Contains(asks[0], fixtures.TestMiners[0]+" 001 10 ")
+	assert.Contains(asks[1], fixtures.TestMiners[0]+" 000 20 ")
+
+	cheapest := minerDaemon.RunSuccess("client", "asks", "--max-price", "15").ReadStdoutTrimNewlines()
+	assert.Contains(cheapest, fixtures.TestMiners[0]+" 001 10 ")
+	assert.NotContains(cheapest, " 20 ")
+
+	limited := minerDaemon.RunSuccess("client", "asks", "--limit", "1").ReadStdoutTrimNewlines()
+	assert.Equal(asks[0], limited)
+}
+
 func TestStorageDealsAfterRestart(t *testing.T) {
 	assert := assert.New(t)
 	minerDaemon := th.NewDaemon(t,
@@ -165,6 +165,7 @@ var rootSubcmdsDaemon = map[string]*cmds.Command{
 	"miner":            minerCmd,
 	"mining":           miningCmd,
 	"mpool":            mpoolCmd,
+	"multisig":         multisigCmd,
 	"paych":            paymentChannelCmd,
 	"ping":             pingCmd,
 	"retrieval-client": retrievalClientCmd,
@@ -300,6 +301,11 @@ func requiresDaemon(req *cmds.Request) bool {
 		return false
 	}
 
+	// chain replay works on a stopped repo.
+	if req.Command == chainReplayCmd {
+		return false
+	}
+
 	return true
 }
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 
 	cmds "gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
@@ -16,6 +17,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
 )
 
 var msgCmd = &cmds.Command{
@@ -30,9 +32,10 @@ var msgCmd = &cmds.Command{
 }
 
 type msgSendResult struct {
-	Cid     cid.Cid
-	GasUsed types.GasUnits
-	Preview bool
+	Cid          cid.Cid
+	GasUsed      types.GasUnits
+	GasBreakdown vm.GasBreakdown
+	Preview      bool
 }
 
 var msgSendCmd = &cmds.Command{
@@ -83,7 +86,7 @@ var msgSendCmd = &cmds.Command{
 		}
 
 		if preview {
-			usedGas, err := GetPorcelainAPI(env).MessagePreview(
+			usedGas, breakdown, err := GetPorcelainAPI(env).MessagePreviewBreakdown(
 				req.Context,
 				fromAddr,
 				target,
@@ -93,9 +96,10 @@ var msgSendCmd = &cmds.Command{
 				return err
 			}
 			return re.Emit(&msgSendResult{
-				Cid:     cid.Cid{},
-				GasUsed: usedGas,
-				Preview: true,
+				Cid:          cid.Cid{},
+				GasUsed:      usedGas,
+				GasBreakdown: breakdown,
+				Preview:      true,
 			})
 		}
 
@@ -123,14 +127,33 @@ var msgSendCmd = &cmds.Command{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *msgSendResult) error {
 			if res.Preview {
 				output := strconv.FormatUint(uint64(res.GasUsed), 10)
-				_, err := w.Write([]byte(output))
-				return err
+				if _, err := w.Write([]byte(output)); err != nil {
+					return err
+				}
+				return printGasBreakdown(w, res.GasBreakdown)
 			}
 			return PrintString(w, res.Cid)
 		}),
 	},
 }
 
+// printGasBreakdown writes one line per operation that consumed gas, in
+// alphabetical order of operation.
+func printGasBreakdown(w io.Writer, breakdown vm.GasBreakdown) error {
+	var ops []string
+	for op := range breakdown {
+		ops = append(ops, string(op))
+	}
+	sort.Strings(ops)
+
+	for _, op := range ops {
+		if _, err := fmt.Fprintf(w, "\n  %s: %d", op, breakdown[exec.GasOp(op)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // WaitResult is the result of a message wait call.
 type WaitResult struct {
 	Message   *types.SignedMessage
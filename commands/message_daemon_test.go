@@ -1,14 +1,12 @@
 package commands
 
 import (
-	"encoding/json"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
-	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
 
 	"github.com/filecoin-project/go-filecoin/fixtures"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
@@ -109,35 +107,30 @@ func TestMessageSendBlockGasLimit(t *testing.T) {
 
 	doubleTheBlockGasLimit := strconv.Itoa(int(types.BlockGasLimit) * 2)
 	halfTheBlockGasLimit := strconv.Itoa(int(types.BlockGasLimit) / 2)
-	result := struct{ Messages []interface{} }{}
 
 	t.Run("when the gas limit is above the block limit, the message fails", func(t *testing.T) {
-		d.RunSuccess(
+		msgCid := d.RunSuccess(
 			"message", "send",
 			"--price", "0", "--limit", doubleTheBlockGasLimit,
 			"--value=10", fixtures.TestAddresses[1],
-		)
+		).ReadStdoutTrimNewlines()
 
 		blockCid := d.RunSuccess("mining", "once").ReadStdoutTrimNewlines()
 
-		blockInfo := d.RunSuccess("show", "block", blockCid, "--enc", "json").ReadStdoutTrimNewlines()
-
-		require.NoError(t, json.Unmarshal([]byte(blockInfo), &result))
-		assert.Empty(t, result.Messages, "msg over the block gas limit fails validation and is _NOT_ run in the block")
+		// msg over the block gas limit fails validation and is _NOT_ run in the block
+		d.RunFail("not in block", "chain", "prove-message", blockCid, msgCid)
 	})
 
 	t.Run("when the gas limit is below the block limit, the message succeeds", func(t *testing.T) {
-		d.RunSuccess(
+		msgCid := d.RunSuccess(
 			"message", "send",
 			"--price", "0", "--limit", halfTheBlockGasLimit,
 			"--value=10", fixtures.TestAddresses[1],
-		)
+		).ReadStdoutTrimNewlines()
 
 		blockCid := d.RunSuccess("mining", "once").ReadStdoutTrimNewlines()
 
-		blockInfo := d.RunSuccess("show", "block", blockCid, "--enc", "json").ReadStdoutTrimNewlines()
-
-		require.NoError(t, json.Unmarshal([]byte(blockInfo), &result))
-		assert.NotEmpty(t, result.Messages, "msg under the block gas limit passes validation and is run in the block")
+		// msg under the block gas limit passes validation and is run in the block
+		d.RunSuccess("chain", "prove-message", blockCid, msgCid)
 	})
 }
@@ -5,7 +5,9 @@ import (
 	"io"
 	"math/big"
 	"strconv"
+	"strings"
 
+	"gx/ipfs/QmQmhotPUzVrMEWNK3x1R5jQ5ZHWyL7tVUrmRPjrBrvyCb/go-ipfs-files"
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
@@ -22,13 +24,24 @@ var minerCmd = &cmds.Command{
 		Tagline: "Manage a single miner actor",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"create":        minerCreateCmd,
-		"add-ask":       minerAddAskCmd,
-		"owner":         minerOwnerCmd,
-		"pledge":        minerPledgeCmd,
-		"power":         minerPowerCmd,
-		"set-price":     minerSetPriceCmd,
-		"update-peerid": minerUpdatePeerIDCmd,
+		"create":              minerCreateCmd,
+		"add-ask":             minerAddAskCmd,
+		"owner":               minerOwnerCmd,
+		"pledge":              minerPledgeCmd,
+		"power":               minerPowerCmd,
+		"report-missed-post":  minerReportMissedPoStCmd,
+		"set-price":           minerSetPriceCmd,
+		"update-peerid":       minerUpdatePeerIDCmd,
+		"collateral":          minerCollateralCmd,
+		"add-collateral":      minerAddCollateralCmd,
+		"increase-pledge":     minerIncreasePledgeCmd,
+		"withdraw-collateral": minerWithdrawCollateralCmd,
+		"exit":                minerExitCmd,
+		"worker":              minerWorkerCmd,
+		"change-worker":       minerChangeWorkerCmd,
+		"transfer-ownership":  minerTransferOwnershipCmd,
+		"import-deal-data":    minerImportDealDataCmd,
+		"deals":               minerDealsCmd,
 	},
 }
 
@@ -367,6 +380,97 @@ var minerUpdatePeerIDCmd = &cmds.Command{
 	},
 }
 
+type minerReportMissedPoStResult struct {
+	Cid     cid.Cid
+	GasUsed types.GasUnits
+	Preview bool
+}
+
+var minerReportMissedPoStCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Report a miner that missed its proving period",
+		ShortDescription: `
+Issues a message reporting that <miner> did not submit a proof of spacetime by
+the end of the grace period following its proving period. The miner loses its
+power until it proves its storage again and part of its collateral is slashed.
+A miner missing several proving periods in a row loses its sectors.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "Address of the miner that missed its proving period"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from"),
+		priceOption,
+		limitOption,
+		previewOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid miner address")
+		}
+
+		fromAddr, err := optionalAddr(req.Options["from"])
+		if err != nil {
+			return err
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MessagePreview(
+				req.Context,
+				fromAddr,
+				minerAddr,
+				"reportMissedPoSt",
+			)
+			if err != nil {
+				return err
+			}
+
+			return re.Emit(&minerReportMissedPoStResult{
+				Cid:     cid.Cid{},
+				GasUsed: usedGas,
+				Preview: true,
+			})
+		}
+
+		c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
+			req.Context,
+			fromAddr,
+			minerAddr,
+			nil,
+			gasPrice,
+			gasLimit,
+			"reportMissedPoSt",
+		)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&minerReportMissedPoStResult{
+			Cid:     c,
+			GasUsed: types.NewGasUnits(0),
+			Preview: false,
+		})
+	},
+	Type: &minerReportMissedPoStResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *minerReportMissedPoStResult) error {
+			if res.Preview {
+				output := strconv.FormatUint(uint64(res.GasUsed), 10)
+				_, err := w.Write([]byte(output))
+				return err
+			}
+			return PrintString(w, res.Cid)
+		}),
+	},
+}
+
 type minerAddAskResult struct {
 	Cid     cid.Cid
 	GasUsed types.GasUnits
@@ -551,3 +655,53 @@ Values will be output as a ratio where the first number is the miner power and s
 		}),
 	},
 }
+
+var minerImportDealDataCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Load the data of a storage deal transferred out of band",
+		ShortDescription: `
+Imports the data of a storage deal proposed with --manual-transfer. The data
+is either the file the client imported or, if its name ends in .car, a car
+file holding the piece. It must match the piece of the deal, which then goes
+on to be added to a sector and sealed like any other.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("proposal", true, false, "CID of the deal proposal"),
+		cmdkit.FileArg("file", true, false, "Path to the file or car file holding the data").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("car", "Read the data as a car file whatever its name"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		proposalCid, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		iter := req.Files.Entries()
+		if !iter.Next() {
+			return fmt.Errorf("no file given: %s", iter.Err())
+		}
+
+		fi, ok := iter.Node().(files.File)
+		if !ok {
+			return fmt.Errorf("given file was not a files.File")
+		}
+
+		isCar, _ := req.Options["car"].(bool)
+		isCar = isCar || strings.HasSuffix(iter.Name(), ".car")
+
+		if err := GetAPI(env).Miner().ImportDealData(req.Context, proposalCid, fi, isCar); err != nil {
+			return err
+		}
+
+		return re.Emit(proposalCid)
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
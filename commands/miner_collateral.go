@@ -0,0 +1,240 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+
+	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type minerMessageResult struct {
+	Cid     cid.Cid
+	GasUsed types.GasUnits
+	Preview bool
+}
+
+var minerMessageOptions = []cmdkit.Option{
+	cmdkit.StringOption("from", "Address to send from"),
+	priceOption,
+	limitOption,
+	previewOption,
+}
+
+var minerMessageResultEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *minerMessageResult) error {
+		if res.Preview {
+			output := strconv.FormatUint(uint64(res.GasUsed), 10)
+			_, err := w.Write([]byte(output))
+			return err
+		}
+		return PrintString(w, res.Cid)
+	}),
+}
+
+var minerCollateralCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline:          "View the collateral of <miner>",
+		ShortDescription: `Shows the amount of FIL the given miner holds as collateral for its pledge`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The miner address"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid miner address")
+		}
+
+		bytes, _, err := GetPorcelainAPI(env).MessageQuery(
+			req.Context,
+			address.Address{},
+			minerAddr,
+			"getCollateral",
+		)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(types.NewAttoFILFromBytes(bytes[0]))
+	},
+	Type: types.AttoFIL{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, collateral *types.AttoFIL) error {
+			return PrintString(w, collateral)
+		}),
+	},
+}
+
+var minerAddCollateralCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline:          "Add <amount> FIL to the collateral of <miner>",
+		ShortDescription: `Issues a new message to the network sending FIL to the miner as collateral.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The miner address"),
+		cmdkit.StringArg("amount", true, false, "Amount of FIL to add"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid miner address")
+		}
+
+		amount, ok := types.NewAttoFILFromFILString(req.Arguments[1])
+		if !ok {
+			return ErrInvalidAmount
+		}
+
+		return sendMinerMessage(req, re, env, minerAddr, amount, "addCollateral")
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+var minerIncreasePledgeCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Pledge <sectors> more sectors for <miner>",
+		ShortDescription: `Issues a new message to the network raising the miner's pledge. The miner's
+collateral, including any sent with --collateral, must cover the minimum
+collateral of the new pledge.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The miner address"),
+		cmdkit.StringArg("sectors", true, false, "Number of sectors to add to the pledge"),
+	},
+	Options: append([]cmdkit.Option{
+		cmdkit.StringOption("collateral", "Amount of FIL to add to the collateral").WithDefault("0"),
+	}, minerMessageOptions...),
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid miner address")
+		}
+
+		sectors, ok := big.NewInt(0).SetString(req.Arguments[1], 10)
+		if !ok {
+			return fmt.Errorf("invalid number of sectors: %s", req.Arguments[1])
+		}
+
+		collateral, ok := types.NewAttoFILFromFILString(req.Options["collateral"].(string))
+		if !ok {
+			return ErrInvalidAmount
+		}
+
+		return sendMinerMessage(req, re, env, minerAddr, collateral, "increasePledge", sectors)
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+var minerWithdrawCollateralCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Withdraw <amount> FIL of collateral from <miner>",
+		ShortDescription: `Issues a new message to the network sending collateral in excess of the
+minimum for the miner's pledge back to its owner.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The miner address"),
+		cmdkit.StringArg("amount", true, false, "Amount of FIL to withdraw"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid miner address")
+		}
+
+		amount, ok := types.NewAttoFILFromFILString(req.Arguments[1])
+		if !ok {
+			return ErrInvalidAmount
+		}
+
+		return sendMinerMessage(req, re, env, minerAddr, nil, "withdrawCollateral", amount)
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+var minerExitCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove <miner> from the storage market",
+		ShortDescription: `Issues a new message to the network removing the miner from the storage
+market and returning all of its collateral to its owner. The miner must not
+have any committed sectors.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The miner address"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid miner address")
+		}
+
+		return sendMinerMessage(req, re, env, minerAddr, nil, "exit")
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+// sendMinerMessage sends, or previews with --preview, a message calling
+// method on the miner actor at minerAddr.
+func sendMinerMessage(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment, minerAddr address.Address, value *types.AttoFIL, method string, params ...interface{}) error {
+	fromAddr, err := optionalAddr(req.Options["from"])
+	if err != nil {
+		return err
+	}
+
+	gasPrice, gasLimit, preview, err := parseGasOptions(req)
+	if err != nil {
+		return err
+	}
+
+	if preview {
+		usedGas, err := GetPorcelainAPI(env).MessagePreview(
+			req.Context,
+			fromAddr,
+			minerAddr,
+			method,
+			params...,
+		)
+		if err != nil {
+			return err
+		}
+		return re.Emit(&minerMessageResult{
+			Cid:     cid.Cid{},
+			GasUsed: usedGas,
+			Preview: true,
+		})
+	}
+
+	c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
+		req.Context,
+		fromAddr,
+		minerAddr,
+		value,
+		gasPrice,
+		gasLimit,
+		method,
+		params...,
+	)
+	if err != nil {
+		return err
+	}
+
+	return re.Emit(&minerMessageResult{
+		Cid:     c,
+		GasUsed: types.NewGasUnits(0),
+		Preview: false,
+	})
+}
@@ -35,13 +35,22 @@ func TestMinerHelp(t *testing.T) {
 		t.Parallel()
 
 		expected := []string{
-			"miner add-ask <miner> <price> <expiry>  - DEPRECATED: Use set-price",
-			"miner create <pledge> <collateral>      - Create a new file miner with <pledge> sectors and <collateral> FIL",
-			"miner owner <miner>                     - Show the actor address of <miner>",
-			"miner pledge <miner>                    - View number of pledged sectors for <miner>",
-			"miner power <miner>                     - Get the power of a miner versus the total storage market power",
-			"miner set-price <storageprice> <expiry> - Set the minimum price for storage",
-			"miner update-peerid <address> <peerid>  - Change the libp2p identity that a miner is operating",
+			"miner add-ask <miner> <price> <expiry>     - DEPRECATED: Use set-price",
+			"miner add-collateral <miner> <amount>      - Add <amount> FIL to the collateral of <miner>",
+			"miner change-worker <miner> <worker>       - Make <worker> the worker address of <miner>",
+			"miner collateral <miner>                   - View the collateral of <miner>",
+			"miner create <pledge> <collateral>         - Create a new file miner with <pledge> sectors and <collateral> FIL",
+			"miner exit <miner>                         - Remove <miner> from the storage market",
+			"miner increase-pledge <miner> <sectors>    - Pledge <sectors> more sectors for <miner>",
+			"miner owner <miner>                        - Show the actor address of <miner>",
+			"miner pledge <miner>                       - View number of pledged sectors for <miner>",
+			"miner power <miner>                        - Get the power of a miner versus the total storage market power",
+			"miner report-missed-post <miner>           - Report a miner that missed its proving period",
+			"miner set-price <storageprice> <expiry>    - Set the minimum price for storage",
+			"miner transfer-ownership <miner> <owner>   - Make <owner> the owner of <miner>",
+			"miner update-peerid <address> <peerid>     - Change the libp2p identity that a miner is operating",
+			"miner withdraw-collateral <miner> <amount> - Withdraw <amount> FIL of collateral from <miner>",
+			"miner worker <miner>                       - Show the worker address of <miner>",
 		}
 
 		result := runHelpSuccess(t, "miner", "--help")
@@ -61,6 +70,13 @@ func TestMinerHelp(t *testing.T) {
 		result := runHelpSuccess(t, "miner", "update-peerid", "--help")
 		assert.Contains(result, "Issues a new message to the network to update the miner's libp2p identity.")
 	})
+
+	t.Run("report-missed-post --help shows report-missed-post help", func(t *testing.T) {
+		t.Parallel()
+		result := runHelpSuccess(t, "miner", "report-missed-post", "--help")
+		assert.Contains(result, "Issues a message reporting that <miner> did not submit a proof of spacetime")
+	})
+
 	t.Run("add-ask --help shows add-ask help", func(t *testing.T) {
 		t.Parallel()
 		result := runHelpSuccess(t, "miner", "add-ask", "--help")
@@ -358,7 +374,7 @@ func TestMinerCreateChargesGas(t *testing.T) {
 	d1.MineAndPropagate(time.Second, d)
 	wg.Wait()
 
-	expectedBlockReward := consensus.NewDefaultBlockRewarder().BlockRewardAmount()
+	expectedBlockReward := consensus.NewDefaultBlockRewarder().BlockRewardAmount(types.NewBlockHeight(0))
 	expectedPrice := types.NewAttoFILFromFIL(333)
 	expectedGasCost := big.NewInt(100)
 	expectedBalance := expectedBlockReward.Add(expectedPrice.MulBigInt(expectedGasCost))
@@ -524,3 +540,44 @@ var testConfig = &gengen.GenesisCfg{
 		},
 	},
 }
+
+func TestMinerCollateral(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := th.NewDaemon(t, th.WithMiner(fixtures.TestMiners[0]), th.KeyFile(fixtures.KeyFilePaths()[0]), th.DefaultAddress(fixtures.TestAddresses[0])).Start()
+	defer d.ShutdownSuccess()
+
+	collateral := func() *types.AttoFIL {
+		out := d.RunSuccess("miner", "collateral", fixtures.TestMiners[0]).ReadStdoutTrimNewlines()
+		amount, ok := types.NewAttoFILFromFILString(out)
+		require.True(ok)
+		return amount
+	}
+	before := collateral()
+
+	d.RunSuccess("miner", "add-collateral", "--price", "0", "--limit", "300", fixtures.TestMiners[0], "5")
+	d.RunSuccess("mining", "once")
+	assert.Equal(before.Add(types.NewAttoFILFromFIL(5)), collateral())
+
+	d.RunSuccess("miner", "withdraw-collateral", "--price", "0", "--limit", "300", fixtures.TestMiners[0], "2")
+	d.RunSuccess("mining", "once")
+	assert.Equal(before.Add(types.NewAttoFILFromFIL(3)), collateral())
+}
+
+func TestMinerWorker(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := th.NewDaemon(t, th.WithMiner(fixtures.TestMiners[0]), th.KeyFile(fixtures.KeyFilePaths()[0]), th.DefaultAddress(fixtures.TestAddresses[0])).Start()
+	defer d.ShutdownSuccess()
+
+	owner := d.RunSuccess("miner", "owner", fixtures.TestMiners[0]).ReadStdoutTrimNewlines()
+	assert.Equal(owner, d.RunSuccess("miner", "worker", fixtures.TestMiners[0]).ReadStdoutTrimNewlines())
+
+	d.RunSuccess("miner", "change-worker", "--price", "0", "--limit", "300", fixtures.TestMiners[0], fixtures.TestAddresses[1])
+	d.RunSuccess("mining", "once")
+	assert.Equal(fixtures.TestAddresses[1], d.RunSuccess("miner", "worker", fixtures.TestMiners[0]).ReadStdoutTrimNewlines())
+	assert.Equal(owner, d.RunSuccess("miner", "owner", fixtures.TestMiners[0]).ReadStdoutTrimNewlines())
+}
@@ -0,0 +1,224 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+)
+
+var minerDealsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the storage deals of the miner",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":     minerDealsLsCmd,
+		"reject": minerDealsRejectCmd,
+		"show":   minerDealsShowCmd,
+		"watch":  minerDealsWatchCmd,
+	},
+}
+
+var minerDealsWatchCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Stream the events of the storage deals of the miner",
+		ShortDescription: `
+Outputs the state changes, sector assignments, commitments, proven PoSts and
+redeemed payments of the storage deals of the miner as they happen.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		events, err := GetAPI(env).Miner().WatchDeals(req.Context)
+		if err != nil {
+			return err
+		}
+
+		for e := range events {
+			if err := re.Emit(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: storagedeal.Event{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(printDealEvent),
+	},
+}
+
+var minerDealsLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the storage deals of the miner",
+		ShortDescription: `
+Lists the storage deals the miner received, one per line: proposal cid, state,
+client, sector (- if the piece is not in a sector yet) and size in bytes.
+Deals can be filtered by state, client and sector.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("state", "comma separated states of the deals to list, e.g. accepted,staged"),
+		cmdkit.StringOption("client", "only list the deals paid by this client address"),
+		cmdkit.Uint64Option("sector", "only list the deals with their piece in this sector"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		var filter storagedeal.DealFilter
+
+		if states, ok := req.Options["state"].(string); ok && states != "" {
+			for _, s := range strings.Split(states, ",") {
+				state, err := storagedeal.ParseState(strings.TrimSpace(s))
+				if err != nil {
+					return err
+				}
+				filter.States = append(filter.States, state)
+			}
+		}
+
+		if client, ok := req.Options["client"].(string); ok && client != "" {
+			addr, err := address.NewFromString(client)
+			if err != nil {
+				return err
+			}
+			filter.Client = addr
+		}
+
+		if sector, ok := req.Options["sector"].(uint64); ok {
+			filter.Sector = &sector
+		}
+
+		deals, err := GetAPI(env).Miner().Deals(req.Context, filter)
+		if err != nil {
+			return err
+		}
+
+		for _, deal := range deals {
+			if err := re.Emit(deal); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: storagedeal.MinerDeal{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, deal *storagedeal.MinerDeal) error {
+			sector := "-"
+			if deal.Sector != nil {
+				sector = fmt.Sprintf("%d", *deal.Sector)
+			}
+			_, err := fmt.Fprintf(w, "%s %s %s %s %s\n", deal.Response.ProposalCid, deal.Response.State, deal.Proposal.Payment.Payer, sector, deal.Proposal.Size)
+			return err
+		}),
+	},
+}
+
+var minerDealsShowCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show a storage deal of the miner",
+		ShortDescription: `
+Shows the proposal, payment vouchers, state, sector and commitments of the
+storage deal of the miner with the given proposal cid.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("id", true, false, "CID of the deal proposal"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		propcid, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		deal, err := GetAPI(env).Miner().Deal(req.Context, propcid)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(deal)
+	},
+	Type: storagedeal.MinerDeal{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(printMinerDeal),
+	},
+}
+
+func printMinerDeal(req *cmds.Request, w io.Writer, deal *storagedeal.MinerDeal) error {
+	p, resp := deal.Proposal, deal.Response
+
+	fmt.Fprintf(w, "Proposal: %s\n", resp.ProposalCid)    // nolint: errcheck
+	fmt.Fprintf(w, "Client: %s\n", p.Payment.Payer)       // nolint: errcheck
+	fmt.Fprintf(w, "Piece: %s\n", p.PieceRef)             // nolint: errcheck
+	fmt.Fprintf(w, "Size: %s\n", p.Size)                  // nolint: errcheck
+	fmt.Fprintf(w, "Padded size: %s\n", p.PaddedSize)     // nolint: errcheck
+	fmt.Fprintf(w, "Duration: %d blocks\n", p.Duration)   // nolint: errcheck
+	fmt.Fprintf(w, "Total price: %s FIL\n", p.TotalPrice) // nolint: errcheck
+	fmt.Fprintf(w, "Transfer mode: %s\n", p.TransferMode) // nolint: errcheck
+	fmt.Fprintf(w, "Status: %s\n", resp.State)            // nolint: errcheck
+	fmt.Fprintf(w, "Message: %s\n", resp.Message)         // nolint: errcheck
+	if deal.Stage != "" {
+		fmt.Fprintf(w, "Stage: %s\n", deal.Stage) // nolint: errcheck
+	}
+	if resp.DealID != 0 {
+		fmt.Fprintf(w, "Deal ID: %d\n", resp.DealID) // nolint: errcheck
+	}
+	if deal.Sector != nil {
+		fmt.Fprintf(w, "Sector: %d\n", *deal.Sector) // nolint: errcheck
+	}
+
+	fmt.Fprintf(w, "CommP: %x\n", p.PieceCommitment) // nolint: errcheck
+	if resp.ProofInfo != nil {
+		fmt.Fprintf(w, "CommD: %x\n", resp.ProofInfo.CommD) // nolint: errcheck
+		fmt.Fprintf(w, "CommR: %x\n", resp.ProofInfo.CommR) // nolint: errcheck
+	}
+
+	if p.Payment.Channel != nil {
+		fmt.Fprintf(w, "Payment channel: %s\n", p.Payment.Channel) // nolint: errcheck
+	}
+	fmt.Fprintf(w, "Vouchers:\n") // nolint: errcheck
+	for _, v := range p.Payment.Vouchers {
+		fmt.Fprintf(w, "  nonce %d lane %d: %s FIL valid at %s\n", v.Nonce, v.Lane, v.Amount, &v.ValidAt) // nolint: errcheck
+	}
+	return nil
+}
+
+var minerDealsRejectCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Reject a storage deal the miner accepted",
+		ShortDescription: `
+Cancels a storage deal the miner accepted while its data is still being
+transferred. The client sees the deal rejected with the reason. Deals the
+miner already published to the storage market cannot be rejected. Data of the
+deal already received stays in the miner's blockstore.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("id", true, false, "CID of the deal proposal"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("reason", "reason for the rejection, sent to the client"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		propcid, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		reason, _ := req.Options["reason"].(string)
+		if err := GetAPI(env).Miner().RejectDeal(req.Context, propcid, reason); err != nil {
+			return err
+		}
+
+		return re.Emit(propcid)
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			_, err := fmt.Fprintf(w, "rejected deal %s\n", c)
+			return err
+		}),
+	},
+}
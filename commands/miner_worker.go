@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"io"
+
+	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+var minerWorkerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the worker address of <miner>",
+		ShortDescription: `Given <miner> miner address, output the address authorized to commit sectors
+and submit PoSts for the miner.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The address of the miner"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid miner address")
+		}
+
+		workerAddr, err := GetPorcelainAPI(env).MinerGetWorkerAddress(req.Context, minerAddr)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&workerAddr)
+	},
+	Type: address.Address{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, a *address.Address) error {
+			return PrintString(w, a)
+		}),
+	},
+}
+
+var minerChangeWorkerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Make <worker> the worker address of <miner>",
+		ShortDescription: `Issues a new message to the network changing the address authorized to commit
+sectors and submit PoSts for the miner. It must be sent by the miner's owner.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The miner address"),
+		cmdkit.StringArg("worker", true, false, "The new worker address"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid miner address")
+		}
+
+		workerAddr, err := address.NewFromString(req.Arguments[1])
+		if err != nil {
+			return errors.Wrap(err, "invalid worker address")
+		}
+
+		return sendMinerMessage(req, re, env, minerAddr, nil, "changeWorker", workerAddr)
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+var minerTransferOwnershipCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Make <owner> the owner of <miner>",
+		ShortDescription: `Issues a new message to the network handing control of the miner and its
+collateral to a new owner. It must be sent by the miner's current owner.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The miner address"),
+		cmdkit.StringArg("owner", true, false, "The new owner address"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid miner address")
+		}
+
+		ownerAddr, err := address.NewFromString(req.Arguments[1])
+		if err != nil {
+			return errors.Wrap(err, "invalid owner address")
+		}
+
+		return sendMinerMessage(req, re, env, minerAddr, nil, "transferOwnership", ownerAddr)
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
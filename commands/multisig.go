@@ -0,0 +1,413 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+
+	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/multisig"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var multisigCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Multisig wallet operations",
+		ShortDescription: `
+Multisig wallets are actors holding funds that are spent by transactions
+approved by a threshold of the wallet's signers. Any signer may propose a
+transaction; it is executed when enough signers have approved it.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add-signer":       multisigAddSignerCmd,
+		"approve":          multisigApproveCmd,
+		"cancel":           multisigCancelCmd,
+		"change-threshold": multisigChangeThresholdCmd,
+		"create":           multisigCreateCmd,
+		"deposit":          multisigDepositCmd,
+		"propose":          multisigProposeCmd,
+		"remove-signer":    multisigRemoveSignerCmd,
+		"show":             multisigShowCmd,
+	},
+}
+
+type multisigResult struct {
+	Cid     cid.Cid
+	GasUsed types.GasUnits
+	Preview bool
+}
+
+var multisigMessageOptions = []cmdkit.Option{
+	cmdkit.StringOption("from", "Address to send from"),
+	priceOption,
+	limitOption,
+	previewOption,
+}
+
+var multisigResultEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *multisigResult) error {
+		if res.Preview {
+			output := strconv.FormatUint(uint64(res.GasUsed), 10)
+			_, err := w.Write([]byte(output))
+			return err
+		}
+		return PrintString(w, res.Cid)
+	}),
+}
+
+var multisigCreateCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Create a new multisig wallet",
+		ShortDescription: `Issues a new message to the network to create a multisig wallet. The address of
+the wallet is the return value of the message.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("threshold", true, false, "Number of signers needed to approve a transaction"),
+		cmdkit.StringArg("signers", true, true, "Addresses of the signers of the wallet"),
+	},
+	Options: append([]cmdkit.Option{
+		cmdkit.StringOption("value", "Amount in FIL the wallet starts with").WithDefault("0"),
+	}, multisigMessageOptions...),
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		threshold, ok := big.NewInt(0).SetString(req.Arguments[0], 10)
+		if !ok {
+			return fmt.Errorf("invalid threshold")
+		}
+
+		var signers []address.Address
+		for _, arg := range req.Arguments[1:] {
+			signer, err := address.NewFromString(arg)
+			if err != nil {
+				return err
+			}
+			signers = append(signers, signer)
+		}
+
+		value, ok := types.NewAttoFILFromFILString(req.Options["value"].(string))
+		if !ok {
+			return ErrInvalidAmount
+		}
+
+		return sendMultisigMessage(req, re, env, address.MultisigAddress, value, "create", signers, threshold)
+	},
+	Type:     &multisigResult{},
+	Encoders: multisigResultEncoders,
+}
+
+var multisigDepositCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Add funds to a multisig wallet",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("wallet", true, false, "Address of the wallet"),
+		cmdkit.StringArg("amount", true, false, "Amount in FIL to add to the wallet"),
+	},
+	Options: multisigMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		wallet, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		amount, ok := types.NewAttoFILFromFILString(req.Arguments[1])
+		if !ok {
+			return ErrInvalidAmount
+		}
+
+		return sendMultisigMessage(req, re, env, wallet, amount, "")
+	},
+	Type:     &multisigResult{},
+	Encoders: multisigResultEncoders,
+}
+
+var multisigProposeCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Propose a transaction spending funds of a multisig wallet",
+		ShortDescription: `Proposes sending the amount from the wallet to the target, calling the given method
+if any with the given params. Proposing counts as the proposer's approval. The
+id of the transaction is the return value of the message.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("wallet", true, false, "Address of the wallet"),
+		cmdkit.StringArg("target", true, false, "Address to send funds to"),
+		cmdkit.StringArg("amount", true, false, "Amount in FIL to send"),
+	},
+	Options: append([]cmdkit.Option{
+		cmdkit.StringOption("method", "Method of the target to call"),
+		cmdkit.StringOption("params", "Hex encoded abi params of the method"),
+	}, multisigMessageOptions...),
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		wallet, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		target, err := address.NewFromString(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+
+		amount, ok := types.NewAttoFILFromFILString(req.Arguments[2])
+		if !ok {
+			return ErrInvalidAmount
+		}
+
+		method, _ := req.Options["method"].(string)
+
+		params, err := optionalHexBytes(req.Options["params"])
+		if err != nil {
+			return err
+		}
+		if params == nil {
+			params = []byte{}
+		}
+
+		return sendMultisigMessage(req, re, env, wallet, types.NewZeroAttoFIL(), "propose", target, amount, method, params)
+	},
+	Type:     &multisigResult{},
+	Encoders: multisigResultEncoders,
+}
+
+var multisigApproveCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Approve a pending transaction of a multisig wallet",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("wallet", true, false, "Address of the wallet"),
+		cmdkit.StringArg("transaction", true, false, "Id of the transaction"),
+	},
+	Options: multisigMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return sendMultisigTxMessage(req, re, env, "approve")
+	},
+	Type:     &multisigResult{},
+	Encoders: multisigResultEncoders,
+}
+
+var multisigCancelCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Cancel a transaction of a multisig wallet you proposed",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("wallet", true, false, "Address of the wallet"),
+		cmdkit.StringArg("transaction", true, false, "Id of the transaction"),
+	},
+	Options: multisigMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return sendMultisigTxMessage(req, re, env, "cancel")
+	},
+	Type:     &multisigResult{},
+	Encoders: multisigResultEncoders,
+}
+
+var multisigAddSignerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Propose adding a signer to a multisig wallet",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("wallet", true, false, "Address of the wallet"),
+		cmdkit.StringArg("signer", true, false, "Address of the signer to add"),
+	},
+	Options: multisigMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		signer, err := address.NewFromString(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		return proposeMultisigChange(req, re, env, multisig.AddSigner, signer)
+	},
+	Type:     &multisigResult{},
+	Encoders: multisigResultEncoders,
+}
+
+var multisigRemoveSignerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Propose removing a signer from a multisig wallet",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("wallet", true, false, "Address of the wallet"),
+		cmdkit.StringArg("signer", true, false, "Address of the signer to remove"),
+	},
+	Options: multisigMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		signer, err := address.NewFromString(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		return proposeMultisigChange(req, re, env, multisig.RemoveSigner, signer)
+	},
+	Type:     &multisigResult{},
+	Encoders: multisigResultEncoders,
+}
+
+var multisigChangeThresholdCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Propose changing the threshold of a multisig wallet",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("wallet", true, false, "Address of the wallet"),
+		cmdkit.StringArg("threshold", true, false, "Number of signers needed to approve a transaction"),
+	},
+	Options: multisigMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		threshold, ok := big.NewInt(0).SetString(req.Arguments[1], 10)
+		if !ok {
+			return fmt.Errorf("invalid threshold")
+		}
+		return proposeMultisigChange(req, re, env, multisig.ChangeThreshold, threshold)
+	},
+	Type:     &multisigResult{},
+	Encoders: multisigResultEncoders,
+}
+
+var multisigShowCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the balance, signers and pending transactions of a multisig wallet",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("wallet", true, false, "Address of the wallet"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address for which message is sent"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, err := optionalAddr(req.Options["from"])
+		if err != nil {
+			return err
+		}
+
+		wallet, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		walletState, err := GetPorcelainAPI(env).MultisigGet(req.Context, fromAddr, wallet)
+		if err != nil {
+			return err
+		}
+
+		balance, err := GetPorcelainAPI(env).WalletBalance(req.Context, wallet)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&multisigView{Balance: balance, State: *walletState})
+	},
+	Type: multisigView{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, wallet *multisigView) error {
+			if _, err := fmt.Fprintf(w, "balance: %s, threshold: %d of %d\n", wallet.Balance, wallet.Threshold, len(wallet.Signers)); err != nil {
+				return err
+			}
+			for _, signer := range wallet.Signers {
+				if _, err := fmt.Fprintf(w, "signer: %s\n", signer); err != nil {
+					return err
+				}
+			}
+			for id, tx := range wallet.Pending {
+				_, err := fmt.Fprintf(w, "%s: to: %s, value: %s, method: %q, approvals: %d\n", id, tx.To, tx.Value, tx.Method, len(tx.Approvals))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
+// multisigView is a multisig wallet as shown to users.
+type multisigView struct {
+	Balance *types.AttoFIL `json:"balance"`
+	multisig.State
+}
+
+// sendMultisigTxMessage sends a message calling method of the wallet given as
+// first argument with the transaction id given as second argument.
+func sendMultisigTxMessage(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment, method string) error {
+	wallet, err := address.NewFromString(req.Arguments[0])
+	if err != nil {
+		return err
+	}
+
+	txID, ok := big.NewInt(0).SetString(req.Arguments[1], 10)
+	if !ok || txID.Sign() < 0 {
+		return fmt.Errorf("invalid transaction id: %s", req.Arguments[1])
+	}
+
+	return sendMultisigMessage(req, re, env, wallet, types.NewZeroAttoFIL(), method, txID)
+}
+
+// proposeMultisigChange proposes a transaction to the wallet given as first
+// argument making the given change to the wallet itself.
+func proposeMultisigChange(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment, change string, param interface{}) error {
+	wallet, err := address.NewFromString(req.Arguments[0])
+	if err != nil {
+		return err
+	}
+
+	params, err := abi.ToEncodedValues(param)
+	if err != nil {
+		return err
+	}
+
+	return sendMultisigMessage(req, re, env, wallet, types.NewZeroAttoFIL(), "propose", wallet, types.NewZeroAttoFIL(), change, params)
+}
+
+// sendMultisigMessage sends, or previews, a message to the given multisig
+// actor and emits the result.
+func sendMultisigMessage(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment, to address.Address, value *types.AttoFIL, method string, params ...interface{}) error {
+	fromAddr, err := optionalAddr(req.Options["from"])
+	if err != nil {
+		return err
+	}
+
+	gasPrice, gasLimit, preview, err := parseGasOptions(req)
+	if err != nil {
+		return err
+	}
+
+	if preview {
+		usedGas, err := GetPorcelainAPI(env).MessagePreview(
+			req.Context,
+			fromAddr,
+			to,
+			method,
+			params...,
+		)
+		if err != nil {
+			return err
+		}
+		return re.Emit(&multisigResult{
+			Cid:     cid.Cid{},
+			GasUsed: usedGas,
+			Preview: true,
+		})
+	}
+
+	c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
+		req.Context,
+		fromAddr,
+		to,
+		value,
+		gasPrice,
+		gasLimit,
+		method,
+		params...,
+	)
+	if err != nil {
+		return err
+	}
+
+	return re.Emit(&multisigResult{
+		Cid:     c,
+		GasUsed: types.NewGasUnits(0),
+		Preview: false,
+	})
+}
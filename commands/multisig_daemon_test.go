@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/fixtures"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+)
+
+func TestMultisigCreateAndShow(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := th.NewDaemon(
+		t,
+		th.WithMiner(fixtures.TestMiners[0]),
+		th.KeyFile(fixtures.KeyFilePaths()[0]),
+	).Start()
+	defer d.ShutdownSuccess()
+
+	create := d.RunSuccess("multisig", "create",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		"--value", "100",
+		"2", fixtures.TestAddresses[0], fixtures.TestAddresses[1],
+	)
+	messageCid, err := cid.Parse(strings.Trim(create.ReadStdout(), "\n"))
+	require.NoError(err)
+
+	var wg sync.WaitGroup
+	var wallet string
+
+	wg.Add(1)
+	go func() {
+		wait := d.RunSuccess("message", "wait",
+			"--return",
+			"--message=false",
+			"--receipt=false",
+			messageCid.String(),
+		)
+		wallet = strings.Trim(wait.ReadStdout(), "\n")
+		wg.Done()
+	}()
+
+	d.RunSuccess("mining once")
+	wg.Wait()
+
+	show := d.RunSuccess("multisig", "show", "--from", fixtures.TestAddresses[0], wallet).ReadStdout()
+	assert.Contains(show, "balance: 100, threshold: 2 of 2")
+	assert.Contains(show, fixtures.TestAddresses[0])
+	assert.Contains(show, fixtures.TestAddresses[1])
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/plumbing/paychs"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -27,6 +28,7 @@ var paymentChannelCmd = &cmds.Command{
 		"ls":      lsCmd,
 		"reclaim": reclaimCmd,
 		"redeem":  redeemCmd,
+		"status":  statusCmd,
 		"voucher": voucherCmd,
 	},
 }
@@ -132,6 +134,50 @@ message to be mined to get the channelID.`,
 	},
 }
 
+var statusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the payment channels opened by this node",
+		ShortDescription: `
+Shows every payment channel opened by a wallet address of this node: its funds,
+how much the target redeemed, its eol, and the vouchers issued on it. Expired
+channels are reclaimed automatically.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		channels, err := GetPorcelainAPI(env).PaymentChannelStatus(req.Context)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(channels)
+	},
+	Type: []*paychs.ChannelInfo{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, channels *[]*paychs.ChannelInfo) error {
+			if len(*channels) == 0 {
+				fmt.Fprintln(w, "no channels") // nolint: errcheck
+				return nil
+			}
+
+			for _, c := range *channels {
+				state := "open"
+				if c.Closed {
+					state = "closed"
+				} else if c.ReclaimedAt != nil {
+					state = "reclaiming"
+				}
+
+				_, err := fmt.Fprintf(w, "%s: payer: %s, target: %s, amt: %v, amt redeemed: %v, eol: %v, vouchers: %d, amt vouchered: %v, %s\n",
+					c.Channel, c.Payer, c.Target, c.Amount, c.AmountRedeemed, c.Eol, len(c.Vouchers), c.AmountCommitted, state)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
 var lsCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline:          "List all payment channels for a payer",
@@ -191,6 +237,10 @@ var voucherCmd = &cmds.Command{
 	Options: []cmdkit.Option{
 		cmdkit.StringOption("from", "Address for which to retrieve channels"),
 		cmdkit.StringOption("validat", "Smallest block height at which target can redeem"),
+		cmdkit.Uint64Option("lane", "Lane of the channel the voucher pays on").WithDefault(uint64(0)),
+		cmdkit.Uint64Option("nonce", "Nonce of the voucher on its lane, defaults to the one after the last issued or redeemed"),
+		cmdkit.StringOption("merge", "Comma separated lane:nonce pairs of other lanes the voucher settles"),
+		cmdkit.StringOption("hash-lock", "Hex encoded sha256 hash lock the target must reveal a preimage of to redeem"),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		fromAddr, err := optionalAddr(req.Options["from"])
@@ -213,7 +263,20 @@ var voucherCmd = &cmds.Command{
 			return err
 		}
 
-		voucher, err := GetPorcelainAPI(env).PaymentChannelVoucher(req.Context, fromAddr, channel, amount, validAt)
+		lane, _ := req.Options["lane"].(uint64)
+		nonce, _ := req.Options["nonce"].(uint64)
+
+		merges, err := parseVoucherMerges(req.Options["merge"])
+		if err != nil {
+			return err
+		}
+
+		hashLock, err := optionalHexBytes(req.Options["hash-lock"])
+		if err != nil {
+			return err
+		}
+
+		voucher, err := GetPorcelainAPI(env).PaymentChannelVoucher(req.Context, fromAddr, channel, amount, validAt, lane, nonce, merges, hashLock)
 		if err != nil {
 			return err
 		}
@@ -248,6 +311,7 @@ var redeemCmd = &cmds.Command{
 	},
 	Options: []cmdkit.Option{
 		cmdkit.StringOption("from", "Address of the channel target"),
+		cmdkit.StringOption("preimage", "Hex encoded preimage of the voucher's hash lock"),
 		priceOption,
 		limitOption,
 		previewOption,
@@ -258,6 +322,11 @@ var redeemCmd = &cmds.Command{
 			return err
 		}
 
+		preimage, err := optionalHexBytes(req.Options["preimage"])
+		if err != nil {
+			return err
+		}
+
 		gasPrice, gasLimit, preview, err := parseGasOptions(req)
 		if err != nil {
 			return err
@@ -275,12 +344,17 @@ var redeemCmd = &cmds.Command{
 				return err
 			}
 
+			params, err := voucher.RedeemParams(preimage)
+			if err != nil {
+				return err
+			}
+
 			usedGas, err := GetPorcelainAPI(env).MessagePreview(
 				req.Context,
 				fromAddr,
 				address.PaymentBrokerAddress,
 				"redeem",
-				voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
+				params...,
 			)
 			if err != nil {
 				return err
@@ -297,6 +371,11 @@ var redeemCmd = &cmds.Command{
 			return err
 		}
 
+		params, err := voucher.RedeemParams(preimage)
+		if err != nil {
+			return err
+		}
+
 		c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
 			req.Context,
 			fromAddr,
@@ -305,7 +384,7 @@ var redeemCmd = &cmds.Command{
 			gasPrice,
 			gasLimit,
 			"redeem",
-			voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
+			params...,
 		)
 		if err != nil {
 			return err
@@ -431,6 +510,7 @@ var closeCmd = &cmds.Command{
 	},
 	Options: []cmdkit.Option{
 		cmdkit.StringOption("from", "Address of the channel target"),
+		cmdkit.StringOption("preimage", "Hex encoded preimage of the voucher's hash lock"),
 		priceOption,
 		limitOption,
 		previewOption,
@@ -441,6 +521,11 @@ var closeCmd = &cmds.Command{
 			return err
 		}
 
+		preimage, err := optionalHexBytes(req.Options["preimage"])
+		if err != nil {
+			return err
+		}
+
 		gasPrice, gasLimit, preview, err := parseGasOptions(req)
 		if err != nil {
 			return err
@@ -458,12 +543,17 @@ var closeCmd = &cmds.Command{
 				return err
 			}
 
+			params, err := voucher.RedeemParams(preimage)
+			if err != nil {
+				return err
+			}
+
 			usedGas, err := GetPorcelainAPI(env).MessagePreview(
 				req.Context,
 				fromAddr,
 				address.PaymentBrokerAddress,
 				"close",
-				voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
+				params...,
 			)
 			if err != nil {
 				return err
@@ -480,6 +570,11 @@ var closeCmd = &cmds.Command{
 			return err
 		}
 
+		params, err := voucher.RedeemParams(preimage)
+		if err != nil {
+			return err
+		}
+
 		c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
 			req.Context,
 			fromAddr,
@@ -488,7 +583,7 @@ var closeCmd = &cmds.Command{
 			gasPrice,
 			gasLimit,
 			"close",
-			voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
+			params...,
 		)
 		if err != nil {
 			return err
@@ -145,6 +145,66 @@ func TestPaymentChannelVoucherSuccess(t *testing.T) {
 	})
 }
 
+func TestPaymentChannelVoucherLanes(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	payer, err := address.NewFromString(fixtures.TestAddresses[2])
+	require.NoError(err)
+	target, err := address.NewFromString(fixtures.TestAddresses[1])
+	require.NoError(err)
+
+	eol := types.NewBlockHeight(20)
+	amt := types.NewAttoFILFromFIL(10000)
+
+	daemonTestWithPaymentChannel(t, &payer, &target, amt, eol, func(d *th.TestDaemon, channelID *types.ChannelID) {
+		assert := assert.New(t)
+
+		voucherString := th.RunSuccessFirstLine(d, "paych", "voucher", channelID.String(), "100",
+			"--from", payer.String(), "--lane", "2", "--nonce", "5", "--merge", "0:1,1:3")
+
+		voucher, err := paymentbroker.DecodeVoucher(voucherString)
+		require.NoError(err)
+
+		assert.Equal(uint64(2), voucher.Lane)
+		assert.Equal(uint64(5), voucher.Nonce)
+		assert.Equal([]paymentbroker.Merge{{Lane: 0, Nonce: 1}, {Lane: 1, Nonce: 3}}, voucher.Merges)
+		assert.True(paymentbroker.VerifyVoucherSignature(payer, voucher))
+
+		// without a nonce the voucher is the next one on its lane
+		next := mustCreateVoucher(t, d, channelID, types.NewAttoFILFromFIL(100), &payer)
+		assert.Equal(uint64(0), next.Lane)
+		assert.Equal(uint64(1), next.Nonce)
+	})
+}
+
+func TestPaymentChannelStatus(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	payer, err := address.NewFromString(fixtures.TestAddresses[2])
+	require.NoError(err)
+	target, err := address.NewFromString(fixtures.TestAddresses[1])
+	require.NoError(err)
+
+	eol := types.NewBlockHeight(20)
+	amt := types.NewAttoFILFromFIL(10000)
+
+	daemonTestWithPaymentChannel(t, &payer, &target, amt, eol, func(d *th.TestDaemon, channelID *types.ChannelID) {
+		assert := assert.New(t)
+
+		mustCreateVoucher(t, d, channelID, types.NewAttoFILFromFIL(100), &payer)
+		mustCreateVoucher(t, d, channelID, types.NewAttoFILFromFIL(200), &payer)
+
+		// vouchers may not pay out more than the channel holds
+		d.RunFail("more than the", "paych", "voucher", channelID.String(), "10001", "--from", payer.String())
+
+		status := d.RunSuccess("paych", "status").ReadStdout()
+		assert.Contains(status, fmt.Sprintf("%s: payer: %s, target: %s", channelID, payer, target))
+		assert.Contains(status, "vouchers: 2, amt vouchered: 200, open")
+	})
+}
+
 func TestPaymentChannelRedeemSuccess(t *testing.T) {
 	t.Parallel()
 	require := require.New(t)
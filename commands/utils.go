@@ -1,9 +1,13 @@
 package commands
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -29,3 +33,46 @@ func optionalBlockHeight(o interface{}) (ret *types.BlockHeight, err error) {
 	}
 	return validAt, nil
 }
+
+// parseVoucherMerges parses comma separated lane:nonce pairs into voucher
+// merges, returning nil when the option is not set.
+func parseVoucherMerges(o interface{}) ([]paymentbroker.Merge, error) {
+	if o == nil || o.(string) == "" {
+		return nil, nil
+	}
+
+	var merges []paymentbroker.Merge
+	for _, pair := range strings.Split(o.(string), ",") {
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid merge %q, expected lane:nonce", pair)
+		}
+
+		lane, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid merge lane %q", parts[0])
+		}
+		nonce, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid merge nonce %q", parts[1])
+		}
+
+		merges = append(merges, paymentbroker.Merge{Lane: lane, Nonce: nonce})
+	}
+
+	return merges, nil
+}
+
+// optionalHexBytes decodes a hex encoded option, returning nil when the option
+// is not set.
+func optionalHexBytes(o interface{}) ([]byte, error) {
+	if o == nil || o.(string) == "" {
+		return nil, nil
+	}
+
+	b, err := hex.DecodeString(o.(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex value %q", o.(string))
+	}
+	return b, nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -24,6 +25,7 @@ type Config struct {
 	Mining    *MiningConfig    `json:"mining"`
 	Wallet    *WalletConfig    `json:"wallet"`
 	Heartbeat *HeartbeatConfig `json:"heartbeat"`
+	Network   *NetworkConfig   `json:"network"`
 }
 
 // APIConfig holds all configuration options related to the api.
@@ -100,10 +102,50 @@ func newDefaultBootstrapConfig() *BootstrapConfig {
 
 // MiningConfig holds all configuration options related to mining.
 type MiningConfig struct {
-	MinerAddress            address.Address `json:"minerAddress"`
-	BlockSignerAddress      address.Address `json:"blockSignerAddress"`
-	AutoSealIntervalSeconds uint            `json:"autoSealIntervalSeconds"`
-	StoragePrice            *types.AttoFIL  `json:"storagePrice"`
+	MinerAddress            address.Address   `json:"minerAddress"`
+	BlockSignerAddress      address.Address   `json:"blockSignerAddress"`
+	AutoSealIntervalSeconds uint              `json:"autoSealIntervalSeconds"`
+	StoragePrice            *types.AttoFIL    `json:"storagePrice"`
+	DealCollateral          *types.AttoFIL    `json:"dealCollateral"`
+	DealPolicy              *DealPolicyConfig `json:"dealPolicy"`
+}
+
+// DealPolicyConfig holds the rules a storage miner applies to deal proposals,
+// on top of requiring at least its storage price per byte per block. Zero
+// values disable a rule.
+type DealPolicyConfig struct {
+	// AllowedClients, if not empty, are the only clients deals are accepted from.
+	AllowedClients []address.Address `json:"allowedClients"`
+	// DeniedClients are the clients deals are never accepted from.
+	DeniedClients []address.Address `json:"deniedClients"`
+	// PreferredClients are not held to MaxUnsealedBytes, so the room above it
+	// is kept for them.
+	PreferredClients []address.Address `json:"preferredClients"`
+
+	MinPieceSize uint64 `json:"minPieceSize"`
+	MaxPieceSize uint64 `json:"maxPieceSize"`
+	MinDuration  uint64 `json:"minDuration"`
+	MaxDuration  uint64 `json:"maxDuration"`
+
+	// MaxUnsealedBytes caps the size of the deals accepted but not yet sealed.
+	MaxUnsealedBytes uint64 `json:"maxUnsealedBytes"`
+
+	// Program is a local program asked about every proposal that passes the
+	// rules above. It reads the proposal as json on its standard input and
+	// writes {"accept": bool, "reason": string} to its standard output.
+	Program string `json:"program"`
+	// ProgramTimeout is how long the program has to answer. Golang duration
+	// units are accepted.
+	ProgramTimeout string `json:"programTimeout"`
+}
+
+func newDefaultDealPolicyConfig() *DealPolicyConfig {
+	return &DealPolicyConfig{
+		AllowedClients:   []address.Address{},
+		DeniedClients:    []address.Address{},
+		PreferredClients: []address.Address{},
+		ProgramTimeout:   "10s",
+	}
 }
 
 func newDefaultMiningConfig() *MiningConfig {
@@ -111,6 +153,8 @@ func newDefaultMiningConfig() *MiningConfig {
 		MinerAddress:            address.Address{},
 		AutoSealIntervalSeconds: 120,
 		StoragePrice:            types.NewZeroAttoFIL(),
+		DealCollateral:          types.NewZeroAttoFIL(),
+		DealPolicy:              newDefaultDealPolicyConfig(),
 	}
 }
 
@@ -148,6 +192,33 @@ func newDefaultHeartbeatConfig() *HeartbeatConfig {
 	}
 }
 
+// NetworkConfig holds the protocol parameters of the network the node is on,
+// every node of the network must agree on them.
+type NetworkConfig struct {
+	// Upgrades are the network upgrades after genesis, the node follows
+	// the rules of the last upgrade activated at each height.
+	Upgrades []*UpgradeConfig `json:"upgrades"`
+}
+
+// UpgradeConfig describes the protocol rules a network upgrade activates.
+// Zero values keep the rules of the previous version.
+type UpgradeConfig struct {
+	Version          uint64 `json:"version"`
+	ActivationHeight uint64 `json:"activationHeight"`
+	// BlockReward is the amount paid to the owner of the miner of each block.
+	BlockReward *types.AttoFIL `json:"blockReward,omitempty"`
+	// ProvingPeriodBlocks is the length of the miners' proving period.
+	ProvingPeriodBlocks uint64 `json:"provingPeriodBlocks,omitempty"`
+	// GasSchedule prices message execution.
+	GasSchedule *gasschedule.Schedule `json:"gasSchedule,omitempty"`
+}
+
+func newDefaultNetworkConfig() *NetworkConfig {
+	return &NetworkConfig{
+		Upgrades: []*UpgradeConfig{},
+	}
+}
+
 // NewDefaultConfig returns a config object with all the fields filled out to
 // their default values
 func NewDefaultConfig() *Config {
@@ -159,6 +230,7 @@ func NewDefaultConfig() *Config {
 		Mining:    newDefaultMiningConfig(),
 		Wallet:    newDefaultWalletConfig(),
 		Heartbeat: newDefaultHeartbeatConfig(),
+		Network:   newDefaultNetworkConfig(),
 	}
 }
 
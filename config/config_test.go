@@ -67,7 +67,20 @@ func TestWriteFile(t *testing.T) {
 		"minerAddress": "",
 		"blockSignerAddress": "",
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"dealCollateral": "0",
+		"dealPolicy": {
+			"allowedClients": [],
+			"deniedClients": [],
+			"preferredClients": [],
+			"minPieceSize": 0,
+			"maxPieceSize": 0,
+			"minDuration": 0,
+			"maxDuration": 0,
+			"maxUnsealedBytes": 0,
+			"program": "",
+			"programTimeout": "10s"
+		}
 	},
 	"wallet": {
 		"defaultAddress": ""
@@ -77,6 +90,9 @@ func TestWriteFile(t *testing.T) {
 		"beatPeriod": "3s",
 		"reconnectPeriod": "10s",
 		"nickname": ""
+	},
+	"network": {
+		"upgrades": []
 	}
 }`,
 		string(content),
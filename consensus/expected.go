@@ -15,9 +15,9 @@ import (
 	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 	"gx/ipfs/QmcTzQXRcU2vf8yX5EEboz1BSvWC7wWmeYAKVQmhp8WZYU/sha256-simd"
 
-	"github.com/filecoin-project/go-filecoin/actor/builtin"
-	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/amt"
+	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -38,6 +38,8 @@ func init() {
 var (
 	// ErrStateRootMismatch is returned when the computed state root doesn't match the expected result.
 	ErrStateRootMismatch = errors.New("blocks state root does not match computed result")
+	// ErrReceiptRootMismatch is returned when the computed receipts root doesn't match the expected result.
+	ErrReceiptRootMismatch = errors.New("blocks message receipts root does not match computed result")
 	// ErrInvalidBase is returned when the chain doesn't connect back to a known good block.
 	ErrInvalidBase = errors.New("block does not connect to a known good chain")
 	// ErrUnorderedTipSets is returned when weight and minticket are the same between two tipsets.
@@ -58,17 +60,14 @@ const ECPrM uint64 = 100
 // past to look back to sample randomness values.
 const LookBackParameter = 3
 
-// AncestorRoundsNeeded is the number of rounds of the ancestor chain needed
-// to process all state transitions.
-var AncestorRoundsNeeded = miner.ProvingPeriodBlocks.Add(miner.GracePeriodBlocks)
-
 // A Processor processes all the messages in a block or tip set.
 type Processor interface {
-	// ProcessBlock processes all messages in a block.
-	ProcessBlock(ctx context.Context, st state.Tree, vms vm.StorageMap, blk *types.Block, ancestors []types.TipSet) ([]*ApplicationResult, error)
+	// ProcessBlock processes msgs, the messages of a block.
+	ProcessBlock(ctx context.Context, st state.Tree, vms vm.StorageMap, blk *types.Block, msgs []*types.SignedMessage, ancestors []types.TipSet) ([]*ApplicationResult, error)
 
-	// ProcessTipSet processes all messages in a tip set.
-	ProcessTipSet(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet) (*ProcessTipSetResponse, error)
+	// ProcessTipSet processes all messages in a tip set, given block by
+	// block in the order of ts.ToSlice().
+	ProcessTipSet(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, tsMessages [][]*types.SignedMessage, ancestors []types.TipSet) (*ProcessTipSetResponse, error)
 }
 
 // Expected implements expected consensus.
@@ -91,6 +90,9 @@ type Expected struct {
 	genesisCid cid.Cid
 
 	verifier proofs.Verifier
+
+	// upgrades determines the protocol rules in effect at each height.
+	upgrades Upgrades
 }
 
 // Ensure Expected satisfies the Protocol interface at compile time.
@@ -98,6 +100,13 @@ var _ Protocol = (*Expected)(nil)
 
 // NewExpected is the constructor for the Expected consenus.Protocol module.
 func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Processor, pt PowerTableView, gCid cid.Cid, verifier proofs.Verifier) Protocol {
+	return NewExpectedWithUpgrades(cs, bs, processor, pt, gCid, verifier, DefaultUpgrades())
+}
+
+// NewExpectedWithUpgrades is like NewExpected but follows the given network
+// upgrade schedule. The processor should be configured with the same
+// schedule.
+func NewExpectedWithUpgrades(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Processor, pt PowerTableView, gCid cid.Cid, verifier proofs.Verifier, upgrades Upgrades) Protocol {
 	return &Expected{
 		cstore:       cs,
 		bstore:       bs,
@@ -105,6 +114,7 @@ func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Pro
 		PwrTableView: pt,
 		genesisCid:   gCid,
 		verifier:     verifier,
+		upgrades:     upgrades,
 	}
 }
 
@@ -227,11 +237,24 @@ func (c *Expected) IsHeavier(ctx context.Context, a, b types.TipSet, aSt, bSt st
 	return cmp == 1, nil
 }
 
+// AncestorRoundsNeeded returns the number of rounds of the ancestor chain
+// needed to process a tipset at height bh under the upgrade schedule.
+func (c *Expected) AncestorRoundsNeeded(bh *types.BlockHeight) *types.BlockHeight {
+	return c.upgrades.AncestorRoundsNeeded(bh)
+}
+
+// BuiltinActors returns the builtin actor code of the rules in effect at
+// height bh under the upgrade schedule.
+func (c *Expected) BuiltinActors(bh *types.BlockHeight) map[cid.Cid]exec.ExecutableActor {
+	return c.upgrades.RulesAt(bh).Actors
+}
+
 // RunStateTransition is the chain transition function that goes from a
 // starting state and a tipset to a new state.  It errors if the tipset was not
 // mined according to the EC rules, or if running the messages in the tipset
-// results in an error.
-func (c *Expected) RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (state.Tree, error) {
+// results in an error.  The messages and receipts of the tipset are given
+// block by block in the order of ts.ToSlice().
+func (c *Expected) RunStateTransition(ctx context.Context, ts types.TipSet, tsMessages [][]*types.SignedMessage, tsReceipts [][]*types.MessageReceipt, ancestors []types.TipSet, pSt state.Tree) (state.Tree, error) {
 	err := c.validateMining(ctx, pSt, ts, ancestors[0])
 	if err != nil {
 		return nil, err
@@ -250,8 +273,12 @@ func (c *Expected) RunStateTransition(ctx context.Context, ts types.TipSet, ance
 		}
 	}
 
+	if len(tsMessages) != len(sl) || len(tsReceipts) != len(sl) {
+		return nil, fmt.Errorf("got messages for %d and receipts for %d blocks of a tipset of %d", len(tsMessages), len(tsReceipts), len(sl))
+	}
+
 	vms := vm.NewStorageMap(c.bstore)
-	st, err := c.runMessages(ctx, pSt, vms, ts, ancestors)
+	st, err := c.runMessages(ctx, pSt, vms, ts, tsMessages, tsReceipts, ancestors)
 	if err != nil {
 		return nil, err
 	}
@@ -365,29 +392,37 @@ func CreateTicket(proof proofs.PoStProof, minerAddr address.Address) []byte {
 // An error is returned if individual blocks contain messages that do not
 // lead to successful state transitions.  An error is also returned if the node
 // faults while running aggregate state computation.
-func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet) (state.Tree, error) {
+func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, tsMessages [][]*types.SignedMessage, tsReceipts [][]*types.MessageReceipt, ancestors []types.TipSet) (state.Tree, error) {
 	var cpySt state.Tree
 
+	h, err := ts.Height()
+	if err != nil {
+		return nil, err
+	}
+	rules := c.upgrades.RulesAt(types.NewBlockHeight(h))
+
 	// TODO: order blocks in the tipset by ticket
 	// TODO: don't process messages twice
-	for _, blk := range ts.ToSlice() {
+	for i, blk := range ts.ToSlice() {
 		cpyCid, err := st.Flush(ctx)
 		if err != nil {
 			return nil, errors.Wrap(err, "error validating block state")
 		}
 		// state copied so changes don't propagate between block validations
-		cpySt, err = state.LoadStateTree(ctx, c.cstore, cpyCid, builtin.Actors)
+		cpySt, err = state.LoadStateTree(ctx, c.cstore, cpyCid, rules.Actors)
 		if err != nil {
 			return nil, errors.Wrap(err, "error validating block state")
 		}
 
-		receipts, err := c.processor.ProcessBlock(ctx, cpySt, vms, blk, ancestors)
+		receipts, err := c.processor.ProcessBlock(ctx, cpySt, vms, blk, tsMessages[i], ancestors)
 		if err != nil {
 			return nil, errors.Wrap(err, "error validating block state")
 		}
-		// TODO: check that receipts actually match
-		if len(receipts) != len(blk.MessageReceipts) {
-			return nil, fmt.Errorf("found invalid message receipts: %v %v", receipts, blk.MessageReceipts)
+		if len(receipts) != len(tsReceipts[i]) {
+			return nil, fmt.Errorf("found invalid message receipts: %v %v", receipts, tsReceipts[i])
+		}
+		if err := checkReceiptsRoot(ctx, blk, receipts); err != nil {
+			return nil, err
 		}
 
 		outCid, err := cpySt.Flush(ctx)
@@ -405,9 +440,35 @@ func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.Storag
 	// NOTE: It is possible to optimize further by applying block validation
 	// in sorted order to reuse first block transitions as the starting state
 	// for the tipSetProcessor.
-	_, err := c.processor.ProcessTipSet(ctx, st, vms, ts, ancestors)
+	_, err = c.processor.ProcessTipSet(ctx, st, vms, ts, tsMessages, ancestors)
 	if err != nil {
 		return nil, errors.Wrap(err, "error validating tipset")
 	}
 	return st, nil
 }
+
+// checkReceiptsRoot returns ErrReceiptRootMismatch unless the receipts of
+// results are the ones blk commits to. A block without a receipts root must
+// have no receipts. The array is built in a throwaway store as its root is
+// all that is needed.
+func checkReceiptsRoot(ctx context.Context, blk *types.Block, results []*ApplicationResult) error {
+	if !blk.MessageReceipts.Defined() {
+		if len(results) != 0 {
+			return ErrReceiptRootMismatch
+		}
+		return nil
+	}
+
+	values := make([]interface{}, len(results))
+	for i, r := range results {
+		values[i] = r.Receipt
+	}
+	root, err := amt.Build(ctx, hamt.NewCborStore(), values)
+	if err != nil {
+		return errors.Wrap(err, "failed to compute message receipts root")
+	}
+	if !root.Equals(blk.MessageReceipts) {
+		return ErrReceiptRootMismatch
+	}
+	return nil
+}
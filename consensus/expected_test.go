@@ -8,6 +8,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/state"
@@ -74,16 +75,8 @@ func TestExpected_NewValidTipSet(t *testing.T) {
 		blocks := []*types.Block{
 			types.NewBlockForTest(parentBlock, 1),
 		}
-		ki := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
-		mockSigner := types.NewMockSigner(ki)
-		blocks[0].Messages = types.NewSignedMsgs(1, mockSigner)
-		retVal := []byte{1, 2, 3}
-
-		receipt := &types.MessageReceipt{
-			ExitCode: 123,
-			Return:   [][]byte{retVal},
-		}
-		blocks[0].MessageReceipts = []*types.MessageReceipt{receipt}
+		blocks[0].Messages = types.SomeCid()
+		blocks[0].MessageReceipts = types.SomeCid()
 
 		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier)
 
@@ -114,6 +107,14 @@ func makeSomeBlocks(ctx context.Context, require *require.Assertions, pTipSet ty
 	return blocks
 }
 
+func emptyMessages(ts types.TipSet) [][]*types.SignedMessage {
+	return make([][]*types.SignedMessage, len(ts))
+}
+
+func emptyReceipts(ts types.TipSet) [][]*types.MessageReceipt {
+	return make([][]*types.MessageReceipt, len(ts))
+}
+
 // TestExpected_RunStateTransition_validateMining is concerned only with validateMining behavior.
 // Fully unit-testing RunStateTransition is difficult due to this requiring that you
 // completely set up a valid state tree with a valid matching TipSet.  RunStateTransition is tested
@@ -148,7 +149,7 @@ func TestExpected_RunStateTransition_validateMining(t *testing.T) {
 		tipSet, err := exp.NewValidTipSet(ctx, blocks)
 		require.NoError(err)
 
-		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
+		_, err = exp.RunStateTransition(ctx, tipSet, emptyMessages(tipSet), emptyReceipts(tipSet), []types.TipSet{pTipSet}, stateTree)
 		assert.NoError(err)
 	})
 
@@ -170,9 +171,44 @@ func TestExpected_RunStateTransition_validateMining(t *testing.T) {
 		tipSet, err := exp.NewValidTipSet(ctx, blocks)
 		require.NoError(err)
 
-		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
+		_, err = exp.RunStateTransition(ctx, tipSet, emptyMessages(tipSet), emptyReceipts(tipSet), []types.TipSet{pTipSet}, stateTree)
 		assert.EqualError(err, "can't check for winning ticket: Couldn't get minerPower: something went wrong with the miner power")
 	})
+
+	t.Run("returns an error when a block's receipts root does not match its messages", func(t *testing.T) {
+		ptv := testhelpers.NewTestPowerTableView(1, 1)
+		exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier)
+
+		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+		require.NoError(err)
+
+		stateTree, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+		require.NoError(err)
+
+		vms := vm.NewStorageMap(bstore)
+
+		// The block carries a message that succeeds but claims it failed.
+		ki := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+		mockSigner := types.NewMockSigner(ki)
+		fromAddr := mockSigner.Addresses[0]
+		require.NoError(stateTree.SetActor(ctx, fromAddr, testhelpers.RequireNewAccountActor(require, types.NewAttoFILFromFIL(100))))
+
+		msg := types.NewMessage(fromAddr, address.NewForTestGetter()(), 0, types.NewAttoFILFromFIL(1), "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+		require.NoError(err)
+		claimed := &types.MessageReceipt{ExitCode: 1}
+
+		blocks := makeSomeBlocks(ctx, require, pTipSet, stateTree, vms)[:1]
+		blocks[0].MessageReceipts = chain.RequirePutReceipts(require, cistore, claimed)
+
+		tipSet, err := exp.NewValidTipSet(ctx, blocks)
+		require.NoError(err)
+
+		messages := [][]*types.SignedMessage{{smsg}}
+		receipts := [][]*types.MessageReceipt{{claimed}}
+		_, err = exp.RunStateTransition(ctx, tipSet, messages, receipts, []types.TipSet{pTipSet}, stateTree)
+		assert.Equal(consensus.ErrReceiptRootMismatch, err)
+	})
 }
 
 func TestIsWinningTicket(t *testing.T) {
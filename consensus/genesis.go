@@ -11,10 +11,13 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/multisig"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/amt"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
@@ -41,6 +44,7 @@ type Config struct {
 	nonces   map[address.Address]uint64
 	actors   map[address.Address]*actor.Actor
 	miners   map[address.Address]*miner.State
+	gas      *gasschedule.Schedule
 }
 
 // GenOption is a configuration option for the GenesisInitFunction.
@@ -80,6 +84,15 @@ func AddActor(addr address.Address, actor *actor.Actor) GenOption {
 	}
 }
 
+// GasSchedule returns a config option that installs a gas schedule in the
+// genesis state. Without it the chain uses gasschedule.DefaultSchedule.
+func GasSchedule(gs *gasschedule.Schedule) GenOption {
+	return func(gc *Config) error {
+		gc.gas = gs
+		return nil
+	}
+}
+
 // NewEmptyConfig inits and returns an empty config
 func NewEmptyConfig() *Config {
 	return &Config{
@@ -145,6 +158,11 @@ func MakeGenesisFunc(opts ...GenOption) GenesisInitFunc {
 		if err := SetupDefaultActors(ctx, st, storageMap); err != nil {
 			return nil, err
 		}
+		if genCfg.gas != nil {
+			if err := vm.InstallGasSchedule(ctx, st, storageMap, genCfg.gas); err != nil {
+				return nil, err
+			}
+		}
 		// Now add any other actors configured.
 		for addr, a := range genCfg.actors {
 			if err := st.SetActor(ctx, addr, a); err != nil {
@@ -157,9 +175,18 @@ func MakeGenesisFunc(opts ...GenOption) GenesisInitFunc {
 			return nil, err
 		}
 
+		// The genesis block has no messages, but commits to the empty
+		// collections like any other block.
+		emptyRoot, err := amt.Build(ctx, cst, nil)
+		if err != nil {
+			return nil, err
+		}
+
 		genesis := &types.Block{
-			StateRoot: c,
-			Nonce:     1337,
+			StateRoot:       c,
+			Nonce:           1337,
+			Messages:        emptyRoot,
+			MessageReceipts: emptyRoot,
 		}
 
 		if _, err := cst.Put(ctx, genesis); err != nil {
@@ -213,5 +240,18 @@ func SetupDefaultActors(ctx context.Context, st state.Tree, storageMap vm.Storag
 
 	pbAct.Balance = types.NewAttoFILFromFIL(0)
 
-	return st.SetActor(ctx, address.PaymentBrokerAddress, pbAct)
+	if err := st.SetActor(ctx, address.PaymentBrokerAddress, pbAct); err != nil {
+		return err
+	}
+
+	msAct, err := multisig.NewFactory()
+	if err != nil {
+		return err
+	}
+	err = (&multisig.Factory{}).InitializeState(storageMap.NewStorage(address.MultisigAddress, msAct), nil)
+	if err != nil {
+		return err
+	}
+
+	return st.SetActor(ctx, address.MultisigAddress, msAct)
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -16,8 +17,8 @@ import (
 
 // BlockRewarder applies all rewards due to the miner's owner for processing a block including block reward and gas
 type BlockRewarder interface {
-	// BlockReward pays out the mining reward
-	BlockReward(ctx context.Context, st state.Tree, minerOwnerAddr address.Address) error
+	// BlockReward pays out the mining reward for a block at height bh
+	BlockReward(ctx context.Context, st state.Tree, minerOwnerAddr address.Address, bh *types.BlockHeight) error
 
 	// GasReward pays gas from the sender to the miner
 	GasReward(ctx context.Context, st state.Tree, minerOwnerAddr address.Address, msg *types.SignedMessage, cost *types.AttoFIL) error
@@ -45,29 +46,39 @@ type ProcessTipSetResponse struct {
 type DefaultProcessor struct {
 	signedMessageValidator SignedMessageValidator
 	blockRewarder          BlockRewarder
+	upgrades               Upgrades
 }
 
 var _ Processor = (*DefaultProcessor)(nil)
 
 // NewDefaultProcessor creates a default processor from the given state tree and vms.
 func NewDefaultProcessor() *DefaultProcessor {
+	return NewProcessorWithUpgrades(DefaultUpgrades())
+}
+
+// NewProcessorWithUpgrades creates a default processor that applies the
+// protocol rules in effect at the height of the messages it processes.
+func NewProcessorWithUpgrades(upgrades Upgrades) *DefaultProcessor {
 	return &DefaultProcessor{
 		signedMessageValidator: NewDefaultMessageValidator(),
-		blockRewarder:          NewDefaultBlockRewarder(),
+		blockRewarder:          NewBlockRewarder(upgrades),
+		upgrades:               upgrades,
 	}
 }
 
-// NewConfiguredProcessor creates a default processor with custom validation and rewards.
-func NewConfiguredProcessor(validator SignedMessageValidator, rewarder BlockRewarder) *DefaultProcessor {
+// NewConfiguredProcessor creates a default processor with custom validation and rewards
+// that follows the given upgrade schedule.
+func NewConfiguredProcessor(validator SignedMessageValidator, rewarder BlockRewarder, upgrades Upgrades) *DefaultProcessor {
 	return &DefaultProcessor{
 		signedMessageValidator: validator,
 		blockRewarder:          rewarder,
+		upgrades:               upgrades,
 	}
 }
 
 // ProcessBlock is the entrypoint for validating the state transitions
 // of the messages in a block. When we receive a new block from the
-// network ProcessBlock applies the block's messages to the beginning
+// network ProcessBlock applies the block's messages, msgs, to the beginning
 // state tree ensuring that all transitions are valid, accumulating
 // changes in the state tree, and returning the message receipts.
 //
@@ -92,7 +103,7 @@ func NewConfiguredProcessor(validator SignedMessageValidator, rewarder BlockRewa
 // will in many cases be successfully applied even though an
 // error was thrown causing any state changes to be rolled back.
 // See comments on ApplyMessage for specific intent.
-func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms vm.StorageMap, blk *types.Block, ancestors []types.TipSet) ([]*ApplicationResult, error) {
+func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms vm.StorageMap, blk *types.Block, msgs []*types.SignedMessage, ancestors []types.TipSet) ([]*ApplicationResult, error) {
 	var emptyResults []*ApplicationResult
 
 	processBlkTimer := time.Now()
@@ -101,13 +112,13 @@ func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms
 	}()
 
 	// find miner's owner address
-	minerOwnerAddr, err := minerOwnerAddress(ctx, st, vms, blk.Miner)
+	minerOwnerAddr, err := MinerOwnerAddress(ctx, st, vms, blk.Miner)
 	if err != nil {
 		return nil, err
 	}
 
 	bh := types.NewBlockHeight(uint64(blk.Height))
-	res, faultErr := p.ApplyMessagesAndPayRewards(ctx, st, vms, blk.Messages, minerOwnerAddr, bh, ancestors)
+	res, faultErr := p.ApplyMessagesAndPayRewards(ctx, st, vms, msgs, minerOwnerAddr, bh, ancestors)
 	if faultErr != nil {
 		return emptyResults, faultErr
 	}
@@ -128,8 +139,9 @@ func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms
 // ProcessTipSet only returns errors in the case of faults.  Other errors
 // coming from calls to ApplyMessage can be traced to different blocks in the
 // TipSet containing conflicting messages and are ignored.  Blocks are applied
-// in the sorted order of their tickets.
-func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet) (*ProcessTipSetResponse, error) {
+// in the sorted order of their tickets.  The i-th entry of tsMessages holds
+// the messages of the i-th block of ts.ToSlice().
+func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, tsMessages [][]*types.SignedMessage, ancestors []types.TipSet) (*ProcessTipSetResponse, error) {
 	var res ProcessTipSetResponse
 	var emptyRes ProcessTipSetResponse
 	h, err := ts.Height()
@@ -140,21 +152,24 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 	msgFilter := make(map[string]struct{})
 
 	tips := ts.ToSlice()
-	types.SortBlocks(tips)
+	if len(tsMessages) != len(tips) {
+		return &emptyRes, errors.NewFaultErrorf("got messages for %d blocks of a tipset of %d", len(tsMessages), len(tips))
+	}
 
 	// TODO: this can be made slightly more efficient by reusing the validation
 	// transition of the first validated block (change would reach here and
 	// consensus functions).
-	for _, blk := range tips {
+	for _, i := range types.CanonicalOrder(tips) {
+		blk := tips[i]
 		// find miner's owner address
-		minerOwnerAddr, err := minerOwnerAddress(ctx, st, vms, blk.Miner)
+		minerOwnerAddr, err := MinerOwnerAddress(ctx, st, vms, blk.Miner)
 		if err != nil {
 			return &emptyRes, err
 		}
 
 		// filter out duplicates within TipSet
 		var msgs []*types.SignedMessage
-		for _, msg := range blk.Messages {
+		for _, msg := range tsMessages[i] {
 			mCid, err := msg.Cid()
 			if err != nil {
 				return &emptyRes, errors.FaultErrorWrap(err, "error getting message cid")
@@ -342,6 +357,12 @@ var (
 // not make any changes to the state/blockchain and is useful for interrogating
 // actor state. Block height bh is optional; some methods will ignore it.
 func CallQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to address.Address, method string, params []byte, from address.Address, optBh *types.BlockHeight) ([][]byte, uint8, error) {
+	return CallQueryMethodWithRules(ctx, st, vms, GenesisRules(), to, method, params, from, optBh)
+}
+
+// CallQueryMethodWithRules is like CallQueryMethod but prices the call with
+// the gas schedule of the given protocol rules.
+func CallQueryMethodWithRules(ctx context.Context, st state.Tree, vms vm.StorageMap, rules ProtocolRules, to address.Address, method string, params []byte, from address.Address, optBh *types.BlockHeight) ([][]byte, uint8, error) {
 	toActor, err := st.GetActor(ctx, to)
 	if err != nil {
 		return nil, 1, errors.ApplyErrorPermanentWrapf(err, "failed to get To actor")
@@ -362,6 +383,10 @@ func CallQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to a
 	// Set the gas limit to the max because this message send should always succeed; it doesn't cost gas.
 	gasTracker := vm.NewGasTracker()
 	gasTracker.MsgGasLimit = types.BlockGasLimit
+	gasTracker.Schedule, err = gasSchedule(ctx, st, vms, rules)
+	if err != nil {
+		return nil, 1, err
+	}
 
 	vmCtxParams := vm.NewContextParams{
 		To:          toActor,
@@ -378,11 +403,12 @@ func CallQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to a
 }
 
 // PreviewQueryMethod estimates the amount of gas that will be used by a method
-// call. It accepts all the same arguments as CallQueryMethod.
-func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to address.Address, method string, params []byte, from address.Address, optBh *types.BlockHeight) (types.GasUnits, error) {
+// call and how it breaks down by operation. It accepts all the same arguments
+// as CallQueryMethodWithRules.
+func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, rules ProtocolRules, to address.Address, method string, params []byte, from address.Address, optBh *types.BlockHeight) (types.GasUnits, vm.GasBreakdown, error) {
 	toActor, err := st.GetActor(ctx, to)
 	if err != nil {
-		return types.NewGasUnits(0), errors.ApplyErrorPermanentWrapf(err, "failed to get To actor")
+		return types.NewGasUnits(0), nil, errors.ApplyErrorPermanentWrapf(err, "failed to get To actor")
 	}
 
 	// not committing or flushing storage structures guarantees changes won't make it to stored state tree or datastore
@@ -400,6 +426,10 @@ func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, t
 	// Set the gas limit to the max because this message send should always succeed; it doesn't cost gas.
 	gasTracker := vm.NewGasTracker()
 	gasTracker.MsgGasLimit = types.BlockGasLimit
+	gasTracker.Schedule, err = gasSchedule(ctx, st, vms, rules)
+	if err != nil {
+		return types.NewGasUnits(0), nil, err
+	}
 
 	vmCtxParams := vm.NewContextParams{
 		To:          toActor,
@@ -412,7 +442,7 @@ func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, t
 	vmCtx := vm.NewVMContext(vmCtxParams)
 	_, _, err = vm.Send(ctx, vmCtx)
 
-	return vmCtx.GasUnits(), err
+	return vmCtx.GasUnits(), vmCtx.GasBreakdown(), err
 }
 
 // attemptApplyMessage encapsulates the work of trying to apply the message in order
@@ -509,7 +539,17 @@ type ApplyMessagesResponse struct {
 	TemporaryErrors []error
 }
 
-// ApplyMessagesAndPayRewards begins by paying the block mining reward to the miner's owner. It then applies messages to a state tree.
+// gasSchedule returns the gas schedule of the given rules, falling back to the
+// schedule installed in the state when the rules do not set one.
+func gasSchedule(ctx context.Context, st state.Tree, vms vm.StorageMap, rules ProtocolRules) (*gasschedule.Schedule, error) {
+	if rules.GasSchedule != nil {
+		return rules.GasSchedule, nil
+	}
+	return vm.LoadGasSchedule(ctx, st, vms)
+}
+
+// ApplyMessagesAndPayRewards begins by paying the block mining reward to the miner's owner. It then applies messages to a state tree
+// under the protocol rules in effect at height bh.
 // It returns an ApplyMessagesResponse which wraps the results of message application,
 // groupings of messages with permanent failures, temporary failures, and
 // successes, and the permanent and temporary errors raised during application.
@@ -519,12 +559,20 @@ func (p *DefaultProcessor) ApplyMessagesAndPayRewards(ctx context.Context, st st
 	var emptyRet ApplyMessagesResponse
 	var ret ApplyMessagesResponse
 
+	rules := p.upgrades.RulesAt(bh)
+	st = state.WithBuiltinActors(st, rules.Actors)
+
 	// transfer block reward to miner's owner from network address.
-	if err := p.blockRewarder.BlockReward(ctx, st, minerOwnerAddr); err != nil {
+	if err := p.blockRewarder.BlockReward(ctx, st, minerOwnerAddr, bh); err != nil {
 		return ApplyMessagesResponse{}, err
 	}
 
 	gasTracker := vm.NewGasTracker()
+	schedule, err := gasSchedule(ctx, st, vms, rules)
+	if err != nil {
+		return emptyRet, err
+	}
+	gasTracker.Schedule = schedule
 
 	// process all messages
 	for _, smsg := range messages {
@@ -550,19 +598,27 @@ func (p *DefaultProcessor) ApplyMessagesAndPayRewards(ctx context.Context, st st
 }
 
 // DefaultBlockRewarder pays the block reward from the network actor to the miner's owner.
-type DefaultBlockRewarder struct{}
+type DefaultBlockRewarder struct {
+	upgrades Upgrades
+}
 
 // NewDefaultBlockRewarder creates a new rewarder that actually pays the appropriate rewards.
 func NewDefaultBlockRewarder() *DefaultBlockRewarder {
-	return &DefaultBlockRewarder{}
+	return NewBlockRewarder(DefaultUpgrades())
+}
+
+// NewBlockRewarder creates a rewarder that pays the block reward of the
+// protocol rules in effect at each block's height.
+func NewBlockRewarder(upgrades Upgrades) *DefaultBlockRewarder {
+	return &DefaultBlockRewarder{upgrades: upgrades}
 }
 
 var _ BlockRewarder = (*DefaultBlockRewarder)(nil)
 
 // BlockReward transfers the block reward from the network actor to the miner's owner.
-func (br *DefaultBlockRewarder) BlockReward(ctx context.Context, st state.Tree, minerOwnerAddr address.Address) error {
+func (br *DefaultBlockRewarder) BlockReward(ctx context.Context, st state.Tree, minerOwnerAddr address.Address, bh *types.BlockHeight) error {
 	cachedTree := state.NewCachedStateTree(st)
-	if err := rewardTransfer(ctx, address.NetworkAddress, minerOwnerAddr, br.BlockRewardAmount(), cachedTree); err != nil {
+	if err := rewardTransfer(ctx, address.NetworkAddress, minerOwnerAddr, br.BlockRewardAmount(bh), cachedTree); err != nil {
 		return errors.FaultErrorWrap(err, "Error attempting to pay block reward")
 	}
 	return cachedTree.Commit(ctx)
@@ -577,11 +633,12 @@ func (br *DefaultBlockRewarder) GasReward(ctx context.Context, st state.Tree, mi
 	return cachedTree.Commit(ctx)
 }
 
-// BlockRewardAmount returns the max FIL value miners can claim as the block reward.
+// BlockRewardAmount returns the max FIL value miners can claim as the block
+// reward for a block at height bh.
 // TODO this is one of the system parameters that should be configured as part of
 // https://github.com/filecoin-project/go-filecoin/issues/884.
-func (br *DefaultBlockRewarder) BlockRewardAmount() *types.AttoFIL {
-	return types.NewAttoFILFromFIL(1000)
+func (br *DefaultBlockRewarder) BlockRewardAmount(bh *types.BlockHeight) *types.AttoFIL {
+	return br.upgrades.RulesAt(bh).BlockReward
 }
 
 // rewardTransfer retrieves two actors from the given addresses and attempts to transfer the given value from the balance of the first's to the second.
@@ -626,8 +683,8 @@ func isPermanentError(err error) bool {
 		err == errGasAboveBlockLimit
 }
 
-// minerOwnerAddress finds the address of the owner of the given miner
-func minerOwnerAddress(ctx context.Context, st state.Tree, vms vm.StorageMap, minerAddr address.Address) (address.Address, error) {
+// MinerOwnerAddress finds the address of the owner of the given miner
+func MinerOwnerAddress(ctx context.Context, st state.Tree, vms vm.StorageMap, minerAddr address.Address) (address.Address, error) {
 	ret, code, err := CallQueryMethod(ctx, st, vms, minerAddr, "getOwner", []byte{}, address.Address{}, types.NewBlockHeight(0))
 	if err != nil {
 		return address.Address{}, errors.FaultErrorWrap(err, "could not get miner owner")
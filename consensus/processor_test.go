@@ -72,10 +72,9 @@ func TestProcessBlockSuccess(t *testing.T) {
 	blk := &types.Block{
 		Height:    20,
 		StateRoot: stCid,
-		Messages:  []*types.SignedMessage{smsg},
 		Miner:     minerAddr,
 	}
-	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil)
+	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, []*types.SignedMessage{smsg}, nil)
 	assert.NoError(err)
 	assert.Len(results, 1)
 
@@ -83,7 +82,7 @@ func TestProcessBlockSuccess(t *testing.T) {
 	assert.NoError(err)
 	expAct1, expAct2 := th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(10000-550)), th.RequireNewEmptyActor(require, types.NewAttoFILFromFIL(550))
 	expAct1.IncNonce()
-	blockRewardAmount := NewDefaultBlockRewarder().BlockRewardAmount()
+	blockRewardAmount := NewDefaultBlockRewarder().BlockRewardAmount(types.NewBlockHeight(0))
 	expectedNetworkBalance := types.NewAttoFILFromFIL(startingNetworkBalance).Sub(blockRewardAmount)
 	expStCid, _ := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
 		address.NetworkAddress: th.RequireNewAccountActor(require, expectedNetworkBalance),
@@ -131,8 +130,8 @@ func TestProcessTipSetSuccess(t *testing.T) {
 	blk1 := &types.Block{
 		Height:    20,
 		StateRoot: stCid,
-		Messages:  []*types.SignedMessage{smsg1},
 		Miner:     minerAddr,
+		Nonce:     1,
 	}
 
 	msg2 := types.NewMessage(fromAddr2, toAddr, 0, types.NewAttoFILFromFIL(50), "", nil)
@@ -141,11 +140,16 @@ func TestProcessTipSetSuccess(t *testing.T) {
 	blk2 := &types.Block{
 		Height:    20,
 		StateRoot: stCid,
-		Messages:  []*types.SignedMessage{smsg2},
 		Miner:     minerAddr,
+		Nonce:     2,
 	}
 
-	res, err := NewDefaultProcessor().ProcessTipSet(ctx, st, vms, th.RequireNewTipSet(require, blk1, blk2), nil)
+	ts := th.RequireNewTipSet(require, blk1, blk2)
+	msgs := tipSetMessages(ts, map[*types.Block][]*types.SignedMessage{
+		blk1: {smsg1},
+		blk2: {smsg2},
+	})
+	res, err := NewDefaultProcessor().ProcessTipSet(ctx, st, vms, ts, msgs, nil)
 	assert.NoError(err)
 	assert.Len(res.Results, 2)
 
@@ -155,7 +159,7 @@ func TestProcessTipSetSuccess(t *testing.T) {
 	expAct1.IncNonce()
 	expAct2.IncNonce()
 
-	blockRewardAmount := NewDefaultBlockRewarder().BlockRewardAmount()
+	blockRewardAmount := NewDefaultBlockRewarder().BlockRewardAmount(types.NewBlockHeight(0))
 	twoBlockRewards := blockRewardAmount.Add(blockRewardAmount)
 	expectedNetworkBalance := startingNetworkBalance.Sub(twoBlockRewards)
 	expStCid, _ := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
@@ -199,7 +203,6 @@ func TestProcessTipsConflicts(t *testing.T) {
 	blk1 := &types.Block{
 		Height:    20,
 		StateRoot: stCid,
-		Messages:  []*types.SignedMessage{smsg1},
 		Ticket:    []byte{0, 0}, // Block with smaller ticket
 		Miner:     minerAddr,
 	}
@@ -210,11 +213,15 @@ func TestProcessTipsConflicts(t *testing.T) {
 	blk2 := &types.Block{
 		Height:    20,
 		StateRoot: stCid,
-		Messages:  []*types.SignedMessage{smsg2},
 		Ticket:    []byte{1, 1},
 		Miner:     minerAddr,
 	}
-	res, err := NewDefaultProcessor().ProcessTipSet(ctx, st, vms, th.RequireNewTipSet(require, blk1, blk2), nil)
+	ts := th.RequireNewTipSet(require, blk1, blk2)
+	msgs := tipSetMessages(ts, map[*types.Block][]*types.SignedMessage{
+		blk1: {smsg1},
+		blk2: {smsg2},
+	})
+	res, err := NewDefaultProcessor().ProcessTipSet(ctx, st, vms, ts, msgs, nil)
 	assert.NoError(err)
 	assert.Len(res.Results, 1)
 
@@ -223,7 +230,7 @@ func TestProcessTipsConflicts(t *testing.T) {
 
 	expAct1, expAct2 := th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(1000-501)), th.RequireNewEmptyActor(require, types.NewAttoFILFromFIL(501))
 	expAct1.IncNonce()
-	blockReward := NewDefaultBlockRewarder().BlockRewardAmount()
+	blockReward := NewDefaultBlockRewarder().BlockRewardAmount(types.NewBlockHeight(0))
 	twoBlockRewards := blockReward.Add(blockReward)
 	expectedNetworkBalance := startingNetworkBalance.Sub(twoBlockRewards)
 	expStCid, _ := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
@@ -269,9 +276,8 @@ func TestProcessBlockBadMsgSig(t *testing.T) {
 		Height:    20,
 		StateRoot: stCid,
 		Miner:     minerAddr,
-		Messages:  []*types.SignedMessage{smsg},
 	}
-	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil)
+	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, []*types.SignedMessage{smsg}, nil)
 	require.Nil(results)
 	assert.EqualError(err, "apply message failed: invalid signature by sender over message data")
 }
@@ -305,16 +311,15 @@ func TestProcessBlockReward(t *testing.T) {
 		Miner:     minerAddr,
 		Height:    20,
 		StateRoot: stCid,
-		Messages:  []*types.SignedMessage{},
 	}
-	ret, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil)
+	ret, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, []*types.SignedMessage{}, nil)
 	require.NoError(err)
 	assert.Nil(ret)
 
 	minerOwnerActor, err := st.GetActor(ctx, minerOwnerAddr)
 	require.NoError(err)
 
-	blockRewardAmount := NewDefaultBlockRewarder().BlockRewardAmount()
+	blockRewardAmount := NewDefaultBlockRewarder().BlockRewardAmount(types.NewBlockHeight(0))
 	assert.Equal(minerBalance.Add(blockRewardAmount), minerOwnerActor.Balance)
 }
 
@@ -357,13 +362,12 @@ func TestProcessBlockVMErrors(t *testing.T) {
 	blk := &types.Block{
 		Height:    20,
 		StateRoot: stCid,
-		Messages:  []*types.SignedMessage{smsg},
 		Miner:     minerAddr,
 	}
 
 	// The "foo" message will cause a vm error and
 	// we're going to check four things...
-	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil)
+	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, []*types.SignedMessage{smsg}, nil)
 
 	// 1. That a VM error is not a message failure (err).
 	assert.NoError(err)
@@ -376,7 +380,7 @@ func TestProcessBlockVMErrors(t *testing.T) {
 	// 3 & 4. That on VM error the state is rolled back and nonce is inc'd.
 	expectedAct1, expectedAct2 := th.RequireNewEmptyActor(require, types.NewAttoFILFromFIL(0)), th.RequireNewFakeActor(require, vms, toAddr, fakeActorCodeCid)
 	expectedAct1.IncNonce()
-	blockRewardAmount := NewDefaultBlockRewarder().BlockRewardAmount()
+	blockRewardAmount := NewDefaultBlockRewarder().BlockRewardAmount(types.NewBlockHeight(0))
 	expectedStCid, _ := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
 		address.NetworkAddress: th.RequireNewAccountActor(require, startingNetworkBalance.Sub(blockRewardAmount)),
 		minerOwnerAddr:         th.RequireNewEmptyActor(require, blockRewardAmount),
@@ -719,6 +723,60 @@ func TestReentrantTransferDoesntAllowMultiSpending(t *testing.T) {
 	assert.Contains(err.Error(), "not enough balance")
 }
 
+func TestRevertedNestedSendIsRolledBack(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	newAddress := address.NewForTestGetter()
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	vms := th.VMStorage()
+
+	// Install the fake actor so we can execute it.
+	fakeActorCodeCid := types.NewCidForTestGetter()()
+	builtin.Actors[fakeActorCodeCid] = &actor.FakeActor{}
+	defer func() {
+		delete(builtin.Actors, fakeActorCodeCid)
+	}()
+
+	addr0, addr1, addr2 := newAddress(), newAddress(), newAddress()
+	act0 := th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(0))
+	act1 := th.RequireNewFakeActorWithTokens(require, vms, addr1, fakeActorCodeCid, types.NewAttoFILFromFIL(100))
+	act2 := th.RequireNewFakeActorWithTokens(require, vms, addr2, fakeActorCodeCid, types.NewAttoFILFromFIL(0))
+
+	_, st := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+		addr0: act0,
+		addr1: act1,
+		addr2: act2,
+	})
+
+	// addr1 sends 100 to addr2, whose method changes its state and reverts.
+	// addr1 ignores the failure, so the message itself succeeds.
+	params, err := abi.ToEncodedValues(addr2)
+	require.NoError(err)
+	msg := types.NewMessage(addr0, addr1, 0, types.ZeroAttoFIL, "ignoreRevertedSend", params)
+	res, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+	require.NoError(err)
+	assert.NoError(res.ExecutionError)
+	assert.Equal(uint8(0), res.Receipt.ExitCode)
+
+	gotStCid, err := st.Flush(ctx)
+	require.NoError(err)
+
+	// Neither the transfer nor addr2's state change survive.
+	expAct0 := th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(0))
+	expAct0.Nonce = 1
+	expAct1 := th.RequireNewFakeActorWithTokens(require, vms, addr1, fakeActorCodeCid, types.NewAttoFILFromFIL(100))
+	expAct2 := th.RequireNewFakeActorWithTokens(require, vms, addr2, fakeActorCodeCid, types.NewAttoFILFromFIL(0))
+
+	expStCid, _ := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+		addr0: expAct0,
+		addr1: expAct1,
+		addr2: expAct2,
+	})
+
+	assert.True(expStCid.Equals(gotStCid))
+}
+
 func TestSendToNonexistentAddressThenSpendFromIt(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -1108,3 +1166,13 @@ func mustCreateMiner(ctx context.Context, require *require.Assertions, st state.
 	require.NoError(err)
 	return stCid, miner
 }
+
+// tipSetMessages lays out the messages of each block of ts in the order of
+// ts.ToSlice(), as the processor expects them.
+func tipSetMessages(ts types.TipSet, blkMsgs map[*types.Block][]*types.SignedMessage) [][]*types.SignedMessage {
+	var msgs [][]*types.SignedMessage
+	for _, blk := range ts.ToSlice() {
+		msgs = append(msgs, blkMsgs[blk])
+	}
+	return msgs
+}
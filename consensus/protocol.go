@@ -12,6 +12,9 @@ package consensus
 import (
 	"context"
 
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -34,6 +37,13 @@ type Protocol interface {
 	// tipset b is heavier than tipset a.
 	IsHeavier(ctx context.Context, a, b types.TipSet, aSt, bSt state.Tree) (bool, error)
 	// RunStateTransition returns the state resulting from applying the input ts to the parent
-	// state pSt.  It returns an error if the transition is invalid.
-	RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (state.Tree, error)
+	// state pSt.  It returns an error if the transition is invalid.  The messages and receipts
+	// of ts are given block by block in the order of ts.ToSlice().
+	RunStateTransition(ctx context.Context, ts types.TipSet, tsMessages [][]*types.SignedMessage, tsReceipts [][]*types.MessageReceipt, ancestors []types.TipSet, pSt state.Tree) (state.Tree, error)
+	// AncestorRoundsNeeded returns the number of rounds of the ancestor chain
+	// RunStateTransition needs to process a tipset at height bh.
+	AncestorRoundsNeeded(bh *types.BlockHeight) *types.BlockHeight
+	// BuiltinActors returns the builtin actor code of the protocol rules in
+	// effect at height bh.
+	BuiltinActors(bh *types.BlockHeight) map[cid.Cid]exec.ExecutableActor
 }
@@ -88,7 +88,7 @@ type TestBlockRewarder struct{}
 var _ BlockRewarder = (*TestBlockRewarder)(nil)
 
 // BlockReward is a noop
-func (tbr *TestBlockRewarder) BlockReward(ctx context.Context, st state.Tree, minerAddr address.Address) error {
+func (tbr *TestBlockRewarder) BlockReward(ctx context.Context, st state.Tree, minerAddr address.Address, bh *types.BlockHeight) error {
 	// do nothing to keep state root the same
 	return nil
 }
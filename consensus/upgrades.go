@@ -0,0 +1,167 @@
+package consensus
+
+import (
+	"fmt"
+	"sort"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ProtocolRules is a version of the protocol rules. It is in effect for
+// tipsets from its ActivationHeight up to the activation height of the next
+// version.
+type ProtocolRules struct {
+	// Version identifies the rules. Versions increase with activation height.
+	Version uint64
+
+	// ActivationHeight is the first height at which these rules apply.
+	ActivationHeight *types.BlockHeight
+
+	// Actors is the registry of builtin actor code, indexed by code CID.
+	Actors map[cid.Cid]exec.ExecutableActor
+
+	// BlockReward is the amount paid to the owner of the miner of each block.
+	BlockReward *types.AttoFIL
+
+	// GasSchedule prices message execution. If nil the schedule installed in
+	// the genesis state is used.
+	GasSchedule *gasschedule.Schedule
+}
+
+// ProvingPeriodBlocks returns the length of the proving period the miner
+// actor of these rules enforces.
+func (r *ProtocolRules) ProvingPeriodBlocks() *types.BlockHeight {
+	if ma, ok := r.Actors[types.MinerActorCodeCid].(*miner.Actor); ok {
+		return ma.ProvingPeriod()
+	}
+	return miner.ProvingPeriodBlocks
+}
+
+// Upgrades is the ordered list of protocol rule versions of a network, the
+// first of which is active from genesis.
+type Upgrades []*ProtocolRules
+
+// GenesisRules returns the rules the network launched with.
+func GenesisRules() *ProtocolRules {
+	return &ProtocolRules{
+		Version:          0,
+		ActivationHeight: types.NewBlockHeight(0),
+		Actors:           builtin.Actors,
+		BlockReward:      types.NewAttoFILFromFIL(1000),
+	}
+}
+
+// DefaultUpgrades returns the upgrade schedule of a network that has never
+// been upgraded.
+func DefaultUpgrades() Upgrades {
+	return Upgrades{GenesisRules()}
+}
+
+// UpgradesFromConfig returns the upgrade schedule of a network launched with
+// the genesis rules and upgraded as configured. Values an upgrade leaves
+// unset are carried over from the version it follows.
+func UpgradesFromConfig(cfgs []*config.UpgradeConfig) (Upgrades, error) {
+	sorted := append([]*config.UpgradeConfig{}, cfgs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ActivationHeight < sorted[j].ActivationHeight
+	})
+
+	prev := GenesisRules()
+	rules := []*ProtocolRules{prev}
+	for _, cfg := range sorted {
+		provingPeriod := prev.ProvingPeriodBlocks()
+		if cfg.ProvingPeriodBlocks != 0 {
+			provingPeriod = types.NewBlockHeight(cfg.ProvingPeriodBlocks)
+		}
+
+		r := &ProtocolRules{
+			Version:          cfg.Version,
+			ActivationHeight: types.NewBlockHeight(cfg.ActivationHeight),
+			Actors:           builtin.NewActors(builtin.Config{ProvingPeriodBlocks: provingPeriod}),
+			BlockReward:      prev.BlockReward,
+			GasSchedule:      prev.GasSchedule,
+		}
+		if cfg.BlockReward != nil {
+			r.BlockReward = cfg.BlockReward
+		}
+		if cfg.GasSchedule != nil {
+			r.GasSchedule = cfg.GasSchedule
+		}
+
+		rules = append(rules, r)
+		prev = r
+	}
+	return NewUpgrades(rules...)
+}
+
+// NewUpgrades returns an upgrade schedule made of the given rules, which may
+// be passed in any order. It errors if no rules are active at genesis, if
+// two versions activate at the same height, or if versions do not increase
+// with activation height.
+func NewUpgrades(rules ...*ProtocolRules) (Upgrades, error) {
+	upgrades := append(Upgrades{}, rules...)
+	sort.Slice(upgrades, func(i, j int) bool {
+		return upgrades[i].ActivationHeight.LessThan(upgrades[j].ActivationHeight)
+	})
+
+	if len(upgrades) == 0 || !upgrades[0].ActivationHeight.Equal(types.NewBlockHeight(0)) {
+		return nil, fmt.Errorf("no protocol rules active at genesis")
+	}
+	for i, r := range upgrades {
+		if r.Actors == nil || r.BlockReward == nil {
+			return nil, fmt.Errorf("protocol version %d is incomplete", r.Version)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := upgrades[i-1]
+		if r.ActivationHeight.Equal(prev.ActivationHeight) {
+			return nil, fmt.Errorf("protocol versions %d and %d activate at the same height %s", prev.Version, r.Version, r.ActivationHeight)
+		}
+		if r.Version <= prev.Version {
+			return nil, fmt.Errorf("protocol version %d activates after version %d", prev.Version, r.Version)
+		}
+	}
+	return upgrades, nil
+}
+
+// RulesAt returns the rules in effect at height bh.
+func (u Upgrades) RulesAt(bh *types.BlockHeight) *ProtocolRules {
+	rules := u[0]
+	for _, r := range u[1:] {
+		if bh.LessThan(r.ActivationHeight) {
+			break
+		}
+		rules = r
+	}
+	return rules
+}
+
+// ProvingPeriodBlocks returns the length of the proving period at height bh.
+func (u Upgrades) ProvingPeriodBlocks(bh *types.BlockHeight) *types.BlockHeight {
+	return u.RulesAt(bh).ProvingPeriodBlocks()
+}
+
+// AncestorRoundsNeeded returns the number of rounds of the ancestor chain
+// needed to process a tipset at height bh. It covers the longest proving
+// period of the rules active up to bh, plus the grace period, so that a PoST
+// for a period that started under earlier rules can still be checked.
+func (u Upgrades) AncestorRoundsNeeded(bh *types.BlockHeight) *types.BlockHeight {
+	needed := u[0].ProvingPeriodBlocks()
+	for _, r := range u[1:] {
+		if bh.LessThan(r.ActivationHeight) {
+			break
+		}
+		if period := r.ProvingPeriodBlocks(); period.GreaterThan(needed) {
+			needed = period
+		}
+	}
+	return needed.Add(miner.GracePeriodBlocks)
+}
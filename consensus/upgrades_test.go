@@ -0,0 +1,269 @@
+package consensus_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	. "github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+func TestNewUpgrades(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	v0 := GenesisRules()
+	v1 := &ProtocolRules{
+		Version:          1,
+		ActivationHeight: types.NewBlockHeight(10),
+		Actors:           builtin.Actors,
+		BlockReward:      types.NewAttoFILFromFIL(500),
+	}
+	v2 := &ProtocolRules{
+		Version:          2,
+		ActivationHeight: types.NewBlockHeight(20),
+		Actors:           builtin.Actors,
+		BlockReward:      types.NewAttoFILFromFIL(250),
+	}
+
+	t.Run("rules are picked by height", func(t *testing.T) {
+		upgrades, err := NewUpgrades(v2, v0, v1)
+		require.NoError(err)
+
+		assert.Equal(v0, upgrades.RulesAt(types.NewBlockHeight(0)))
+		assert.Equal(v0, upgrades.RulesAt(types.NewBlockHeight(9)))
+		assert.Equal(v1, upgrades.RulesAt(types.NewBlockHeight(10)))
+		assert.Equal(v1, upgrades.RulesAt(types.NewBlockHeight(19)))
+		assert.Equal(v2, upgrades.RulesAt(types.NewBlockHeight(20)))
+		assert.Equal(v2, upgrades.RulesAt(types.NewBlockHeight(1000)))
+	})
+
+	t.Run("genesis rules are required", func(t *testing.T) {
+		_, err := NewUpgrades(v1, v2)
+		assert.Error(err)
+	})
+
+	t.Run("activation heights must be distinct", func(t *testing.T) {
+		clash := &ProtocolRules{
+			Version:          3,
+			ActivationHeight: types.NewBlockHeight(10),
+			Actors:           builtin.Actors,
+			BlockReward:      types.NewAttoFILFromFIL(1),
+		}
+		_, err := NewUpgrades(v0, v1, clash)
+		assert.Error(err)
+	})
+
+	t.Run("versions must increase with height", func(t *testing.T) {
+		backwards := &ProtocolRules{
+			Version:          1,
+			ActivationHeight: types.NewBlockHeight(30),
+			Actors:           builtin.Actors,
+			BlockReward:      types.NewAttoFILFromFIL(1),
+		}
+		_, err := NewUpgrades(v0, v2, backwards)
+		assert.Error(err)
+	})
+}
+
+// upgradeHarness runs a chain of single block tipsets through a processor
+// following an upgrade schedule. Every block calls goodCall on a fake actor
+// whose code only exists from the upgrade on.
+type upgradeHarness struct {
+	require   *require.Assertions
+	processor *DefaultProcessor
+	st        state.Tree
+	vms       vm.StorageMap
+	signer    types.MockSigner
+	nonce     uint64
+
+	minerAddr  address.Address
+	ownerAddr  address.Address
+	senderAddr address.Address
+	fakeAddr   address.Address
+}
+
+func newUpgradeHarness(require *require.Assertions, upgrades Upgrades, fakeCode cid.Cid) *upgradeHarness {
+	ctx := context.Background()
+	newAddress := address.NewForTestGetter()
+	ki := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+	signer := types.NewMockSigner(ki)
+
+	h := &upgradeHarness{
+		require:    require,
+		processor:  NewProcessorWithUpgrades(upgrades),
+		vms:        th.VMStorage(),
+		signer:     signer,
+		minerAddr:  newAddress(),
+		ownerAddr:  newAddress(),
+		senderAddr: signer.Addresses[0],
+		fakeAddr:   newAddress(),
+	}
+
+	_, h.st = th.RequireMakeStateTree(require, hamt.NewCborStore(), map[address.Address]*actor.Actor{
+		address.NetworkAddress: th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(1000000)),
+		h.ownerAddr:            th.RequireNewAccountActor(require, types.ZeroAttoFIL),
+		h.senderAddr:           th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(1000)),
+		h.fakeAddr:             th.RequireNewFakeActor(require, h.vms, h.fakeAddr, fakeCode),
+	})
+	mustCreateMiner(ctx, require, h.st, h.vms, h.minerAddr, h.ownerAddr)
+	return h
+}
+
+// runTipSetAt processes a tipset at the given height and returns the receipt
+// of its message along with the amount the miner's owner was paid.
+func (h *upgradeHarness) runTipSetAt(height uint64) (*types.MessageReceipt, *types.AttoFIL) {
+	ctx := context.Background()
+
+	msg := types.NewMessage(h.senderAddr, h.fakeAddr, h.nonce, types.ZeroAttoFIL, "goodCall", nil)
+	smsg, err := types.NewSignedMessage(*msg, &h.signer, types.NewGasPrice(1), types.NewGasUnits(10000))
+	h.require.NoError(err)
+	h.nonce++
+
+	blk := &types.Block{
+		Miner:  h.minerAddr,
+		Height: types.Uint64(height),
+	}
+
+	before, err := h.st.GetActor(ctx, h.ownerAddr)
+	h.require.NoError(err)
+	balance := before.Balance
+
+	res, err := h.processor.ProcessTipSet(ctx, h.st, h.vms, th.RequireNewTipSet(h.require, blk), [][]*types.SignedMessage{{smsg}}, nil)
+	h.require.NoError(err)
+	h.require.Len(res.Results, 1)
+
+	after, err := h.st.GetActor(ctx, h.ownerAddr)
+	h.require.NoError(err)
+	return res.Results[0].Receipt, after.Balance.Sub(balance)
+}
+
+func TestProcessorAcrossUpgradeBoundary(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fakeCode := types.NewCidForTestGetter()()
+	upgradedActors := map[cid.Cid]exec.ExecutableActor{fakeCode: &actor.FakeActor{}}
+	for c, a := range builtin.Actors {
+		upgradedActors[c] = a
+	}
+
+	upgrades, err := NewUpgrades(GenesisRules(), &ProtocolRules{
+		Version:          1,
+		ActivationHeight: types.NewBlockHeight(10),
+		Actors:           upgradedActors,
+		BlockReward:      types.NewAttoFILFromFIL(500),
+		GasSchedule:      &gasschedule.Schedule{StoragePutPerByte: types.NewGasUnits(1)},
+	})
+	require.NoError(err)
+
+	h := newUpgradeHarness(require, upgrades, fakeCode)
+
+	for _, height := range []uint64{8, 9} {
+		receipt, paid := h.runTipSetAt(height)
+		assert.Equal(uint8(errors.ErrNoActorCode), receipt.ExitCode, "height %d", height)
+		assert.True(receipt.GasAttoFIL.IsZero())
+		assert.True(types.NewAttoFILFromFIL(1000).Equal(paid))
+	}
+
+	for _, height := range []uint64{10, 11} {
+		receipt, paid := h.runTipSetAt(height)
+		assert.Equal(uint8(0), receipt.ExitCode, "height %d", height)
+		// The upgraded schedule charges for the fake actor's storage writes.
+		assert.True(receipt.GasAttoFIL.IsPositive())
+		assert.True(types.NewAttoFILFromFIL(500).Add(receipt.GasAttoFIL).Equal(paid))
+	}
+}
+
+func TestUpgradesFromConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	upgrades, err := UpgradesFromConfig([]*config.UpgradeConfig{
+		{
+			Version:          2,
+			ActivationHeight: 200,
+			BlockReward:      types.NewAttoFILFromFIL(250),
+		},
+		{
+			Version:             1,
+			ActivationHeight:    100,
+			ProvingPeriodBlocks: 5000,
+		},
+	})
+	require.NoError(err)
+
+	genesis := types.NewBlockHeight(0)
+	before := types.NewBlockHeight(99)
+	at := types.NewBlockHeight(100)
+	after := types.NewBlockHeight(200)
+
+	assert.Equal(miner.ProvingPeriodBlocks, upgrades.ProvingPeriodBlocks(before))
+	assert.Equal(types.NewBlockHeight(5000), upgrades.ProvingPeriodBlocks(at))
+	// unset values carry over from the previous version
+	assert.Equal(types.NewBlockHeight(5000), upgrades.ProvingPeriodBlocks(after))
+	assert.True(upgrades.RulesAt(genesis).BlockReward.Equal(upgrades.RulesAt(at).BlockReward))
+	assert.True(types.NewAttoFILFromFIL(250).Equal(upgrades.RulesAt(after).BlockReward))
+
+	// the ancestors needed cover the longest proving period in effect so far
+	assert.Equal(miner.ProvingPeriodBlocks.Add(miner.GracePeriodBlocks), upgrades.AncestorRoundsNeeded(before))
+	assert.Equal(types.NewBlockHeight(5000).Add(miner.GracePeriodBlocks), upgrades.AncestorRoundsNeeded(after))
+}
+
+func TestMinerProvingPeriodAcrossUpgrade(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	upgrades, err := UpgradesFromConfig([]*config.UpgradeConfig{{
+		Version:             1,
+		ActivationHeight:    10,
+		ProvingPeriodBlocks: 5000,
+	}})
+	require.NoError(err)
+
+	st, vms := core.CreateStorages(ctx, t)
+	pdata := actor.MustConvertParams(big.NewInt(100), []byte("my public key"), th.RequireRandomPeerID())
+	msg := types.NewMessage(address.TestAddress, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(100), "createMiner", pdata)
+	res, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	minerAddr, err := address.NewFromBytes(res.Receipt.Return[0])
+	require.NoError(err)
+
+	// the first commitment starts the proving period at height 3
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	provingPeriodEnd := func(height uint64) *types.BlockHeight {
+		bh := types.NewBlockHeight(height)
+		upgraded := state.WithBuiltinActors(st, upgrades.RulesAt(bh).Actors)
+		ret, code, err := CallQueryMethod(ctx, upgraded, vms, minerAddr, "getProvingPeriodEnd", nil, address.TestAddress, bh)
+		require.NoError(err)
+		require.Equal(uint8(0), code)
+		return types.NewBlockHeightFromBytes(ret[0])
+	}
+
+	assert.Equal(types.NewBlockHeight(3).Add(miner.ProvingPeriodBlocks), provingPeriodEnd(9))
+	assert.Equal(types.NewBlockHeight(5003), provingPeriodEnd(10))
+}
@@ -9,6 +9,7 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -102,6 +103,19 @@ func getParentTipSet(ctx context.Context, store *hamt.CborIpldStore, ts types.Ti
 	return newTipSet, nil
 }
 
+// tipSetMessages returns the messages of all blocks of ts.
+func tipSetMessages(ctx context.Context, store *hamt.CborIpldStore, ts types.TipSet) ([]*types.SignedMessage, error) {
+	blkMsgs, _, err := chain.NewMessageStore(store).LoadTipSetMessages(ctx, ts)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*types.SignedMessage
+	for _, m := range blkMsgs {
+		msgs = append(msgs, m...)
+	}
+	return msgs, nil
+}
+
 // collectChainsMessagesToHeight is a helper that collects all the messages
 // from block `b` down the chain to but not including its ancestor of
 // height `height`.  This function returns the messages collected along with
@@ -114,9 +128,11 @@ func collectChainsMessagesToHeight(ctx context.Context, store *hamt.CborIpldStor
 		return nil, nil, err
 	}
 	for h > height {
-		for _, blk := range curTipSet {
-			msgs = append(msgs, blk.Messages...)
+		tsMsgs, err := tipSetMessages(ctx, store, curTipSet)
+		if err != nil {
+			return nil, nil, err
 		}
+		msgs = append(msgs, tsMsgs...)
 		parents, err := curTipSet.Parents()
 		if err != nil {
 			return nil, nil, err
@@ -180,15 +196,19 @@ func UpdateMessagePool(ctx context.Context, pool *MessagePool, store *hamt.CborI
 	//
 	// TODO probably should limit depth here.
 	for !old.Equals(new) {
-		for _, blk := range old {
-			// skip genesis block
-			if blk.Height > 0 {
-				addToPool = append(addToPool, blk.Messages...)
+		// skip genesis block
+		if h, _ := old.Height(); h > 0 {
+			oldMsgs, err := tipSetMessages(ctx, store, old)
+			if err != nil {
+				return err
 			}
+			addToPool = append(addToPool, oldMsgs...)
 		}
-		for _, blk := range new {
-			removeFromPool = append(removeFromPool, blk.Messages...)
+		newMsgs, err := tipSetMessages(ctx, store, new)
+		if err != nil {
+			return err
 		}
+		removeFromPool = append(removeFromPool, newMsgs...)
 		oldParents, err := old.Parents()
 		if err != nil {
 			return err
@@ -16,6 +16,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -91,8 +92,12 @@ func NewChainWithMessages(store *hamt.CborIpldStore, root types.TipSet, msgSets
 			ts[child.Cid()] = child
 		}
 		for _, msgs := range tsMsgs {
+			msgsRoot, err := chain.NewMessageStore(store).StoreMessages(context.Background(), msgs)
+			if err != nil {
+				panic(err)
+			}
 			child := &types.Block{
-				Messages: msgs,
+				Messages: msgsRoot,
 				Parents:  parents.ToSortedCidSet(),
 				Height:   types.Uint64(height + 1),
 			}
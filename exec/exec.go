@@ -35,6 +35,28 @@ var Errors = map[uint8]error{
 	ErrStaleHead:       errors.NewCodedRevertError(ErrStaleHead, "Expected head is stale"),
 }
 
+// GasOp identifies an operation whose gas price is set by the VM's gas schedule.
+type GasOp string
+
+const (
+	// GasOpMethodCall is the base cost of invoking an actor method.
+	GasOpMethodCall = GasOp("methodCall")
+	// GasOpSend is the cost of an actor sending a message to another actor.
+	GasOpSend = GasOp("send")
+	// GasOpStoragePutByte is the cost of each byte an actor puts in storage.
+	GasOpStoragePutByte = GasOp("storagePutByte")
+	// GasOpCreateActor is the cost of creating a new actor.
+	GasOpCreateActor = GasOp("createActor")
+	// GasOpVerifySignature is the cost of verifying a signature.
+	GasOpVerifySignature = GasOp("verifySignature")
+	// GasOpVerifySeal is the cost of verifying a proof of replication.
+	GasOpVerifySeal = GasOp("verifySeal")
+	// GasOpVerifyPoSt is the cost of verifying a proof of spacetime.
+	GasOpVerifyPoSt = GasOp("verifyPoSt")
+	// GasOpOther accounts for gas charged directly in gas units.
+	GasOpOther = GasOp("other")
+)
+
 // Exports describe the public methods of an actor.
 type Exports map[string]*FunctionSignature
 
@@ -72,8 +94,10 @@ type VMContext interface {
 	Send(to address.Address, method string, value *types.AttoFIL, params []interface{}) ([][]byte, uint8, error)
 	AddressForNewActor() (address.Address, error)
 	BlockHeight() *types.BlockHeight
+	MyBalance() *types.AttoFIL
 	IsFromAccountActor() bool
 	Charge(cost types.GasUnits) error
+	ChargeOp(op GasOp, count uint64) error
 
 	CreateNewActor(addr address.Address, code cid.Cid, initalizationParams interface{}) error
 
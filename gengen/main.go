@@ -52,6 +52,15 @@ $ cat setup.json
 			"owner": 1,
 			"power": 1000
 		}
+	],
+	"vesting": [
+		{
+			"beneficiary": 2,
+			"amount": "1000",
+			"start": 0,
+			"duration": 10000,
+			"step": 100
+		}
 	]
 }
 $ cat setup.json | gengen > genesis.car
@@ -124,6 +133,9 @@ func main() {
 	for _, m := range info.Miners {
 		fmt.Fprintf(os.Stderr, "created miner %s, owned by %d, power = %d\n", m.Address, m.Owner, m.Power) // nolint: errcheck
 	}
+	for _, v := range info.Vesting {
+		fmt.Fprintf(os.Stderr, "created vesting account %s for %d\n", v.Address, v.Beneficiary) // nolint: errcheck
+	}
 }
 
 func readConfig(filePath string) (*gengen.GenesisCfg, error) {
@@ -11,7 +11,10 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/vesting"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/amt"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/crypto"
 	"github.com/filecoin-project/go-filecoin/proofs"
@@ -47,6 +50,27 @@ type Miner struct {
 	Power uint64
 }
 
+// VestingAccount is an account created in the genesis block holding Amount,
+// which is released to its beneficiary over Duration blocks from Start.
+type VestingAccount struct {
+	// Beneficiary is the name of the key that may withdraw the vested funds
+	// It must be a name of a key from the configs 'Keys' list
+	Beneficiary int
+
+	// Amount is the string value of whole filecoin locked in the account
+	Amount string
+
+	// Start is the block height at which funds start to vest
+	Start uint64
+
+	// Duration is the number of blocks after Start at which all funds have vested
+	Duration uint64
+
+	// Step, if greater than one, releases funds every Step blocks rather
+	// than every block
+	Step uint64
+}
+
 // GenesisCfg is
 type GenesisCfg struct {
 	// Keys is an array of names of keys. A random key will be generated
@@ -59,6 +83,14 @@ type GenesisCfg struct {
 
 	// Miners is a list of miners that should be set up at the start of the network
 	Miners []Miner
+
+	// Vesting is a list of accounts whose funds are released to their
+	// beneficiary over time
+	Vesting []VestingAccount
+
+	// GasSchedule, if set, prices the operations performed by messages on
+	// this network. The VM's default schedule is used otherwise.
+	GasSchedule *gasschedule.Schedule
 }
 
 // RenderedGenInfo contains information about a genesis block creation
@@ -69,10 +101,22 @@ type RenderedGenInfo struct {
 	// Miners is the list of addresses of miners created
 	Miners []RenderedMinerInfo
 
+	// Vesting is the list of vesting accounts created
+	Vesting []RenderedVestingInfo
+
 	// GenesisCid is the cid of the created genesis block
 	GenesisCid cid.Cid
 }
 
+// RenderedVestingInfo contains info about a created vesting account
+type RenderedVestingInfo struct {
+	// Beneficiary is the key name of the beneficiary of this account
+	Beneficiary int
+
+	// Address is the address of the vesting actor holding the funds
+	Address address.Address
+}
+
 // RenderedMinerInfo contains info about a created miner
 type RenderedMinerInfo struct {
 	// Owner is the key name of the owner of this miner
@@ -104,6 +148,12 @@ func GenGen(ctx context.Context, cfg *GenesisCfg, cst *hamt.CborIpldStore, bs bl
 		return nil, err
 	}
 
+	if cfg.GasSchedule != nil {
+		if err := vm.InstallGasSchedule(ctx, st, storageMap, cfg.GasSchedule); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := setupPrealloc(st, keys, cfg.PreAlloc); err != nil {
 		return nil, err
 	}
@@ -113,6 +163,11 @@ func GenGen(ctx context.Context, cfg *GenesisCfg, cst *hamt.CborIpldStore, bs bl
 		return nil, err
 	}
 
+	vesting, err := setupVesting(st, storageMap, keys, cfg.Vesting)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := cst.Blocks.AddBlock(types.StorageMarketActorCodeObj); err != nil {
 		return nil, err
 	}
@@ -128,6 +183,15 @@ func GenGen(ctx context.Context, cfg *GenesisCfg, cst *hamt.CborIpldStore, bs bl
 	if err := cst.Blocks.AddBlock(types.PaymentBrokerActorCodeObj); err != nil {
 		return nil, err
 	}
+	if err := cst.Blocks.AddBlock(types.MultisigActorCodeObj); err != nil {
+		return nil, err
+	}
+	if err := cst.Blocks.AddBlock(types.MultisigFactoryActorCodeObj); err != nil {
+		return nil, err
+	}
+	if err := cst.Blocks.AddBlock(types.VestingActorCodeObj); err != nil {
+		return nil, err
+	}
 
 	stateRoot, err := st.Flush(ctx)
 	if err != nil {
@@ -139,8 +203,15 @@ func GenGen(ctx context.Context, cfg *GenesisCfg, cst *hamt.CborIpldStore, bs bl
 		return nil, err
 	}
 
+	emptyRoot, err := amt.Build(ctx, cst, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	geneblk := &types.Block{
-		StateRoot: stateRoot,
+		StateRoot:       stateRoot,
+		Messages:        emptyRoot,
+		MessageReceipts: emptyRoot,
 	}
 
 	c, err := cst.Put(ctx, geneblk)
@@ -152,6 +223,7 @@ func GenGen(ctx context.Context, cfg *GenesisCfg, cst *hamt.CborIpldStore, bs bl
 		Keys:       keys,
 		GenesisCid: c,
 		Miners:     miners,
+		Vesting:    vesting,
 	}, nil
 }
 
@@ -283,7 +355,7 @@ func setupMiners(st state.Tree, sm vm.StorageMap, keys []*types.KeyInfo, miners
 			if _, err := pnrg.Read(sealProof[:]); err != nil {
 				return nil, err
 			}
-			_, err := applyMessageDirect(ctx, st, sm, addr, maddr, types.NewAttoFILFromFIL(0), "commitSector", sectorID, commD, commR, commRStar, sealProof)
+			_, err := applyMessageDirect(ctx, st, sm, addr, maddr, types.NewAttoFILFromFIL(0), "commitSector", sectorID, commD, commR, commRStar, sealProof, []uint64{})
 			if err != nil {
 				return nil, err
 			}
@@ -293,6 +365,47 @@ func setupMiners(st state.Tree, sm vm.StorageMap, keys []*types.KeyInfo, miners
 	return minfos, nil
 }
 
+func setupVesting(st state.Tree, sm vm.StorageMap, keys []*types.KeyInfo, accounts []VestingAccount) ([]RenderedVestingInfo, error) {
+	var vinfos []RenderedVestingInfo
+	ctx := context.Background()
+
+	for i, v := range accounts {
+		if v.Beneficiary < 0 || v.Beneficiary >= len(keys) {
+			return nil, fmt.Errorf("vesting account %d has no beneficiary key", i)
+		}
+		beneficiary, err := keys[v.Beneficiary].Address()
+		if err != nil {
+			return nil, err
+		}
+
+		valint, err := strconv.ParseUint(v.Amount, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		total := types.NewAttoFILFromFIL(valint)
+
+		// vesting actors are not created by a message, so their address is
+		// derived from their position in the config
+		addr := address.NewMainnet(address.Hash([]byte(fmt.Sprintf("vesting-%d", i))))
+
+		act := vesting.NewActor(total)
+		initState := vesting.NewState(beneficiary, total, types.NewBlockHeight(v.Start), v.Duration, v.Step)
+		if err := (&vesting.Actor{}).InitializeState(sm.NewStorage(addr, act), initState); err != nil {
+			return nil, err
+		}
+		if err := st.SetActor(ctx, addr, act); err != nil {
+			return nil, err
+		}
+
+		vinfos = append(vinfos, RenderedVestingInfo{
+			Beneficiary: v.Beneficiary,
+			Address:     addr,
+		})
+	}
+
+	return vinfos, nil
+}
+
 // GenGenesisCar generates a car for the given genesis configuration
 func GenGenesisCar(cfg *GenesisCfg, out io.Writer, seed int64) (*RenderedGenInfo, error) {
 	// TODO: these six lines are ugly. We can do better...
@@ -327,7 +440,7 @@ func applyMessageDirect(ctx context.Context, st state.Tree, vms vm.StorageMap, f
 	}
 
 	// create new processor that doesn't reward and doesn't validate
-	applier := consensus.NewConfiguredProcessor(&messageValidator{}, &blockRewarder{})
+	applier := consensus.NewConfiguredProcessor(&messageValidator{}, &blockRewarder{}, consensus.DefaultUpgrades())
 
 	res, err := applier.ApplyMessagesAndPayRewards(ctx, st, vms, []*types.SignedMessage{smsg}, address.Address{}, types.NewBlockHeight(0), nil)
 	if err != nil {
@@ -361,7 +474,7 @@ type blockRewarder struct{}
 var _ consensus.BlockRewarder = (*blockRewarder)(nil)
 
 // BlockReward is a noop
-func (gbr *blockRewarder) BlockReward(ctx context.Context, st state.Tree, minerAddr address.Address) error {
+func (gbr *blockRewarder) BlockReward(ctx context.Context, st state.Tree, minerAddr address.Address, bh *types.BlockHeight) error {
 	return nil
 }
 
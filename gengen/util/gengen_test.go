@@ -30,6 +30,14 @@ var testConfig = &GenesisCfg{
 			Power: 10,
 		},
 	},
+	Vesting: []VestingAccount{
+		{
+			Beneficiary: 2,
+			Amount:      "1000",
+			Duration:    100,
+			Step:        10,
+		},
+	},
 }
 
 func TestGenGenLoading(t *testing.T) {
@@ -49,6 +57,7 @@ func TestGenGenLoading(t *testing.T) {
 	stdout := o.ReadStdout()
 	assert.Contains(stdout, `"MinerActor"`)
 	assert.Contains(stdout, `"StoragemarketActor"`)
+	assert.Contains(stdout, `"VestingActor"`)
 }
 
 func TestGenGenDeterministicBetweenBuilds(t *testing.T) {
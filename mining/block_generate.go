@@ -10,6 +10,7 @@ import (
 
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
@@ -58,7 +59,14 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 	messages := mq.Drain()
 
 	vms := vm.NewStorageMap(w.blockstore)
-	res, err := w.processor.ApplyMessagesAndPayRewards(ctx, stateTree, vms, messages, w.minerOwnerAddr, types.NewBlockHeight(blockHeight), ancestors)
+
+	// the owner can change, so the rewards go to the one in the parent state
+	minerOwnerAddr, err := w.getMinerOwner(ctx, stateTree, vms, w.minerAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "get miner owner")
+	}
+
+	res, err := w.processor.ApplyMessagesAndPayRewards(ctx, stateTree, vms, messages, minerOwnerAddr, types.NewBlockHeight(blockHeight), ancestors)
 	if err != nil {
 		return nil, errors.Wrap(err, "generate apply messages")
 	}
@@ -77,11 +85,21 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 		receipts = append(receipts, r.Receipt)
 	}
 
+	msgStore := chain.NewMessageStore(w.cstore)
+	messagesRoot, err := msgStore.StoreMessages(ctx, res.SuccessfulMessages)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate store messages")
+	}
+	receiptsRoot, err := msgStore.StoreReceipts(ctx, receipts)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate store receipts")
+	}
+
 	next := &types.Block{
 		Miner:           w.minerAddr,
 		Height:          types.Uint64(blockHeight),
-		Messages:        res.SuccessfulMessages,
-		MessageReceipts: receipts,
+		Messages:        messagesRoot,
+		MessageReceipts: receiptsRoot,
 		Parents:         baseTipSet.ToSortedCidSet(),
 		ParentWeight:    types.Uint64(weight),
 		Proof:           proof,
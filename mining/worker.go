@@ -59,6 +59,10 @@ type GetWeight func(context.Context, types.TipSet) (uint64, error)
 // process the input tipset.
 type GetAncestors func(context.Context, types.TipSet, *types.BlockHeight) ([]types.TipSet, error)
 
+// GetMinerOwner is a function that returns the owner of a miner in the given
+// state, the address its block and gas rewards are paid to.
+type GetMinerOwner func(context.Context, state.Tree, vm.StorageMap, address.Address) (address.Address, error)
+
 // MessageSource provides message candidates for mining into blocks
 type MessageSource interface {
 	// Pending returns a slice of un-mined messages.
@@ -77,14 +81,14 @@ type MessageApplier interface {
 type DefaultWorker struct {
 	createPoSTFunc  DoSomeWorkFunc
 	minerAddr       address.Address
-	minerOwnerAddr  address.Address
 	blockSignerAddr address.Address
 	blockSigner     types.Signer
 
 	// consensus things
-	getStateTree GetStateTree
-	getWeight    GetWeight
-	getAncestors GetAncestors
+	getStateTree  GetStateTree
+	getWeight     GetWeight
+	getAncestors  GetAncestors
+	getMinerOwner GetMinerOwner
 
 	// core filecoin things
 	messageSource MessageSource
@@ -105,7 +109,7 @@ func NewDefaultWorker(messageSource MessageSource,
 	bs blockstore.Blockstore,
 	cst *hamt.CborIpldStore,
 	miner address.Address,
-	minerOwner address.Address,
+	getMinerOwner GetMinerOwner,
 	blockSignerAddr address.Address,
 	blockSigner types.Signer,
 	bt time.Duration) *DefaultWorker {
@@ -119,7 +123,7 @@ func NewDefaultWorker(messageSource MessageSource,
 		bs,
 		cst,
 		miner,
-		minerOwner,
+		getMinerOwner,
 		blockSignerAddr,
 		blockSigner,
 		bt,
@@ -142,7 +146,7 @@ func NewDefaultWorkerWithDeps(messageSource MessageSource,
 	bs blockstore.Blockstore,
 	cst *hamt.CborIpldStore,
 	miner address.Address,
-	minerOwner address.Address,
+	getMinerOwner GetMinerOwner,
 	blockSignerAddr address.Address,
 	blockSigner types.Signer,
 	bt time.Duration,
@@ -158,7 +162,7 @@ func NewDefaultWorkerWithDeps(messageSource MessageSource,
 		cstore:          cst,
 		createPoSTFunc:  createPoST,
 		minerAddr:       miner,
-		minerOwnerAddr:  minerOwner,
+		getMinerOwner:   getMinerOwner,
 		blockTime:       bt,
 		blockSignerAddr: blockSignerAddr,
 		blockSigner:     blockSigner,
@@ -15,6 +15,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/mining"
@@ -22,6 +23,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/state"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
 )
 
 func Test_Mine(t *testing.T) {
@@ -53,7 +55,7 @@ func Test_Mine(t *testing.T) {
 	// Success case.
 	// TODO: this case isn't testing much.  Testing w.Mine further needs a lot more attention.
 	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, th.NewTestProcessor(),
-		mining.NewTestPowerTableView(1), bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest,
+		mining.NewTestPowerTableView(1), bs, cst, minerAddr, getMinerOwnerTest(minerOwnerAddr), blockSignerAddr, mockSigner, th.BlockTimeTest,
 		CreatePoSTFunc)
 
 	outCh := make(chan mining.Output)
@@ -65,7 +67,7 @@ func Test_Mine(t *testing.T) {
 	// Block generation fails.
 	ctx, cancel = context.WithCancel(context.Background())
 	worker = mining.NewDefaultWorkerWithDeps(pool, makeExplodingGetStateTree(st), getWeightTest, getAncestors, th.NewTestProcessor(),
-		mining.NewTestPowerTableView(1), bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		mining.NewTestPowerTableView(1), bs, cst, minerAddr, getMinerOwnerTest(minerOwnerAddr), blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
 	outCh = make(chan mining.Output)
 	doSomeWorkCalled = false
 	go worker.Mine(ctx, tipSet, 0, outCh)
@@ -77,7 +79,7 @@ func Test_Mine(t *testing.T) {
 	// Sent empty tipset
 	ctx, cancel = context.WithCancel(context.Background())
 	worker = mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, th.NewTestProcessor(),
-		mining.NewTestPowerTableView(1), bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		mining.NewTestPowerTableView(1), bs, cst, minerAddr, getMinerOwnerTest(minerOwnerAddr), blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
 	outCh = make(chan mining.Output)
 	doSomeWorkCalled = false
 	input := types.TipSet{}
@@ -102,6 +104,12 @@ func sharedSetupInitial() (*hamt.CborIpldStore, *core.MessagePool, cid.Cid) {
 	return cst, pool, fakeActorCodeCid
 }
 
+func requireBlockMessages(require *require.Assertions, cst *hamt.CborIpldStore, blk *types.Block) []*types.SignedMessage {
+	msgs, err := chain.NewMessageStore(cst).LoadMessages(context.Background(), blk.Messages)
+	require.NoError(err)
+	return msgs
+}
+
 func sharedSetup(t *testing.T, mockSigner types.MockSigner) (
 	state.Tree, *core.MessagePool, []address.Address, *hamt.CborIpldStore, blockstore.Blockstore) {
 
@@ -212,7 +220,7 @@ func TestGenerateMultiBlockTipSet(t *testing.T) {
 	minerOwnerAddr := addrs[3]
 
 	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, th.NewTestProcessor(),
-		&th.TestView{}, bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, minerAddr, getMinerOwnerTest(minerOwnerAddr), blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
 
 	parents := types.NewSortedCidSet(newCid())
 	stateRoot := newCid()
@@ -232,7 +240,7 @@ func TestGenerateMultiBlockTipSet(t *testing.T) {
 	blk, err := worker.Generate(ctx, th.RequireNewTipSet(require, &baseBlock1, &baseBlock2), nil, proofs.PoStProof{}, 0)
 	assert.NoError(err)
 
-	assert.Len(blk.Messages, 0)
+	assert.Len(requireBlockMessages(require, cst, blk), 0)
 	assert.Equal(types.Uint64(101), blk.Height)
 	assert.Equal(types.Uint64(1020), blk.ParentWeight)
 }
@@ -255,7 +263,7 @@ func TestGeneratePoolBlockResults(t *testing.T) {
 		return nil, nil
 	}
 	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, consensus.NewDefaultProcessor(),
-		&th.TestView{}, bs, cst, addrs[4], addrs[3], blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, addrs[4], getMinerOwnerTest(addrs[3]), blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
 
 	// addr3 doesn't correspond to an extant account, so this will trigger errAccountNotFound -- a temporary failure.
 	msg1 := types.NewMessage(addrs[2], addrs[0], 0, nil, "", nil)
@@ -297,7 +305,7 @@ func TestGeneratePoolBlockResults(t *testing.T) {
 	assert.Contains(pool.Pending(), smsg1)
 	assert.Contains(pool.Pending(), smsg2)
 
-	assert.Len(blk.Messages, 1) // This is the good message
+	assert.Len(requireBlockMessages(require, cst, blk), 1) // This is the good message
 }
 
 func TestGenerateSetsBasicFields(t *testing.T) {
@@ -321,7 +329,7 @@ func TestGenerateSetsBasicFields(t *testing.T) {
 	minerAddr := addrs[4]
 	minerOwnerAddr := addrs[3]
 	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, consensus.NewDefaultProcessor(),
-		&th.TestView{}, bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, minerAddr, getMinerOwnerTest(minerOwnerAddr), blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
 
 	h := types.Uint64(100)
 	w := types.Uint64(1000)
@@ -364,7 +372,7 @@ func TestGenerateWithoutMessages(t *testing.T) {
 		return nil, nil
 	}
 	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, consensus.NewDefaultProcessor(),
-		&th.TestView{}, bs, cst, addrs[4], addrs[3], blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, addrs[4], getMinerOwnerTest(addrs[3]), blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
 
 	assert.Len(pool.Pending(), 0)
 	baseBlock := types.Block{
@@ -377,7 +385,7 @@ func TestGenerateWithoutMessages(t *testing.T) {
 	assert.NoError(err)
 
 	assert.Len(pool.Pending(), 0) // This is the temporary failure.
-	assert.Len(blk.Messages, 0)
+	assert.Len(requireBlockMessages(require, cst, blk), 0)
 }
 
 // If something goes wrong while generating a new block, even as late as when flushing it,
@@ -399,7 +407,7 @@ func TestGenerateError(t *testing.T) {
 	}
 	worker := mining.NewDefaultWorkerWithDeps(pool, makeExplodingGetStateTree(st), getWeightTest, getAncestors,
 		consensus.NewDefaultProcessor(),
-		&th.TestView{}, bs, cst, addrs[4], addrs[3], blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, addrs[4], getMinerOwnerTest(addrs[3]), blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
 
 	// This is actually okay and should result in a receipt
 	msg := types.NewMessage(addrs[0], addrs[1], 0, nil, "", nil)
@@ -447,6 +455,12 @@ func getWeightTest(c context.Context, ts types.TipSet) (uint64, error) {
 	return w + uint64(len(ts))*consensus.ECV, nil
 }
 
+func getMinerOwnerTest(owner address.Address) mining.GetMinerOwner {
+	return func(ctx context.Context, st state.Tree, vms vm.StorageMap, minerAddr address.Address) (address.Address, error) {
+		return owner, nil
+	}
+}
+
 func makeExplodingGetStateTree(st state.Tree) func(context.Context, types.TipSet) (state.Tree, error) {
 	return func(c context.Context, ts types.TipSet) (state.Tree, error) {
 		stt := wrapStateTreeForTest(st)
@@ -119,7 +119,7 @@ func TestChainSync(t *testing.T) {
 
 type zeroRewarder struct{}
 
-func (r *zeroRewarder) BlockReward(ctx context.Context, st state.Tree, minerAddr address.Address) error {
+func (r *zeroRewarder) BlockReward(ctx context.Context, st state.Tree, minerAddr address.Address, bh *types.BlockHeight) error {
 	return nil
 }
 
@@ -136,8 +136,8 @@ func makeNodes(t *testing.T, assertions *assert.Assertions, numNodes int) (addre
 		AutoSealIntervalSecondsOpt(1),
 	)
 	seed.GiveKey(t, minerNode, 0)
-	mineraddr, minerOwnerAddr := seed.GiveMiner(t, minerNode, 0)
-	_, err := storage.NewMiner(mineraddr, minerOwnerAddr, minerNode, minerNode.Repo.DealsDatastore(), minerNode.PorcelainAPI)
+	mineraddr, _ := seed.GiveMiner(t, minerNode, 0)
+	_, err := storage.NewMiner(mineraddr, minerNode, minerNode.Repo.DealsDatastore(), minerNode.PorcelainAPI)
 	assertions.NoError(err)
 
 	nodes := []*Node{minerNode}
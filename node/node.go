@@ -54,6 +54,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
 	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
+	"github.com/filecoin-project/go-filecoin/plumbing/paychs"
 	"github.com/filecoin-project/go-filecoin/plumbing/strgdls"
 	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/proofs"
@@ -72,6 +73,12 @@ var filecoinDHTProtocol dhtprotocol.ID = "/fil/kad/1.0.0"
 
 var log = logging.Logger("node") // nolint: deadcode
 
+// commitSectorGasLimit bounds the gas of a commitSector message, which also
+// pays for the storage market calls updating the miner's power and
+// activating the deals of the sector, and for verifying the seal proof where
+// the gas schedule prices it.
+const commitSectorGasLimit = 10000
+
 var (
 	// ErrNoMinerAddress is returned when the node is not configured to have any miner addresses.
 	ErrNoMinerAddress = errors.New("no miner addresses configured")
@@ -88,6 +95,8 @@ type Node struct {
 	ChainReader chain.ReadStore
 	Syncer      chain.Syncer
 	PowerTable  consensus.PowerTableView
+	// Upgrades is the network upgrade schedule the node follows.
+	Upgrades consensus.Upgrades
 
 	PorcelainAPI *porcelain.API
 
@@ -169,6 +178,7 @@ type Config struct {
 	OfflineMode bool
 	Verifier    proofs.Verifier
 	Rewarder    consensus.BlockRewarder
+	Upgrades    consensus.Upgrades
 	Repo        repo.Repo
 	IsRelay     bool
 }
@@ -228,6 +238,15 @@ func RewarderConfigOption(rewarder consensus.BlockRewarder) ConfigOpt {
 	}
 }
 
+// UpgradesConfigOption returns a function that sets the network upgrade
+// schedule the node follows
+func UpgradesConfigOption(upgrades consensus.Upgrades) ConfigOpt {
+	return func(c *Config) error {
+		c.Upgrades = upgrades
+		return nil
+	}
+}
+
 // New creates a new node.
 func New(ctx context.Context, opts ...ConfigOpt) (*Node, error) {
 	n := &Config{}
@@ -373,18 +392,26 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	var chainStore chain.Store = chain.NewDefaultStore(nc.Repo.ChainDatastore(), &cstOffline, genCid)
 	powerTable := &consensus.MarketView{}
 
+	upgrades := nc.Upgrades
+	if upgrades == nil {
+		upgrades, err = consensus.UpgradesFromConfig(nc.Repo.Config().Network.Upgrades)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid network upgrades in config")
+		}
+	}
+
 	var processor consensus.Processor
 	if nc.Rewarder == nil {
-		processor = consensus.NewDefaultProcessor()
+		processor = consensus.NewProcessorWithUpgrades(upgrades)
 	} else {
-		processor = consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), nc.Rewarder)
+		processor = consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), nc.Rewarder, upgrades)
 	}
 
 	var nodeConsensus consensus.Protocol
 	if nc.Verifier == nil {
-		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, &proofs.RustVerifier{})
+		nodeConsensus = consensus.NewExpectedWithUpgrades(&cstOffline, bs, processor, powerTable, genCid, &proofs.RustVerifier{}, upgrades)
 	} else {
-		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, nc.Verifier)
+		nodeConsensus = consensus.NewExpectedWithUpgrades(&cstOffline, bs, processor, powerTable, genCid, nc.Verifier, upgrades)
 	}
 
 	// only the syncer gets the storage which is online connected
@@ -408,14 +435,17 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 
 	PorcelainAPI := porcelain.New(plumbing.New(&plumbing.APIDeps{
 		Chain:        chainReader,
+		CborStore:    &cstOffline,
 		Config:       cfg.NewConfig(nc.Repo),
 		Deals:        strgdls.New(nc.Repo.DealsDatastore()),
 		MsgPool:      msgPool,
-		MsgPreviewer: msg.NewPreviewer(fcWallet, chainReader, &cstOffline, bs),
-		MsgQueryer:   msg.NewQueryer(nc.Repo, fcWallet, chainReader, &cstOffline, bs),
+		MsgPreviewer: msg.NewPreviewer(fcWallet, chainReader, &cstOffline, bs, upgrades),
+		MsgQueryer:   msg.NewQueryer(nc.Repo, fcWallet, chainReader, &cstOffline, bs, upgrades),
 		MsgSender:    msg.NewSender(fcWallet, chainReader, msgPool, consensus.NewOutboundMessageValidator(), fsub.Publish),
-		MsgWaiter:    msg.NewWaiter(chainReader, bs, &cstOffline),
+		MsgStore:     chain.NewMessageStore(&cstOffline),
+		MsgWaiter:    msg.NewWaiter(chainReader, bs, &cstOffline, upgrades),
 		Network:      net.New(peerHost, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker),
+		Paychs:       paychs.New(nc.Repo.DealsDatastore()),
 		SigGetter:    mthdsig.NewGetter(chainReader),
 		Wallet:       fcWallet,
 	}))
@@ -429,6 +459,7 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		ChainReader:  chainReader,
 		Syncer:       chainSyncer,
 		PowerTable:   powerTable,
+		Upgrades:     upgrades,
 		PorcelainAPI: PorcelainAPI,
 		Exchange:     bswap,
 		host:         peerHost,
@@ -655,6 +686,7 @@ func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet
 			if node.StorageMiner != nil {
 				node.StorageMiner.OnNewHeaviestTipSet(newHead)
 			}
+			node.reclaimExpiredPaymentChannels(ctx, newHead)
 			node.HeaviestTipSetHandled()
 		case <-ctx.Done():
 			return
@@ -662,6 +694,24 @@ func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet
 	}
 }
 
+// reclaimExpiredPaymentChannels gets back the funds the targets of the payment
+// channels opened by the node did not redeem before the channels expired.
+func (node *Node) reclaimExpiredPaymentChannels(ctx context.Context, head types.TipSet) {
+	height, err := head.Height()
+	if err != nil {
+		log.Errorf("failed to get height of new heaviest tipset: %s", err)
+		return
+	}
+
+	reclaimed, err := node.PorcelainAPI.PaymentChannelReclaimExpired(ctx, types.NewBlockHeight(height))
+	if err != nil {
+		log.Errorf("failed to reclaim expired payment channels: %s", err)
+	}
+	for _, channel := range reclaimed {
+		log.Infof("reclaiming expired payment channel %s of %s", channel.Channel, channel.Payer)
+	}
+}
+
 func (node *Node) cancelSubscriptions() {
 	if node.BlockSub != nil || node.MessageSub != nil {
 		node.cancelSubscriptionsCtx()
@@ -770,11 +820,7 @@ func (node *Node) StartMining(ctx context.Context) error {
 		}
 	}
 
-	minerOwnerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
 	minerSigningAddress := node.MiningSignerAddress()
-	if err != nil {
-		return errors.Wrapf(err, "failed to get mining owner address for miner %s", minerAddr)
-	}
 
 	blockTime, mineDelay := node.MiningTimes()
 
@@ -805,11 +851,11 @@ func (node *Node) StartMining(ctx context.Context) error {
 			return node.Consensus.Weight(ctx, ts, pSt)
 		}
 		getAncestors := func(ctx context.Context, ts types.TipSet, newBlockHeight *types.BlockHeight) ([]types.TipSet, error) {
-			return chain.GetRecentAncestors(ctx, ts, node.ChainReader, newBlockHeight, consensus.AncestorRoundsNeeded, consensus.LookBackParameter)
+			return chain.GetRecentAncestors(ctx, ts, node.ChainReader, newBlockHeight, node.Upgrades.AncestorRoundsNeeded(newBlockHeight), consensus.LookBackParameter)
 		}
-		processor := consensus.NewDefaultProcessor()
+		processor := consensus.NewProcessorWithUpgrades(node.Upgrades)
 		worker := mining.NewDefaultWorker(node.MsgPool, getState, getWeight, getAncestors, processor, node.PowerTable,
-			node.Blockstore, node.CborStore(), minerAddr, minerOwnerAddr, minerSigningAddress, node.Wallet, blockTime)
+			node.Blockstore, node.CborStore(), minerAddr, consensus.MinerOwnerAddress, minerSigningAddress, node.Wallet, blockTime)
 		node.MiningScheduler = mining.NewScheduler(worker, mineDelay, node.ChainReader.Head)
 	}
 
@@ -843,14 +889,21 @@ func (node *Node) StartMining(ctx context.Context) error {
 
 					// TODO: determine these algorithmically by simulating call and querying historical prices
 					gasPrice := types.NewGasPrice(0)
-					gasUnits := types.NewGasUnits(300)
+					gasUnits := types.NewGasUnits(commitSectorGasLimit)
 
 					val := result.SealingResult
+					// the worker can change, so it is looked up for every commitment
+					minerWorkerAddr, err := node.miningWorkerAddress(node.miningCtx, minerAddr)
+					if err != nil {
+						log.Errorf("failed to get mining worker address for miner %s: %s", minerAddr, err)
+						continue
+					}
+
 					// This call can fail due to, e.g. nonce collisions. Our miners existence depends on this.
 					// We should deal with this, but MessageSendWithRetry is problematic.
-					_, err := node.PorcelainAPI.MessageSend(
+					_, err = node.PorcelainAPI.MessageSend(
 						node.miningCtx,
-						minerOwnerAddr,
+						minerWorkerAddr,
 						minerAddr,
 						nil,
 						gasPrice,
@@ -861,9 +914,10 @@ func (node *Node) StartMining(ctx context.Context) error {
 						val.CommR[:],
 						val.CommRStar[:],
 						val.Proof[:],
+						node.StorageMiner.SectorDeals(val),
 					)
 					if err != nil {
-						log.Errorf("failed to send commitSector message from %s to %s for sector with id %d: %s", minerOwnerAddr, minerAddr, val.SectorID, err)
+						log.Errorf("failed to send commitSector message from %s to %s for sector with id %d: %s", minerWorkerAddr, minerAddr, val.SectorID, err)
 						continue
 					}
 
@@ -961,12 +1015,7 @@ func initStorageMinerForNode(ctx context.Context, node *Node) (*storage.Miner, e
 		return nil, errors.Wrap(err, "failed to get node's mining address")
 	}
 
-	miningOwnerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
-	if err != nil {
-		return nil, errors.Wrap(err, "no mining owner available, skipping storage miner setup")
-	}
-
-	miner, err := storage.NewMiner(minerAddr, miningOwnerAddr, node, node.Repo.DealsDatastore(), node.PorcelainAPI)
+	miner, err := storage.NewMiner(minerAddr, node, node.Repo.DealsDatastore(), node.PorcelainAPI)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to instantiate storage miner")
 	}
@@ -1045,7 +1094,7 @@ func (node *Node) CreateMiner(ctx context.Context, accountAddr address.Address,
 	}
 
 	// TODO: https://github.com/filecoin-project/go-filecoin/issues/1843
-	blockSignerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
+	blockSignerAddr, err := node.miningWorkerAddress(ctx, minerAddr)
 	if err != nil {
 		return &minerAddr, err
 	}
@@ -1069,17 +1118,17 @@ func (node *Node) saveMinerConfig(minerAddr address.Address, signerAddr address.
 	return r.ReplaceConfig(newConfig)
 }
 
-// miningOwnerAddress returns the owner of miningAddr.
-// TODO: find a better home for this method
-func (node *Node) miningOwnerAddress(ctx context.Context, miningAddr address.Address) (address.Address, error) {
+// miningWorkerAddress returns the worker of miningAddr, the address that
+// signs the miner's sector commitments and PoSts.
+func (node *Node) miningWorkerAddress(ctx context.Context, miningAddr address.Address) (address.Address, error) {
 	res, _, err := node.PorcelainAPI.MessageQuery(
 		ctx,
 		address.Address{},
 		miningAddr,
-		"getOwner",
+		"getWorker",
 	)
 	if err != nil {
-		return address.Address{}, errors.Wrap(err, "failed to getOwner")
+		return address.Address{}, errors.Wrap(err, "failed to getWorker")
 	}
 
 	return address.NewFromBytes(res[0])
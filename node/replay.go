@@ -0,0 +1,45 @@
+package node
+
+import (
+	"context"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+)
+
+// NewReplayer loads the chain stored in the given repo and returns a
+// chain.Replayer wired up with the same consensus rules a node built from the
+// repo would use.  It does not start any networking, so the repo must not be
+// in use by a running daemon.
+func NewReplayer(ctx context.Context, r repo.Repo) (*chain.Replayer, error) {
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+
+	genCid, err := readGenesisCid(r.Datastore())
+	if err != nil {
+		return nil, err
+	}
+
+	chainStore := chain.NewDefaultStore(r.ChainDatastore(), &cst, genCid)
+	if err := chainStore.Load(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to load chain")
+	}
+
+	upgrades, err := consensus.UpgradesFromConfig(r.Config().Network.Upgrades)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid network upgrades in config")
+	}
+
+	processor := consensus.NewProcessorWithUpgrades(upgrades)
+	con := consensus.NewExpectedWithUpgrades(&cst, bs, processor, &consensus.MarketView{}, genCid, &proofs.RustVerifier{}, upgrades)
+
+	return chain.NewReplayer(chainStore, &cst, bs, con, processor, upgrades), nil
+}
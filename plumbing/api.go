@@ -3,6 +3,7 @@ package plumbing
 import (
 	"context"
 
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	pstore "gx/ipfs/QmRhFARzTHcFh8wUxwN5KvyTGq73FLC65EfFAhz8Ng7aGb/go-libp2p-peerstore"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
@@ -19,9 +20,12 @@ import (
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
 	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
+	"github.com/filecoin-project/go-filecoin/plumbing/paychs"
 	"github.com/filecoin-project/go-filecoin/plumbing/strgdls"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
 	"github.com/filecoin-project/go-filecoin/wallet"
 )
 
@@ -34,13 +38,16 @@ type API struct {
 	logger logging.EventLogger
 
 	chain        chain.ReadStore
+	cst          *hamt.CborIpldStore
 	config       *cfg.Config
 	msgPool      *core.MessagePool
 	msgPreviewer *msg.Previewer
 	msgQueryer   *msg.Queryer
 	msgSender    *msg.Sender
+	msgStore     *chain.MessageStore
 	msgWaiter    *msg.Waiter
 	network      *net.Network
+	paychs       *paychs.Store
 	sigGetter    *mthdsig.Getter
 	wallet       *wallet.Wallet
 	storagedeals *strgdls.Store
@@ -49,14 +56,17 @@ type API struct {
 // APIDeps contains all the API's dependencies
 type APIDeps struct {
 	Chain        chain.ReadStore
+	CborStore    *hamt.CborIpldStore
 	Config       *cfg.Config
 	Deals        *strgdls.Store
 	MsgPool      *core.MessagePool
 	MsgPreviewer *msg.Previewer
 	MsgQueryer   *msg.Queryer
 	MsgSender    *msg.Sender
+	MsgStore     *chain.MessageStore
 	MsgWaiter    *msg.Waiter
 	Network      *net.Network
+	Paychs       *paychs.Store
 	SigGetter    *mthdsig.Getter
 	Wallet       *wallet.Wallet
 }
@@ -67,13 +77,16 @@ func New(deps *APIDeps) *API {
 		logger: logging.Logger("porcelain"),
 
 		chain:        deps.Chain,
+		cst:          deps.CborStore,
 		config:       deps.Config,
 		msgPool:      deps.MsgPool,
 		msgPreviewer: deps.MsgPreviewer,
 		msgQueryer:   deps.MsgQueryer,
 		msgSender:    deps.MsgSender,
+		msgStore:     deps.MsgStore,
 		msgWaiter:    deps.MsgWaiter,
 		network:      deps.Network,
+		paychs:       deps.Paychs,
 		sigGetter:    deps.SigGetter,
 		wallet:       deps.Wallet,
 		storagedeals: deps.Deals,
@@ -113,6 +126,13 @@ func (api *API) ChainLs(ctx context.Context) <-chan interface{} {
 	return api.chain.BlockHistory(ctx, api.chain.Head())
 }
 
+// ChainProveMessage returns a proof that the message with cid msgCid and its
+// receipt are included in the block with cid blkCid. The proof can be checked
+// with chain.VerifyMessageProof.
+func (api *API) ChainProveMessage(ctx context.Context, blkCid cid.Cid, msgCid cid.Cid) (*chain.MessageProof, error) {
+	return api.msgStore.ProveMessage(ctx, blkCid, msgCid)
+}
+
 // ActorGet returns an actor from the latest state on the chain
 func (api *API) ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error) {
 	state, err := api.chain.LatestState(ctx)
@@ -122,6 +142,25 @@ func (api *API) ActorGet(ctx context.Context, addr address.Address) (*actor.Acto
 	return state.GetActor(ctx, addr)
 }
 
+// ActorProve returns a proof that the actor at addr is in the state of the
+// tipset with the given key, along with the root of that state. An empty key
+// stands for the head. If field is not empty the proof also covers that field
+// of the actor's storage. The proof can be checked with state.VerifyActorProof.
+func (api *API) ActorProve(ctx context.Context, addr address.Address, tsKey types.SortedCidSet, field string) (cid.Cid, *state.ActorProof, error) {
+	if tsKey.Len() == 0 {
+		tsKey = api.chain.Head().ToSortedCidSet()
+	}
+	tsas, err := api.chain.GetTipSetAndState(ctx, tsKey.String())
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	proof, err := state.ProveActor(ctx, api.cst, tsas.TipSetStateRoot, addr, field)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	return tsas.TipSetStateRoot, proof, nil
+}
+
 // BlockGet gets a block by CID
 func (api *API) BlockGet(ctx context.Context, id cid.Cid) (*types.Block, error) {
 	return api.chain.GetBlock(ctx, id)
@@ -137,6 +176,35 @@ func (api *API) DealPut(storageDeal *storagedeal.Deal) error {
 	return api.storagedeals.Put(storageDeal)
 }
 
+// ReplicationsLs returns the replication records of the pieces stored with
+// several miners, as recorded in the local datastore
+func (api *API) ReplicationsLs() ([]*storagedeal.Replication, error) {
+	return api.storagedeals.ReplicationsLs()
+}
+
+// ReplicationGet returns the replication record of the piece, or nil if there
+// is none
+func (api *API) ReplicationGet(pieceRef cid.Cid) (*storagedeal.Replication, error) {
+	return api.storagedeals.ReplicationGet(pieceRef)
+}
+
+// ReplicationPut puts the replication record of a piece in the local datastore
+func (api *API) ReplicationPut(replication *storagedeal.Replication) error {
+	return api.storagedeals.ReplicationPut(replication)
+}
+
+// PieceGet returns the record of a piece imported for storage, or nil if
+// there is none
+func (api *API) PieceGet(ref cid.Cid) (*storagedeal.Piece, error) {
+	return api.storagedeals.PieceGet(ref)
+}
+
+// PiecePut puts the record of a piece imported for storage in the local
+// datastore
+func (api *API) PiecePut(piece *storagedeal.Piece) error {
+	return api.storagedeals.PiecePut(piece)
+}
+
 // MessagePoolPending lists messages un-mined in the pool
 func (api *API) MessagePoolPending() []*types.SignedMessage {
 	return api.msgPool.Pending()
@@ -158,6 +226,12 @@ func (api *API) MessagePreview(ctx context.Context, from, to address.Address, me
 	return api.msgPreviewer.Preview(ctx, from, to, method, params...)
 }
 
+// MessagePreviewBreakdown previews the Gas cost of a message like MessagePreview and
+// additionally reports how the Gas breaks down by operation.
+func (api *API) MessagePreviewBreakdown(ctx context.Context, from, to address.Address, method string, params ...interface{}) (types.GasUnits, vm.GasBreakdown, error) {
+	return api.msgPreviewer.PreviewBreakdown(ctx, from, to, method, params...)
+}
+
 // MessageQuery calls an actor's method using the most recent chain state. It is read-only,
 // it does not change any state. It is use to interrogate actor state. The from address
 // is optional; if not provided, an address will be chosen from the node's wallet.
@@ -183,6 +257,30 @@ func (api *API) MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.
 	return api.msgWaiter.Wait(ctx, msgCid, cb)
 }
 
+// PaychsLs returns the payment channels opened by the wallet, as recorded in
+// the local datastore
+func (api *API) PaychsLs() ([]*paychs.ChannelInfo, error) {
+	return api.paychs.Ls()
+}
+
+// PaychGet returns the local record of the payment channel of the payer with
+// the given id, or nil if there is none
+func (api *API) PaychGet(payer address.Address, chid *types.ChannelID) (*paychs.ChannelInfo, error) {
+	return api.paychs.Get(payer, chid)
+}
+
+// PaychPut puts the record of a payment channel in the local datastore
+func (api *API) PaychPut(channel *paychs.ChannelInfo) error {
+	return api.paychs.Put(channel)
+}
+
+// PaychUpdate applies update to the local record of the payment channel of
+// the payer with the given id and stores the result, with no other write to
+// the records in between
+func (api *API) PaychUpdate(payer address.Address, chid *types.ChannelID, update func(channel *paychs.ChannelInfo) error) error {
+	return api.paychs.Update(payer, chid, update)
+}
+
 // PubSubSubscribe subscribes to a topic for notifications from the filecoin network
 func (api *API) PubSubSubscribe(topic string) (pubsub.Subscription, error) {
 	return api.network.Subscribe(topic)
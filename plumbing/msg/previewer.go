@@ -8,7 +8,6 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
 	"github.com/filecoin-project/go-filecoin/abi"
-	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
@@ -27,38 +26,48 @@ type Previewer struct {
 	cst *hamt.CborIpldStore
 	// For vm storage.
 	bs bstore.Blockstore
+	// To run the actors of the protocol rules in effect.
+	upgrades consensus.Upgrades
 }
 
 // NewPreviewer constructs a Previewer.
-func NewPreviewer(wallet *wallet.Wallet, chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore) *Previewer {
-	return &Previewer{wallet, chainReader, cst, bs}
+func NewPreviewer(wallet *wallet.Wallet, chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore, upgrades consensus.Upgrades) *Previewer {
+	return &Previewer{wallet, chainReader, cst, bs, upgrades}
 }
 
-// Preview sends a read-only message to an actor.
+// Preview sends a read-only message to an actor and returns the gas it used.
 func (p *Previewer) Preview(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) (types.GasUnits, error) {
+	usedGas, _, err := p.PreviewBreakdown(ctx, optFrom, to, method, params...)
+	return usedGas, err
+}
+
+// PreviewBreakdown sends a read-only message to an actor and returns the gas
+// it used along with how that gas breaks down by operation.
+func (p *Previewer) PreviewBreakdown(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) (types.GasUnits, vm.GasBreakdown, error) {
 	encodedParams, err := abi.ToEncodedValues(params...)
 	if err != nil {
-		return types.NewGasUnits(0), errors.Wrap(err, "couldnt encode message params")
+		return types.NewGasUnits(0), nil, errors.Wrap(err, "couldnt encode message params")
 	}
 
 	headTs := p.chainReader.Head()
 	tsas, err := p.chainReader.GetTipSetAndState(ctx, headTs.String())
 	if err != nil {
-		return types.NewGasUnits(0), errors.Wrap(err, "couldnt get latest state root")
+		return types.NewGasUnits(0), nil, errors.Wrap(err, "couldnt get latest state root")
 	}
-	st, err := state.LoadStateTree(ctx, p.cst, tsas.TipSetStateRoot, builtin.Actors)
+	h, err := headTs.Height()
 	if err != nil {
-		return types.NewGasUnits(0), errors.Wrap(err, "could load tree for latest state root")
+		return types.NewGasUnits(0), nil, errors.Wrap(err, "couldnt get base tipset height")
 	}
-	h, err := headTs.Height()
+	rules := p.upgrades.RulesAt(types.NewBlockHeight(h))
+	st, err := state.LoadStateTree(ctx, p.cst, tsas.TipSetStateRoot, rules.Actors)
 	if err != nil {
-		return types.NewGasUnits(0), errors.Wrap(err, "couldnt get base tipset height")
+		return types.NewGasUnits(0), nil, errors.Wrap(err, "could load tree for latest state root")
 	}
 
 	vms := vm.NewStorageMap(p.bs)
-	usedGas, err := consensus.PreviewQueryMethod(ctx, st, vms, to, method, encodedParams, optFrom, types.NewBlockHeight(h))
+	usedGas, breakdown, err := consensus.PreviewQueryMethod(ctx, st, vms, rules, to, method, encodedParams, optFrom, types.NewBlockHeight(h))
 	if err != nil {
-		return types.NewGasUnits(0), errors.Wrap(err, "query method returned an error")
+		return types.NewGasUnits(0), nil, errors.Wrap(err, "query method returned an error")
 	}
-	return usedGas, nil
+	return usedGas, breakdown, nil
 }
@@ -8,7 +8,6 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
 	"github.com/filecoin-project/go-filecoin/abi"
-	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
@@ -32,11 +31,13 @@ type Queryer struct {
 	cst *hamt.CborIpldStore
 	// For vm storage.
 	bs bstore.Blockstore
+	// To run the actors of the protocol rules in effect.
+	upgrades consensus.Upgrades
 }
 
 // NewQueryer constructs a Queryer.
-func NewQueryer(repo repo.Repo, wallet *wallet.Wallet, chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore) *Queryer {
-	return &Queryer{repo, wallet, chainReader, cst, bs}
+func NewQueryer(repo repo.Repo, wallet *wallet.Wallet, chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore, upgrades consensus.Upgrades) *Queryer {
+	return &Queryer{repo, wallet, chainReader, cst, bs, upgrades}
 }
 
 // Query sends a read-only message to an actor.
@@ -60,17 +61,18 @@ func (q *Queryer) Query(ctx context.Context, optFrom, to address.Address, method
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "couldnt get latest state root")
 	}
-	st, err := state.LoadStateTree(ctx, q.cst, tsas.TipSetStateRoot, builtin.Actors)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "could load tree for latest state root")
-	}
 	h, err := headTs.Height()
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "couldnt get base tipset height")
 	}
+	rules := q.upgrades.RulesAt(types.NewBlockHeight(h))
+	st, err := state.LoadStateTree(ctx, q.cst, tsas.TipSetStateRoot, rules.Actors)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could load tree for latest state root")
+	}
 
 	vms := vm.NewStorageMap(q.bs)
-	r, ec, err := consensus.CallQueryMethod(ctx, st, vms, to, method, encodedParams, optFrom, types.NewBlockHeight(h))
+	r, ec, err := consensus.CallQueryMethodWithRules(ctx, st, vms, rules, to, method, encodedParams, optFrom, types.NewBlockHeight(h))
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "querymethod returned an error")
 	} else if ec != 0 {
@@ -50,7 +50,7 @@ func TestQuery(t *testing.T) {
 		)
 		deps := requireCommonDepsWithGifAndBlockstore(require, testGen, r, bs)
 
-		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore)
+		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore, consensus.DefaultUpgrades())
 		returnValue, funcSig, err := queryer.Query(ctx, fromAddr, fakeActorAddr, "hasReturnValue")
 		require.NoError(err)
 		require.NotNil(returnValue)
@@ -89,7 +89,7 @@ func TestQuery(t *testing.T) {
 		)
 		deps := requireCommonDepsWithGifAndBlockstore(require, testGen, r, bs)
 
-		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore)
+		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore, consensus.DefaultUpgrades())
 		_, _, err := queryer.Query(ctx, fromAddr, fakeActorAddr, "nonZeroExitCode")
 		require.Error(err)
 		assert.Contains(err.Error(), "42")
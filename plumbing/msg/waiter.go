@@ -10,7 +10,6 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 
-	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/state"
@@ -25,14 +24,19 @@ type Waiter struct {
 	chainReader chain.ReadStore
 	cst         *hamt.CborIpldStore
 	bs          bstore.Blockstore
+	messages    *chain.MessageStore
+	upgrades    consensus.Upgrades
 }
 
-// NewWaiter returns a new Waiter.
-func NewWaiter(chainStore chain.ReadStore, bs bstore.Blockstore, cst *hamt.CborIpldStore) *Waiter {
+// NewWaiter returns a new Waiter. It recomputes receipts under the protocol
+// rules of the given upgrade schedule.
+func NewWaiter(chainStore chain.ReadStore, bs bstore.Blockstore, cst *hamt.CborIpldStore, upgrades consensus.Upgrades) *Waiter {
 	return &Waiter{
 		chainReader: chainStore,
 		cst:         cst,
 		bs:          bs,
+		messages:    chain.NewMessageStore(cst),
+		upgrades:    upgrades,
 	}
 }
 
@@ -93,15 +97,20 @@ func (w *Waiter) Wait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block,
 				return e
 			case types.TipSet:
 				ts := raw.(types.TipSet)
-				for _, blk := range ts {
-					for _, msg := range blk.Messages {
+				tsMessages, tsReceipts, err := w.messages.LoadTipSetMessages(ctx, ts)
+				if err != nil {
+					log.Errorf("Waiter.Wait: %s", err)
+					return err
+				}
+				for i, blk := range ts.ToSlice() {
+					for _, msg := range tsMessages[i] {
 						c, err := msg.Cid()
 						if err != nil {
 							log.Errorf("Waiter.Wait: %s", err)
 							return err
 						}
 						if c.Equals(msgCid) {
-							recpt, err := w.receiptFromTipSet(ctx, msgCid, ts)
+							recpt, err := w.receiptFromTipSet(ctx, msgCid, ts, tsMessages, tsReceipts)
 							if err != nil {
 								return errors.Wrap(err, "error retrieving receipt from tipset")
 							}
@@ -119,22 +128,21 @@ func (w *Waiter) Wait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block,
 // receiptFromTipSet finds the receipt for the message with msgCid in the
 // input tipset.  This can differ from the message's receipt as stored in its
 // parent block in the case that the message is in conflict with another
-// message of the tipset.
-func (w *Waiter) receiptFromTipSet(ctx context.Context, msgCid cid.Cid, ts types.TipSet) (*types.MessageReceipt, error) {
+// message of the tipset.  The messages and receipts of the tipset are given
+// block by block in the order of ts.ToSlice().
+func (w *Waiter) receiptFromTipSet(ctx context.Context, msgCid cid.Cid, ts types.TipSet, tsMessages [][]*types.SignedMessage, tsReceipts [][]*types.MessageReceipt) (*types.MessageReceipt, error) {
 	// Receipts always match block if tipset has only 1 member.
 	var rcpt *types.MessageReceipt
-	blks := ts.ToSlice()
 	if len(ts) == 1 {
-		b := blks[0]
 		// TODO: this should return an error if a receipt doesn't exist.
 		// Right now doing so breaks tests because our test helpers
 		// don't correctly apply messages when making test chains.
-		j, err := msgIndexOfTipSet(msgCid, ts, types.SortedCidSet{})
+		j, err := msgIndexOfTipSet(msgCid, ts, tsMessages, types.SortedCidSet{})
 		if err != nil {
 			return nil, err
 		}
-		if j < len(b.MessageReceipts) {
-			rcpt = b.MessageReceipts[j]
+		if j < len(tsReceipts[0]) {
+			rcpt = tsReceipts[0][j]
 		}
 		return rcpt, nil
 	}
@@ -148,22 +156,22 @@ func (w *Waiter) receiptFromTipSet(ctx context.Context, msgCid cid.Cid, ts types
 	if err != nil {
 		return nil, err
 	}
-	st, err := state.LoadStateTree(ctx, w.cst, tsas.TipSetStateRoot, builtin.Actors)
+	tsHeight, err := ts.Height()
 	if err != nil {
 		return nil, err
 	}
-
-	tsHeight, err := ts.Height()
+	tsBlockHeight := types.NewBlockHeight(tsHeight)
+	st, err := state.LoadStateTree(ctx, w.cst, tsas.TipSetStateRoot, w.upgrades.RulesAt(tsBlockHeight).Actors)
 	if err != nil {
 		return nil, err
 	}
-	tsBlockHeight := types.NewBlockHeight(tsHeight)
-	ancestors, err := chain.GetRecentAncestors(ctx, tsas.TipSet, w.chainReader, tsBlockHeight, consensus.AncestorRoundsNeeded, consensus.LookBackParameter)
+
+	ancestors, err := chain.GetRecentAncestors(ctx, tsas.TipSet, w.chainReader, tsBlockHeight, w.upgrades.AncestorRoundsNeeded(tsBlockHeight), consensus.LookBackParameter)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := consensus.NewDefaultProcessor().ProcessTipSet(ctx, st, vm.NewStorageMap(w.bs), ts, ancestors)
+	res, err := consensus.NewProcessorWithUpgrades(w.upgrades).ProcessTipSet(ctx, st, vm.NewStorageMap(w.bs), ts, tsMessages, ancestors)
 	if err != nil {
 		return nil, err
 	}
@@ -173,7 +181,7 @@ func (w *Waiter) receiptFromTipSet(ctx context.Context, msgCid cid.Cid, ts types
 		return nil, nil
 	}
 
-	j, err := msgIndexOfTipSet(msgCid, ts, res.Failures)
+	j, err := msgIndexOfTipSet(msgCid, ts, tsMessages, res.Failures)
 	if err != nil {
 		return nil, err
 	}
@@ -186,15 +194,14 @@ func (w *Waiter) receiptFromTipSet(ctx context.Context, msgCid cid.Cid, ts types
 
 // msgIndexOfTipSet returns the order in which msgCid appears in the canonical
 // message ordering of the given tipset, or an error if it is not in the
-// tipset.
+// tipset.  The messages of the tipset are given block by block in the order
+// of ts.ToSlice().
 // TODO: find a better home for this method
-func msgIndexOfTipSet(msgCid cid.Cid, ts types.TipSet, fails types.SortedCidSet) (int, error) {
-	blks := ts.ToSlice()
-	types.SortBlocks(blks)
+func msgIndexOfTipSet(msgCid cid.Cid, ts types.TipSet, tsMessages [][]*types.SignedMessage, fails types.SortedCidSet) (int, error) {
 	var duplicates types.SortedCidSet
 	var msgCnt int
-	for _, b := range blks {
-		for _, msg := range b.Messages {
+	for _, i := range types.CanonicalOrder(ts.ToSlice()) {
+		for _, msg := range tsMessages[i] {
 			c, err := msg.Cid()
 			if err != nil {
 				return -1, err
@@ -46,12 +46,12 @@ type smsgsSet [][]*types.SignedMessage
 
 func setupTest(require *require.Assertions) (*hamt.CborIpldStore, *chain.DefaultStore, *Waiter) {
 	d := requiredCommonDeps(require, consensus.DefaultGenesis)
-	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst)
+	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst, consensus.DefaultUpgrades())
 }
 
 func setupTestWithGif(require *require.Assertions, gif consensus.GenesisInitFunc) (*hamt.CborIpldStore, *chain.DefaultStore, *Waiter) {
 	d := requiredCommonDeps(require, gif)
-	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst)
+	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst, consensus.DefaultUpgrades())
 }
 
 func TestWait(t *testing.T) {
@@ -160,7 +160,7 @@ func TestWaitConflicting(t *testing.T) {
 	b1 := chain.RequireMkFakeChild(require,
 		chain.FakeChildParams{
 			Parent: baseTS, GenesisCid: chainStore.GenesisCid(), StateRoot: baseBlock.StateRoot, MinerAddr: minerAddr})
-	b1.Messages = []*types.SignedMessage{sm1}
+	b1.Messages = chain.RequirePutMessages(require, cst, sm1)
 	b1.Ticket = []byte{0} // block 1 comes first in message application
 	core.MustPut(cst, b1)
 
@@ -168,7 +168,7 @@ func TestWaitConflicting(t *testing.T) {
 		chain.FakeChildParams{
 			Parent: baseTS, GenesisCid: chainStore.GenesisCid(),
 			StateRoot: baseBlock.StateRoot, Nonce: uint64(1), MinerAddr: minerAddr})
-	b2.Messages = []*types.SignedMessage{sm2}
+	b2.Messages = chain.RequirePutMessages(require, cst, sm2)
 	b2.Ticket = []byte{1}
 	core.MustPut(cst, b2)
 
@@ -0,0 +1,192 @@
+package paychs
+
+import (
+	"sync"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(ChannelInfo{})
+}
+
+// ChannelInfo is the client's record of a payment channel opened by one of
+// its wallet addresses.
+type ChannelInfo struct {
+	Payer   address.Address
+	Target  address.Address
+	Channel *types.ChannelID
+
+	// Amount is the amount the payer put in the channel.
+	Amount *types.AttoFIL
+	// AmountRedeemed is the amount the target redeemed, as last read from chain.
+	AmountRedeemed *types.AttoFIL
+	// Eol is the block height from which the payer can reclaim the funds
+	// the target has not redeemed.
+	Eol *types.BlockHeight
+
+	// Vouchers are the vouchers issued on the channel, in the order they
+	// were issued.
+	Vouchers []*paymentbroker.PaymentVoucher
+	// LastNonce is the nonce of the last voucher issued on the channel.
+	// Nonces increase over all the lanes of the channel, so the next voucher
+	// on any lane is redeemable after the ones issued before it.
+	LastNonce uint64
+	// AmountCommitted is the amount the vouchers issued on the channel pay
+	// out once all redeemed, see CommittedAmount.
+	AmountCommitted *types.AttoFIL
+
+	// ReclaimedAt is the block height at which the payer last asked for the
+	// funds of the expired channel back, nil if it never did.
+	ReclaimedAt *types.BlockHeight
+	// Closed is set once the channel is gone from chain.
+	Closed bool
+}
+
+// AddVoucher records a voucher issued on the channel.
+func (c *ChannelInfo) AddVoucher(voucher *paymentbroker.PaymentVoucher) {
+	c.Vouchers = append(c.Vouchers, voucher)
+	if voucher.Nonce > c.LastNonce {
+		c.LastNonce = voucher.Nonce
+	}
+	c.AmountCommitted = CommittedAmount(c.Vouchers)
+}
+
+// CommittedAmount returns the amount the vouchers, in the order they were
+// issued, pay out once all redeemed: the sum over lanes of the largest
+// voucher on each, with a merging voucher standing in for the lanes it
+// merges.
+func CommittedAmount(vouchers []*paymentbroker.PaymentVoucher) *types.AttoFIL {
+	lanes := make(map[uint64]*types.AttoFIL)
+	for _, v := range vouchers {
+		for _, m := range v.Merges {
+			delete(lanes, m.Lane)
+		}
+		amount := v.Amount
+		if cur, ok := lanes[v.Lane]; !ok || amount.GreaterThan(cur) {
+			lanes[v.Lane] = &amount
+		}
+	}
+
+	committed := types.ZeroAttoFIL
+	for _, amount := range lanes {
+		committed = committed.Add(amount)
+	}
+	return committed
+}
+
+// Store is plumbing implementation storing the payment channels of the client
+type Store struct {
+	// lk serializes the writes of records, so an update is not lost to a
+	// concurrent one
+	lk       sync.Mutex
+	paychsDs repo.Datastore
+}
+
+// PaymentChannelPrefix is the datastore prefix for payment channels
+const PaymentChannelPrefix = "paymentchannels"
+
+// New returns a new Store.
+func New(paychsDatastore repo.Datastore) *Store {
+	return &Store{paychsDs: paychsDatastore}
+}
+
+// Ls returns all payment channels in the store, with a possible error
+func (store *Store) Ls() ([]*ChannelInfo, error) {
+	var channels []*ChannelInfo
+
+	results, err := store.paychsDs.Query(query.Query{Prefix: "/" + PaymentChannelPrefix})
+	if err != nil {
+		return channels, errors.Wrap(err, "failed to query payment channels from datastore")
+	}
+	for entry := range results.Next() {
+		var channel ChannelInfo
+		if err := cbor.DecodeInto(entry.Value, &channel); err != nil {
+			return channels, errors.Wrap(err, "failed to unmarshal payment channel from datastore")
+		}
+		channels = append(channels, &channel)
+	}
+
+	return channels, nil
+}
+
+// Get returns the payment channel of the payer with the given id, or nil if
+// the store does not hold it.
+func (store *Store) Get(payer address.Address, chid *types.ChannelID) (*ChannelInfo, error) {
+	store.lk.Lock()
+	defer store.lk.Unlock()
+
+	return store.get(payer, chid)
+}
+
+func (store *Store) get(payer address.Address, chid *types.ChannelID) (*ChannelInfo, error) {
+	datum, err := store.paychsDs.Get(key(payer, chid))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get payment channel from datastore")
+	}
+
+	var channel ChannelInfo
+	if err := cbor.DecodeInto(datum, &channel); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal payment channel from datastore")
+	}
+	return &channel, nil
+}
+
+// Put puts the payment channel into the datastore
+func (store *Store) Put(channel *ChannelInfo) error {
+	store.lk.Lock()
+	defer store.lk.Unlock()
+
+	return store.put(channel)
+}
+
+// Update applies update to the payment channel of the payer with the given
+// id, a new record if the store does not hold it, and puts the result into
+// the datastore unless update fails. No other write of the store happens in
+// between, so the update sees the vouchers issued before it.
+func (store *Store) Update(payer address.Address, chid *types.ChannelID, update func(channel *ChannelInfo) error) error {
+	store.lk.Lock()
+	defer store.lk.Unlock()
+
+	channel, err := store.get(payer, chid)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		channel = &ChannelInfo{Payer: payer, Channel: chid, AmountCommitted: types.ZeroAttoFIL}
+	}
+
+	if err := update(channel); err != nil {
+		return err
+	}
+	return store.put(channel)
+}
+
+func (store *Store) put(channel *ChannelInfo) error {
+	datum, err := cbor.DumpObject(channel)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal payment channel")
+	}
+
+	err = store.paychsDs.Put(key(channel.Payer, channel.Channel), datum)
+	if err != nil {
+		return errors.Wrap(err, "could not save payment channel to disk")
+	}
+
+	return nil
+}
+
+func key(payer address.Address, chid *types.ChannelID) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{PaymentChannelPrefix, payer.String(), chid.KeyString()})
+}
@@ -0,0 +1,105 @@
+package paychs_test
+
+import (
+	"errors"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/plumbing/paychs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestPaymentChannelStoreRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addressMaker := address.NewForTestGetter()
+	store := paychs.New(repo.NewInMemoryRepo().DealsDs)
+
+	payer, target := addressMaker(), addressMaker()
+	channelID := types.NewChannelID(19)
+
+	missing, err := store.Get(payer, channelID)
+	require.NoError(err)
+	assert.Nil(missing)
+
+	channel := &paychs.ChannelInfo{
+		Payer:          payer,
+		Target:         target,
+		Channel:        channelID,
+		Amount:         types.NewAttoFILFromFIL(100),
+		AmountRedeemed: types.NewAttoFILFromFIL(20),
+		Eol:            types.NewBlockHeight(300),
+		Vouchers: []*paymentbroker.PaymentVoucher{{
+			Channel: *channelID,
+			Payer:   payer,
+			Target:  target,
+			Amount:  *types.NewAttoFILFromFIL(20),
+			ValidAt: *types.NewBlockHeight(10),
+			Nonce:   1,
+		}},
+	}
+	require.NoError(store.Put(channel))
+
+	retrieved, err := store.Get(payer, channelID)
+	require.NoError(err)
+	require.NotNil(retrieved)
+	assert.Equal(target, retrieved.Target)
+	assert.Equal(types.NewAttoFILFromFIL(100), retrieved.Amount)
+	assert.Equal(types.NewAttoFILFromFIL(20), retrieved.AmountRedeemed)
+	assert.Equal(types.NewBlockHeight(300), retrieved.Eol)
+	require.Len(retrieved.Vouchers, 1)
+	assert.Equal(uint64(1), retrieved.Vouchers[0].Nonce)
+	assert.Nil(retrieved.ReclaimedAt)
+	assert.False(retrieved.Closed)
+
+	// putting the channel again replaces it
+	channel.Closed = true
+	require.NoError(store.Put(channel))
+
+	channels, err := store.Ls()
+	require.NoError(err)
+	require.Len(channels, 1)
+	assert.True(channels[0].Closed)
+}
+
+func TestPaymentChannelStoreUpdate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store := paychs.New(repo.NewInMemoryRepo().DealsDs)
+	payer := address.NewForTestGetter()()
+	channelID := types.NewChannelID(3)
+
+	// a channel not in the store starts out empty
+	err := store.Update(payer, channelID, func(channel *paychs.ChannelInfo) error {
+		assert.Equal(payer, channel.Payer)
+		assert.Empty(channel.Vouchers)
+		assert.Equal(types.ZeroAttoFIL, channel.AmountCommitted)
+
+		channel.AddVoucher(&paymentbroker.PaymentVoucher{Amount: *types.NewAttoFILFromFIL(5), Lane: 0, Nonce: 2})
+		channel.AddVoucher(&paymentbroker.PaymentVoucher{Amount: *types.NewAttoFILFromFIL(7), Lane: 1, Nonce: 3})
+		return nil
+	})
+	require.NoError(err)
+
+	// a failed update is not stored
+	err = store.Update(payer, channelID, func(channel *paychs.ChannelInfo) error {
+		channel.Closed = true
+		return errors.New("failed")
+	})
+	require.Error(err)
+
+	retrieved, err := store.Get(payer, channelID)
+	require.NoError(err)
+	require.NotNil(retrieved)
+	assert.Len(retrieved.Vouchers, 2)
+	assert.Equal(uint64(3), retrieved.LastNonce)
+	assert.Equal(types.NewAttoFILFromFIL(12), retrieved.AmountCommitted)
+	assert.False(retrieved.Closed)
+}
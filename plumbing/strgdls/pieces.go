@@ -0,0 +1,49 @@
+package strgdls
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+)
+
+// StoragePiecePrefix is the datastore prefix for imported pieces
+const StoragePiecePrefix = "storagepieces"
+
+// PieceGet returns the record of the imported piece, or nil if the store does
+// not hold one
+func (store *Store) PieceGet(ref cid.Cid) (*storagedeal.Piece, error) {
+	datum, err := store.dealsDs.Get(pieceKey(ref))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get piece from datastore")
+	}
+
+	var piece storagedeal.Piece
+	if err := cbor.DecodeInto(datum, &piece); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal piece from datastore")
+	}
+	return &piece, nil
+}
+
+// PiecePut puts the record of the imported piece into the datastore
+func (store *Store) PiecePut(piece *storagedeal.Piece) error {
+	datum, err := cbor.DumpObject(piece)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal piece")
+	}
+
+	if err := store.dealsDs.Put(pieceKey(piece.Ref), datum); err != nil {
+		return errors.Wrap(err, "could not save piece to disk")
+	}
+
+	return nil
+}
+
+func pieceKey(ref cid.Cid) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{StoragePiecePrefix, ref.String()})
+}
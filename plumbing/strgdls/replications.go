@@ -0,0 +1,70 @@
+package strgdls
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+)
+
+// StorageReplicationPrefix is the datastore prefix for replication records
+const StorageReplicationPrefix = "storagereplications"
+
+// ReplicationsLs returns all replication records in the store, with a
+// possible error
+func (store *Store) ReplicationsLs() ([]*storagedeal.Replication, error) {
+	var replications []*storagedeal.Replication
+
+	results, err := store.dealsDs.Query(query.Query{Prefix: "/" + StorageReplicationPrefix})
+	if err != nil {
+		return replications, errors.Wrap(err, "failed to query replications from datastore")
+	}
+	for entry := range results.Next() {
+		var replication storagedeal.Replication
+		if err := cbor.DecodeInto(entry.Value, &replication); err != nil {
+			return replications, errors.Wrap(err, "failed to unmarshal replication from datastore")
+		}
+		replications = append(replications, &replication)
+	}
+
+	return replications, nil
+}
+
+// ReplicationGet returns the replication record of the piece, or nil if the
+// store does not hold one
+func (store *Store) ReplicationGet(pieceRef cid.Cid) (*storagedeal.Replication, error) {
+	datum, err := store.dealsDs.Get(replicationKey(pieceRef))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get replication from datastore")
+	}
+
+	var replication storagedeal.Replication
+	if err := cbor.DecodeInto(datum, &replication); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal replication from datastore")
+	}
+	return &replication, nil
+}
+
+// ReplicationPut puts the replication record into the datastore
+func (store *Store) ReplicationPut(replication *storagedeal.Replication) error {
+	datum, err := cbor.DumpObject(replication)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal replication")
+	}
+
+	if err := store.dealsDs.Put(replicationKey(replication.PieceRef), datum); err != nil {
+		return errors.Wrap(err, "could not save replication to disk")
+	}
+
+	return nil
+}
+
+func replicationKey(pieceRef cid.Cid) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{StorageReplicationPrefix, pieceRef.String()})
+}
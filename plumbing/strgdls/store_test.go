@@ -87,3 +87,69 @@ func TestDealStoreRoundTrip(t *testing.T) {
 	assert.Equal(t, *totalPrice, retrievedDeal.Proposal.Payment.Vouchers[0].Amount)
 	assert.Equal(t, *validAt, retrievedDeal.Proposal.Payment.Vouchers[0].ValidAt)
 }
+
+func TestReplicationStoreRoundTrip(t *testing.T) {
+	addressMaker := address.NewForTestGetter()
+
+	store := strgdls.New(repo.NewInMemoryRepo().DealsDs)
+	pieceRefCid, err := convert.ToCid("pieceRef")
+	require.NoError(t, err)
+	proposalCid, err := convert.ToCid("proposal")
+	require.NoError(t, err)
+
+	retrieved, err := store.ReplicationGet(pieceRefCid)
+	require.NoError(t, err)
+	assert.Nil(t, retrieved)
+
+	replication := &storagedeal.Replication{
+		PieceRef: pieceRefCid,
+		Replicas: 2,
+		MaxPrice: types.NewAttoFILFromFIL(3),
+		Duration: 23,
+		Deals:    []storagedeal.Replica{{Miner: addressMaker(), ProposalCid: proposalCid, State: storagedeal.Accepted}},
+		Failures: []storagedeal.ReplicaFailure{{Miner: addressMaker(), Error: "deal rejected"}},
+	}
+	require.NoError(t, store.ReplicationPut(replication))
+
+	retrieved, err = store.ReplicationGet(pieceRefCid)
+	require.NoError(t, err)
+	assert.Equal(t, replication, retrieved)
+
+	replications, err := store.ReplicationsLs()
+	require.NoError(t, err)
+	assert.Equal(t, []*storagedeal.Replication{replication}, replications)
+
+	// replications are not deals
+	deals, err := store.Ls()
+	require.NoError(t, err)
+	assert.Empty(t, deals)
+}
+
+func TestPieceStoreRoundTrip(t *testing.T) {
+	store := strgdls.New(repo.NewInMemoryRepo().DealsDs)
+	pieceRefCid, err := convert.ToCid("pieceRef")
+	require.NoError(t, err)
+
+	retrieved, err := store.PieceGet(pieceRefCid)
+	require.NoError(t, err)
+	assert.Nil(t, retrieved)
+
+	piece := &storagedeal.Piece{
+		Ref:        pieceRefCid,
+		Size:       types.NewBytesAmount(12),
+		Commitment: []byte{1, 2, 3},
+	}
+	require.NoError(t, store.PiecePut(piece))
+
+	retrieved, err = store.PieceGet(pieceRefCid)
+	require.NoError(t, err)
+	assert.Equal(t, piece, retrieved)
+
+	// pieces are neither deals nor replications
+	deals, err := store.Ls()
+	require.NoError(t, err)
+	assert.Empty(t, deals)
+	replications, err := store.ReplicationsLs()
+	require.NoError(t, err)
+	assert.Empty(t, replications)
+}
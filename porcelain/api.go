@@ -8,9 +8,12 @@ import (
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 
 	minerActor "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/multisig"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/plumbing"
+	"github.com/filecoin-project/go-filecoin/plumbing/paychs"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -58,6 +61,12 @@ func (a *API) DealGet(proposalCid cid.Cid) *storagedeal.Deal {
 	return DealGet(a, proposalCid)
 }
 
+// StorageMarketGetDeal queries the storage market for the deal published
+// under the given id
+func (a *API) StorageMarketGetDeal(ctx context.Context, dealID uint64) (*storagemarket.Deal, error) {
+	return StorageMarketGetDeal(ctx, a, dealID)
+}
+
 // MessagePoolWait waits for the message pool to have at least messageCount unmined messages.
 // It's useful for integration testing.
 func (a *API) MessagePoolWait(ctx context.Context, messageCount uint) ([]*types.SignedMessage, error) {
@@ -105,11 +114,22 @@ func (a *API) MinerGetAsk(ctx context.Context, minerAddr address.Address, askID
 	return MinerGetAsk(ctx, a, minerAddr, askID)
 }
 
+// StorageMarketAsks returns the live asks in the storage market that pass
+// the filter, cheapest first
+func (a *API) StorageMarketAsks(ctx context.Context, filter AskFilter) ([]StorageAsk, error) {
+	return StorageMarketAsks(ctx, a, filter)
+}
+
 // MinerGetOwnerAddress queries for the owner address of the given miner
 func (a *API) MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
 	return MinerGetOwnerAddress(ctx, a, minerAddr)
 }
 
+// MinerGetWorkerAddress queries for the worker address of the given miner
+func (a *API) MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return MinerGetWorkerAddress(ctx, a, minerAddr)
+}
+
 // MinerGetPeerID queries for the peer id of the given miner
 func (a *API) MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error) {
 	return MinerGetPeerID(ctx, a, minerAddr)
@@ -144,6 +164,11 @@ func (a *API) WalletBalance(ctx context.Context, address address.Address) (*type
 	return WalletBalance(ctx, a, address)
 }
 
+// MultisigGet returns the state of the multisig wallet at the given address
+func (a *API) MultisigGet(ctx context.Context, fromAddr address.Address, wallet address.Address) (*multisig.State, error) {
+	return MultisigGet(ctx, a, fromAddr, wallet)
+}
+
 // PaymentChannelLs lists payment channels for a given payer
 func (a *API) PaymentChannelLs(
 	ctx context.Context,
@@ -160,6 +185,22 @@ func (a *API) PaymentChannelVoucher(
 	channel *types.ChannelID,
 	amount *types.AttoFIL,
 	validAt *types.BlockHeight,
+	lane uint64,
+	nonce uint64,
+	merges []paymentbroker.Merge,
+	hashLock []byte,
 ) (voucher *paymentbroker.PaymentVoucher, err error) {
-	return PaymentChannelVoucher(ctx, a, fromAddr, channel, amount, validAt)
+	return PaymentChannelVoucher(ctx, a, fromAddr, channel, amount, validAt, lane, nonce, merges, hashLock)
+}
+
+// PaymentChannelStatus returns the payment channels opened by the wallet
+// addresses of the node, as tracked by the node and updated from chain
+func (a *API) PaymentChannelStatus(ctx context.Context) ([]*paychs.ChannelInfo, error) {
+	return PaymentChannelStatus(ctx, a)
+}
+
+// PaymentChannelReclaimExpired reclaims the funds of the payment channels of
+// the node that reached their eol
+func (a *API) PaymentChannelReclaimExpired(ctx context.Context, height *types.BlockHeight) ([]*paychs.ChannelInfo, error) {
+	return PaymentChannelReclaimExpired(ctx, a, height)
 }
@@ -0,0 +1,152 @@
+package porcelain
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	minerActor "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// StorageAsk is a live ask in the storage market order book.
+type StorageAsk struct {
+	Miner  address.Address
+	ID     uint64
+	Price  *types.AttoFIL
+	Expiry *types.BlockHeight
+
+	// FreeSectors is the number of pledged sectors the miner has not yet
+	// committed.
+	FreeSectors uint64
+}
+
+// AskFilter restricts the asks returned by StorageMarketAsks. Zero values
+// mean no restriction.
+type AskFilter struct {
+	// MaxPrice drops asks priced above it.
+	MaxPrice *types.AttoFIL
+	// MinFreeSectors drops asks of miners with fewer free sectors.
+	MinFreeSectors uint64
+	// Limit caps the number of asks returned.
+	Limit int
+}
+
+// smaAPI is the subset of the plumbing.API that StorageMarketAsks uses.
+type smaAPI interface {
+	ChainLs(ctx context.Context) <-chan interface{}
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+// StorageMarketAsks returns the order book of the storage market: the
+// unexpired asks of every miner in the storage market that pass the filter,
+// cheapest first.
+func StorageMarketAsks(ctx context.Context, plumbing smaAPI, filter AskFilter) ([]StorageAsk, error) {
+	height, err := ChainBlockHeight(ctx, plumbing)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, _, err := plumbing.MessageQuery(ctx, address.Address{}, address.StorageMarketAddress, "getMiners")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query storage market miners")
+	}
+
+	var miners []address.Address
+	if err := cbor.DecodeInto(ret[0], &miners); err != nil {
+		return nil, errors.Wrap(err, "failed to decode storage market miners")
+	}
+
+	asks := []StorageAsk{}
+	for _, minerAddr := range miners {
+		minerAsks, err := minerLiveAsks(ctx, plumbing, minerAddr, height)
+		if err != nil {
+			return nil, err
+		}
+		if len(minerAsks) == 0 {
+			continue
+		}
+
+		freeSectors, err := minerFreeSectors(ctx, plumbing, minerAddr)
+		if err != nil {
+			return nil, err
+		}
+		if freeSectors < filter.MinFreeSectors {
+			continue
+		}
+
+		for _, ask := range minerAsks {
+			if filter.MaxPrice != nil && ask.Price.GreaterThan(filter.MaxPrice) {
+				continue
+			}
+			asks = append(asks, StorageAsk{
+				Miner:       minerAddr,
+				ID:          ask.ID.Uint64(),
+				Price:       ask.Price,
+				Expiry:      ask.Expiry,
+				FreeSectors: freeSectors,
+			})
+		}
+	}
+
+	sort.SliceStable(asks, func(i, j int) bool {
+		return asks[i].Price.LessThan(asks[j].Price)
+	})
+
+	if filter.Limit > 0 && len(asks) > filter.Limit {
+		asks = asks[:filter.Limit]
+	}
+
+	return asks, nil
+}
+
+// minerLiveAsks returns the asks of the miner that have not expired at the
+// given height. The miner actor leaves out the asks that expired by the head
+// of the chain, the height check only covers a head that moved since.
+func minerLiveAsks(ctx context.Context, plumbing smaAPI, minerAddr address.Address, height *types.BlockHeight) ([]minerActor.Ask, error) {
+	ret, _, err := plumbing.MessageQuery(ctx, address.Address{}, minerAddr, "getLiveAsks")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query asks of miner %s", minerAddr)
+	}
+
+	var minerAsks []minerActor.Ask
+	if err := cbor.DecodeInto(ret[0], &minerAsks); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode asks of miner %s", minerAddr)
+	}
+
+	var asks []minerActor.Ask
+	for _, ask := range minerAsks {
+		if !height.LessThan(ask.Expiry) {
+			continue
+		}
+		asks = append(asks, ask)
+	}
+
+	return asks, nil
+}
+
+// minerFreeSectors returns the number of sectors the miner pledged but has
+// not yet committed.
+func minerFreeSectors(ctx context.Context, plumbing smaAPI, minerAddr address.Address) (uint64, error) {
+	ret, _, err := plumbing.MessageQuery(ctx, address.Address{}, minerAddr, "getPledge")
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to query pledge of miner %s", minerAddr)
+	}
+	pledge := big.NewInt(0).SetBytes(ret[0])
+
+	ret, _, err = plumbing.MessageQuery(ctx, address.Address{}, minerAddr, "getPower")
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to query power of miner %s", minerAddr)
+	}
+	power := big.NewInt(0).SetBytes(ret[0])
+
+	if pledge.Cmp(power) <= 0 {
+		return 0, nil
+	}
+	return pledge.Sub(pledge, power).Uint64(), nil
+}
@@ -0,0 +1,143 @@
+package porcelain_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	minerActor "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type testAsksMiner struct {
+	asks   []*minerActor.Ask
+	pledge int64
+	power  int64
+}
+
+type testStorageMarketAsksPlumbing struct {
+	require *require.Assertions
+	height  uint64
+	miners  map[address.Address]*testAsksMiner
+}
+
+func (p *testStorageMarketAsksPlumbing) ChainLs(ctx context.Context) <-chan interface{} {
+	ts, err := types.NewTipSet(&types.Block{Height: types.Uint64(p.height)})
+	p.require.NoError(err)
+
+	out := make(chan interface{}, 1)
+	out <- ts
+	close(out)
+	return out
+}
+
+func (p *testStorageMarketAsksPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	if to == address.StorageMarketAddress {
+		p.require.Equal("getMiners", method)
+		var addrs []address.Address
+		for addr := range p.miners {
+			addrs = append(addrs, addr)
+		}
+		return p.encode(addrs), nil, nil
+	}
+
+	miner, ok := p.miners[to]
+	p.require.True(ok)
+
+	switch method {
+	case "getLiveAsks":
+		live := []*minerActor.Ask{}
+		for _, ask := range miner.asks {
+			if types.NewBlockHeight(p.height).LessThan(ask.Expiry) {
+				live = append(live, ask)
+			}
+		}
+		return p.encode(live), nil, nil
+	case "getPledge":
+		return [][]byte{big.NewInt(miner.pledge).Bytes()}, nil, nil
+	case "getPower":
+		return [][]byte{big.NewInt(miner.power).Bytes()}, nil, nil
+	}
+
+	p.require.Failf("unexpected method", "method %s", method)
+	return nil, nil, nil
+}
+
+func (p *testStorageMarketAsksPlumbing) encode(v interface{}) [][]byte {
+	bytes, err := cbor.DumpObject(v)
+	p.require.NoError(err)
+	return [][]byte{bytes}
+}
+
+func TestStorageMarketAsks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	addrGetter := address.NewForTestGetter()
+	cheapMiner, fullMiner := addrGetter(), addrGetter()
+
+	newAsk := func(id int64, price uint64, expiry uint64) *minerActor.Ask {
+		return &minerActor.Ask{
+			ID:     big.NewInt(id),
+			Price:  types.NewAttoFILFromFIL(price),
+			Expiry: types.NewBlockHeight(expiry),
+		}
+	}
+
+	plumbing := &testStorageMarketAsksPlumbing{
+		require: require,
+		height:  10,
+		miners: map[address.Address]*testAsksMiner{
+			cheapMiner: {
+				asks:   []*minerActor.Ask{newAsk(0, 5, 20), newAsk(1, 1, 10), newAsk(2, 3, 20)},
+				pledge: 10,
+				power:  2,
+			},
+			fullMiner: {
+				asks:   []*minerActor.Ask{newAsk(0, 2, 20)},
+				pledge: 10,
+				power:  10,
+			},
+		},
+	}
+
+	t.Run("expired asks are dropped and the rest sorted by price", func(t *testing.T) {
+		asks, err := porcelain.StorageMarketAsks(ctx, plumbing, porcelain.AskFilter{})
+		require.NoError(err)
+		require.Len(asks, 3)
+
+		assert.Equal(fullMiner, asks[0].Miner)
+		assert.Equal(uint64(0), asks[0].FreeSectors)
+		assert.Equal(cheapMiner, asks[1].Miner)
+		assert.Equal(uint64(2), asks[1].ID)
+		assert.Equal(uint64(8), asks[1].FreeSectors)
+		assert.Equal(uint64(0), asks[2].ID)
+	})
+
+	t.Run("filters on price and free sectors", func(t *testing.T) {
+		asks, err := porcelain.StorageMarketAsks(ctx, plumbing, porcelain.AskFilter{
+			MaxPrice:       types.NewAttoFILFromFIL(4),
+			MinFreeSectors: 1,
+		})
+		require.NoError(err)
+		require.Len(asks, 1)
+		assert.Equal(cheapMiner, asks[0].Miner)
+		assert.Equal(uint64(2), asks[0].ID)
+	})
+
+	t.Run("limits the number of asks", func(t *testing.T) {
+		asks, err := porcelain.StorageMarketAsks(ctx, plumbing, porcelain.AskFilter{Limit: 2})
+		require.NoError(err)
+		require.Len(asks, 2)
+		assert.Equal(types.NewAttoFILFromFIL(2), asks[0].Price)
+		assert.Equal(types.NewAttoFILFromFIL(3), asks[1].Price)
+	})
+}
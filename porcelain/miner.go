@@ -211,6 +211,21 @@ func MinerGetOwnerAddress(ctx context.Context, plumbing mgoaAPI, minerAddr addre
 	return address.NewFromBytes(res[0])
 }
 
+// mgwaAPI is the subset of the plumbing.API that MinerGetWorkerAddress uses.
+type mgwaAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+// MinerGetWorkerAddress queries for the worker address of the given miner
+func MinerGetWorkerAddress(ctx context.Context, plumbing mgwaAPI, minerAddr address.Address) (address.Address, error) {
+	res, _, err := plumbing.MessageQuery(ctx, address.Address{}, minerAddr, "getWorker")
+	if err != nil {
+		return address.Address{}, err
+	}
+
+	return address.NewFromBytes(res[0])
+}
+
 // mgaAPI is the subset of the plumbing.API that MinerGetAsk uses.
 type mgaAPI interface {
 	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
@@ -365,6 +365,23 @@ func TestMinerGetOwnerAddress(t *testing.T) {
 	assert.Equal(address.TestAddress, addr)
 }
 
+type minerGetWorkerPlumbing struct{}
+
+func (mgwp *minerGetWorkerPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	if method != "getWorker" {
+		return nil, nil, errors.New("unexpected method " + method)
+	}
+	return [][]byte{address.TestAddress.Bytes()}, nil, nil
+}
+
+func TestMinerGetWorkerAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, err := MinerGetWorkerAddress(context.Background(), &minerGetWorkerPlumbing{}, address.TestAddress2)
+	assert.NoError(err)
+	assert.Equal(address.TestAddress, addr)
+}
+
 type minerGetPeerIDPlumbing struct{}
 
 func (mgop *minerGetPeerIDPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
@@ -0,0 +1,38 @@
+package porcelain
+
+import (
+	"context"
+
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/multisig"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+)
+
+type mgPlumbing interface {
+	GetAndMaybeSetDefaultSenderAddress() (address.Address, error)
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+// MultisigGet returns the state of the multisig wallet at the given address
+func MultisigGet(ctx context.Context, plumbing mgPlumbing, fromAddr address.Address, wallet address.Address) (*multisig.State, error) {
+	if fromAddr == (address.Address{}) {
+		var err error
+		fromAddr, err = plumbing.GetAndMaybeSetDefaultSenderAddress()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	values, _, err := plumbing.MessageQuery(ctx, fromAddr, wallet, "get")
+	if err != nil {
+		return nil, err
+	}
+
+	var walletState multisig.State
+	if err := cbor.DecodeInto(values[0], &walletState); err != nil {
+		return nil, err
+	}
+	return &walletState, nil
+}
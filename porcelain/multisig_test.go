@@ -0,0 +1,51 @@
+package porcelain_test
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/multisig"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+)
+
+type testMultisigGetPlumbing struct {
+	require *require.Assertions
+	from    address.Address
+	wallet  address.Address
+	state   *multisig.State
+}
+
+func (p *testMultisigGetPlumbing) GetAndMaybeSetDefaultSenderAddress() (address.Address, error) {
+	return p.from, nil
+}
+
+func (p *testMultisigGetPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	p.require.Equal(p.from, optFrom)
+	p.require.Equal(p.wallet, to)
+	p.require.Equal("get", method)
+	walletBytes, err := cbor.DumpObject(p.state)
+	p.require.NoError(err)
+	return [][]byte{walletBytes}, nil, nil
+}
+
+func TestMultisigGet(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addrGetter := address.NewForTestGetter()
+	expected := multisig.NewState([]address.Address{addrGetter(), addrGetter()}, 2)
+	plumbing := &testMultisigGetPlumbing{require: require, from: addrGetter(), wallet: addrGetter(), state: expected}
+
+	walletState, err := porcelain.MultisigGet(context.Background(), plumbing, address.Address{}, plumbing.wallet)
+	require.NoError(err)
+	assert.Equal(expected.Signers, walletState.Signers)
+	assert.Equal(expected.Threshold, walletState.Threshold)
+	assert.Empty(walletState.Pending)
+}
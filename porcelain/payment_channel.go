@@ -2,12 +2,18 @@ package porcelain
 
 import (
 	"context"
+	"fmt"
+	"math/big"
+	"sort"
 
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/plumbing/paychs"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -56,9 +62,18 @@ type pcvPlumbing interface {
 	GetAndMaybeSetDefaultSenderAddress() (address.Address, error)
 	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
 	SignBytes(data []byte, addr address.Address) (types.Signature, error)
+	PaychUpdate(payer address.Address, chid *types.ChannelID, update func(channel *paychs.ChannelInfo) error) error
 }
 
-// PaymentChannelVoucher returns a signed payment channel voucher
+// PaymentChannelVoucher returns a signed payment channel voucher on the given
+// lane. A zero nonce uses the nonce following the last one issued on the
+// channel or redeemed on the lane, so vouchers issued before the earlier ones
+// are redeemed stay redeemable after them; a given nonce must be above the
+// last one issued.
+// Merges settle other lanes with the voucher, and a non-empty hash lock makes
+// the voucher redeemable only with a preimage of it. The voucher is recorded
+// with the channel, and refused if the vouchers issued on the channel would
+// pay out more than it holds.
 func PaymentChannelVoucher(
 	ctx context.Context,
 	plumbing pcvPlumbing,
@@ -66,7 +81,15 @@ func PaymentChannelVoucher(
 	channel *types.ChannelID,
 	amount *types.AttoFIL,
 	validAt *types.BlockHeight,
+	lane uint64,
+	nonce uint64,
+	merges []paymentbroker.Merge,
+	hashLock []byte,
 ) (voucher *paymentbroker.PaymentVoucher, err error) {
+	if len(hashLock) != 0 && len(hashLock) != paymentbroker.HashLockLen {
+		return nil, fmt.Errorf("hash lock must be %d bytes, not %d", paymentbroker.HashLockLen, len(hashLock))
+	}
+
 	if fromAddr == (address.Address{}) {
 		fromAddr, err = plumbing.GetAndMaybeSetDefaultSenderAddress()
 		if err != nil {
@@ -79,7 +102,7 @@ func PaymentChannelVoucher(
 		fromAddr,
 		address.PaymentBrokerAddress,
 		"voucher",
-		channel, amount, validAt,
+		channel, amount, validAt, big.NewInt(0).SetUint64(lane),
 	)
 	if err != nil {
 		return nil, err
@@ -89,11 +112,251 @@ func PaymentChannelVoucher(
 		return nil, err
 	}
 
-	sig, err := paymentbroker.SignVoucher(channel, amount, validAt, fromAddr, plumbing)
+	channels, err := paymentChannelsOnChain(ctx, plumbing, fromAddr)
+	if err != nil {
+		return nil, err
+	}
+	onChain, ok := channels[channel.KeyString()]
+	if !ok {
+		return nil, fmt.Errorf("payer %s has no payment channel %s", fromAddr, channel)
+	}
+
+	// the nonce and the commitment are checked against the record and the
+	// voucher added to it in one update, so vouchers issued concurrently
+	// neither share a nonce nor together commit more than the channel holds
+	err = plumbing.PaychUpdate(fromAddr, channel, func(record *paychs.ChannelInfo) error {
+		refreshPaymentChannelRecord(record, onChain)
+
+		// the chain only knows the redeemed nonce of the lane, vouchers
+		// issued since have to be counted here
+		if nonce == 0 {
+			if voucher.Nonce <= record.LastNonce {
+				voucher.Nonce = record.LastNonce + 1
+			}
+		} else if nonce <= record.LastNonce {
+			return fmt.Errorf("nonce %d is not above %d, the last one issued on channel %s", nonce, record.LastNonce, channel)
+		} else {
+			voucher.Nonce = nonce
+		}
+		voucher.Merges = merges
+		voucher.HashLock = hashLock
+
+		committed := paychs.CommittedAmount(append(record.Vouchers, voucher))
+		if committed.GreaterThan(record.Amount) {
+			return fmt.Errorf("vouchers issued on channel %s would pay %s, more than the %s it holds", channel, committed, record.Amount)
+		}
+
+		sig, err := paymentbroker.SignVoucher(voucher, fromAddr, plumbing)
+		if err != nil {
+			return err
+		}
+		voucher.Signature = sig
+
+		record.AddVoucher(voucher)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	voucher.Signature = sig
 
 	return voucher, nil
 }
+
+type pcsPlumbing interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+	PaychsLs() ([]*paychs.ChannelInfo, error)
+	PaychUpdate(payer address.Address, chid *types.ChannelID, update func(channel *paychs.ChannelInfo) error) error
+	WalletAddresses() []address.Address
+}
+
+// PaymentChannelStatus returns the records of the payment channels opened by
+// the wallet addresses of the node, updated with their state on chain.
+// Channels no longer on chain are marked closed.
+func PaymentChannelStatus(ctx context.Context, plumbing pcsPlumbing) ([]*paychs.ChannelInfo, error) {
+	records, err := plumbing.PaychsLs()
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*paychs.ChannelInfo)
+	for _, record := range records {
+		byKey[paymentChannelRecordKey(record.Payer, record.Channel)] = record
+	}
+
+	// onChain holds the channels of the wallet addresses by key, nil for
+	// the recorded ones no longer on chain
+	onChain := make(map[string]*paymentbroker.PaymentChannel)
+	for _, payer := range plumbing.WalletAddresses() {
+		channels, err := paymentChannelsOnChain(ctx, plumbing, payer)
+		if err != nil {
+			return nil, err
+		}
+
+		for id, channel := range channels {
+			chid, ok := types.NewChannelIDFromString(id, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid channel id %s", id)
+			}
+			key := paymentChannelRecordKey(payer, chid)
+			if _, ok := byKey[key]; !ok {
+				byKey[key] = &paychs.ChannelInfo{Payer: payer, Channel: chid}
+			}
+			onChain[key] = channel
+		}
+
+		for key, record := range byKey {
+			if _, ok := onChain[key]; !ok && record.Payer == payer {
+				onChain[key] = nil
+			}
+		}
+	}
+
+	records = make([]*paychs.ChannelInfo, 0, len(byKey))
+	for key, record := range byKey {
+		channel, ok := onChain[key]
+		if ok {
+			// refresh the stored record rather than the listed one, which
+			// misses the vouchers issued since
+			err := plumbing.PaychUpdate(record.Payer, record.Channel, func(stored *paychs.ChannelInfo) error {
+				if channel != nil {
+					refreshPaymentChannelRecord(stored, channel)
+				} else {
+					stored.Closed = true
+				}
+				record = stored
+				return nil
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to update payment channel record")
+			}
+		}
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Payer != records[j].Payer {
+			return records[i].Payer.String() < records[j].Payer.String()
+		}
+		// channel ids are decimal numbers, so shorter ones are smaller
+		a, b := records[i].Channel.String(), records[j].Channel.String()
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+
+	return records, nil
+}
+
+// TODO: replace this with a queries to pick reasonable gas price and limits.
+const reclaimGasPrice = 0
+const reclaimGasLimit = 300
+
+// reclaimRetryBlocks is the number of blocks a reclaim message has to make it
+// into the chain before it is sent again.
+const reclaimRetryBlocks = 10
+
+type pcrPlumbing interface {
+	pcsPlumbing
+	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
+}
+
+// PaymentChannelReclaimExpired sends a reclaim for every open payment channel
+// of the node that reached its eol at the given height, and returns the
+// channels it sent one for.
+func PaymentChannelReclaimExpired(ctx context.Context, plumbing pcrPlumbing, height *types.BlockHeight) ([]*paychs.ChannelInfo, error) {
+	records, err := plumbing.PaychsLs()
+	if err != nil {
+		return nil, err
+	}
+
+	// only go to chain if there may be something to reclaim
+	due := false
+	for _, record := range records {
+		if reclaimDue(record, height) {
+			due = true
+			break
+		}
+	}
+	if !due {
+		return nil, nil
+	}
+
+	records, err = PaymentChannelStatus(ctx, plumbing)
+	if err != nil {
+		return nil, err
+	}
+
+	var reclaimed []*paychs.ChannelInfo
+	for _, record := range records {
+		if !reclaimDue(record, height) {
+			continue
+		}
+
+		_, err := plumbing.MessageSend(
+			ctx,
+			record.Payer,
+			address.PaymentBrokerAddress,
+			types.ZeroAttoFIL,
+			types.NewGasPrice(reclaimGasPrice),
+			types.NewGasUnits(reclaimGasLimit),
+			"reclaim",
+			record.Channel,
+		)
+		if err != nil {
+			return reclaimed, errors.Wrapf(err, "failed to reclaim payment channel %s", record.Channel)
+		}
+
+		err = plumbing.PaychUpdate(record.Payer, record.Channel, func(stored *paychs.ChannelInfo) error {
+			stored.ReclaimedAt = height
+			record = stored
+			return nil
+		})
+		if err != nil {
+			return reclaimed, errors.Wrap(err, "failed to update payment channel record")
+		}
+		reclaimed = append(reclaimed, record)
+	}
+
+	return reclaimed, nil
+}
+
+// reclaimDue returns true if the channel is open, past its eol and no reclaim
+// sent for it is still waiting to land on chain.
+func reclaimDue(record *paychs.ChannelInfo, height *types.BlockHeight) bool {
+	if record.Closed || record.Eol == nil || height.LessThan(record.Eol) {
+		return false
+	}
+	if record.ReclaimedAt == nil {
+		return true
+	}
+	return height.GreaterEqual(record.ReclaimedAt.Add(types.NewBlockHeight(reclaimRetryBlocks)))
+}
+
+type messageQuerier interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+func paymentChannelsOnChain(ctx context.Context, plumbing messageQuerier, payer address.Address) (map[string]*paymentbroker.PaymentChannel, error) {
+	values, _, err := plumbing.MessageQuery(ctx, payer, address.PaymentBrokerAddress, "ls", payer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query payment channels of %s", payer)
+	}
+
+	var channels map[string]*paymentbroker.PaymentChannel
+	if err := cbor.DecodeInto(values[0], &channels); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode payment channels of %s", payer)
+	}
+	return channels, nil
+}
+
+func refreshPaymentChannelRecord(record *paychs.ChannelInfo, channel *paymentbroker.PaymentChannel) {
+	record.Target = channel.Target
+	record.Amount = channel.Amount
+	record.AmountRedeemed = channel.AmountRedeemed
+	record.Eol = channel.Eol
+	record.Closed = false
+}
+
+func paymentChannelRecordKey(payer address.Address, chid *types.ChannelID) string {
+	return payer.String() + "/" + chid.KeyString()
+}
@@ -2,17 +2,22 @@ package porcelain_test
 
 import (
 	"context"
+	"math/big"
+	"sync"
 	"testing"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/plumbing/paychs"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -53,8 +58,26 @@ func TestPaymentChannelLs(t *testing.T) {
 }
 
 type testPaymentChannelVoucherPlumbing struct {
-	require *require.Assertions
-	voucher *paymentbroker.PaymentVoucher
+	require  *require.Assertions
+	voucher  *paymentbroker.PaymentVoucher
+	channels map[string]*paymentbroker.PaymentChannel
+	records  map[string]*paychs.ChannelInfo
+}
+
+func newTestPaymentChannelVoucherPlumbing(require *require.Assertions, voucher *paymentbroker.PaymentVoucher, funds *types.AttoFIL) *testPaymentChannelVoucherPlumbing {
+	return &testPaymentChannelVoucherPlumbing{
+		require: require,
+		voucher: voucher,
+		channels: map[string]*paymentbroker.PaymentChannel{
+			voucher.Channel.KeyString(): {
+				Target:         voucher.Target,
+				Amount:         funds,
+				AmountRedeemed: types.ZeroAttoFIL,
+				Eol:            types.NewBlockHeight(100),
+			},
+		},
+		records: map[string]*paychs.ChannelInfo{},
+	}
 }
 
 func (p *testPaymentChannelVoucherPlumbing) GetAndMaybeSetDefaultSenderAddress() (address.Address, error) {
@@ -62,7 +85,17 @@ func (p *testPaymentChannelVoucherPlumbing) GetAndMaybeSetDefaultSenderAddress()
 }
 
 func (p *testPaymentChannelVoucherPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
-	result, err := actor.MarshalStorage(p.voucher)
+	if method == "ls" {
+		result, err := cbor.DumpObject(p.channels)
+		p.require.NoError(err)
+		return [][]byte{result}, nil, nil
+	}
+
+	p.require.Equal("voucher", method)
+	voucher := *p.voucher
+	voucher.Amount = *params[1].(*types.AttoFIL)
+	voucher.Lane = params[3].(*big.Int).Uint64()
+	result, err := actor.MarshalStorage(&voucher)
 	p.require.NoError(err)
 	return [][]byte{result}, nil, nil
 }
@@ -71,6 +104,33 @@ func (p *testPaymentChannelVoucherPlumbing) SignBytes(data []byte, addr address.
 	return []byte("test"), nil
 }
 
+func (p *testPaymentChannelVoucherPlumbing) PaychGet(payer address.Address, chid *types.ChannelID) (*paychs.ChannelInfo, error) {
+	return p.records[payer.String()+"/"+chid.KeyString()], nil
+}
+
+func (p *testPaymentChannelVoucherPlumbing) PaychUpdate(payer address.Address, chid *types.ChannelID, update func(channel *paychs.ChannelInfo) error) error {
+	key := payer.String() + "/" + chid.KeyString()
+	channel := paychs.ChannelInfo{Payer: payer, Channel: chid, AmountCommitted: types.ZeroAttoFIL}
+	if stored, ok := p.records[key]; ok {
+		channel = *stored
+	}
+	if err := update(&channel); err != nil {
+		return err
+	}
+	p.records[key] = &channel
+	return nil
+}
+
+// testPaymentChannelStorePlumbing keeps the records in a real store.
+type testPaymentChannelStorePlumbing struct {
+	*testPaymentChannelVoucherPlumbing
+	store *paychs.Store
+}
+
+func (p *testPaymentChannelStorePlumbing) PaychUpdate(payer address.Address, chid *types.ChannelID, update func(channel *paychs.ChannelInfo) error) error {
+	return p.store.Update(payer, chid, update)
+}
+
 func TestPaymentChannelVoucher(t *testing.T) {
 	t.Parallel()
 
@@ -84,13 +144,12 @@ func TestPaymentChannelVoucher(t *testing.T) {
 			Target:    address.Address{},
 			Amount:    *types.NewAttoFILFromFIL(10),
 			ValidAt:   *types.NewBlockHeight(0),
+			Lane:      2,
+			Nonce:     4,
 			Signature: []byte{},
 		}
 
-		plumbing := &testPaymentChannelVoucherPlumbing{
-			require: require,
-			voucher: expectedVoucher,
-		}
+		plumbing := newTestPaymentChannelVoucherPlumbing(require, expectedVoucher, types.NewAttoFILFromFIL(100))
 		ctx := context.Background()
 
 		voucher, err := porcelain.PaymentChannelVoucher(
@@ -100,6 +159,10 @@ func TestPaymentChannelVoucher(t *testing.T) {
 			types.NewChannelID(5),
 			types.NewAttoFILFromFIL(10),
 			types.NewBlockHeight(0),
+			2,
+			0,
+			nil,
+			nil,
 		)
 		require.NoError(err)
 		assert.Equal(expectedVoucher.Channel, voucher.Channel)
@@ -107,6 +170,307 @@ func TestPaymentChannelVoucher(t *testing.T) {
 		assert.Equal(expectedVoucher.Target, voucher.Target)
 		assert.Equal(expectedVoucher.Amount, voucher.Amount)
 		assert.Equal(expectedVoucher.ValidAt, voucher.ValidAt)
+		assert.Equal(expectedVoucher.Lane, voucher.Lane)
+		assert.Equal(expectedVoucher.Nonce, voucher.Nonce)
 		assert.NotEqual(expectedVoucher.Signature, voucher.Signature)
+
+		record, err := plumbing.PaychGet(address.Address{}, types.NewChannelID(5))
+		require.NoError(err)
+		require.NotNil(record)
+		require.Len(record.Vouchers, 1)
+		assert.Equal(voucher, record.Vouchers[0])
+		assert.Equal(types.NewAttoFILFromFIL(100), record.Amount)
+		assert.Equal(uint64(1), record.LastNonce)
+		assert.Equal(types.NewAttoFILFromFIL(10), record.AmountCommitted)
+	})
+
+	t.Run("uses the given nonce, merges and hash lock", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		plumbing := newTestPaymentChannelVoucherPlumbing(require, &paymentbroker.PaymentVoucher{
+			Channel: *types.NewChannelID(5),
+			Amount:  *types.NewAttoFILFromFIL(10),
+			Nonce:   1,
+		}, types.NewAttoFILFromFIL(100))
+		merges := []paymentbroker.Merge{{Lane: 1, Nonce: 3}}
+		hashLock := paymentbroker.NewHashLock([]byte("key"))
+
+		voucher, err := porcelain.PaymentChannelVoucher(
+			context.Background(),
+			plumbing,
+			address.Address{},
+			types.NewChannelID(5),
+			types.NewAttoFILFromFIL(10),
+			types.NewBlockHeight(0),
+			0,
+			7,
+			merges,
+			hashLock,
+		)
+		require.NoError(err)
+		assert.Equal(uint64(7), voucher.Nonce)
+		assert.Equal(merges, voucher.Merges)
+		assert.Equal(hashLock, voucher.HashLock)
+
+		_, err = porcelain.PaymentChannelVoucher(context.Background(), plumbing, address.Address{}, types.NewChannelID(5), types.NewAttoFILFromFIL(10), types.NewBlockHeight(0), 0, 8, nil, []byte("lock"))
+		assert.Error(err)
+	})
+
+	t.Run("redeems voucher 1 and then voucher 2 issued before it", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx := context.Background()
+
+		// the voucher query returns the nonce following the one redeemed on
+		// the lane, like the payment broker
+		plumbing := newTestPaymentChannelVoucherPlumbing(require, &paymentbroker.PaymentVoucher{
+			Channel: *types.NewChannelID(5),
+			Nonce:   1,
+		}, types.NewAttoFILFromFIL(100))
+		redeemed := uint64(0)
+		redeem := func(v *paymentbroker.PaymentVoucher) {
+			require.True(v.Nonce > redeemed, "stale nonce %d", v.Nonce)
+			redeemed = v.Nonce
+			plumbing.voucher.Nonce = redeemed + 1
+		}
+
+		voucher := func(amount uint64, nonce uint64) (*paymentbroker.PaymentVoucher, error) {
+			return porcelain.PaymentChannelVoucher(ctx, plumbing, address.Address{}, types.NewChannelID(5), types.NewAttoFILFromFIL(amount), types.NewBlockHeight(0), 0, nonce, nil, nil)
+		}
+
+		first, err := voucher(10, 0)
+		require.NoError(err)
+		second, err := voucher(20, 0)
+		require.NoError(err)
+		assert.Equal(uint64(1), first.Nonce)
+		assert.Equal(uint64(2), second.Nonce)
+
+		redeem(first)
+		redeem(second)
+
+		third, err := voucher(30, 0)
+		require.NoError(err)
+		assert.Equal(uint64(3), third.Nonce)
+
+		_, err = voucher(40, 3)
+		require.Error(err)
+		assert.Contains(err.Error(), "the last one issued on channel 5")
+
+		// nonces keep increasing on other lanes
+		other, err := porcelain.PaymentChannelVoucher(ctx, plumbing, address.Address{}, types.NewChannelID(5), types.NewAttoFILFromFIL(10), types.NewBlockHeight(0), 1, 0, nil, nil)
+		require.NoError(err)
+		assert.Equal(uint64(4), other.Nonce)
+	})
+
+	t.Run("refuses vouchers that exceed the channel funds", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx := context.Background()
+
+		plumbing := newTestPaymentChannelVoucherPlumbing(require, &paymentbroker.PaymentVoucher{
+			Channel: *types.NewChannelID(5),
+		}, types.NewAttoFILFromFIL(100))
+
+		voucher := func(amount uint64, lane uint64, merges []paymentbroker.Merge) error {
+			_, err := porcelain.PaymentChannelVoucher(ctx, plumbing, address.Address{}, types.NewChannelID(5), types.NewAttoFILFromFIL(amount), types.NewBlockHeight(0), lane, 0, merges, nil)
+			return err
+		}
+
+		// later vouchers on a lane replace earlier ones
+		require.NoError(voucher(40, 0, nil))
+		require.NoError(voucher(60, 0, nil))
+
+		// lanes add up
+		require.NoError(voucher(40, 1, nil))
+		err := voucher(41, 2, nil)
+		require.Error(err)
+		assert.Contains(err.Error(), "more than the")
+
+		// a merging voucher stands in for the lanes it merges
+		require.NoError(voucher(100, 2, []paymentbroker.Merge{{Lane: 0, Nonce: 2}, {Lane: 1, Nonce: 1}}))
+
+		record, err := plumbing.PaychGet(address.Address{}, types.NewChannelID(5))
+		require.NoError(err)
+		assert.Len(record.Vouchers, 4)
+		assert.Equal(types.NewAttoFILFromFIL(100), record.AmountCommitted)
+	})
+
+	t.Run("does not over-commit the channel with concurrent vouchers", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx := context.Background()
+
+		store := paychs.New(repo.NewInMemoryRepo().DealsDs)
+		plumbing := &testPaymentChannelStorePlumbing{
+			testPaymentChannelVoucherPlumbing: newTestPaymentChannelVoucherPlumbing(require, &paymentbroker.PaymentVoucher{
+				Channel: *types.NewChannelID(5),
+				Nonce:   1,
+			}, types.NewAttoFILFromFIL(100)),
+			store: store,
+		}
+
+		// each voucher commits 30 on its own lane, so only 3 of them fit
+		var wg sync.WaitGroup
+		for lane := uint64(0); lane < 10; lane++ {
+			wg.Add(1)
+			go func(lane uint64) {
+				defer wg.Done()
+				porcelain.PaymentChannelVoucher(ctx, plumbing, address.Address{}, types.NewChannelID(5), types.NewAttoFILFromFIL(30), types.NewBlockHeight(0), lane, 0, nil, nil) // nolint: errcheck
+			}(lane)
+		}
+		wg.Wait()
+
+		record, err := store.Get(address.Address{}, types.NewChannelID(5))
+		require.NoError(err)
+		require.Len(record.Vouchers, 3)
+		assert.Equal(types.NewAttoFILFromFIL(90), record.AmountCommitted)
+		assert.Equal(uint64(3), record.LastNonce)
+	})
+}
+
+type testPaymentChannelStatusPlumbing struct {
+	require  *require.Assertions
+	payer    address.Address
+	channels map[string]*paymentbroker.PaymentChannel
+	records  map[string]*paychs.ChannelInfo
+	sent     []*types.ChannelID
+}
+
+func (p *testPaymentChannelStatusPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	p.require.Equal("ls", method)
+	p.require.Equal(p.payer, params[0])
+	result, err := cbor.DumpObject(p.channels)
+	p.require.NoError(err)
+	return [][]byte{result}, nil, nil
+}
+
+func (p *testPaymentChannelStatusPlumbing) MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+	p.require.Equal(p.payer, from)
+	p.require.Equal(address.PaymentBrokerAddress, to)
+	p.require.Equal("reclaim", method)
+	p.sent = append(p.sent, params[0].(*types.ChannelID))
+	return types.SomeCid(), nil
+}
+
+func (p *testPaymentChannelStatusPlumbing) PaychsLs() ([]*paychs.ChannelInfo, error) {
+	var records []*paychs.ChannelInfo
+	for _, record := range p.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (p *testPaymentChannelStatusPlumbing) PaychUpdate(payer address.Address, chid *types.ChannelID, update func(channel *paychs.ChannelInfo) error) error {
+	channel := paychs.ChannelInfo{Payer: payer, Channel: chid, AmountCommitted: types.ZeroAttoFIL}
+	if stored, ok := p.records[chid.KeyString()]; ok {
+		channel = *stored
+	}
+	if err := update(&channel); err != nil {
+		return err
+	}
+	p.records[chid.KeyString()] = &channel
+	return nil
+}
+
+func (p *testPaymentChannelStatusPlumbing) WalletAddresses() []address.Address {
+	return []address.Address{p.payer}
+}
+
+func newTestPaymentChannelStatusPlumbing(require *require.Assertions) *testPaymentChannelStatusPlumbing {
+	addressGetter := address.NewForTestGetter()
+	payer, target := addressGetter(), addressGetter()
+
+	return &testPaymentChannelStatusPlumbing{
+		require: require,
+		payer:   payer,
+		channels: map[string]*paymentbroker.PaymentChannel{
+			"1": {Target: target, Amount: types.NewAttoFILFromFIL(10), AmountRedeemed: types.NewAttoFILFromFIL(4), Eol: types.NewBlockHeight(50)},
+			"2": {Target: target, Amount: types.NewAttoFILFromFIL(20), AmountRedeemed: types.ZeroAttoFIL, Eol: types.NewBlockHeight(200)},
+		},
+		records: map[string]*paychs.ChannelInfo{
+			// channel 1 was opened through the node, channel 0 has been closed since
+			"1": {Payer: payer, Target: target, Channel: types.NewChannelID(1), Amount: types.NewAttoFILFromFIL(10), AmountRedeemed: types.ZeroAttoFIL, Eol: types.NewBlockHeight(50)},
+			"0": {Payer: payer, Target: target, Channel: types.NewChannelID(0), Amount: types.NewAttoFILFromFIL(5), AmountRedeemed: types.ZeroAttoFIL, Eol: types.NewBlockHeight(20)},
+		},
+	}
+}
+
+func TestPaymentChannelStatus(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	plumbing := newTestPaymentChannelStatusPlumbing(require)
+
+	channels, err := porcelain.PaymentChannelStatus(context.Background(), plumbing)
+	require.NoError(err)
+	require.Len(channels, 3)
+
+	assert.Equal(types.NewChannelID(0), channels[0].Channel)
+	assert.True(channels[0].Closed)
+
+	assert.Equal(types.NewChannelID(1), channels[1].Channel)
+	assert.False(channels[1].Closed)
+	assert.Equal(types.NewAttoFILFromFIL(4), channels[1].AmountRedeemed)
+
+	assert.Equal(types.NewChannelID(2), channels[2].Channel)
+	assert.Equal(plumbing.payer, channels[2].Payer)
+	assert.Equal(types.NewAttoFILFromFIL(20), channels[2].Amount)
+
+	// the store is brought up to date
+	assert.Len(plumbing.records, 3)
+	assert.True(plumbing.records["0"].Closed)
+}
+
+func TestPaymentChannelReclaimExpired(t *testing.T) {
+	t.Parallel()
+
+	t.Run("does nothing before eol", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		plumbing := newTestPaymentChannelStatusPlumbing(require)
+		plumbing.records["0"].Closed = true
+
+		reclaimed, err := porcelain.PaymentChannelReclaimExpired(context.Background(), plumbing, types.NewBlockHeight(49))
+		require.NoError(err)
+		assert.Empty(reclaimed)
+		assert.Empty(plumbing.sent)
+	})
+
+	t.Run("reclaims expired channels until they are gone", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx := context.Background()
+
+		plumbing := newTestPaymentChannelStatusPlumbing(require)
+
+		reclaimed, err := porcelain.PaymentChannelReclaimExpired(ctx, plumbing, types.NewBlockHeight(50))
+		require.NoError(err)
+		require.Len(reclaimed, 1)
+		assert.Equal(types.NewChannelID(1), reclaimed[0].Channel)
+		assert.Equal(types.NewBlockHeight(50), plumbing.records["1"].ReclaimedAt)
+		require.Len(plumbing.sent, 1)
+
+		// the reclaim is given time to land on chain
+		reclaimed, err = porcelain.PaymentChannelReclaimExpired(ctx, plumbing, types.NewBlockHeight(55))
+		require.NoError(err)
+		assert.Empty(reclaimed)
+		assert.Len(plumbing.sent, 1)
+
+		// and sent again if it did not
+		reclaimed, err = porcelain.PaymentChannelReclaimExpired(ctx, plumbing, types.NewBlockHeight(60))
+		require.NoError(err)
+		assert.Len(reclaimed, 1)
+		assert.Len(plumbing.sent, 2)
+
+		// once the channel is gone it is closed
+		delete(plumbing.channels, "1")
+		reclaimed, err = porcelain.PaymentChannelReclaimExpired(ctx, plumbing, types.NewBlockHeight(70))
+		require.NoError(err)
+		assert.Empty(reclaimed)
+		assert.True(plumbing.records["1"].Closed)
 	})
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/plumbing/paychs"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -22,6 +23,7 @@ type cpPlumbing interface {
 	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
 	ChainLs(ctx context.Context) <-chan interface{}
 	SignBytes(data []byte, addr address.Address) (types.Signature, error)
+	PaychPut(channel *paychs.ChannelInfo) error
 }
 
 // CreatePaymentsParams structures all the parameters for the CreatePayments command. All values are required.
@@ -160,6 +162,22 @@ func CreatePayments(ctx context.Context, plumbing cpPlumbing, config CreatePayme
 		}
 	}
 
+	// keep track of the channel and the vouchers issued on it
+	record := &paychs.ChannelInfo{
+		Payer:          config.From,
+		Target:         config.To,
+		Channel:        response.Channel,
+		Amount:         &config.Value,
+		AmountRedeemed: types.ZeroAttoFIL,
+		Eol:            &config.ChannelExpiry,
+	}
+	for _, voucher := range response.Vouchers {
+		record.AddVoucher(voucher)
+	}
+	if err := plumbing.PaychPut(record); err != nil {
+		return response, errors.Wrap(err, "failed to record payment channel")
+	}
+
 	return response, nil
 }
 
@@ -170,7 +188,8 @@ func createPayment(ctx context.Context, plumbing cpPlumbing, response *CreatePay
 		"voucher",
 		response.Channel,
 		amount,
-		validAt)
+		validAt,
+		big.NewInt(0))
 	if err != nil {
 		return err
 	}
@@ -180,7 +199,10 @@ func createPayment(ctx context.Context, plumbing cpPlumbing, response *CreatePay
 		return err
 	}
 
-	sig, err := paymentbroker.SignVoucher(&voucher.Channel, amount, validAt, voucher.Payer, plumbing)
+	// The channel is new, so each payment is the next voucher on its only lane.
+	voucher.Nonce = uint64(len(response.Vouchers)) + 1
+
+	sig, err := paymentbroker.SignVoucher(&voucher, voucher.Payer, plumbing)
 	if err != nil {
 		return err
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/plumbing/paychs"
 	"github.com/filecoin-project/go-filecoin/types"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
@@ -24,8 +25,9 @@ const (
 )
 
 type paymentsTestPlumbing struct {
-	tipSets []*types.TipSet
-	msgCid  cid.Cid
+	tipSets  []*types.TipSet
+	msgCid   cid.Cid
+	channels []*paychs.ChannelInfo
 
 	messageSend  func(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
 	messageWait  func(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
@@ -107,6 +109,11 @@ func (ptp *paymentsTestPlumbing) SignBytes(data []byte, addr address.Address) (t
 	return []byte("signature"), nil
 }
 
+func (ptp *paymentsTestPlumbing) PaychPut(channel *paychs.ChannelInfo) error {
+	ptp.channels = append(ptp.channels, channel)
+	return nil
+}
+
 func validPaymentsConfig() CreatePaymentsParams {
 	addresses := address.NewForTestGetter()
 	from := addresses()
@@ -157,6 +164,8 @@ func TestCreatePayments(t *testing.T) {
 			assert.Equal(config.To, voucher.Target)
 			assert.Equal(*types.NewBlockHeight(startingBlock).Add(types.NewBlockHeight(config.PaymentInterval * uint64(i+1))), voucher.ValidAt)
 			assert.Equal(*expectedValuePerPayment.MulBigInt(big.NewInt(int64(i + 1))), voucher.Amount)
+			assert.Equal(uint64(0), voucher.Lane)
+			assert.Equal(uint64(i+1), voucher.Nonce)
 
 			// voucher signature should be what is returned by SignBytes
 
@@ -169,6 +178,19 @@ func TestCreatePayments(t *testing.T) {
 		assert.Equal(config.From, paymentResponse.Vouchers[9].Payer)
 		assert.Equal(config.To, paymentResponse.Vouchers[9].Target)
 		assert.Equal(config.Value, paymentResponse.Vouchers[9].Amount)
+		assert.Equal(uint64(10), paymentResponse.Vouchers[9].Nonce)
+
+		// the channel is recorded with its vouchers
+		require.NotEmpty(successPlumbing.channels)
+		channel := successPlumbing.channels[len(successPlumbing.channels)-1]
+		assert.Equal(config.From, channel.Payer)
+		assert.Equal(config.To, channel.Target)
+		assert.Equal(types.NewChannelID(channelID), channel.Channel)
+		assert.Equal(&config.Value, channel.Amount)
+		assert.Equal(&config.ChannelExpiry, channel.Eol)
+		assert.Equal(paymentResponse.Vouchers, channel.Vouchers)
+		assert.Equal(uint64(10), channel.LastNonce)
+		assert.Equal(&config.Value, channel.AmountCommitted)
 	})
 
 	t.Run("Validates from", func(t *testing.T) {
@@ -1,8 +1,16 @@
 package porcelain
 
 import (
+	"context"
+	"math/big"
+
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 )
 
@@ -23,3 +31,24 @@ func DealGet(plumbing strgdlsPlumbing, dealCid cid.Cid) *storagedeal.Deal {
 	}
 	return nil
 }
+
+// smgdAPI is the subset of the plumbing.API that StorageMarketGetDeal uses.
+type smgdAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+// StorageMarketGetDeal queries the storage market for the deal published
+// under the given id
+func StorageMarketGetDeal(ctx context.Context, plumbing smgdAPI, dealID uint64) (*storagemarket.Deal, error) {
+	ret, _, err := plumbing.MessageQuery(ctx, address.Address{}, address.StorageMarketAddress, "getDeal", big.NewInt(0).SetUint64(dealID))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query deal %d", dealID)
+	}
+
+	var deal storagemarket.Deal
+	if err := cbor.DecodeInto(ret[0], &deal); err != nil {
+		return nil, errors.Wrap(err, "failed to decode deal")
+	}
+
+	return &deal, nil
+}
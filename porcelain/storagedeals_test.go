@@ -0,0 +1,61 @@
+package porcelain_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type testStorageMarketGetDealPlumbing struct {
+	require *require.Assertions
+	dealID  uint64
+	deal    *storagemarket.Deal
+}
+
+func (p *testStorageMarketGetDealPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	p.require.Equal(address.StorageMarketAddress, to)
+	p.require.Equal("getDeal", method)
+	p.require.Equal(big.NewInt(0).SetUint64(p.dealID), params[0])
+
+	dealBytes, err := cbor.DumpObject(p.deal)
+	p.require.NoError(err)
+	return [][]byte{dealBytes}, nil, nil
+}
+
+func TestStorageMarketGetDeal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addrGetter := address.NewForTestGetter()
+	deal := &storagemarket.Deal{
+		Client:     addrGetter(),
+		Miner:      addrGetter(),
+		PieceRef:   types.NewCidForTestGetter()(),
+		Size:       types.NewBytesAmount(1000),
+		Duration:   100,
+		Price:      types.NewAttoFILFromFIL(5),
+		Collateral: types.NewAttoFILFromFIL(2),
+		State:      storagemarket.DealActive,
+		SectorID:   4,
+		Start:      types.NewBlockHeight(10),
+	}
+	plumbing := &testStorageMarketGetDealPlumbing{require: require, dealID: 3, deal: deal}
+
+	got, err := porcelain.StorageMarketGetDeal(context.Background(), plumbing, 3)
+	require.NoError(err)
+	assert.Equal(deal.Client, got.Client)
+	assert.Equal(deal.PieceRef, got.PieceRef)
+	assert.Equal(storagemarket.DealActive, got.State)
+	assert.Equal(uint64(4), got.SectorID)
+	assert.True(deal.Collateral.Equal(got.Collateral))
+}
@@ -0,0 +1,158 @@
+package proofs
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+)
+
+// A piece is written into a sector in 127 byte chunks, each padded to 128
+// bytes so that every 32 byte node of the tree holds at most 254 bits, which
+// fits in a field element. The piece is then padded with zeros to a power of
+// two number of nodes and the commitment is the root of the binary tree over
+// them, hashed with sha256 truncated to 254 bits.
+const (
+	unpaddedChunkSize = 127
+	paddedChunkSize   = 128
+
+	// MinPaddedPieceSize is the size of the smallest padded piece.
+	MinPaddedPieceSize = uint64(paddedChunkSize)
+)
+
+// PaddedPieceSize returns the number of bytes a piece of the given size takes
+// once padded.
+func PaddedPieceSize(size uint64) uint64 {
+	chunks := (size + unpaddedChunkSize - 1) / unpaddedChunkSize
+	padded := MinPaddedPieceSize
+	for padded < chunks*paddedChunkSize {
+		padded <<= 1
+	}
+	return padded
+}
+
+// GeneratePieceCommitment computes the commitment of the piece read from r,
+// which must hold size bytes.
+func GeneratePieceCommitment(r io.Reader, size uint64) (CommP, error) {
+	if size == 0 {
+		return CommP{}, errors.New("cannot commit to an empty piece")
+	}
+
+	var tree pieceTree
+	in := make([]byte, unpaddedChunkSize)
+	out := make([]byte, paddedChunkSize)
+	for read := uint64(0); read < size; read += unpaddedChunkSize {
+		n := size - read
+		if n > unpaddedChunkSize {
+			n = unpaddedChunkSize
+		}
+		for i := range in {
+			in[i] = 0
+		}
+		if _, err := io.ReadFull(r, in[:n]); err != nil {
+			return CommP{}, errors.Wrapf(err, "failed to read piece after %d bytes", read)
+		}
+
+		padChunk(in, out)
+		for i := 0; i < paddedChunkSize; i += int(CommitmentBytesLen) {
+			var leaf [CommitmentBytesLen]byte
+			copy(leaf[:], out[i:])
+			tree.add(leaf)
+		}
+	}
+
+	return tree.root(PaddedPieceSize(size) / uint64(CommitmentBytesLen)), nil
+}
+
+// padChunk spreads the 1016 bits of a 127 byte chunk over four 254 bit
+// nodes, leaving the two top bits of each node zero.
+func padChunk(in, out []byte) {
+	copy(out[:31], in[:31])
+	t := in[31] >> 6
+	out[31] = in[31] & 0x3f
+
+	var v byte
+	for i := 32; i < 64; i++ {
+		v = in[i]
+		out[i] = (v << 2) | t
+		t = v >> 6
+	}
+	t = v >> 4
+	out[63] &= 0x3f
+
+	for i := 64; i < 96; i++ {
+		v = in[i]
+		out[i] = (v << 4) | t
+		t = v >> 4
+	}
+	t = v >> 2
+	out[95] &= 0x3f
+
+	for i := 96; i < 127; i++ {
+		v = in[i]
+		out[i] = (v << 6) | t
+		t = v >> 2
+	}
+	out[127] = t & 0x3f
+}
+
+// pieceTree computes the root of the tree over the nodes of a piece as they
+// are added, keeping only the pending left node of each level.
+type pieceTree struct {
+	pending []*[CommitmentBytesLen]byte
+}
+
+func (pt *pieceTree) add(leaf [CommitmentBytesLen]byte) {
+	pt.carry(0, leaf)
+}
+
+// carry places the node at the level, hashing it with the pending left node
+// of the level and moving up as long as there is one.
+func (pt *pieceTree) carry(level int, node [CommitmentBytesLen]byte) {
+	for ; ; level++ {
+		if level == len(pt.pending) {
+			pt.pending = append(pt.pending, nil)
+		}
+		left := pt.pending[level]
+		if left == nil {
+			pt.pending[level] = &node
+			return
+		}
+		pt.pending[level] = nil
+		node = hashNodes(*left, node)
+	}
+}
+
+// root returns the root of the tree once padded with zero nodes to the given
+// number of leaves, a power of two at least as large as the leaves added.
+func (pt *pieceTree) root(leaves uint64) CommP {
+	height := 0
+	for n := leaves; n > 1; n >>= 1 {
+		height++
+	}
+
+	// pair every pending left node with the zero subtree of its level
+	var zero [CommitmentBytesLen]byte
+	for level := 0; level < height; level++ {
+		if level < len(pt.pending) && pt.pending[level] != nil {
+			pt.carry(level, zero)
+		}
+		zero = hashNodes(zero, zero)
+	}
+
+	if height >= len(pt.pending) || pt.pending[height] == nil {
+		return CommP(zero)
+	}
+	return CommP(*pt.pending[height])
+}
+
+func hashNodes(left, right [CommitmentBytesLen]byte) [CommitmentBytesLen]byte {
+	h := sha256.New()
+	h.Write(left[:])  // nolint: errcheck
+	h.Write(right[:]) // nolint: errcheck
+
+	var node [CommitmentBytesLen]byte
+	copy(node[:], h.Sum(nil))
+	node[CommitmentBytesLen-1] &= 0x3f
+	return node
+}
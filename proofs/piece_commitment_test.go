@@ -0,0 +1,60 @@
+package proofs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+func TestPaddedPieceSize(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(uint64(128), PaddedPieceSize(1))
+	assert.Equal(uint64(128), PaddedPieceSize(127))
+	assert.Equal(uint64(256), PaddedPieceSize(128))
+	assert.Equal(uint64(256), PaddedPieceSize(254))
+	assert.Equal(uint64(512), PaddedPieceSize(255))
+	assert.Equal(uint64(1024*1024), PaddedPieceSize(1024*1024/128*127))
+}
+
+func TestGeneratePieceCommitment(t *testing.T) {
+	t.Run("commits to a zero piece", func(t *testing.T) {
+		require := require.New(t)
+
+		commP, err := GeneratePieceCommitment(bytes.NewReader(make([]byte, 127)), 127)
+		require.NoError(err)
+		assert.Equal(t, "3731bb99ac689f66eef5973e4a94da188f4ddcae580724fc6f3fd60dfd488333", hex.EncodeToString(commP[:]))
+
+		// a shorter piece is padded with zeros
+		short, err := GeneratePieceCommitment(bytes.NewReader(make([]byte, 3)), 3)
+		require.NoError(err)
+		assert.Equal(t, commP, short)
+	})
+
+	t.Run("commits to the data", func(t *testing.T) {
+		require := require.New(t)
+
+		data := bytes.Repeat([]byte("filecoin"), 1000)
+		commP, err := GeneratePieceCommitment(bytes.NewReader(data), uint64(len(data)))
+		require.NoError(err)
+
+		data[4321] ^= 1
+		other, err := GeneratePieceCommitment(bytes.NewReader(data), uint64(len(data)))
+		require.NoError(err)
+		assert.NotEqual(t, commP, other)
+
+		// the top two bits of the root are always clear
+		assert.Equal(t, byte(0), commP[CommitmentBytesLen-1]&0xc0)
+	})
+
+	t.Run("fails if the piece is shorter than its size", func(t *testing.T) {
+		_, err := GeneratePieceCommitment(bytes.NewReader(make([]byte, 100)), 200)
+		assert.Error(t, err)
+
+		_, err = GeneratePieceCommitment(bytes.NewReader(nil), 0)
+		assert.Error(t, err)
+	})
+}
@@ -32,3 +32,7 @@ type CommD [CommitmentBytesLen]byte
 // CommRStar is a hash of intermediate layers. It is an output of the sector
 // sealing (PoRep) process.
 type CommRStar [CommitmentBytesLen]byte
+
+// CommP is the merkle root of a piece, padded as it is written into a sector.
+// It is computed by the client before proposing a deal for the piece.
+type CommP [CommitmentBytesLen]byte
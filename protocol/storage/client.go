@@ -2,12 +2,16 @@ package storage
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
@@ -17,9 +21,11 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/util/convert"
@@ -52,9 +58,13 @@ const (
 
 type clientNode interface {
 	GetFileSize(context.Context, cid.Cid) (uint64, error)
+	GetPieceCommitment(ctx context.Context, c cid.Cid, size uint64) (proofs.CommP, error)
 	MakeProtocolRequest(ctx context.Context, protocol protocol.ID, peer peer.ID, request interface{}, response interface{}) error
 	GetBlockTime() time.Duration
 	Ping(ctx context.Context, p peer.ID) (<-chan time.Duration, error)
+	DAGService() ipld.DAGService
+	NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error)
+	SetStreamHandler(pid protocol.ID, handler inet.StreamHandler)
 }
 
 type clientPorcelainAPI interface {
@@ -67,26 +77,84 @@ type clientPorcelainAPI interface {
 	MinerGetAsk(ctx context.Context, minerAddr address.Address, askID uint64) (miner.Ask, error)
 	MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
 	MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error)
+	PieceGet(ref cid.Cid) (*storagedeal.Piece, error)
+	PiecePut(piece *storagedeal.Piece) error
+	ReplicationGet(pieceRef cid.Cid) (*storagedeal.Replication, error)
+	ReplicationPut(replication *storagedeal.Replication) error
+	StorageMarketAsks(ctx context.Context, filter porcelain.AskFilter) ([]porcelain.StorageAsk, error)
 	types.Signer
 }
 
 // Client is used to make deals directly with storage miners.
 type Client struct {
-	node clientNode
-	api  clientPorcelainAPI
+	node   clientNode
+	api    clientPorcelainAPI
+	events *storagedeal.EventBus
+
+	// replicationsLk serializes the updates of replication records and
+	// guards storing
+	replicationsLk sync.Mutex
+	// storing holds the pieces being stored by Store, keyed by cid
+	storing map[string]bool
 }
 
 // NewClient creates a new storage client.
 func NewClient(nd clientNode, api clientPorcelainAPI) (*Client, error) {
 	smc := &Client{
-		node: nd,
-		api:  api,
+		node:   nd,
+		api:    api,
+		events: storagedeal.NewEventBus(),
 	}
+
+	nd.SetStreamHandler(dataPullProtocol, smc.handleDataPull)
+
 	return smc, nil
 }
 
+// ImportPiece records the size and commitment of imported data. They are
+// computed once, here, and used by every deal for the data. Empty data cannot
+// be stored and is not recorded.
+func (smc *Client) ImportPiece(ctx context.Context, data cid.Cid) (*storagedeal.Piece, error) {
+	size, err := smc.node.GetFileSize(ctx, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to determine the size of the data")
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	commP, err := smc.node.GetPieceCommitment(ctx, data, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute the piece commitment of the data")
+	}
+
+	piece := &storagedeal.Piece{Ref: data, Size: types.NewBytesAmount(size), Commitment: commP[:]}
+	if err := smc.api.PiecePut(piece); err != nil {
+		return nil, err
+	}
+	return piece, nil
+}
+
+// piece returns the record of the data, recording it first if the data was
+// not imported with ImportPiece.
+func (smc *Client) piece(ctx context.Context, data cid.Cid) (*storagedeal.Piece, error) {
+	piece, err := smc.api.PieceGet(data)
+	if err != nil {
+		return nil, err
+	}
+	if piece == nil {
+		if piece, err = smc.ImportPiece(ctx, data); err != nil {
+			return nil, err
+		}
+	}
+	if piece == nil {
+		return nil, errors.New("cannot store empty data")
+	}
+	return piece, nil
+}
+
 // ProposeDeal is
-func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data cid.Cid, askID uint64, duration uint64, allowDuplicates bool) (*storagedeal.Response, error) {
+func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data cid.Cid, askID uint64, duration uint64, transferMode storagedeal.TransferMode, allowDuplicates bool) (*storagedeal.Response, error) {
 	ctx, cancel := context.WithTimeout(ctx, 4*smc.node.GetBlockTime())
 	defer cancel()
 
@@ -101,10 +169,11 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		minerAlive <- smc.pingMiner(ctx, pid, 15*time.Second)
 	}()
 
-	size, err := smc.node.GetFileSize(ctx, data)
+	piece, err := smc.piece(ctx, data)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to determine the size of the data")
+		return nil, err
 	}
+	size := piece.Size.Uint64()
 
 	ask, err := smc.api.MinerGetAsk(ctx, miner, askID)
 	if err != nil {
@@ -135,6 +204,10 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		TotalPrice:   totalPrice,
 		Duration:     duration,
 		MinerAddress: miner,
+		TransferMode: transferMode,
+
+		PieceCommitment: piece.Commitment,
+		PaddedSize:      types.NewBytesAmount(proofs.PaddedPieceSize(size)),
 	}
 
 	if smc.isMaybeDupDeal(proposal) && !allowDuplicates {
@@ -172,6 +245,18 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	proposal.Payment.ChannelMsgCid = &cpResp.ChannelMsgCid
 	proposal.Payment.Vouchers = cpResp.Vouchers
 
+	// sign the terms the miner will publish to the storage market, with a
+	// random nonce so that the signature cannot be used for another deal
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, errors.Wrap(err, "failed to generate deal nonce")
+	}
+	proposal.ClientNonce = binary.BigEndian.Uint64(nonce[:])
+	proposal.DealSignature, err = storagemarket.SignDeal(fromAddress, miner, data, proposal.Size, duration, totalPrice, proposal.ClientNonce, smc.api)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign deal terms")
+	}
+
 	signedProposal, err := proposal.NewSignedProposal(fromAddress, smc.api)
 	if err != nil {
 		return nil, err
@@ -188,11 +273,15 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		return nil, errors.Wrap(err, "response check failed")
 	}
 
-	// Note: currently the miner requests the data out of band
-
 	if err := smc.recordResponse(&response, miner, proposal); err != nil {
 		return nil, errors.Wrap(err, "failed to track response")
 	}
+	smc.events.Publish(&storagedeal.Event{ProposalCid: response.ProposalCid, Kind: storagedeal.StateChanged, State: response.State, Message: response.Message})
+
+	// The miner pulls the data, unless we push it or it goes out of band
+	if transferMode == storagedeal.TransferPush {
+		go smc.pushDealData(context.Background(), pid, response.ProposalCid, data)
+	}
 
 	return &response, nil
 }
@@ -278,6 +367,14 @@ func (smc *Client) QueryDeal(ctx context.Context, proposalCid cid.Cid) (*storage
 		return nil, errors.Wrap(err, "error querying deal")
 	}
 
+	if deal := smc.api.DealGet(proposalCid); deal != nil && deal.Response.State != resp.State {
+		e := &storagedeal.Event{ProposalCid: proposalCid, Kind: storagedeal.StateChanged, State: resp.State, Message: resp.Message}
+		if resp.ProofInfo != nil {
+			e.SectorID = resp.ProofInfo.SectorID
+		}
+		smc.receiveDealEvent(e)
+	}
+
 	return &resp, nil
 }
 
@@ -331,6 +428,28 @@ func (cni *ClientNodeImpl) GetFileSize(ctx context.Context, c cid.Cid) (uint64,
 	return getFileSize(ctx, c, cni.dserv)
 }
 
+// GetPieceCommitment returns the commitment of the piece referenced by 'c',
+// of the given size
+func (cni *ClientNodeImpl) GetPieceCommitment(ctx context.Context, c cid.Cid, size uint64) (proofs.CommP, error) {
+	return pieceCommitment(ctx, cni.dserv, c, size)
+}
+
+// DAGService returns the DAG service holding the data of the client.
+func (cni *ClientNodeImpl) DAGService() ipld.DAGService {
+	return cni.dserv
+}
+
+// NewStream opens a stream to the peer with the first of the protocols it
+// supports.
+func (cni *ClientNodeImpl) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	return cni.host.NewStream(ctx, p, pids...)
+}
+
+// SetStreamHandler sets the handler of the streams opened with the protocol.
+func (cni *ClientNodeImpl) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	cni.host.SetStreamHandler(pid, handler)
+}
+
 // MakeProtocolRequest makes a request and expects a response from the host using the given protocol.
 func (cni *ClientNodeImpl) MakeProtocolRequest(ctx context.Context, protocol protocol.ID, peer peer.ID, request interface{}, response interface{}) error {
 	s, err := cni.host.NewStream(ctx, peer, protocol)
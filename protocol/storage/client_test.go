@@ -3,13 +3,18 @@ package storage
 import (
 	"context"
 	"math/big"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
@@ -19,12 +24,15 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/util/convert"
 )
 
 var testSignature = types.Signature("<test signature>")
 
+var testPieceCommitment = proofs.CommP{1, 2, 3}
+
 func TestProposeDeal(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
@@ -57,7 +65,7 @@ func TestProposeDeal(t *testing.T) {
 	ctx := context.Background()
 	askID := uint64(67)
 	duration := uint64(10000)
-	dealResponse, err := client.ProposeDeal(ctx, minerAddr, dataCid, askID, duration, false)
+	dealResponse, err := client.ProposeDeal(ctx, minerAddr, dataCid, askID, duration, storagedeal.TransferPull, false)
 	require.NoError(err)
 
 	t.Run("and creates proposal from parameters", func(t *testing.T) {
@@ -73,6 +81,11 @@ func TestProposeDeal(t *testing.T) {
 		assert.Equal(types.NewBytesAmount(expectedFileSize), proposal.Size)
 	})
 
+	t.Run("and commits to the padded piece", func(t *testing.T) {
+		assert.Equal(testPieceCommitment[:], proposal.PieceCommitment)
+		assert.Equal(types.NewBytesAmount(1<<30), proposal.PaddedSize)
+	})
+
 	t.Run("and computes the correct total price", func(t *testing.T) {
 		expectedAskPrice := types.NewAttoFILFromFIL(32) // from test plumbing
 		expectedFileSize, err := testNode.GetFileSize(ctx, dataCid)
@@ -102,6 +115,16 @@ func TestProposeDeal(t *testing.T) {
 		}
 	})
 
+	t.Run("and computes the piece commitment once", func(t *testing.T) {
+		_, err := client.ProposeDeal(ctx, addressCreator(), dataCid, askID, duration, storagedeal.TransferPull, true)
+		require.NoError(err)
+		assert.Equal(int32(1), atomic.LoadInt32(&testNode.commitments))
+
+		piece, err := testAPI.PieceGet(dataCid)
+		require.NoError(err)
+		assert.Equal(testPieceCommitment[:], piece.Commitment)
+	})
+
 	t.Run("and sends proposal and stores response", func(t *testing.T) {
 		assert.NotNil(dealResponse)
 
@@ -121,7 +144,14 @@ type clientTestAPI struct {
 	target      address.Address
 	perPayment  *types.AttoFIL
 	require     *require.Assertions
-	deals       map[cid.Cid]*storagedeal.Deal
+	asks        []porcelain.StorageAsk
+
+	// lk guards the deals, pieces and replications, replicas are proposed
+	// in parallel
+	lk           sync.Mutex
+	deals        map[cid.Cid]*storagedeal.Deal
+	pieces       map[cid.Cid]*storagedeal.Piece
+	replications map[cid.Cid]*storagedeal.Replication
 }
 
 func newTestClientAPI(require *require.Assertions) *clientTestAPI {
@@ -195,6 +225,9 @@ func (ctp *clientTestAPI) SignBytes(data []byte, addr address.Address) (types.Si
 
 type testClientNode struct {
 	responder func(request interface{}) (interface{}, error)
+
+	// commitments counts the piece commitments computed
+	commitments int32
 }
 
 func newTestClientNode(responder func(request interface{}) (interface{}, error)) *testClientNode {
@@ -211,6 +244,11 @@ func (tcn *testClientNode) GetFileSize(context.Context, cid.Cid) (uint64, error)
 	return 1000000000, nil
 }
 
+func (tcn *testClientNode) GetPieceCommitment(ctx context.Context, c cid.Cid, size uint64) (proofs.CommP, error) {
+	atomic.AddInt32(&tcn.commitments, 1)
+	return testPieceCommitment, nil
+}
+
 func (tcn *testClientNode) MakeProtocolRequest(ctx context.Context, protocol protocol.ID, peer peer.ID, request interface{}, response interface{}) error {
 	dealResponse := response.(*storagedeal.Response)
 	res, err := tcn.responder(request)
@@ -228,7 +266,20 @@ func (tcn *testClientNode) Ping(ctx context.Context, p peer.ID) (<-chan time.Dur
 	return out, nil
 }
 
+func (tcn *testClientNode) DAGService() ipld.DAGService {
+	return nil
+}
+
+func (tcn *testClientNode) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	return nil, errors.New("no streams in test client node")
+}
+
+func (tcn *testClientNode) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {}
+
 func (ctp *clientTestAPI) DealsLs() ([]*storagedeal.Deal, error) {
+	ctp.lk.Lock()
+	defer ctp.lk.Unlock()
+
 	var results []*storagedeal.Deal
 
 	for _, storageDeal := range ctp.deals {
@@ -238,10 +289,62 @@ func (ctp *clientTestAPI) DealsLs() ([]*storagedeal.Deal, error) {
 }
 
 func (ctp *clientTestAPI) DealGet(dealCid cid.Cid) *storagedeal.Deal {
+	ctp.lk.Lock()
+	defer ctp.lk.Unlock()
+
 	return ctp.deals[dealCid]
 }
 
 func (ctp *clientTestAPI) DealPut(storageDeal *storagedeal.Deal) error {
+	ctp.lk.Lock()
+	defer ctp.lk.Unlock()
+
 	ctp.deals[storageDeal.Response.ProposalCid] = storageDeal
 	return nil
 }
+
+func (ctp *clientTestAPI) StorageMarketAsks(ctx context.Context, filter porcelain.AskFilter) ([]porcelain.StorageAsk, error) {
+	var asks []porcelain.StorageAsk
+	for _, ask := range ctp.asks {
+		if filter.MaxPrice == nil || !ask.Price.GreaterThan(filter.MaxPrice) {
+			asks = append(asks, ask)
+		}
+	}
+	return asks, nil
+}
+
+func (ctp *clientTestAPI) PieceGet(ref cid.Cid) (*storagedeal.Piece, error) {
+	ctp.lk.Lock()
+	defer ctp.lk.Unlock()
+
+	return ctp.pieces[ref], nil
+}
+
+func (ctp *clientTestAPI) PiecePut(piece *storagedeal.Piece) error {
+	ctp.lk.Lock()
+	defer ctp.lk.Unlock()
+
+	if ctp.pieces == nil {
+		ctp.pieces = make(map[cid.Cid]*storagedeal.Piece)
+	}
+	ctp.pieces[piece.Ref] = piece
+	return nil
+}
+
+func (ctp *clientTestAPI) ReplicationGet(pieceRef cid.Cid) (*storagedeal.Replication, error) {
+	ctp.lk.Lock()
+	defer ctp.lk.Unlock()
+
+	return ctp.replications[pieceRef], nil
+}
+
+func (ctp *clientTestAPI) ReplicationPut(replication *storagedeal.Replication) error {
+	ctp.lk.Lock()
+	defer ctp.lk.Unlock()
+
+	if ctp.replications == nil {
+		ctp.replications = make(map[cid.Cid]*storagedeal.Replication)
+	}
+	ctp.replications[replication.PieceRef] = replication
+	return nil
+}
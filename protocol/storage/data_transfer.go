@@ -0,0 +1,627 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	offline "gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	"gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/util/convert"
+)
+
+// dataPullProtocol is served by clients: the miner of a deal pulls its data.
+const dataPullProtocol = protocol.ID("/fil/storage/pull/1.0.0")
+
+// dataPushProtocol is served by miners: the client of a deal pushes its data.
+const dataPushProtocol = protocol.ID("/fil/storage/push/1.0.0")
+
+// dataTransferFragmentSize is the largest amount of block data sent in one
+// message, blocks larger than that are split.
+const dataTransferFragmentSize = 128 << 10
+
+// maxDataTransferBlockSize is the largest block accepted in a transfer.
+const maxDataTransferBlockSize = 1 << 20
+
+// dataTransferProgressInterval is the number of blocks received between
+// records of the progress of a transfer. An interrupted transfer restarts
+// after the last recorded block.
+const dataTransferProgressInterval = 16
+
+// dataTransferAttempts is the number of times a transfer is tried before the
+// side driving it gives up.
+const dataTransferAttempts = 5
+
+const dataTransferRetryInterval = 30 * time.Second
+
+// dataTransferReadTimeout is how long a side of a transfer waits for the next
+// message before giving up on the stream.
+const dataTransferReadTimeout = time.Minute
+
+// waitForDealDataDuration is how long a miner waits for the client of a deal
+// to push its data.
+const waitForDealDataDuration = time.Hour
+
+// waitForManualDealDataDuration is how long a miner waits for the data of a
+// deal transferred manually to be imported, which takes the time to ship it.
+const waitForManualDealDataDuration = 30 * 24 * time.Hour
+
+func init() {
+	cbor.RegisterCborType(dataTransferRequest{})
+	cbor.RegisterCborType(dataTransferHeader{})
+	cbor.RegisterCborType(dataTransferBlock{})
+}
+
+// dataTransferRequest opens the transfer of the data of a deal.
+type dataTransferRequest struct {
+	ProposalCid cid.Cid
+	// Offset is the number of blocks of the piece, in transfer order, the
+	// miner already has. Pulls only, the miner answers a push with it.
+	Offset uint64
+}
+
+// dataTransferHeader answers a request, refusing it if Error is set. The
+// miner answers a push with the offset to start at, and the side sending the
+// data precedes the blocks with their total number and size.
+type dataTransferHeader struct {
+	Error  string
+	Offset uint64
+	Blocks uint64
+	Bytes  uint64
+}
+
+// dataTransferBlock carries a block of the piece or, for blocks larger than
+// dataTransferFragmentSize, a part of it. The parts of a block are sent in
+// order and the last one has Last set.
+type dataTransferBlock struct {
+	Cid  cid.Cid
+	Data []byte
+	Last bool
+}
+
+// pieceBlocks returns the cids of the blocks of the piece in transfer order,
+// depth first and each block once, and the total size of their data.
+func pieceBlocks(ctx context.Context, ng ipld.NodeGetter, root cid.Cid) ([]cid.Cid, uint64, error) {
+	var order []cid.Cid
+	var size uint64
+	seen := cid.NewSet()
+
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if !seen.Visit(c) {
+			return nil
+		}
+		order = append(order, c)
+
+		nd, err := ng.Get(ctx, c)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get block %s", c)
+		}
+		size += uint64(len(nd.RawData()))
+		for _, link := range nd.Links() {
+			if err := walk(link.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root); err != nil {
+		return nil, 0, err
+	}
+	return order, size, nil
+}
+
+// dataTransferLimit returns the largest number of bytes of blocks accepted for
+// the piece of the proposal. The blocks hold the data of the piece and the
+// links and encoding of its DAG, which amount to much less than an eighth of
+// the data for pieces of any size.
+func dataTransferLimit(p *storagedeal.Proposal) uint64 {
+	size := p.Size.Uint64()
+	return size + size/8 + maxDataTransferBlockSize
+}
+
+// timeoutReader reads from a stream, failing reads that wait for more than
+// dataTransferReadTimeout so that a stalled peer does not hold the transfer.
+type timeoutReader struct {
+	s inet.Stream
+}
+
+func (tr timeoutReader) Read(p []byte) (int, error) {
+	if err := tr.s.SetReadDeadline(time.Now().Add(dataTransferReadTimeout)); err != nil {
+		return 0, err
+	}
+	return tr.s.Read(p)
+}
+
+// sendPiece streams the blocks of the piece following the first offset ones,
+// preceded by a header with the number and size of the blocks of the piece.
+func sendPiece(ctx context.Context, w *cbu.MsgWriter, ng ipld.NodeGetter, root cid.Cid, offset uint64) error {
+	order, size, err := pieceBlocks(ctx, ng, root)
+	if err != nil {
+		w.WriteMsg(&dataTransferHeader{Error: "failed to read the data of the deal"}) // nolint: errcheck
+		return err
+	}
+
+	if err := w.WriteMsg(&dataTransferHeader{Blocks: uint64(len(order)), Bytes: size}); err != nil {
+		return errors.Wrap(err, "failed to write transfer header")
+	}
+
+	for i := offset; i < uint64(len(order)); i++ {
+		nd, err := ng.Get(ctx, order[i])
+		if err != nil {
+			return errors.Wrapf(err, "failed to get block %s", order[i])
+		}
+
+		data := nd.RawData()
+		for {
+			n := len(data)
+			if n > dataTransferFragmentSize {
+				n = dataTransferFragmentSize
+			}
+			msg := &dataTransferBlock{Cid: order[i], Data: data[:n], Last: n == len(data)}
+			if err := w.WriteMsg(msg); err != nil {
+				return errors.Wrapf(err, "failed to write block %s", order[i])
+			}
+			data = data[n:]
+			if msg.Last {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// receivePiece reads the blocks streamed by sendPiece into the block service,
+// checking each against its cid. A piece of more than limit bytes is refused
+// and reading stops once the blocks exceed the size announced by the sender.
+// Progress counts from start, whose Blocks is the offset the sender starts at.
+// It is passed to record every dataTransferProgressInterval blocks and when
+// the transfer completes.
+func receivePiece(ctx context.Context, r *cbu.MsgReader, bs bserv.BlockService, limit uint64, start storagedeal.TransferProgress, record func(storagedeal.TransferProgress) error) (storagedeal.TransferProgress, error) {
+	progress := start
+
+	var header dataTransferHeader
+	if err := r.ReadMsg(&header); err != nil {
+		return progress, errors.Wrap(err, "failed to read transfer header")
+	}
+	if header.Error != "" {
+		return progress, fmt.Errorf("transfer refused: %s", header.Error)
+	}
+	if header.Bytes > limit || header.Blocks > limit {
+		return progress, fmt.Errorf("piece of %d blocks and %d bytes is larger than the %d bytes of the deal", header.Blocks, header.Bytes, limit)
+	}
+	if progress.Blocks > header.Blocks {
+		return progress, fmt.Errorf("offset %d is past the %d blocks of the piece", progress.Blocks, header.Blocks)
+	}
+	progress.TotalBlocks = header.Blocks
+
+	for progress.Blocks < progress.TotalBlocks {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		blk, err := readTransferBlock(r)
+		if err != nil {
+			return progress, err
+		}
+		if progress.Bytes+uint64(len(blk.RawData())) > header.Bytes {
+			return progress, fmt.Errorf("received more than the %d bytes of the piece", header.Bytes)
+		}
+		if err := bs.AddBlock(blk); err != nil {
+			return progress, errors.Wrapf(err, "failed to store block %s", blk.Cid())
+		}
+
+		progress.Blocks++
+		progress.Bytes += uint64(len(blk.RawData()))
+		if progress.Blocks%dataTransferProgressInterval == 0 && progress.Blocks < progress.TotalBlocks {
+			if err := record(progress); err != nil {
+				return progress, err
+			}
+		}
+	}
+
+	return progress, record(progress)
+}
+
+// readTransferBlock reads the parts of the next block of a transfer and checks
+// its data against its cid.
+func readTransferBlock(r *cbu.MsgReader) (blocks.Block, error) {
+	var data []byte
+	var c cid.Cid
+	for {
+		var msg dataTransferBlock
+		if err := r.ReadMsg(&msg); err != nil {
+			return nil, errors.Wrap(err, "failed to read block")
+		}
+		if data != nil && !msg.Cid.Equals(c) {
+			return nil, fmt.Errorf("block %s interrupted by block %s", c, msg.Cid)
+		}
+		c = msg.Cid
+		data = append(data, msg.Data...)
+		if len(data) > maxDataTransferBlockSize {
+			return nil, fmt.Errorf("block %s is larger than %d bytes", c, maxDataTransferBlockSize)
+		}
+		if msg.Last {
+			break
+		}
+	}
+
+	sum, err := c.Prefix().Sum(data)
+	if err != nil || !sum.Equals(c) {
+		return nil, fmt.Errorf("received data does not match block %s", c)
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+// dealTransfers tracks the deals whose data is being pushed to or imported by
+// the miner.
+type dealTransfers struct {
+	l sync.Mutex
+	// active holds the deals being received, keyed by proposal cid.
+	active map[string]bool
+	// done holds channels closed once the data of a deal is received.
+	done map[string]chan struct{}
+}
+
+// start marks the deal as being received, returning false if it already is.
+func (dt *dealTransfers) start(c cid.Cid) bool {
+	dt.l.Lock()
+	defer dt.l.Unlock()
+
+	if dt.active == nil {
+		dt.active = make(map[string]bool)
+	}
+	if dt.active[c.String()] {
+		return false
+	}
+	dt.active[c.String()] = true
+	return true
+}
+
+func (dt *dealTransfers) stop(c cid.Cid) {
+	dt.l.Lock()
+	defer dt.l.Unlock()
+
+	delete(dt.active, c.String())
+}
+
+// doneChan returns the channel closed once the data of the deal is received.
+func (dt *dealTransfers) doneChan(c cid.Cid) chan struct{} {
+	dt.l.Lock()
+	defer dt.l.Unlock()
+
+	if dt.done == nil {
+		dt.done = make(map[string]chan struct{})
+	}
+	done, ok := dt.done[c.String()]
+	if !ok {
+		done = make(chan struct{})
+		dt.done[c.String()] = done
+	}
+	return done
+}
+
+func (dt *dealTransfers) finish(c cid.Cid) {
+	done := dt.doneChan(c)
+
+	dt.l.Lock()
+	defer dt.l.Unlock()
+
+	select {
+	case <-done:
+	default:
+		close(done)
+	}
+}
+
+func (dt *dealTransfers) forget(c cid.Cid) {
+	dt.l.Lock()
+	defer dt.l.Unlock()
+
+	delete(dt.done, c.String())
+}
+
+// transferDealData gets the data of the deal with the data transfer protocol.
+// It pulls the data from the client or waits for the client to push it, or
+// for the miner to import it, then checks the miner holds the whole piece and
+// that it matches the piece commitment of the proposal.
+func transferDealData(ctx context.Context, sm *Miner, p *storagedeal.Proposal) error {
+	proposalCid, err := convert.ToCid(p)
+	if err != nil {
+		return errors.Wrap(err, "failed to get cid of proposal")
+	}
+
+	if !sm.transferProgress(proposalCid).Complete() {
+		switch p.TransferMode {
+		case storagedeal.TransferPull:
+			err = sm.pullDealData(ctx, proposalCid, dataTransferLimit(p))
+		case storagedeal.TransferPush:
+			err = sm.awaitDealData(ctx, proposalCid, time.After(waitForDealDataDuration))
+		case storagedeal.TransferManual:
+			err = sm.awaitDealData(ctx, proposalCid, time.After(waitForManualDealDataDuration))
+		default:
+			err = fmt.Errorf("unknown transfer mode %s", p.TransferMode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// the blocks were checked against their cids, not against the piece nor
+	// the commitment of the client
+	bs := sm.node.BlockService().Blockstore()
+	local := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	if err := dag.FetchGraph(ctx, p.PieceRef, local); err != nil {
+		return errors.Wrap(err, "transferred data does not hold the piece")
+	}
+	return checkPieceCommitment(ctx, local, p)
+}
+
+// pullDealData pulls the data of the deal from the peer that proposed it,
+// trying again from the last recorded block if the transfer breaks. The piece
+// may hold at most limit bytes.
+func (sm *Miner) pullDealData(ctx context.Context, proposalCid cid.Cid, limit uint64) error {
+	process, _ := sm.getDealProcess(proposalCid)
+	if process.ClientPeer == "" {
+		return errors.New("no client peer to pull the data from")
+	}
+	clientPeer, err := peer.IDB58Decode(process.ClientPeer)
+	if err != nil {
+		return errors.Wrap(err, "invalid client peer")
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = sm.pullDealDataOnce(ctx, clientPeer, proposalCid, limit)
+		if err == nil || attempt == dataTransferAttempts {
+			return err
+		}
+		log.Warningf("failed to pull data of deal %s, retrying: %s", proposalCid, err)
+
+		select {
+		case <-time.After(dataTransferRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (sm *Miner) pullDealDataOnce(ctx context.Context, clientPeer peer.ID, proposalCid cid.Cid, limit uint64) error {
+	s, err := sm.node.Host().NewStream(ctx, clientPeer, dataPullProtocol)
+	if err != nil {
+		return errors.Wrap(err, "failed to open data transfer stream to client")
+	}
+	defer s.Close() // nolint: errcheck
+
+	start := sm.transferProgress(proposalCid)
+	if err := cbu.NewMsgWriter(s).WriteMsg(&dataTransferRequest{ProposalCid: proposalCid, Offset: start.Blocks}); err != nil {
+		return errors.Wrap(err, "failed to write data transfer request")
+	}
+
+	_, err = receivePiece(ctx, cbu.NewMsgReader(timeoutReader{s}), sm.node.BlockService(), limit, start, func(progress storagedeal.TransferProgress) error {
+		return sm.recordTransferProgress(proposalCid, progress)
+	})
+	return err
+}
+
+// awaitDealData waits for the data of the deal to be pushed or imported, until
+// timeout fires if it is not nil.
+func (sm *Miner) awaitDealData(ctx context.Context, proposalCid cid.Cid, timeout <-chan time.Time) error {
+	done := sm.transfers.doneChan(proposalCid)
+	defer sm.transfers.forget(proposalCid)
+
+	if sm.transferProgress(proposalCid).Complete() {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return errors.New("timed out waiting for the data of the deal")
+	}
+}
+
+// handleDataPush receives the data of a deal pushed by its client.
+func (sm *Miner) handleDataPush(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	r := cbu.NewMsgReader(timeoutReader{s})
+	w := cbu.NewMsgWriter(s)
+
+	var req dataTransferRequest
+	if err := r.ReadMsg(&req); err != nil {
+		log.Errorf("received invalid data transfer request: %s", err)
+		return
+	}
+
+	refuse := func(reason string) {
+		if err := w.WriteMsg(&dataTransferHeader{Error: reason}); err != nil {
+			log.Errorf("failed to write data transfer refusal: %s", err)
+		}
+	}
+
+	deal, err := sm.checkDataPush(req.ProposalCid, s.Conn().RemotePeer())
+	if err != nil {
+		refuse(err.Error())
+		return
+	}
+	if !sm.transfers.start(req.ProposalCid) {
+		refuse("the data of the deal is already being transferred")
+		return
+	}
+	defer sm.transfers.stop(req.ProposalCid)
+
+	start := sm.transferProgress(req.ProposalCid)
+	if err := w.WriteMsg(&dataTransferHeader{Offset: start.Blocks}); err != nil {
+		log.Errorf("failed to write data transfer header: %s", err)
+		return
+	}
+
+	_, err = receivePiece(context.Background(), r, sm.node.BlockService(), dataTransferLimit(deal.Proposal), start, func(progress storagedeal.TransferProgress) error {
+		return sm.recordTransferProgress(req.ProposalCid, progress)
+	})
+	if err != nil {
+		log.Errorf("failed to receive data of deal %s: %s", req.ProposalCid, err)
+		return
+	}
+
+	sm.transfers.finish(req.ProposalCid)
+}
+
+// checkDataPush returns the deal, or an error if the peer may not push its
+// data.
+func (sm *Miner) checkDataPush(proposalCid cid.Cid, pid peer.ID) (*storagedeal.Deal, error) {
+	deal := sm.porcelainAPI.DealGet(proposalCid)
+	if deal == nil || deal.Miner != sm.minerAddr {
+		return nil, fmt.Errorf("unknown deal %s", proposalCid)
+	}
+	if deal.Proposal.TransferMode != storagedeal.TransferPush {
+		return nil, fmt.Errorf("the data of the deal is transferred by %s", deal.Proposal.TransferMode)
+	}
+	if err := sm.checkDataAwaited(deal); err != nil {
+		return nil, err
+	}
+
+	process, _ := sm.getDealProcess(proposalCid)
+	if process.ClientPeer != "" && process.ClientPeer != peer.IDB58Encode(pid) {
+		return nil, fmt.Errorf("peer %s did not propose the deal", pid.Pretty())
+	}
+	return deal, nil
+}
+
+// checkDataAwaited returns an error if the miner is not waiting for the data
+// of the deal.
+func (sm *Miner) checkDataAwaited(deal *storagedeal.Deal) error {
+	if deal.Response.State != storagedeal.Accepted {
+		return fmt.Errorf("deal is %s", deal.Response.State)
+	}
+
+	process, _ := sm.getDealProcess(deal.Response.ProposalCid)
+	if process.Stage != dealStageFetching || sm.transferProgress(deal.Response.ProposalCid).Complete() {
+		return errors.New("the data of the deal was already received")
+	}
+	return nil
+}
+
+// transferProgress returns how far the transfer of the data of the deal got.
+func (sm *Miner) transferProgress(proposalCid cid.Cid) storagedeal.TransferProgress {
+	deal := sm.porcelainAPI.DealGet(proposalCid)
+	if deal == nil || deal.Response.Transfer == nil {
+		return storagedeal.TransferProgress{}
+	}
+	return *deal.Response.Transfer
+}
+
+// recordTransferProgress stores the progress of the transfer in the deal
+// response, where the client can query it.
+func (sm *Miner) recordTransferProgress(proposalCid cid.Cid, progress storagedeal.TransferProgress) error {
+	log.Debugf("deal %s: received %d of %d blocks", proposalCid, progress.Blocks, progress.TotalBlocks)
+	return sm.updateDealResponse(proposalCid, func(resp *storagedeal.Response) {
+		resp.Transfer = &progress
+	})
+}
+
+// handleDataPull serves the data of a deal to its miner.
+func (smc *Client) handleDataPull(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var req dataTransferRequest
+	if err := cbu.NewMsgReader(timeoutReader{s}).ReadMsg(&req); err != nil {
+		log.Errorf("received invalid data transfer request: %s", err)
+		return
+	}
+	w := cbu.NewMsgWriter(s)
+
+	ctx := context.Background()
+	deal, err := smc.dealForTransfer(ctx, req.ProposalCid, s.Conn().RemotePeer())
+	if err != nil {
+		if err := w.WriteMsg(&dataTransferHeader{Error: err.Error()}); err != nil {
+			log.Errorf("failed to write data transfer refusal: %s", err)
+		}
+		return
+	}
+
+	if err := sendPiece(ctx, w, smc.node.DAGService(), deal.Proposal.PieceRef, req.Offset); err != nil {
+		log.Errorf("failed to send data of deal %s: %s", req.ProposalCid, err)
+	}
+}
+
+// dealForTransfer returns the deal with the proposal cid, if the peer is its
+// miner.
+func (smc *Client) dealForTransfer(ctx context.Context, proposalCid cid.Cid, pid peer.ID) (*storagedeal.Deal, error) {
+	deal := smc.api.DealGet(proposalCid)
+	if deal == nil || deal.Proposal == nil {
+		return nil, fmt.Errorf("unknown deal %s", proposalCid)
+	}
+
+	minerPid, err := smc.api.MinerGetPeerID(ctx, deal.Miner)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get peer id of miner")
+	}
+	if minerPid != pid {
+		return nil, fmt.Errorf("peer %s is not the miner of deal %s", pid.Pretty(), proposalCid)
+	}
+	return deal, nil
+}
+
+// pushDealData pushes the data of the deal to its miner, trying again from
+// where the miner got if the transfer breaks.
+func (smc *Client) pushDealData(ctx context.Context, minerPid peer.ID, proposalCid cid.Cid, pieceRef cid.Cid) {
+	for attempt := 1; ; attempt++ {
+		err := smc.pushDealDataOnce(ctx, minerPid, proposalCid, pieceRef)
+		if err == nil {
+			return
+		}
+		if attempt == dataTransferAttempts {
+			log.Errorf("giving up pushing data of deal %s: %s", proposalCid, err)
+			return
+		}
+		log.Warningf("failed to push data of deal %s, retrying: %s", proposalCid, err)
+
+		select {
+		case <-time.After(dataTransferRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (smc *Client) pushDealDataOnce(ctx context.Context, minerPid peer.ID, proposalCid cid.Cid, pieceRef cid.Cid) error {
+	s, err := smc.node.NewStream(ctx, minerPid, dataPushProtocol)
+	if err != nil {
+		return errors.Wrap(err, "failed to open data transfer stream to miner")
+	}
+	defer s.Close() // nolint: errcheck
+
+	w := cbu.NewMsgWriter(s)
+	if err := w.WriteMsg(&dataTransferRequest{ProposalCid: proposalCid}); err != nil {
+		return errors.Wrap(err, "failed to write data transfer request")
+	}
+
+	var header dataTransferHeader
+	if err := cbu.NewMsgReader(timeoutReader{s}).ReadMsg(&header); err != nil {
+		return errors.Wrap(err, "failed to read data transfer header")
+	}
+	if header.Error != "" {
+		return fmt.Errorf("miner refused the data: %s", header.Error)
+	}
+
+	return sendPiece(ctx, w, smc.node.DAGService(), pieceRef, header.Offset)
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	offline "gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestDataTransfer(t *testing.T) {
+	ctx := context.Background()
+
+	// limit accepts any piece of the tests
+	const limit = 1 << 30
+
+	// transfer streams the piece from the sender's DAG into the receiver's
+	// block service, starting at the offset of start.
+	transfer := func(from ipld.DAGService, root cid.Cid, to bserv.BlockService, start storagedeal.TransferProgress) (storagedeal.TransferProgress, []storagedeal.TransferProgress, error) {
+		r, w := io.Pipe()
+		go func() {
+			err := sendPiece(ctx, cbu.NewMsgWriter(w), from, root, start.Blocks)
+			w.CloseWithError(err) // nolint: errcheck
+		}()
+
+		var recorded []storagedeal.TransferProgress
+		progress, err := receivePiece(ctx, cbu.NewMsgReader(r), to, limit, start, func(p storagedeal.TransferProgress) error {
+			recorded = append(recorded, p)
+			return nil
+		})
+		return progress, recorded, err
+	}
+
+	t.Run("transfers every block of the piece", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		_, src := newTransferTestDAG()
+		root := newTransferTestPiece(t, src, 40)
+		dst, dstDAG := newTransferTestDAG()
+
+		progress, recorded, err := transfer(src, root, dst, storagedeal.TransferProgress{})
+		require.NoError(err)
+
+		assert.Equal(uint64(41), progress.TotalBlocks)
+		assert.True(progress.Complete())
+		assert.Equal(pieceSize(t, src, root), progress.Bytes)
+
+		// recorded every dataTransferProgressInterval blocks, then at the end
+		require.Len(recorded, 3)
+		assert.Equal(uint64(16), recorded[0].Blocks)
+		assert.Equal(uint64(32), recorded[1].Blocks)
+		assert.Equal(progress, recorded[2])
+
+		assert.NoError(dag.FetchGraph(ctx, root, dstDAG))
+	})
+
+	t.Run("resumes after the recorded blocks", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		_, src := newTransferTestDAG()
+		root := newTransferTestPiece(t, src, 40)
+		dst, dstDAG := newTransferTestDAG()
+
+		// the receiver has the first 16 blocks of a transfer that broke
+		order, _, err := pieceBlocks(ctx, src, root)
+		require.NoError(err)
+		start := storagedeal.TransferProgress{Blocks: 16, TotalBlocks: uint64(len(order))}
+		for _, c := range order[:16] {
+			nd, err := src.Get(ctx, c)
+			require.NoError(err)
+			require.NoError(dst.AddBlock(nd))
+			start.Bytes += uint64(len(nd.RawData()))
+		}
+
+		progress, recorded, err := transfer(src, root, dst, start)
+		require.NoError(err)
+
+		assert.True(progress.Complete())
+		assert.Equal(pieceSize(t, src, root), progress.Bytes)
+		require.Len(recorded, 2)
+		assert.Equal(uint64(32), recorded[0].Blocks)
+		assert.NoError(dag.FetchGraph(ctx, root, dstDAG))
+	})
+
+	t.Run("splits large blocks", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		_, src := newTransferTestDAG()
+		large := dag.NewRawNode(bytes.Repeat([]byte{7}, 3*dataTransferFragmentSize+5))
+		require.NoError(src.Add(ctx, large))
+		root := dag.NodeWithData([]byte("root"))
+		require.NoError(root.AddNodeLink("large", large))
+		require.NoError(src.Add(ctx, root))
+		dst, dstDAG := newTransferTestDAG()
+
+		progress, _, err := transfer(src, root.Cid(), dst, storagedeal.TransferProgress{})
+		require.NoError(err)
+
+		assert.Equal(uint64(2), progress.Blocks)
+		nd, err := dstDAG.Get(ctx, large.Cid())
+		require.NoError(err)
+		assert.Equal(large.RawData(), nd.RawData())
+	})
+
+	t.Run("rejects data not matching its cid", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r, w := io.Pipe()
+		go func() {
+			mw := cbu.NewMsgWriter(w)
+			mw.WriteMsg(&dataTransferHeader{Blocks: 1, Bytes: 6})                                     // nolint: errcheck
+			mw.WriteMsg(&dataTransferBlock{Cid: types.SomeCid(), Data: []byte("forged"), Last: true}) // nolint: errcheck
+			w.Close()                                                                                 // nolint: errcheck
+		}()
+
+		dst, _ := newTransferTestDAG()
+		_, err := receivePiece(ctx, cbu.NewMsgReader(r), dst, limit, storagedeal.TransferProgress{}, func(storagedeal.TransferProgress) error {
+			return nil
+		})
+		assert.Error(err)
+		assert.Contains(err.Error(), "does not match")
+	})
+
+	t.Run("reports refusals", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r, w := io.Pipe()
+		go func() {
+			cbu.NewMsgWriter(w).WriteMsg(&dataTransferHeader{Error: "unknown deal"}) // nolint: errcheck
+			w.Close()                                                                // nolint: errcheck
+		}()
+
+		dst, _ := newTransferTestDAG()
+		_, err := receivePiece(ctx, cbu.NewMsgReader(r), dst, limit, storagedeal.TransferProgress{}, func(storagedeal.TransferProgress) error {
+			return nil
+		})
+		assert.EqualError(err, "transfer refused: unknown deal")
+	})
+
+	t.Run("refuses a piece larger than the deal", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, src := newTransferTestDAG()
+		root := newTransferTestPiece(t, src, 40)
+		dst, _ := newTransferTestDAG()
+
+		r, w := io.Pipe()
+		go func() {
+			err := sendPiece(ctx, cbu.NewMsgWriter(w), src, root, 0)
+			w.CloseWithError(err) // nolint: errcheck
+		}()
+		defer r.Close() // nolint: errcheck
+
+		_, err := receivePiece(ctx, cbu.NewMsgReader(r), dst, pieceSize(t, src, root)-1, storagedeal.TransferProgress{}, func(storagedeal.TransferProgress) error {
+			return nil
+		})
+		assert.Error(err)
+		assert.Contains(err.Error(), "is larger than")
+	})
+
+	t.Run("stops reading past the size of the piece", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		first := dag.NewRawNode([]byte("first"))
+		second := dag.NewRawNode([]byte("second"))
+
+		r, w := io.Pipe()
+		go func() {
+			mw := cbu.NewMsgWriter(w)
+			mw.WriteMsg(&dataTransferHeader{Blocks: 2, Bytes: 6})                                  // nolint: errcheck
+			mw.WriteMsg(&dataTransferBlock{Cid: first.Cid(), Data: first.RawData(), Last: true})   // nolint: errcheck
+			mw.WriteMsg(&dataTransferBlock{Cid: second.Cid(), Data: second.RawData(), Last: true}) // nolint: errcheck
+			w.Close()                                                                              // nolint: errcheck
+		}()
+
+		dst, _ := newTransferTestDAG()
+		progress, err := receivePiece(ctx, cbu.NewMsgReader(r), dst, limit, storagedeal.TransferProgress{}, func(storagedeal.TransferProgress) error {
+			return nil
+		})
+		assert.EqualError(err, "received more than the 6 bytes of the piece")
+		assert.Equal(uint64(1), progress.Blocks)
+
+		has, err := dst.Blockstore().Has(second.Cid())
+		require.NoError(err)
+		assert.False(has)
+	})
+}
+
+func newTransferTestDAG() (bserv.BlockService, ipld.DAGService) {
+	bs := bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())
+	bsvc := bserv.New(bs, offline.Exchange(bs))
+	return bsvc, dag.NewDAGService(bsvc)
+}
+
+// newTransferTestPiece adds a piece of a root and n leaves, the first linked
+// twice, to the DAG service and returns its cid.
+func newTransferTestPiece(t *testing.T, dserv ipld.DAGService, n int) cid.Cid {
+	ctx := context.Background()
+
+	root := dag.NodeWithData([]byte("root"))
+	for i := 0; i < n; i++ {
+		leaf := dag.NewRawNode([]byte{byte(i), byte(i >> 8)})
+		require.NoError(t, dserv.Add(ctx, leaf))
+		require.NoError(t, root.AddNodeLink(string(leaf.RawData()), leaf))
+	}
+	require.NoError(t, root.AddNodeLink("again", dag.NewRawNode([]byte{0, 0})))
+	require.NoError(t, dserv.Add(ctx, root))
+	return root.Cid()
+}
+
+func pieceSize(t *testing.T, dserv ipld.DAGService, root cid.Cid) uint64 {
+	ctx := context.Background()
+
+	order, _, err := pieceBlocks(ctx, dserv, root)
+	require.NoError(t, err)
+
+	var size uint64
+	for _, c := range order {
+		nd, err := dserv.Get(ctx, c)
+		require.NoError(t, err)
+		size += uint64(len(nd.RawData()))
+	}
+	return size
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+)
+
+// dealEventsProtocol is served by miners: it streams the events of a deal to
+// its client.
+const dealEventsProtocol = protocol.ID("/fil/storage/events/1.0.0")
+
+// publishDealEvent publishes the event with the current state and message of
+// its deal.
+func (sm *Miner) publishDealEvent(e *storagedeal.Event) {
+	if deal := sm.porcelainAPI.DealGet(e.ProposalCid); deal != nil {
+		e.State = deal.Response.State
+		e.Message = deal.Response.Message
+		if e.SectorID == 0 && deal.Response.ProofInfo != nil {
+			e.SectorID = deal.Response.ProofInfo.SectorID
+		}
+	}
+	sm.events.Publish(e)
+}
+
+// WatchDeals returns the events of the deals of the miner until the context
+// is done.
+func (sm *Miner) WatchDeals(ctx context.Context) <-chan *storagedeal.Event {
+	return sm.events.Subscribe(ctx, cid.Undef)
+}
+
+// handleDealEvents streams the events of a deal, starting with its current
+// state, until the peer closes the stream. The request must be signed by the
+// client of the deal.
+func (sm *Miner) handleDealEvents(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var q storagedeal.EventsRequest
+	if err := cbu.NewMsgReader(s).ReadMsg(&q); err != nil {
+		log.Errorf("received invalid deal events request: %s", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		// the peer sends nothing more, it is gone once its side closes
+		io.Copy(ioutil.Discard, s) // nolint: errcheck
+		cancel()
+	}()
+
+	// subscribe before looking the deal up, not to miss an event in between
+	events := sm.events.Subscribe(ctx, q.ProposalCid)
+
+	w := cbu.NewMsgWriter(s)
+	current := &storagedeal.Event{ProposalCid: q.ProposalCid, Kind: storagedeal.StateChanged}
+	deal := sm.porcelainAPI.DealGet(q.ProposalCid)
+	if deal == nil || deal.Proposal == nil || !q.Verify(deal.Proposal.Payment.Payer) {
+		// a peer other than the client learns nothing, not even whether the
+		// deal exists
+		current.State = storagedeal.Unknown
+		current.Message = "unknown deal"
+		if err := w.WriteMsg(current); err != nil {
+			log.Errorf("failed to write deal event: %s", err)
+		}
+		return
+	}
+
+	current.State = deal.Response.State
+	current.Message = deal.Response.Message
+	if deal.Response.ProofInfo != nil {
+		current.SectorID = deal.Response.ProofInfo.SectorID
+	}
+	if err := w.WriteMsg(current); err != nil {
+		log.Errorf("failed to write deal event: %s", err)
+		return
+	}
+
+	for e := range events {
+		if err := w.WriteMsg(e); err != nil {
+			log.Debugf("stopped streaming events of deal %s: %s", q.ProposalCid, err)
+			return
+		}
+	}
+	if ctx.Err() == nil {
+		log.Warningf("stopped streaming events of deal %s: the peer fell behind", q.ProposalCid)
+	}
+}
+
+// WatchDeal returns the events of the deal until the context is done. They
+// are streamed from the miner of the deal, and the state of the deal is
+// recorded as it changes.
+func (smc *Client) WatchDeal(ctx context.Context, proposalCid cid.Cid) (<-chan *storagedeal.Event, error) {
+	deal := smc.api.DealGet(proposalCid)
+	if deal == nil || deal.Proposal == nil {
+		return nil, fmt.Errorf("unknown deal %s", proposalCid)
+	}
+	req, err := storagedeal.NewEventsRequest(proposalCid, deal.Proposal.Payment.Payer, smc.api)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign deal events request")
+	}
+
+	minerpid, err := smc.api.MinerGetPeerID(ctx, deal.Miner)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := smc.node.NewStream(ctx, minerpid, dealEventsProtocol)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open deal events stream to miner")
+	}
+	if err := cbu.NewMsgWriter(s).WriteMsg(req); err != nil {
+		s.Close() // nolint: errcheck
+		return nil, errors.Wrap(err, "failed to write deal events request")
+	}
+
+	events := smc.events.Subscribe(ctx, proposalCid)
+	go func() {
+		<-ctx.Done()
+		s.Close() // nolint: errcheck
+	}()
+	go func() {
+		r := cbu.NewMsgReader(s)
+		for {
+			var e storagedeal.Event
+			if err := r.ReadMsg(&e); err != nil {
+				if ctx.Err() == nil && err != io.EOF {
+					log.Errorf("failed to read events of deal %s: %s", proposalCid, err)
+				}
+				return
+			}
+			if !e.ProposalCid.Equals(proposalCid) {
+				log.Errorf("miner sent an event of deal %s for deal %s", e.ProposalCid, proposalCid)
+				return
+			}
+			smc.receiveDealEvent(&e)
+		}
+	}()
+
+	return events, nil
+}
+
+// receiveDealEvent records the state of a deal event from the miner and
+// publishes the event.
+func (smc *Client) receiveDealEvent(e *storagedeal.Event) {
+	if e.Kind == storagedeal.StateChanged {
+		if err := smc.recordDealState(e.ProposalCid, e.State, e.Message); err != nil {
+			log.Errorf("failed to record state of deal %s: %s", e.ProposalCid, err)
+		}
+	}
+	smc.events.Publish(e)
+}
+
+// recordDealState stores the state the miner reported for the deal.
+func (smc *Client) recordDealState(proposalCid cid.Cid, state storagedeal.State, message string) error {
+	deal := smc.api.DealGet(proposalCid)
+	if deal == nil {
+		return fmt.Errorf("unknown deal %s", proposalCid)
+	}
+	if deal.Response.State == state && deal.Response.Message == message {
+		return nil
+	}
+	deal.Response.State = state
+	deal.Response.Message = message
+	return smc.api.DealPut(deal)
+}
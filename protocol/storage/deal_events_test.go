@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestDealEvents(t *testing.T) {
+	t.Parallel()
+
+	// next returns the next event, failing if none comes.
+	next := func(t *testing.T, events <-chan *storagedeal.Event) *storagedeal.Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no event published")
+			return nil
+		}
+	}
+
+	t.Run("miner publishes state changes and sector assignments", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		porcelainAPI := newMinerTestPorcelain(require)
+		miner := newTestMiner(porcelainAPI)
+		dealCid := types.SomeCid()
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Proposal: &storagedeal.Proposal{},
+			Response: &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: dealCid},
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := miner.WatchDeals(ctx)
+
+		// no event when the state stays the same
+		require.NoError(miner.updateDealResponse(dealCid, func(resp *storagedeal.Response) {
+			resp.DealID = 4
+		}))
+		require.NoError(miner.updateDealResponse(dealCid, func(resp *storagedeal.Response) {
+			resp.State = storagedeal.Staged
+		}))
+		miner.publishDealEvent(&storagedeal.Event{ProposalCid: dealCid, Kind: storagedeal.SectorAssigned, SectorID: 7})
+
+		e := next(t, events)
+		assert.Equal(storagedeal.StateChanged, e.Kind)
+		assert.Equal(storagedeal.Staged, e.State)
+		assert.True(dealCid.Equals(e.ProposalCid))
+
+		e = next(t, events)
+		assert.Equal(storagedeal.SectorAssigned, e.Kind)
+		assert.Equal(storagedeal.Staged, e.State)
+		assert.Equal(uint64(7), e.SectorID)
+	})
+
+	t.Run("miner publishes each redeemed voucher once", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		porcelainAPI := newMinerTestPorcelain(require)
+		miner := newTestMiner(porcelainAPI)
+		proposal := testSignedDealProposal(porcelainAPI, testPaymentVouchers(porcelainAPI, 3, defaultAmountInc), porcelainAPI.targetAddress)
+		dealCid := types.SomeCid()
+		deal := &storagedeal.Deal{
+			Proposal: &proposal.Proposal,
+			Response: &storagedeal.Response{State: storagedeal.Posted, ProposalCid: dealCid},
+		}
+		require.NoError(porcelainAPI.DealPut(deal))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := miner.WatchDeals(ctx)
+
+		vouchers := proposal.Payment.Vouchers
+		r := &voucherRedemption{ProposalCid: dealCid}
+		miner.publishRedeemedVouchers(deal, r, vouchers[1].Nonce)
+		miner.publishRedeemedVouchers(deal, r, vouchers[1].Nonce)
+		miner.publishRedeemedVouchers(deal, r, vouchers[2].Nonce)
+
+		e := next(t, events)
+		assert.Equal(storagedeal.PaymentRedeemed, e.Kind)
+		assert.Equal(vouchers[1].Amount, *e.Amount)
+
+		e = next(t, events)
+		assert.Equal(vouchers[2].Amount, *e.Amount)
+		assert.Equal(vouchers[2].Nonce, r.RedeemedNonce)
+	})
+
+	t.Run("subscribers of a deal only get its events", func(t *testing.T) {
+		assert := assert.New(t)
+
+		bus := storagedeal.NewEventBus()
+		newCid := types.NewCidForTestGetter()
+		dealCid := newCid()
+		otherCid := newCid()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := bus.Subscribe(ctx, dealCid)
+
+		bus.Publish(&storagedeal.Event{ProposalCid: otherCid, Kind: storagedeal.Committed})
+		bus.Publish(&storagedeal.Event{ProposalCid: dealCid, Kind: storagedeal.PoStProven})
+
+		e := next(t, events)
+		assert.Equal(storagedeal.PoStProven, e.Kind)
+	})
+
+	t.Run("publishing drops subscribers that fall behind", func(t *testing.T) {
+		assert := assert.New(t)
+
+		bus := storagedeal.NewEventBus()
+		dealCid := types.SomeCid()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		slow := bus.Subscribe(ctx, dealCid)
+		all := bus.Subscribe(ctx, cid.Undef)
+
+		for i := 0; i < 1000; i++ {
+			bus.Publish(&storagedeal.Event{ProposalCid: dealCid, Kind: storagedeal.PoStProven})
+			<-all
+		}
+
+		received := 0
+		for range slow {
+			received++
+		}
+		assert.True(received < 1000)
+
+		// the subscriber keeping up is not dropped
+		bus.Publish(&storagedeal.Event{ProposalCid: dealCid, Kind: storagedeal.Committed})
+		assert.Equal(storagedeal.Committed, next(t, all).Kind)
+	})
+
+	t.Run("events requests are signed by the client of the deal", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		signer := types.NewMockSigner(types.MustGenerateKeyInfo(2, types.GenerateKeyInfoSeed()))
+		client, other := signer.Addresses[0], signer.Addresses[1]
+
+		req, err := storagedeal.NewEventsRequest(types.SomeCid(), client, signer)
+		require.NoError(err)
+		assert.True(req.Verify(client))
+		assert.False(req.Verify(other))
+
+		req.ProposalCid = types.NewCidForTestGetter()()
+		assert.False(req.Verify(client))
+	})
+
+	t.Run("client records the states the miner reports", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		testAPI := newTestClientAPI(require)
+		client, err := NewClient(newTestClientNode(nil), testAPI)
+		require.NoError(err)
+
+		dealCid := types.SomeCid()
+		require.NoError(testAPI.DealPut(&storagedeal.Deal{
+			Proposal: &storagedeal.Proposal{},
+			Response: &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: dealCid},
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := client.events.Subscribe(ctx, dealCid)
+
+		client.receiveDealEvent(&storagedeal.Event{ProposalCid: dealCid, Kind: storagedeal.StateChanged, State: storagedeal.Staged})
+
+		e := next(t, events)
+		assert.Equal(storagedeal.Staged, e.State)
+		assert.Equal(storagedeal.Staged, testAPI.DealGet(dealCid).Response.State)
+	})
+}
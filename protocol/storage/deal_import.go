@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	dag "gx/ipfs/QmNRAuGmvnVw8urHkUZQirhu42VTiZjVWASa2aTznEMmpP/go-merkledag"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	imp "gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs/importer"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	offline "gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	car "gx/ipfs/QmUGpiTCKct5s1F7jaAnY9KJmoo7Qm1R2uhSjq5iHDSUMn/go-car"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	dss "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/sync"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	chunk "gx/ipfs/QmXivYDjgMqNQXbEQVC7TMuZnRADCa71ABQUQxWPZPTLbd/go-ipfs-chunker"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+)
+
+// ImportDealData loads the data of a deal made with manual transfer, checks it
+// is the piece of the deal and lets the processing of the deal go on with it.
+// The data is either a car file holding the piece or the file the client
+// imported, which is imported again the same way. It is loaded into a
+// temporary store and only the blocks of the piece are copied to the miner's
+// blockstore, once the data turned out to be the piece.
+func (sm *Miner) ImportDealData(ctx context.Context, proposalCid cid.Cid, data io.Reader, isCar bool) error {
+	deal := sm.porcelainAPI.DealGet(proposalCid)
+	if deal == nil || deal.Miner != sm.minerAddr {
+		return fmt.Errorf("unknown deal %s", proposalCid)
+	}
+	if deal.Proposal.TransferMode != storagedeal.TransferManual {
+		return fmt.Errorf("the data of the deal is transferred by %s", deal.Proposal.TransferMode)
+	}
+	if err := sm.checkDataAwaited(deal); err != nil {
+		return err
+	}
+
+	if !sm.transfers.start(proposalCid) {
+		return errors.New("the data of the deal is already being transferred")
+	}
+	defer sm.transfers.stop(proposalCid)
+
+	tmp := blockstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	tmpDAG := dag.NewDAGService(bserv.New(tmp, offline.Exchange(tmp)))
+
+	var root cid.Cid
+	if isCar {
+		header, err := car.LoadCar(tmp, data)
+		if err != nil {
+			return errors.Wrap(err, "failed to load car")
+		}
+		if len(header.Roots) != 1 {
+			return fmt.Errorf("expected car with only a single root")
+		}
+		root = header.Roots[0]
+	} else {
+		bufds := ipld.NewBufferedDAG(ctx, tmpDAG)
+		nd, err := imp.BuildDagFromReader(bufds, chunk.DefaultSplitter(data))
+		if err != nil {
+			return errors.Wrap(err, "failed to import data")
+		}
+		if err := bufds.Commit(); err != nil {
+			return errors.Wrap(err, "failed to import data")
+		}
+		root = nd.Cid()
+	}
+
+	if !root.Equals(deal.Proposal.PieceRef) {
+		return fmt.Errorf("imported data %s does not match the piece %s of the deal", root, deal.Proposal.PieceRef)
+	}
+
+	order, _, err := pieceBlocks(ctx, tmpDAG, root)
+	if err != nil {
+		return errors.Wrap(err, "imported data does not hold the piece")
+	}
+	bs := sm.node.BlockService().Blockstore()
+	for _, c := range order {
+		blk, err := tmp.Get(c)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get imported block %s", c)
+		}
+		if err := bs.Put(blk); err != nil {
+			return errors.Wrapf(err, "failed to store imported block %s", c)
+		}
+	}
+
+	local := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	progress, err := localTransferProgress(ctx, local, root)
+	if err != nil {
+		return errors.Wrap(err, "imported data does not hold the piece")
+	}
+	if err := sm.recordTransferProgress(proposalCid, progress); err != nil {
+		return err
+	}
+
+	sm.transfers.finish(proposalCid)
+	return nil
+}
+
+// localTransferProgress returns the progress of a completed transfer of the
+// piece, failing if a block of the piece is missing.
+func localTransferProgress(ctx context.Context, ng ipld.NodeGetter, root cid.Cid) (storagedeal.TransferProgress, error) {
+	order, size, err := pieceBlocks(ctx, ng, root)
+	if err != nil {
+		return storagedeal.TransferProgress{}, err
+	}
+
+	progress := storagedeal.TransferProgress{
+		Blocks:      uint64(len(order)),
+		TotalBlocks: uint64(len(order)),
+		Bytes:       size,
+	}
+	return progress, nil
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	imp "gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs/importer"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	car "gx/ipfs/QmUGpiTCKct5s1F7jaAnY9KJmoo7Qm1R2uhSjq5iHDSUMn/go-car"
+	chunk "gx/ipfs/QmXivYDjgMqNQXbEQVC7TMuZnRADCa71ABQUQxWPZPTLbd/go-ipfs-chunker"
+
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestImportDealData(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("deal data "), 100000)
+
+	// setup returns a miner with an accepted deal for the piece the client
+	// imported from data, and the client's DAG service.
+	setup := func(require *require.Assertions, mode storagedeal.TransferMode) (*Miner, cid.Cid, ipld.DAGService) {
+		_, clientDAG := newTransferTestDAG()
+		bufds := ipld.NewBufferedDAG(ctx, clientDAG)
+		nd, err := imp.BuildDagFromReader(bufds, chunk.DefaultSplitter(bytes.NewReader(data)))
+		require.NoError(err)
+		require.NoError(bufds.Commit())
+
+		porcelainAPI := newMinerTestPorcelain(require)
+		proposal := testSignedDealProposal(porcelainAPI, testPaymentVouchers(porcelainAPI, 10, defaultAmountInc), porcelainAPI.targetAddress)
+		proposal.PieceRef = nd.Cid()
+		proposal.TransferMode = mode
+		dealCid := types.SomeCid()
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Proposal: &proposal.Proposal,
+			Response: &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: dealCid},
+		}))
+
+		bs, _ := newTransferTestDAG()
+		miner := newTestMiner(porcelainAPI)
+		miner.node = &minerTestNode{blockService: bs}
+		miner.dealsAwaitingSealDs = repo.NewInMemoryRepo().DealsDatastore()
+		require.NoError(miner.loadDealsInProcess())
+		return miner, dealCid, clientDAG
+	}
+
+	t.Run("imports the file the client imported", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		miner, dealCid, _ := setup(require, storagedeal.TransferManual)
+
+		awaited := make(chan error, 1)
+		go func() {
+			awaited <- miner.awaitDealData(ctx, dealCid, nil)
+		}()
+
+		require.NoError(miner.ImportDealData(ctx, dealCid, bytes.NewReader(data), false))
+		require.NoError(<-awaited)
+
+		progress := miner.transferProgress(dealCid)
+		assert.True(progress.Complete())
+		assert.True(progress.Bytes > uint64(len(data)))
+
+		// the data was received, there is nothing left to import
+		err := miner.ImportDealData(ctx, dealCid, bytes.NewReader(data), false)
+		assert.EqualError(err, "the data of the deal was already received")
+	})
+
+	t.Run("imports a car of the piece", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		miner, dealCid, clientDAG := setup(require, storagedeal.TransferManual)
+
+		var buf bytes.Buffer
+		deal := miner.porcelainAPI.DealGet(dealCid)
+		require.NoError(car.WriteCar(ctx, clientDAG, []cid.Cid{deal.Proposal.PieceRef}, &buf))
+
+		require.NoError(miner.ImportDealData(ctx, dealCid, &buf, true))
+		assert.True(miner.transferProgress(dealCid).Complete())
+	})
+
+	t.Run("rejects data other than the piece", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		miner, dealCid, _ := setup(require, storagedeal.TransferManual)
+
+		err := miner.ImportDealData(ctx, dealCid, bytes.NewReader([]byte("other data")), false)
+		require.Error(err)
+		assert.Contains(err.Error(), "does not match the piece")
+		assert.False(miner.transferProgress(dealCid).Complete())
+
+		// none of the rejected data is kept
+		keys, err := miner.node.BlockService().Blockstore().AllKeysChan(ctx)
+		require.NoError(err)
+		_, kept := <-keys
+		assert.False(kept)
+	})
+
+	t.Run("rejects deals transferred over the network", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		miner, dealCid, _ := setup(require, storagedeal.TransferPull)
+
+		err := miner.ImportDealData(ctx, dealCid, bytes.NewReader(data), false)
+		assert.EqualError(err, "the data of the deal is transferred by pull")
+	})
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"fmt"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+)
+
+// Deals returns the deals of the miner that pass the filter.
+func (sm *Miner) Deals(filter storagedeal.DealFilter) ([]*storagedeal.MinerDeal, error) {
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list deals")
+	}
+
+	minerDeals := []*storagedeal.MinerDeal{}
+	for _, deal := range deals {
+		if deal.Miner != sm.minerAddr {
+			// a deal this node made as a client
+			continue
+		}
+		md := sm.minerDeal(deal)
+		if filter.Match(md) {
+			minerDeals = append(minerDeals, md)
+		}
+	}
+	return minerDeals, nil
+}
+
+// Deal returns the deal of the miner with the given proposal cid.
+func (sm *Miner) Deal(proposalCid cid.Cid) (*storagedeal.MinerDeal, error) {
+	deal := sm.porcelainAPI.DealGet(proposalCid)
+	if deal == nil || deal.Miner != sm.minerAddr {
+		return nil, fmt.Errorf("unknown deal %s", proposalCid)
+	}
+	return sm.minerDeal(deal), nil
+}
+
+// minerDeal returns the deal with how far the miner got with it.
+func (sm *Miner) minerDeal(deal *storagedeal.Deal) *storagedeal.MinerDeal {
+	md := &storagedeal.MinerDeal{Deal: *deal}
+	proposalCid := deal.Response.ProposalCid
+
+	process, inProcess := sm.getDealProcess(proposalCid)
+	if inProcess {
+		md.Stage = process.Stage.String()
+	}
+
+	switch {
+	case deal.Response.ProofInfo != nil:
+		sectorID := deal.Response.ProofInfo.SectorID
+		md.Sector = &sectorID
+	case inProcess && process.Stage == dealStageStaging:
+		sectorID := process.SectorID
+		md.Sector = &sectorID
+	default:
+		md.Sector = sm.sectorAwaitingSeal(proposalCid)
+	}
+
+	return md
+}
+
+// sectorAwaitingSeal returns the sector awaiting seal holding the piece of
+// the deal, nil if there is none.
+func (sm *Miner) sectorAwaitingSeal(proposalCid cid.Cid) *uint64 {
+	sm.dealsAwaitingSeal.l.Lock()
+	defer sm.dealsAwaitingSeal.l.Unlock()
+
+	for sectorID, dealCids := range sm.dealsAwaitingSeal.SectorsToDeals {
+		for _, c := range dealCids {
+			if c.Equals(proposalCid) {
+				return &sectorID
+			}
+		}
+	}
+	return nil
+}
+
+// RejectDeal cancels a deal the miner accepted. The client sees the deal
+// rejected with the reason. Only deals whose data is still being transferred
+// can be rejected: once the miner published a deal to the storage market it
+// is bound to seal its piece. Blocks of the piece already pushed or imported
+// remain in the blockstore, they may be shared with other data.
+func (sm *Miner) RejectDeal(proposalCid cid.Cid, reason string) error {
+	deal := sm.porcelainAPI.DealGet(proposalCid)
+	if deal == nil || deal.Miner != sm.minerAddr {
+		return fmt.Errorf("unknown deal %s", proposalCid)
+	}
+
+	message := "rejected by the miner"
+	if reason != "" {
+		message = fmt.Sprintf("%s: %s", message, reason)
+	}
+	if err := sm.rejectDeal(proposalCid, message); err != nil {
+		return err
+	}
+
+	// published once the lock is released, subscribers may call back into
+	// the miner
+	sm.publishDealEvent(&storagedeal.Event{ProposalCid: proposalCid, Kind: storagedeal.StateChanged})
+	sm.transfers.forget(proposalCid)
+	log.Infof("rejected deal %s: %s", proposalCid, message)
+	return nil
+}
+
+// rejectDeal stores the rejection of the deal and stops its processing.
+func (sm *Miner) rejectDeal(proposalCid cid.Cid, message string) error {
+	sm.dealsInProcess.l.Lock()
+	defer sm.dealsInProcess.l.Unlock()
+
+	// the processing of the deal does not move on while the lock is held
+	deal := sm.porcelainAPI.DealGet(proposalCid)
+	if deal.Response.State != storagedeal.Accepted {
+		return fmt.Errorf("deal is %s, only accepted deals can be rejected", deal.Response.State)
+	}
+	if process, ok := sm.dealsInProcess.Deals[proposalCid.String()]; ok && process.Stage != dealStageFetching {
+		return fmt.Errorf("deal is already %s, it can only be rejected while its data is being transferred", process.Stage)
+	}
+
+	_, _, err := sm.storeDealResponse(proposalCid, func(resp *storagedeal.Response) {
+		resp.State = storagedeal.Rejected
+		resp.Message = message
+	})
+	if err != nil {
+		return err
+	}
+
+	if cancel, ok := sm.dealsInProcess.cancels[proposalCid.String()]; ok {
+		cancel()
+	}
+	delete(sm.dealsInProcess.Deals, proposalCid.String())
+	return sm.saveDealsInProcess()
+}
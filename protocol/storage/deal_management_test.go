@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestDealManagement(t *testing.T) {
+	t.Parallel()
+
+	// setup returns a miner and a function adding a deal of the miner in the
+	// given state, paid by the given client.
+	setup := func(require *require.Assertions) (*Miner, func(storagedeal.State, address.Address) cid.Cid) {
+		porcelainAPI := newMinerTestPorcelain(require)
+		miner := newTestMiner(porcelainAPI)
+		miner.minerAddr = porcelainAPI.targetAddress
+		miner.dealsAwaitingSealDs = repo.NewInMemoryRepo().DealsDatastore()
+		require.NoError(miner.loadDealsAwaitingSeal())
+		require.NoError(miner.loadDealsInProcess())
+
+		newCid := types.NewCidForTestGetter()
+		addDeal := func(state storagedeal.State, client address.Address) cid.Cid {
+			proposal := testSignedDealProposal(porcelainAPI, nil, porcelainAPI.targetAddress)
+			proposal.Payment.Payer = client
+			dealCid := newCid()
+			require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+				Miner:    miner.minerAddr,
+				Proposal: &proposal.Proposal,
+				Response: &storagedeal.Response{State: state, ProposalCid: dealCid},
+			}))
+			return dealCid
+		}
+		return miner, addDeal
+	}
+
+	t.Run("lists the deals of the miner that pass the filter", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		miner, addDeal := setup(require)
+		addrs := address.NewForTestGetter()
+		alice, bob := addrs(), addrs()
+
+		accepted := addDeal(storagedeal.Accepted, alice)
+		staged := addDeal(storagedeal.Staged, bob)
+		failed := addDeal(storagedeal.Failed, alice)
+		miner.dealsAwaitingSeal.add(4, staged)
+
+		// a deal the node made as a client is not listed
+		clientDeal := types.SomeCid()
+		require.NoError(miner.porcelainAPI.DealPut(&storagedeal.Deal{
+			Miner:    addrs(),
+			Proposal: &storagedeal.Proposal{},
+			Response: &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: clientDeal},
+		}))
+
+		dealCids := func(filter storagedeal.DealFilter) []cid.Cid {
+			deals, err := miner.Deals(filter)
+			require.NoError(err)
+			var cids []cid.Cid
+			for _, d := range deals {
+				cids = append(cids, d.Response.ProposalCid)
+			}
+			return cids
+		}
+
+		all := dealCids(storagedeal.DealFilter{})
+		assert.Len(all, 3)
+		assert.NotContains(all, clientDeal)
+
+		byState := dealCids(storagedeal.DealFilter{States: []storagedeal.State{storagedeal.Accepted, storagedeal.Failed}})
+		assert.Len(byState, 2)
+		assert.Contains(byState, accepted)
+		assert.Contains(byState, failed)
+
+		assert.Equal([]cid.Cid{staged}, dealCids(storagedeal.DealFilter{Client: bob}))
+
+		sector := uint64(4)
+		assert.Equal([]cid.Cid{staged}, dealCids(storagedeal.DealFilter{Sector: &sector}))
+
+		deal, err := miner.Deal(staged)
+		require.NoError(err)
+		require.NotNil(deal.Sector)
+		assert.Equal(uint64(4), *deal.Sector)
+
+		_, err = miner.Deal(clientDeal)
+		assert.Error(err)
+	})
+
+	t.Run("rejects a deal while its data is transferred", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		miner, addDeal := setup(require)
+		dealCid := addDeal(storagedeal.Accepted, address.TestAddress)
+		require.NoError(miner.updateDealProcess(dealCid, func(p *dealProcess) { p.Stage = dealStageFetching }))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := miner.WatchDeals(ctx)
+
+		require.NoError(miner.RejectDeal(dealCid, "out of space"))
+
+		deal := miner.porcelainAPI.DealGet(dealCid)
+		assert.Equal(storagedeal.Rejected, deal.Response.State)
+		assert.Equal("rejected by the miner: out of space", deal.Response.Message)
+		_, inProcess := miner.getDealProcess(dealCid)
+		assert.False(inProcess)
+
+		// published once the rejection is stored
+		e := <-events
+		assert.Equal(dealCid, e.ProposalCid)
+		assert.Equal(storagedeal.Rejected, e.State)
+		assert.Equal("rejected by the miner: out of space", e.Message)
+	})
+
+	t.Run("does not reject published or staged deals", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		miner, addDeal := setup(require)
+		published := addDeal(storagedeal.Accepted, address.TestAddress)
+		require.NoError(miner.updateDealProcess(published, func(p *dealProcess) { p.Stage = dealStagePublishing }))
+		staged := addDeal(storagedeal.Staged, address.TestAddress)
+
+		err := miner.RejectDeal(published, "")
+		require.Error(err)
+		assert.Contains(err.Error(), "it can only be rejected while its data is being transferred")
+		assert.Equal(storagedeal.Accepted, miner.porcelainAPI.DealGet(published).Response.State)
+
+		err = miner.RejectDeal(staged, "")
+		require.Error(err)
+		assert.Contains(err.Error(), "only accepted deals can be rejected")
+
+		assert.Error(miner.RejectDeal(types.SomeCid(), ""))
+	})
+
+	t.Run("stops the processing of the rejected deal", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		miner, addDeal := setup(require)
+		dealCid := addDeal(storagedeal.Accepted, address.TestAddress)
+
+		fetching := make(chan struct{})
+		miner.dataFetcher = func(ctx context.Context, m *Miner, p *storagedeal.Proposal) error {
+			close(fetching)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			miner.processStorageDeal(dealCid)
+		}()
+
+		<-fetching
+		require.NoError(miner.RejectDeal(dealCid, ""))
+		<-done
+
+		deal := miner.porcelainAPI.DealGet(dealCid)
+		assert.Equal(storagedeal.Rejected, deal.Response.State)
+		assert.Equal("rejected by the miner", deal.Response.Message)
+		_, inProcess := miner.getDealProcess(dealCid)
+		assert.False(inProcess)
+	})
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// dealPolicyProposal is the proposal as given to the deal policy program.
+type dealPolicyProposal struct {
+	Client     address.Address `json:"client"`
+	PieceRef   string          `json:"pieceRef"`
+	Size       uint64          `json:"size"`
+	Duration   uint64          `json:"duration"`
+	TotalPrice *types.AttoFIL  `json:"totalPrice"`
+}
+
+// dealPolicyDecision is the answer of the deal policy program.
+type dealPolicyDecision struct {
+	Accept bool   `json:"accept"`
+	Reason string `json:"reason"`
+}
+
+func (sm *Miner) getDealPolicy() (*config.DealPolicyConfig, error) {
+	dealPolicy, err := sm.porcelainAPI.ConfigGet("mining.dealPolicy")
+	if err != nil {
+		return nil, err
+	}
+	dealPolicyConfig, ok := dealPolicy.(*config.DealPolicyConfig)
+	if !ok {
+		return nil, errors.New("Could not retrieve dealPolicy from config")
+	}
+	return dealPolicyConfig, nil
+}
+
+// validateDealPolicy checks the proposal against the deal policy rules of the
+// miner configuration.
+func (sm *Miner) validateDealPolicy(p *storagedeal.Proposal) error {
+	policy, err := sm.getDealPolicy()
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return nil
+	}
+
+	client := p.Payment.Payer
+	if len(policy.AllowedClients) > 0 && !containsAddress(policy.AllowedClients, client) {
+		return fmt.Errorf("client %s is not allowed to make deals", client)
+	}
+	if containsAddress(policy.DeniedClients, client) {
+		return fmt.Errorf("client %s is denied deals", client)
+	}
+
+	if p.Size == nil {
+		return fmt.Errorf("proposed deal has no size")
+	}
+	size := p.Size.Uint64()
+	if policy.MinPieceSize > 0 && size < policy.MinPieceSize {
+		return fmt.Errorf("piece size (%d) is less than the minimum of %d", size, policy.MinPieceSize)
+	}
+	if policy.MaxPieceSize > 0 && size > policy.MaxPieceSize {
+		return fmt.Errorf("piece size (%d) is more than the maximum of %d", size, policy.MaxPieceSize)
+	}
+
+	if policy.MinDuration > 0 && p.Duration < policy.MinDuration {
+		return fmt.Errorf("duration (%d) is less than the minimum of %d", p.Duration, policy.MinDuration)
+	}
+	if policy.MaxDuration > 0 && p.Duration > policy.MaxDuration {
+		return fmt.Errorf("duration (%d) is more than the maximum of %d", p.Duration, policy.MaxDuration)
+	}
+
+	if policy.MaxUnsealedBytes > 0 && !containsAddress(policy.PreferredClients, client) {
+		unsealed, err := sm.unsealedDealBytes()
+		if err != nil {
+			return err
+		}
+		if unsealed+size > policy.MaxUnsealedBytes {
+			return fmt.Errorf("not enough room for the piece: %d of %d bytes awaiting seal", unsealed, policy.MaxUnsealedBytes)
+		}
+	}
+
+	return nil
+}
+
+// unsealedDealBytes returns the size of the deals the miner accepted that are
+// not yet sealed.
+func (sm *Miner) unsealedDealBytes() (uint64, error) {
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list deals")
+	}
+
+	var unsealed uint64
+	for _, deal := range deals {
+		if deal.Miner != sm.minerAddr || deal.Proposal == nil || deal.Proposal.Size == nil {
+			continue
+		}
+		if deal.Response.State == storagedeal.Accepted || deal.Response.State == storagedeal.Staged {
+			unsealed += deal.Proposal.Size.Uint64()
+		}
+	}
+	return unsealed, nil
+}
+
+// validateDealWithPolicyProgram asks the deal policy program of the miner
+// configuration, if any, whether to accept the proposal.
+func (sm *Miner) validateDealWithPolicyProgram(ctx context.Context, p *storagedeal.Proposal) error {
+	policy, err := sm.getDealPolicy()
+	if err != nil {
+		return err
+	}
+	if policy == nil || policy.Program == "" {
+		return nil
+	}
+
+	timeout := 10 * time.Second
+	if policy.ProgramTimeout != "" {
+		timeout, err = time.ParseDuration(policy.ProgramTimeout)
+		if err != nil {
+			return errors.Wrap(err, "invalid deal policy program timeout")
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	input, err := json.Marshal(dealPolicyProposal{
+		Client:     p.Payment.Payer,
+		PieceRef:   p.PieceRef.String(),
+		Size:       p.Size.Uint64(),
+		Duration:   p.Duration,
+		TotalPrice: p.TotalPrice,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode proposal for deal policy program")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, policy.Program)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		log.Errorf("deal policy program %s failed: %s: %s", policy.Program, err, strings.TrimSpace(stderr.String()))
+		return errors.New("deal policy program failed")
+	}
+
+	var decision dealPolicyDecision
+	if err := json.Unmarshal(stdout.Bytes(), &decision); err != nil {
+		log.Errorf("deal policy program %s gave an invalid answer: %s", policy.Program, err)
+		return errors.New("deal policy program failed")
+	}
+	if !decision.Accept {
+		if decision.Reason == "" {
+			return errors.New("rejected by deal policy")
+		}
+		return errors.New(decision.Reason)
+	}
+
+	return nil
+}
+
+func containsAddress(addrs []address.Address, addr address.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+const dealsInProcessDatastorePrefix = "dealsInProcess"
+
+// dealStage is the step of its processing an accepted deal is at. Every step
+// can be run again, so a deal picks up from its last recorded stage when the
+// miner restarts.
+type dealStage int
+
+const (
+	// dealStageFetching is fetching the data of the deal.
+	dealStageFetching = dealStage(iota)
+	// dealStagePublishing is publishing the deal in the storage market.
+	dealStagePublishing
+	// dealStageAddingPiece is adding the data of the published deal to a
+	// staged sector.
+	dealStageAddingPiece
+	// dealStageStaging is handing the staged piece over to sealing.
+	dealStageStaging
+)
+
+func (s dealStage) String() string {
+	switch s {
+	case dealStageFetching:
+		return "fetching"
+	case dealStagePublishing:
+		return "publishing"
+	case dealStageAddingPiece:
+		return "adding piece"
+	case dealStageStaging:
+		return "staging"
+	default:
+		return fmt.Sprintf("<unrecognized %d>", s)
+	}
+}
+
+// dealProcess records how far the processing of an accepted deal got.
+type dealProcess struct {
+	ProposalCid cid.Cid
+	Stage       dealStage
+	// ClientPeer is the base58 id of the peer that proposed the deal, the
+	// miner pulls the data of the deal from it.
+	ClientPeer string `json:",omitempty"`
+	// PublishMessage is the cid of the publishDeal message, once sent. A
+	// resumed deal waits for it instead of publishing the deal twice.
+	PublishMessage *cid.Cid `json:",omitempty"`
+	// PublishNonce is the nonce of the publishDeal message.
+	PublishNonce uint64 `json:",omitempty"`
+	// PublishHeight is the block height at which the publishDeal message was
+	// sent.
+	PublishHeight *types.BlockHeight `json:",omitempty"`
+	// AddingPiece is set while the piece of the deal is being added to a
+	// staged sector. A resumed deal with it set does not add the piece again.
+	AddingPiece bool `json:",omitempty"`
+	// SectorID is the sector the piece of the deal was added to, once it was.
+	SectorID uint64
+}
+
+// dealProcessSchedule holds the deals the miner accepted and has not yet
+// handed over to sealing, keyed by proposal cid. Deals awaiting seal are
+// tracked by dealsAwaitingSeal.
+type dealProcessSchedule struct {
+	l     sync.Mutex
+	Deals map[string]*dealProcess
+
+	// cancels stop the processing of the deals being processed, keyed by
+	// proposal cid
+	cancels map[string]context.CancelFunc
+}
+
+func (sm *Miner) loadDealsInProcess() error {
+	sm.dealsInProcess = &dealProcessSchedule{
+		Deals: make(map[string]*dealProcess),
+	}
+
+	key := datastore.KeyWithNamespaces([]string{dealsInProcessDatastorePrefix})
+	result, notFound := sm.dealsAwaitingSealDs.Get(key)
+	if notFound == nil {
+		if err := json.Unmarshal(result, &sm.dealsInProcess); err != nil {
+			return errors.Wrap(err, "failed to unmarshal deals in process from datastore")
+		}
+	}
+
+	return nil
+}
+
+// saveDealsInProcess persists the schedule. Callers must hold its lock.
+func (sm *Miner) saveDealsInProcess() error {
+	marshalledDeals, err := json.Marshal(sm.dealsInProcess)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal deals in process")
+	}
+	key := datastore.KeyWithNamespaces([]string{dealsInProcessDatastorePrefix})
+	err = sm.dealsAwaitingSealDs.Put(key, marshalledDeals)
+	if err != nil {
+		return errors.Wrap(err, "could not save deals in process to disk, in-memory deals differ from persisted deals!")
+	}
+
+	return nil
+}
+
+// getDealProcess returns a copy of the processing record of the deal, and
+// false if the deal is not being processed.
+func (sm *Miner) getDealProcess(dealCid cid.Cid) (dealProcess, bool) {
+	sm.dealsInProcess.l.Lock()
+	defer sm.dealsInProcess.l.Unlock()
+
+	process, ok := sm.dealsInProcess.Deals[dealCid.String()]
+	if !ok {
+		return dealProcess{ProposalCid: dealCid}, false
+	}
+	return *process, true
+}
+
+// updateDealProcess applies f to the processing record of the deal, creating
+// it if needed, and persists it.
+func (sm *Miner) updateDealProcess(dealCid cid.Cid, f func(*dealProcess)) error {
+	sm.dealsInProcess.l.Lock()
+	defer sm.dealsInProcess.l.Unlock()
+
+	return sm.updateDealProcessLocked(dealCid, f)
+}
+
+// advanceDealProcess is updateDealProcess for the processing of the deal
+// running with ctx. It fails once ctx is done, so that a deal rejected while
+// processed does not move on.
+func (sm *Miner) advanceDealProcess(ctx context.Context, dealCid cid.Cid, f func(*dealProcess)) error {
+	sm.dealsInProcess.l.Lock()
+	defer sm.dealsInProcess.l.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return sm.updateDealProcessLocked(dealCid, f)
+}
+
+func (sm *Miner) updateDealProcessLocked(dealCid cid.Cid, f func(*dealProcess)) error {
+	process, ok := sm.dealsInProcess.Deals[dealCid.String()]
+	if !ok {
+		process = &dealProcess{ProposalCid: dealCid}
+		sm.dealsInProcess.Deals[dealCid.String()] = process
+	}
+	f(process)
+
+	return sm.saveDealsInProcess()
+}
+
+// startDealProcess registers the cancel func of the processing of the deal.
+// It returns false if the deal is no longer to be processed, as it was
+// rejected in the meantime.
+func (sm *Miner) startDealProcess(dealCid cid.Cid, cancel context.CancelFunc) bool {
+	sm.dealsInProcess.l.Lock()
+	defer sm.dealsInProcess.l.Unlock()
+
+	deal := sm.porcelainAPI.DealGet(dealCid)
+	if deal == nil || (deal.Response.State != storagedeal.Accepted && deal.Response.State != storagedeal.Staged) {
+		return false
+	}
+
+	if sm.dealsInProcess.cancels == nil {
+		sm.dealsInProcess.cancels = make(map[string]context.CancelFunc)
+	}
+	sm.dealsInProcess.cancels[dealCid.String()] = cancel
+	return true
+}
+
+// stopDealProcess unregisters the cancel func of the processing of the deal.
+func (sm *Miner) stopDealProcess(dealCid cid.Cid) {
+	sm.dealsInProcess.l.Lock()
+	defer sm.dealsInProcess.l.Unlock()
+
+	delete(sm.dealsInProcess.cancels, dealCid.String())
+}
+
+// finishDealProcess drops the processing record of the deal.
+func (sm *Miner) finishDealProcess(dealCid cid.Cid) error {
+	sm.dealsInProcess.l.Lock()
+	defer sm.dealsInProcess.l.Unlock()
+
+	delete(sm.dealsInProcess.Deals, dealCid.String())
+	return sm.saveDealsInProcess()
+}
+
+// dealsToResume returns the proposal cids of the deals the miner accepted
+// but had not handed over to sealing when it stopped.
+func (sm *Miner) dealsToResume() ([]cid.Cid, error) {
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list deals")
+	}
+
+	var dealCids []cid.Cid
+	for _, deal := range deals {
+		if deal.Miner != sm.minerAddr {
+			// a deal this node made as a client
+			continue
+		}
+		_, inProcess := sm.getDealProcess(deal.Response.ProposalCid)
+		if deal.Response.State == storagedeal.Accepted || inProcess {
+			dealCids = append(dealCids, deal.Response.ProposalCid)
+		}
+	}
+
+	return dealCids, nil
+}
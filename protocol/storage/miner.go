@@ -16,6 +16,7 @@ import (
 	"gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs"
 	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
 	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
@@ -25,8 +26,10 @@ import (
 	"gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
 
 	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
 	"github.com/filecoin-project/go-filecoin/exec"
@@ -45,6 +48,12 @@ const queryDealProtocol = protocol.ID("/fil/storage/qry/1.0.0")
 // TODO: replace this with a queries to pick reasonable gas price and limits.
 const submitPostGasPrice = 0
 const submitPostGasLimit = 300
+const publishDealGasPrice = 0
+const publishDealGasLimit = 300
+
+// publishDealRetryBlocks is the number of blocks after which a publishDeal
+// message that is neither on chain nor in the message pool is sent again.
+const publishDealRetryBlocks = 10
 
 const waitForPaymentChannelDuration = 2 * time.Minute
 
@@ -52,21 +61,35 @@ const dealsAwatingSealDatastorePrefix = "dealsAwaitingSeal"
 
 // Miner represents a storage miner.
 type Miner struct {
-	minerAddr      address.Address
-	minerOwnerAddr address.Address
+	minerAddr address.Address
 
 	dealsAwaitingSealDs repo.Datastore
 
 	postInProcessLk sync.Mutex
 	postInProcess   *types.BlockHeight
 
+	redeemInProcessLk sync.Mutex
+	redeemInProcess   bool
+
 	dealsAwaitingSeal *dealsAwaitingSealStruct
 
+	voucherRedemptions *voucherRedemptionSchedule
+
+	dealsInProcess *dealProcessSchedule
+
+	// dealResponsesLk serializes the updates of the stored deal responses
+	dealResponsesLk sync.Mutex
+
+	transfers dealTransfers
+
+	events *storagedeal.EventBus
+
 	porcelainAPI minerPorcelain
 	node         node
 
 	proposalAcceptor func(m *Miner, p *storagedeal.Proposal) (*storagedeal.Response, error)
 	proposalRejector func(m *Miner, p *storagedeal.Proposal, reason string) (*storagedeal.Response, error)
+	dataFetcher      func(ctx context.Context, m *Miner, p *storagedeal.Proposal) error
 }
 
 // minerPorcelain is the subset of the porcelain API that storage.Miner needs.
@@ -77,9 +100,13 @@ type minerPorcelain interface {
 	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
 	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
 	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+	MessagePoolGet(cid.Cid) (*types.SignedMessage, bool)
+	ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error)
 	DealsLs() ([]*storagedeal.Deal, error)
 	DealGet(cid.Cid) *storagedeal.Deal
 	DealPut(*storagedeal.Deal) error
+	MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
+	MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
 }
 
 // node is subset of node on which this protocol depends. These deps
@@ -107,15 +134,16 @@ func init() {
 }
 
 // NewMiner is
-func NewMiner(minerAddr, minerOwnerAddr address.Address, nd node, dealsDs repo.Datastore, porcelainAPI minerPorcelain) (*Miner, error) {
+func NewMiner(minerAddr address.Address, nd node, dealsDs repo.Datastore, porcelainAPI minerPorcelain) (*Miner, error) {
 	sm := &Miner{
 		minerAddr:           minerAddr,
-		minerOwnerAddr:      minerOwnerAddr,
 		porcelainAPI:        porcelainAPI,
 		dealsAwaitingSealDs: dealsDs,
 		node:                nd,
 		proposalAcceptor:    acceptProposal,
 		proposalRejector:    rejectProposal,
+		dataFetcher:         transferDealData,
+		events:              storagedeal.NewEventBus(),
 	}
 
 	if err := sm.loadDealsAwaitingSeal(); err != nil {
@@ -124,8 +152,25 @@ func NewMiner(minerAddr, minerOwnerAddr address.Address, nd node, dealsDs repo.D
 	sm.dealsAwaitingSeal.onSuccess = sm.onCommitSuccess
 	sm.dealsAwaitingSeal.onFail = sm.onCommitFail
 
+	if err := sm.loadVoucherRedemptions(); err != nil {
+		return nil, errors.Wrap(err, "failed to load voucher redemptions when creating miner")
+	}
+
+	if err := sm.loadDealsInProcess(); err != nil {
+		return nil, errors.Wrap(err, "failed to load deals in process when creating miner")
+	}
+	dealCids, err := sm.dealsToResume()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find deals to resume when creating miner")
+	}
+	for _, dealCid := range dealCids {
+		go sm.processStorageDeal(dealCid)
+	}
+
 	nd.Host().SetStreamHandler(makeDealProtocol, sm.handleMakeDeal)
 	nd.Host().SetStreamHandler(queryDealProtocol, sm.handleQueryDeal)
+	nd.Host().SetStreamHandler(dataPushProtocol, sm.handleDataPush)
+	nd.Host().SetStreamHandler(dealEventsProtocol, sm.handleDealEvents)
 
 	return sm, nil
 }
@@ -139,6 +184,13 @@ func (sm *Miner) handleMakeDeal(s inet.Stream) {
 		return
 	}
 
+	proposalCid, err := convert.ToCid(&signedProposal.Proposal)
+	if err != nil {
+		log.Errorf("failed to get cid of proposal: %s", err)
+		return
+	}
+	isNew := sm.porcelainAPI.DealGet(proposalCid) == nil
+
 	ctx := context.Background()
 	resp, err := sm.receiveStorageProposal(ctx, &signedProposal)
 	if err != nil {
@@ -146,6 +198,20 @@ func (sm *Miner) handleMakeDeal(s inet.Stream) {
 		return
 	}
 
+	// Remember the peer proposing an accepted deal, it has the data of the
+	// deal, before processing the deal.
+	if isNew && resp.State == storagedeal.Accepted {
+		err := sm.updateDealProcess(proposalCid, func(process *dealProcess) {
+			process.ClientPeer = peer.IDB58Encode(s.Conn().RemotePeer())
+		})
+		if err != nil {
+			log.Errorf("failed to record client peer of proposal: %s", err)
+		}
+
+		// TODO: use some sort of nicer scheduler
+		go sm.processStorageDeal(proposalCid)
+	}
+
 	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
 		log.Errorf("failed to write proposal response: %s", err)
 	}
@@ -164,10 +230,28 @@ func (sm *Miner) receiveStorageProposal(ctx context.Context, sp *storagedeal.Sig
 		return sm.proposalRejector(sm, p, fmt.Sprint("invalid deal signature"))
 	}
 
+	if err := validatePieceCommitment(p); err != nil {
+		return sm.proposalRejector(sm, p, err.Error())
+	}
+
+	if err := sm.validateDealPolicy(p); err != nil {
+		return sm.proposalRejector(sm, p, err.Error())
+	}
+
 	if err := sm.validateDealPayment(ctx, p); err != nil {
 		return sm.proposalRejector(sm, p, err.Error())
 	}
 
+	// The terms signature lets us publish the deal to the storage market.
+	if !storagemarket.VerifyDealSignature(p.Payment.Payer, p.MinerAddress, p.PieceRef, p.Size, p.Duration, p.TotalPrice, p.ClientNonce, p.DealSignature) {
+		return sm.proposalRejector(sm, p, "invalid deal terms signature")
+	}
+
+	// Leave the policy program, possibly slow, for proposals that pass everything else
+	if err := sm.validateDealWithPolicyProgram(ctx, p); err != nil {
+		return sm.proposalRejector(sm, p, err.Error())
+	}
+
 	// Payment is valid, everything else checks out, let's accept this proposal
 	return sm.proposalAcceptor(sm, p)
 }
@@ -197,8 +281,12 @@ func (sm *Miner) validateDealPayment(ctx context.Context, p *storagedeal.Proposa
 	}
 
 	// confirm we are target of channel
-	if channel.Target != sm.minerOwnerAddr {
-		return fmt.Errorf("miner account (%s) is not target of payment channel (%s)", sm.minerOwnerAddr.String(), channel.Target.String())
+	minerOwnerAddr, err := sm.porcelainAPI.MinerGetOwnerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to get miner owner")
+	}
+	if channel.Target != minerOwnerAddr {
+		return fmt.Errorf("miner account (%s) is not target of payment channel (%s)", minerOwnerAddr.String(), channel.Target.String())
 	}
 
 	// confirm channel contains enough funds
@@ -225,12 +313,30 @@ func (sm *Miner) validateDealPayment(ctx context.Context, p *storagedeal.Proposa
 	}
 
 	lastValidAt := expectedFirstPayment
+	var lastNonce uint64
 	for _, v := range p.Payment.Vouchers {
-		// confirm signature is valid against expected actor and channel id
-		if !paymentbroker.VerifyVoucherSignature(p.Payment.Payer, p.Payment.Channel, &v.Amount, &v.ValidAt, v.Signature) {
+		// confirm voucher is for the expected channel and signed by the payer
+		if !v.Channel.Equal(p.Payment.Channel) {
+			return fmt.Errorf("voucher for channel %s does not match payment channel %s", v.Channel.String(), p.Payment.Channel.String())
+		}
+		if !paymentbroker.VerifyVoucherSignature(p.Payment.Payer, v) {
 			return errors.New("invalid signature in voucher")
 		}
 
+		// the miner has nothing to reveal for storage, so it could never redeem a hash-locked voucher
+		if len(v.HashLock) > 0 {
+			return errors.New("voucher is hash-locked")
+		}
+
+		// vouchers must be redeemable in order: one lane, increasing nonces
+		if v.Lane != p.Payment.Vouchers[0].Lane {
+			return fmt.Errorf("vouchers span several lanes (%d != %d)", v.Lane, p.Payment.Vouchers[0].Lane)
+		}
+		if v.Nonce <= lastNonce {
+			return fmt.Errorf("voucher nonces do not increase (%d <= %d)", v.Nonce, lastNonce)
+		}
+		lastNonce = v.Nonce
+
 		// make sure voucher validAt is not spaced to far apart
 		expectedValidAt := lastValidAt.Add(types.NewBlockHeight(VoucherInterval))
 		if v.ValidAt.GreaterThan(expectedValidAt) {
@@ -264,6 +370,18 @@ func (sm *Miner) validateDealPayment(ctx context.Context, p *storagedeal.Proposa
 	return nil
 }
 
+func (sm *Miner) getDealCollateral() (*types.AttoFIL, error) {
+	dealCollateral, err := sm.porcelainAPI.ConfigGet("mining.dealCollateral")
+	if err != nil {
+		return nil, err
+	}
+	dealCollateralAF, ok := dealCollateral.(*types.AttoFIL)
+	if !ok {
+		return nil, errors.New("Could not retrieve dealCollateral from config")
+	}
+	return dealCollateralAF, nil
+}
+
 func (sm *Miner) getStoragePrice() (*types.AttoFIL, error) {
 	storagePrice, err := sm.porcelainAPI.ConfigGet("mining.storagePrice")
 	if err != nil {
@@ -293,8 +411,19 @@ func (sm *Miner) getPaymentChannel(ctx context.Context, p *storagedeal.Proposal)
 		return nil, err
 	}
 
-	payer := p.Payment.Payer
+	channel, err := sm.paymentChannel(ctx, p.Payment.Payer, p.Payment.Channel)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, fmt.Errorf("could not find payment channel for payer %s and id %s", p.Payment.Payer.String(), p.Payment.Channel.KeyString())
+	}
+	return channel, nil
+}
 
+// paymentChannel returns the payment channel of the payer with the given id,
+// or nil if there is none.
+func (sm *Miner) paymentChannel(ctx context.Context, payer address.Address, chid *types.ChannelID) (*paymentbroker.PaymentChannel, error) {
 	ret, _, err := sm.porcelainAPI.MessageQuery(ctx, address.Address{}, address.PaymentBrokerAddress, "ls", payer)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error getting payment channel for payer")
@@ -304,11 +433,7 @@ func (sm *Miner) getPaymentChannel(ctx context.Context, p *storagedeal.Proposal)
 	if err := cbor.DecodeInto(ret[0], &channels); err != nil {
 		return nil, errors.Wrap(err, "Could not decode payment channels for payer")
 	}
-	channel, ok := channels[p.Payment.Channel.KeyString()]
-	if !ok {
-		return nil, fmt.Errorf("could not find payment channel for payer %s and id %s", payer.String(), p.Payment.Channel.KeyString())
-	}
-	return channel, nil
+	return channels[chid.KeyString()], nil
 }
 
 func acceptProposal(sm *Miner, p *storagedeal.Proposal) (*storagedeal.Response, error) {
@@ -336,9 +461,7 @@ func acceptProposal(sm *Miner, p *storagedeal.Proposal) (*storagedeal.Response,
 	if err := sm.porcelainAPI.DealPut(storageDeal); err != nil {
 		return nil, errors.Wrap(err, "Could not persist miner deal")
 	}
-
-	// TODO: use some sort of nicer scheduler
-	go sm.processStorageDeal(proposalCid)
+	sm.publishDealEvent(&storagedeal.Event{ProposalCid: proposalCid, Kind: storagedeal.StateChanged})
 
 	return resp, nil
 }
@@ -364,25 +487,48 @@ func rejectProposal(sm *Miner, p *storagedeal.Proposal, reason string) (*storage
 	if err := sm.porcelainAPI.DealPut(storageDeal); err != nil {
 		return nil, errors.Wrap(err, "failed to save miner deal")
 	}
+	sm.publishDealEvent(&storagedeal.Event{ProposalCid: proposalCid, Kind: storagedeal.StateChanged})
 
 	return resp, nil
 }
 
 func (sm *Miner) updateDealResponse(proposalCid cid.Cid, f func(*storagedeal.Response)) error {
+	storageDeal, stateChanged, err := sm.storeDealResponse(proposalCid, f)
+	if err != nil {
+		return err
+	}
+	if stateChanged {
+		sm.publishDealEvent(&storagedeal.Event{ProposalCid: proposalCid, Kind: storagedeal.StateChanged})
+	}
+
+	log.Debugf("Miner.updatedeal.Response(%s) - %d", proposalCid.String(), storageDeal.Response)
+	return nil
+}
+
+// storeDealResponse applies f to the stored response of the deal and returns
+// the deal, and whether f changed its state. Updates are serialized so that
+// none is lost.
+func (sm *Miner) storeDealResponse(proposalCid cid.Cid, f func(*storagedeal.Response)) (*storagedeal.Deal, bool, error) {
+	sm.dealResponsesLk.Lock()
+	defer sm.dealResponsesLk.Unlock()
+
 	storageDeal := sm.porcelainAPI.DealGet(proposalCid)
 	if storageDeal == nil {
-		return fmt.Errorf("failed to get retrive deal with proposal CID %s", proposalCid.String())
+		return nil, false, fmt.Errorf("failed to get retrive deal with proposal CID %s", proposalCid.String())
 	}
+	oldState := storageDeal.Response.State
 	f(storageDeal.Response)
 	err := sm.porcelainAPI.DealPut(storageDeal)
 	if err != nil {
-		return errors.Wrap(err, "failed to store updated deal response in datastore")
+		return nil, false, errors.Wrap(err, "failed to store updated deal response in datastore")
 	}
-
-	log.Debugf("Miner.updatedeal.Response(%s) - %d", proposalCid.String(), storageDeal.Response)
-	return nil
+	return storageDeal, storageDeal.Response.State != oldState, nil
 }
 
+// processStorageDeal takes an accepted deal through fetching its data,
+// publishing it and adding its piece to a sector, then hands it over to
+// sealing. The stage reached is persisted, so a deal the miner was processing
+// when it stopped resumes where it left off.
 func (sm *Miner) processStorageDeal(c cid.Cid) {
 	log.Debugf("Miner.processStorageDeal(%s)", c.String())
 	ctx, cancel := context.WithCancel(context.Background())
@@ -391,31 +537,34 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 	d := sm.porcelainAPI.DealGet(c)
 	if d == nil {
 		log.Errorf("could not retrieve deal with proposal CID %s", c.String())
+		return
 	}
-	if d.Response.State != storagedeal.Accepted {
-		// TODO: handle resumption of deal processing across miner restarts
+
+	process, inProcess := sm.getDealProcess(c)
+	if d.Response.State != storagedeal.Accepted && !(inProcess && d.Response.State == storagedeal.Staged) {
+		if inProcess {
+			// the deal moved on before its record was dropped
+			if err := sm.finishDealProcess(c); err != nil {
+				log.Errorf("could not drop processing record of deal %s: %s", c, err)
+			}
+			return
+		}
 		log.Error("attempted to process an already started deal")
 		return
 	}
+	log.Debugf("processing deal %s from stage %s", c, process.Stage)
 
-	// 'Receive' the data, this could also be a truck full of hard drives. (TODO: proper abstraction)
-	// TODO: this is not a great way to do this. At least use a session
-	// Also, this needs to be fetched into a staging area for miners to prepare and seal in data
-	log.Debug("Miner.processStorageDeal - FetchGraph")
-	if err := dag.FetchGraph(ctx, d.Proposal.PieceRef, dag.NewDAGService(sm.node.BlockService())); err != nil {
-		log.Errorf("failed to fetch data: %s", err)
-		err := sm.updateDealResponse(c, func(resp *storagedeal.Response) {
-			resp.Message = "Transfer failed"
-			resp.State = storagedeal.Failed
-			// TODO: signature?
-		})
-		if err != nil {
-			log.Errorf("could not update to deal to 'Failed' state: %s", err)
-		}
+	if !sm.startDealProcess(c, cancel) {
+		log.Infof("deal %s was rejected before its processing started", c)
 		return
 	}
+	defer sm.stopDealProcess(c)
 
 	fail := func(message, logerr string) {
+		if ctx.Err() != nil {
+			log.Infof("stopped processing deal %s, it was rejected", c)
+			return
+		}
 		log.Errorf(logerr)
 		err := sm.updateDealResponse(c, func(resp *storagedeal.Response) {
 			resp.Message = message
@@ -424,29 +573,108 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 		if err != nil {
 			log.Errorf("could not update to deal to 'Failed' state in fail callback: %s", err)
 		}
+		if err := sm.finishDealProcess(c); err != nil {
+			log.Errorf("could not drop processing record of failed deal: %s", err)
+		}
 	}
 
-	pi := &sectorbuilder.PieceInfo{
-		Ref:  d.Proposal.PieceRef,
-		Size: d.Proposal.Size.Uint64(),
+	advance := func(f func(*dealProcess)) bool {
+		if err := sm.advanceDealProcess(ctx, c, f); err != nil {
+			fail("failed to record deal progress", fmt.Sprintf("failed to record progress of deal %s: %s", c, err))
+			return false
+		}
+		process, _ = sm.getDealProcess(c)
+		return true
 	}
 
-	// There is a race here that requires us to use dealsAwaitingSeal below. If the
-	// sector gets sealed and OnCommitmentAddedToChain is called right after
-	// AddPiece returns but before we record the sector/deal mapping we might
-	// miss it. Hence, dealsAwaitingSealStruct. I'm told that sealing in practice is
-	// so slow that the race only exists in tests, but tests were flaky so
-	// we fixed it with dealsAwaitingSealStruct.
-	//
-	// Also, this pattern of not being able to set up book-keeping ahead of
-	// the call is inelegant.
-	sectorID, err := sm.node.SectorBuilder().AddPiece(ctx, pi)
-	if err != nil {
-		fail("failed to submit seal proof", fmt.Sprintf("failed to add piece: %s", err))
+	if process.Stage == dealStageFetching {
+		// TODO: this needs to be fetched into a staging area for miners to prepare and seal in data
+		log.Debug("Miner.processStorageDeal - fetch data")
+		if err := sm.dataFetcher(ctx, sm, d.Proposal); err != nil {
+			fail("Transfer failed", fmt.Sprintf("failed to fetch data: %s", err))
+			return
+		}
+		if !advance(func(p *dealProcess) { p.Stage = dealStagePublishing }) {
+			return
+		}
+	}
+
+	if process.Stage == dealStagePublishing {
+		log.Debug("Miner.processStorageDeal - publishDeal")
+		dealID, err := sm.publishDeal(ctx, c, d.Proposal)
+		if err != nil {
+			fail("failed to publish deal", fmt.Sprintf("failed to publish deal: %s", err))
+			return
+		}
+		err = sm.updateDealResponse(c, func(resp *storagedeal.Response) {
+			resp.DealID = dealID
+		})
+		if err != nil {
+			log.Errorf("could not record published deal id: %s", err)
+		}
+		if !advance(func(p *dealProcess) { p.Stage = dealStageAddingPiece }) {
+			return
+		}
+	}
+
+	if process.Stage == dealStageAddingPiece && process.AddingPiece {
+		// The miner stopped while adding the piece, which may be staged
+		// already. Adding it again could store it twice, so the deal waits
+		// for a sealed sector holding its piece instead.
+		log.Warningf("deal %s was interrupted while adding its piece, waiting for a sector holding it", c)
+		if err := sm.updateDealResponse(c, func(resp *storagedeal.Response) {
+			resp.State = storagedeal.Staged
+		}); err != nil {
+			log.Errorf("could update to 'Staged': %s", err)
+		}
+		sm.dealsAwaitingSeal.addPiece(d.Proposal.PieceRef, c)
+		if err := sm.saveDealsAwaitingSeal(); err != nil {
+			log.Errorf("could not save deal awaiting seal: %s", err)
+			return
+		}
+		if err := sm.finishDealProcess(c); err != nil {
+			log.Errorf("could not drop processing record of staged deal: %s", err)
+		}
 		return
 	}
 
-	err = sm.updateDealResponse(c, func(resp *storagedeal.Response) {
+	if process.Stage == dealStageAddingPiece {
+		pi := &sectorbuilder.PieceInfo{
+			Ref:  d.Proposal.PieceRef,
+			Size: d.Proposal.Size.Uint64(),
+		}
+
+		if !advance(func(p *dealProcess) { p.AddingPiece = true }) {
+			return
+		}
+
+		// There is a race here that requires us to use dealsAwaitingSeal below. If the
+		// sector gets sealed and OnCommitmentAddedToChain is called right after
+		// AddPiece returns but before we record the sector/deal mapping we might
+		// miss it. Hence, dealsAwaitingSealStruct. I'm told that sealing in practice is
+		// so slow that the race only exists in tests, but tests were flaky so
+		// we fixed it with dealsAwaitingSealStruct.
+		//
+		// Also, this pattern of not being able to set up book-keeping ahead of
+		// the call is inelegant. AddingPiece is recorded before the call, so a
+		// miner stopping before the sector is recorded does not add the piece
+		// again when it resumes.
+		sectorID, err := sm.node.SectorBuilder().AddPiece(ctx, pi)
+		if err != nil {
+			fail("failed to submit seal proof", fmt.Sprintf("failed to add piece: %s", err))
+			return
+		}
+		if !advance(func(p *dealProcess) {
+			p.Stage = dealStageStaging
+			p.AddingPiece = false
+			p.SectorID = sectorID
+		}) {
+			return
+		}
+		sm.publishDealEvent(&storagedeal.Event{ProposalCid: c, Kind: storagedeal.SectorAssigned, SectorID: sectorID})
+	}
+
+	err := sm.updateDealResponse(c, func(resp *storagedeal.Response) {
 		resp.State = storagedeal.Staged
 	})
 	if err != nil {
@@ -455,10 +683,245 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 
 	// Careful: this might update state to success or failure so it should go after
 	// updating state to Staged.
-	sm.dealsAwaitingSeal.add(sectorID, c)
+	sm.dealsAwaitingSeal.add(process.SectorID, c)
 	if err := sm.saveDealsAwaitingSeal(); err != nil {
 		log.Errorf("could not save deal awaiting seal: %s", err)
+		return
+	}
+
+	// from here on dealsAwaitingSeal tracks the deal
+	if err := sm.finishDealProcess(c); err != nil {
+		log.Errorf("could not drop processing record of staged deal: %s", err)
+	}
+}
+
+// publishDeal records the deal in the storage market actor, putting up the
+// configured collateral, and returns the id the deal was published under. If
+// the publishDeal message was already sent, it waits for that one instead. A
+// message that is lost is sent again, unless the deal made it to chain.
+func (sm *Miner) publishDeal(ctx context.Context, dealCid cid.Cid, p *storagedeal.Proposal) (uint64, error) {
+	for {
+		process, _ := sm.getDealProcess(dealCid)
+		if process.PublishMessage == nil {
+			if err := sm.sendPublishDeal(ctx, dealCid, p); err != nil {
+				return 0, err
+			}
+			process, _ = sm.getDealProcess(dealCid)
+		}
+
+		dealID, lost, err := sm.waitForPublishDeal(ctx, process)
+		if err != nil || !lost {
+			return dealID, err
+		}
+
+		dealID, err = sm.findPublishedDeal(ctx, process, p)
+		if err != nil {
+			return 0, err
+		}
+		if dealID != 0 {
+			return dealID, nil
+		}
+
+		log.Infof("publishDeal message %s of deal %s was lost, sending it again", process.PublishMessage, dealCid)
+		err = sm.updateDealProcess(dealCid, func(process *dealProcess) {
+			process.PublishMessage = nil
+		})
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to drop lost publishDeal message")
+		}
+	}
+}
+
+// sendPublishDeal sends the publishDeal message of the deal and records it
+// with the deal's processing.
+func (sm *Miner) sendPublishDeal(ctx context.Context, dealCid cid.Cid, p *storagedeal.Proposal) error {
+	collateral, err := sm.getDealCollateral()
+	if err != nil {
+		return err
 	}
+
+	workerAddr, err := sm.porcelainAPI.MinerGetWorkerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to get miner worker")
+	}
+
+	height, err := sm.porcelainAPI.ChainBlockHeight(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get block height")
+	}
+
+	msgCid, err := sm.porcelainAPI.MessageSend(
+		ctx,
+		workerAddr,
+		address.StorageMarketAddress,
+		collateral,
+		types.NewGasPrice(publishDealGasPrice),
+		types.NewGasUnits(publishDealGasLimit),
+		"publishDeal",
+		p.Payment.Payer,
+		sm.minerAddr,
+		p.PieceRef.Bytes(),
+		p.Size,
+		big.NewInt(0).SetUint64(p.Duration),
+		p.TotalPrice,
+		big.NewInt(0).SetUint64(p.ClientNonce),
+		[]byte(p.DealSignature),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to send publishDeal message")
+	}
+	// a message already gone from the pool keeps a zero nonce, which has the
+	// chain checked for the deal if the message is lost
+	var nonce uint64
+	if msg, ok := sm.porcelainAPI.MessagePoolGet(msgCid); ok {
+		nonce = uint64(msg.Nonce)
+	}
+
+	err = sm.updateDealProcess(dealCid, func(process *dealProcess) {
+		process.PublishMessage = &msgCid
+		process.PublishNonce = nonce
+		process.PublishHeight = height
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to record publishDeal message")
+	}
+	return nil
+}
+
+// waitForPublishDeal waits for the publishDeal message of the deal to land
+// on chain and returns the id of the published deal. It gives up and returns
+// lost once the message has been neither on chain nor in the message pool for
+// publishDealRetryBlocks blocks.
+func (sm *Miner) waitForPublishDeal(ctx context.Context, process dealProcess) (dealID uint64, lost bool, err error) {
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lostCh := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(sm.node.GetBlockTime())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-waitCtx.Done():
+				return
+			case <-ticker.C:
+				if sm.publishDealLost(waitCtx, process) {
+					close(lostCh)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err = sm.porcelainAPI.MessageWait(waitCtx, *process.PublishMessage, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+		if receipt.ExitCode != uint8(0) {
+			return fmt.Errorf("publishDeal failed with exit code %d", receipt.ExitCode)
+		}
+		dealID = big.NewInt(0).SetBytes(receipt.Return[0]).Uint64()
+		return nil
+	})
+	if err == nil {
+		return dealID, false, nil
+	}
+	select {
+	case <-lostCh:
+		return 0, true, nil
+	default:
+		return 0, false, err
+	}
+}
+
+// publishDealLost returns true if the publishDeal message of the deal left
+// the message pool and publishDealRetryBlocks blocks passed since it was sent.
+func (sm *Miner) publishDealLost(ctx context.Context, process dealProcess) bool {
+	if _, ok := sm.porcelainAPI.MessagePoolGet(*process.PublishMessage); ok {
+		return false
+	}
+	if process.PublishHeight == nil {
+		return true
+	}
+
+	height, err := sm.porcelainAPI.ChainBlockHeight(ctx)
+	if err != nil {
+		log.Errorf("failed to get block height: %s", err)
+		return false
+	}
+	return height.GreaterEqual(process.PublishHeight.Add(types.NewBlockHeight(publishDealRetryBlocks)))
+}
+
+// findPublishedDeal returns the id of the deal if a publishDeal message for
+// it made it to chain, or zero if none did. The chain is only checked once the
+// nonce of the lost message was used by the worker, before that the message
+// cannot have landed.
+func (sm *Miner) findPublishedDeal(ctx context.Context, process dealProcess, p *storagedeal.Proposal) (uint64, error) {
+	workerAddr, err := sm.porcelainAPI.MinerGetWorkerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get miner worker")
+	}
+	worker, err := sm.porcelainAPI.ActorGet(ctx, workerAddr)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get worker %s", workerAddr)
+	}
+	if uint64(worker.Nonce) <= process.PublishNonce {
+		return 0, nil
+	}
+
+	res, _, err := sm.porcelainAPI.MessageQuery(ctx, address.Address{}, address.StorageMarketAddress, "getPublishedDealID", p.Payment.Payer, big.NewInt(0).SetUint64(p.ClientNonce))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to look up published deal")
+	}
+	dealID := big.NewInt(0).SetBytes(res[0]).Uint64()
+	if dealID == 0 {
+		return 0, nil
+	}
+
+	res, _, err = sm.porcelainAPI.MessageQuery(ctx, address.Address{}, address.StorageMarketAddress, "getDeal", big.NewInt(0).SetUint64(dealID))
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get published deal %d", dealID)
+	}
+	var deal storagemarket.Deal
+	if err := cbor.DecodeInto(res[0], &deal); err != nil {
+		return 0, errors.Wrapf(err, "failed to decode published deal %d", dealID)
+	}
+	if deal.Miner != sm.minerAddr || !deal.PieceRef.Equals(p.PieceRef) {
+		return 0, fmt.Errorf("client nonce %d was used in deal %d with miner %s", p.ClientNonce, dealID, deal.Miner)
+	}
+	return dealID, nil
+}
+
+// SectorDeals returns the storage market ids of the published deals with
+// pieces in the sealed sector, in the order of the pieces. Pieces whose deal
+// is not published (yet) are skipped, so their deals stay published. The
+// deals are activated on chain when the sector is committed.
+func (sm *Miner) SectorDeals(sector *sectorbuilder.SealedSectorMetadata) []uint64 {
+	sm.dealsAwaitingSeal.l.Lock()
+	dealCids := append([]cid.Cid{}, sm.dealsAwaitingSeal.SectorsToDeals[sector.SectorID]...)
+	for _, piece := range sector.Pieces {
+		if dealCid, ok := sm.dealsAwaitingSeal.PiecesToDeals[piece.Ref.String()]; ok {
+			dealCids = append(dealCids, dealCid)
+		}
+	}
+	sm.dealsAwaitingSeal.l.Unlock()
+
+	dealsByPiece := make(map[cid.Cid]uint64)
+	for _, dealCid := range dealCids {
+		deal := sm.porcelainAPI.DealGet(dealCid)
+		if deal != nil && deal.Response.DealID != 0 {
+			dealsByPiece[deal.Proposal.PieceRef] = deal.Response.DealID
+		}
+	}
+
+	dealIDs := []uint64{}
+	for _, piece := range sector.Pieces {
+		dealID, ok := dealsByPiece[piece.Ref]
+		if !ok {
+			log.Warningf("no published deal for piece %s of sector %d", piece.Ref, sector.SectorID)
+			continue
+		}
+		dealIDs = append(dealIDs, dealID)
+	}
+	return dealIDs
 }
 
 // dealsAwaitingSealStruct is a container for keeping track of which sectors have
@@ -474,6 +937,10 @@ type dealsAwaitingSealStruct struct {
 	SuccessfulSectors map[uint64]*sectorbuilder.SealedSectorMetadata
 	// Maps from sector id to seal failure error string.
 	FailedSectors map[uint64]string
+	// Maps from piece cid to the deal cid of a piece whose sector is not
+	// known, as the miner stopped while adding it. The deal is matched to the
+	// first sealed sector holding the piece.
+	PiecesToDeals map[string]cid.Cid
 
 	onSuccess func(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata)
 	onFail    func(dealCid cid.Cid, message string)
@@ -484,6 +951,7 @@ func (sm *Miner) loadDealsAwaitingSeal() error {
 		SectorsToDeals:    make(map[uint64][]cid.Cid),
 		SuccessfulSectors: make(map[uint64]*sectorbuilder.SealedSectorMetadata),
 		FailedSectors:     make(map[uint64]string),
+		PiecesToDeals:     make(map[string]cid.Cid),
 	}
 
 	key := datastore.KeyWithNamespaces([]string{dealsAwatingSealDatastorePrefix})
@@ -539,6 +1007,26 @@ func (dealsAwaitingSeal *dealsAwaitingSealStruct) add(sectorID uint64, dealCid c
 	}
 }
 
+// addPiece records a deal whose piece is in a sector not known to the miner.
+func (dealsAwaitingSeal *dealsAwaitingSealStruct) addPiece(pieceRef cid.Cid, dealCid cid.Cid) {
+	dealsAwaitingSeal.l.Lock()
+	defer dealsAwaitingSeal.l.Unlock()
+
+	for _, sector := range dealsAwaitingSeal.SuccessfulSectors {
+		for _, piece := range sector.Pieces {
+			if piece.Ref.Equals(pieceRef) {
+				dealsAwaitingSeal.onSuccess(dealCid, sector)
+				return
+			}
+		}
+	}
+
+	if dealsAwaitingSeal.PiecesToDeals == nil {
+		dealsAwaitingSeal.PiecesToDeals = make(map[string]cid.Cid)
+	}
+	dealsAwaitingSeal.PiecesToDeals[pieceRef.String()] = dealCid
+}
+
 func (dealsAwaitingSeal *dealsAwaitingSealStruct) success(sector *sectorbuilder.SealedSectorMetadata) {
 	dealsAwaitingSeal.l.Lock()
 	defer dealsAwaitingSeal.l.Unlock()
@@ -549,6 +1037,13 @@ func (dealsAwaitingSeal *dealsAwaitingSealStruct) success(sector *sectorbuilder.
 		dealsAwaitingSeal.onSuccess(dealCid, sector)
 	}
 	delete(dealsAwaitingSeal.SectorsToDeals, sector.SectorID)
+
+	for _, piece := range sector.Pieces {
+		if dealCid, ok := dealsAwaitingSeal.PiecesToDeals[piece.Ref.String()]; ok {
+			dealsAwaitingSeal.onSuccess(dealCid, sector)
+			delete(dealsAwaitingSeal.PiecesToDeals, piece.Ref.String())
+		}
+	}
 }
 
 func (dealsAwaitingSeal *dealsAwaitingSealStruct) fail(sectorID uint64, message string) {
@@ -593,6 +1088,11 @@ func (sm *Miner) onCommitSuccess(dealCid cid.Cid, sector *sectorbuilder.SealedSe
 	if err != nil {
 		log.Errorf("commit succeeded but could not update to deal 'Posted' state: %s", err)
 	}
+	sm.publishDealEvent(&storagedeal.Event{ProposalCid: dealCid, Kind: storagedeal.Committed, SectorID: sector.SectorID})
+
+	if err := sm.scheduleVoucherRedemption(dealCid); err != nil {
+		log.Errorf("commit succeeded but could not schedule voucher redemption: %s", err)
+	}
 }
 
 func (sm *Miner) onCommitFail(dealCid cid.Cid, message string) {
@@ -604,10 +1104,17 @@ func (sm *Miner) onCommitFail(dealCid cid.Cid, message string) {
 }
 
 // OnNewHeaviestTipSet is a callback called by node, everytime the the latest head is updated.
-// It is used to check if we are in a new proving period and need to trigger PoSt submission.
+// It is used to redeem payment vouchers that became valid, and to check if we are in a new
+// proving period and need to trigger PoSt submission.
 func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 	ctx := context.Background()
 
+	if height, err := ts.Height(); err != nil {
+		log.Errorf("failed to get block height to redeem vouchers: %s", err)
+	} else {
+		sm.startVoucherRedemption(types.NewBlockHeight(height))
+	}
+
 	rets, sig, err := sm.porcelainAPI.MessageQuery(
 		ctx,
 		address.Address{},
@@ -673,17 +1180,25 @@ func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 	}
 
 	h := types.NewBlockHeight(height)
-	provingPeriodEnd := provingPeriodStart.Add(miner.ProvingPeriodBlocks)
+	provingPeriodEnd, err := sm.getProvingPeriodEnd()
+	if err != nil {
+		log.Errorf("failed to get provingPeriodEnd: %s", err)
+		return
+	}
+	gracePeriodEnd := provingPeriodEnd.Add(miner.GracePeriodBlocks)
 
 	if h.GreaterEqual(provingPeriodStart) {
-		if h.LessThan(provingPeriodEnd) {
-			// we are in a new proving period, lets get this post going
+		if h.LessEqual(gracePeriodEnd) {
+			// we are in a new proving period, or late but within its grace
+			// period, lets get this post going
 			sm.postInProcess = provingPeriodStart
-			go sm.submitPoSt(provingPeriodStart, provingPeriodEnd, inputs)
+			go sm.submitPoSt(provingPeriodStart, gracePeriodEnd, inputs)
 		} else {
-			// we are too late
-			// TODO: figure out faults and payments here
-			log.Errorf("too late start=%s  end=%s current=%s", provingPeriodStart, provingPeriodEnd, h)
+			// We are too late and will be slashed for it. Report the missed
+			// post ourselves so that we can prove again in the next period.
+			log.Errorf("missed proving period start=%s end=%s current=%s", provingPeriodStart, provingPeriodEnd, h)
+			sm.postInProcess = provingPeriodStart
+			go sm.reportMissedPoSt()
 		}
 	}
 }
@@ -702,6 +1217,23 @@ func (sm *Miner) getProvingPeriodStart() (*types.BlockHeight, error) {
 	return types.NewBlockHeightFromBytes(res[0]), nil
 }
 
+// getProvingPeriodEnd returns the end of the current proving period as the
+// miner actor computes it, under the proving period length of the protocol
+// rules in effect.
+func (sm *Miner) getProvingPeriodEnd() (*types.BlockHeight, error) {
+	res, _, err := sm.porcelainAPI.MessageQuery(
+		context.Background(),
+		address.Address{},
+		sm.minerAddr,
+		"getProvingPeriodEnd",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewBlockHeightFromBytes(res[0]), nil
+}
+
 // generatePoSt creates the required PoSt, given a list of sector ids and
 // matching seeds. It returns the Snark Proof for the PoSt, and a list of
 // sectors that faulted, if there were any faults.
@@ -730,14 +1262,24 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePost
 		commRs[i] = input.commR
 	}
 
-	proofs, faults, err := sm.generatePoSt(commRs, seed)
+	proofs, faultIndices, err := sm.generatePoSt(commRs, seed)
 	if err != nil {
 		log.Errorf("failed to generate PoSts: %s", err)
 		return
 	}
+
+	// faults are reported by index into commRs, the miner actor expects
+	// sector ids
+	faults := make([]uint64, 0, len(faultIndices))
+	for _, i := range faultIndices {
+		if i >= uint64(len(inputs)) {
+			log.Errorf("PoSt generation reported an unknown fault: %d", i)
+			return
+		}
+		faults = append(faults, inputs[i].sectorID)
+	}
 	if len(faults) != 0 {
-		log.Warningf("some faults when generating PoSt: %v", faults)
-		// TODO: proper fault handling
+		log.Warningf("declaring faulted sectors with PoSt, their collateral will be slashed: %v", faults)
 	}
 
 	height, err := sm.node.BlockHeight()
@@ -752,8 +1294,9 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePost
 		return
 	}
 
-	if height.GreaterEqual(end) {
-		// TODO: we are too late, figure out faults and decide if we want to still submit
+	if height.GreaterThan(end) {
+		// too late even for the grace period, the missed post is reported
+		// once a new tipset shows we are past it
 		log.Errorf("PoSt generation was too slow height=%s end=%s", height, end)
 		return
 	}
@@ -766,13 +1309,85 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePost
 	gasPrice := types.NewGasPrice(submitPostGasPrice)
 	gasLimit := types.NewGasUnits(submitPostGasLimit)
 
-	_, err = sm.porcelainAPI.MessageSend(ctx, sm.minerOwnerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "submitPoSt", proofs)
+	workerAddr, err := sm.porcelainAPI.MinerGetWorkerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		log.Errorf("failed to get miner worker: %s", err)
+		return
+	}
+
+	msgCid, err := sm.porcelainAPI.MessageSend(ctx, workerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "submitPoSt", proofs, faults)
 	if err != nil {
 		log.Errorf("failed to submit PoSt: %s", err)
 		return
 	}
 
 	log.Debug("submitted PoSt")
+
+	err = sm.porcelainAPI.MessageWait(ctx, msgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+		if receipt.ExitCode != uint8(0) {
+			return fmt.Errorf("submitPoSt failed with exit code %d", receipt.ExitCode)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("failed to wait for PoSt: %s", err)
+		return
+	}
+
+	faulted := make(map[uint64]bool)
+	for _, sectorID := range faults {
+		faulted[sectorID] = true
+	}
+	proven := make(map[uint64]bool)
+	for _, input := range inputs {
+		if !faulted[input.sectorID] {
+			proven[input.sectorID] = true
+		}
+	}
+	sm.publishPoStProven(proven)
+}
+
+// publishPoStProven publishes a PoStProven event for each deal with its piece
+// in one of the proven sectors.
+func (sm *Miner) publishPoStProven(proven map[uint64]bool) {
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		log.Errorf("failed to list deals to publish proven PoSt: %s", err)
+		return
+	}
+
+	for _, deal := range deals {
+		if deal.Miner != sm.minerAddr || deal.Response.ProofInfo == nil {
+			continue
+		}
+		if proven[deal.Response.ProofInfo.SectorID] {
+			sm.publishDealEvent(&storagedeal.Event{ProposalCid: deal.Response.ProposalCid, Kind: storagedeal.PoStProven})
+		}
+	}
+}
+
+// reportMissedPoSt reports that the miner missed its current proving period,
+// accepting the penalty and moving it on to the next one.
+func (sm *Miner) reportMissedPoSt() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	gasPrice := types.NewGasPrice(submitPostGasPrice)
+	gasLimit := types.NewGasUnits(submitPostGasLimit)
+
+	workerAddr, err := sm.porcelainAPI.MinerGetWorkerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		log.Errorf("failed to get miner worker: %s", err)
+		return
+	}
+
+	_, err = sm.porcelainAPI.MessageSend(ctx, workerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "reportMissedPoSt")
+	if err != nil {
+		log.Errorf("failed to report missed PoSt: %s", err)
+		return
+	}
+
+	log.Debug("reported missed PoSt")
 }
 
 // Query responds to a query for the proposal referenced by the given cid
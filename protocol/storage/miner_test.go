@@ -2,7 +2,15 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 
@@ -10,12 +18,17 @@ import (
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+	"gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
 
 	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
+	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
 	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -36,8 +49,7 @@ func TestReceiveStorageProposal(t *testing.T) {
 
 		porcelainAPI := newMinerTestPorcelain(require)
 		miner := Miner{
-			porcelainAPI:   porcelainAPI,
-			minerOwnerAddr: porcelainAPI.targetAddress,
+			porcelainAPI: porcelainAPI,
 			proposalAcceptor: func(m *Miner, p *storagedeal.Proposal) (*storagedeal.Response, error) {
 				accepted = true
 				return &storagedeal.Response{State: storagedeal.Accepted}, nil
@@ -95,9 +107,8 @@ func TestReceiveStorageProposal(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
 
-		_, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
-
-		miner.minerOwnerAddr = address.TestAddress
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		porcelainAPI.ownerAddress = address.TestAddress
 
 		res, err := miner.receiveStorageProposal(context.Background(), proposal)
 		require.NoError(err)
@@ -151,6 +162,46 @@ func TestReceiveStorageProposal(t *testing.T) {
 		assert.Contains(res.Message, "invalid signature in voucher")
 	})
 
+	t.Run("Rejects proposals with vouchers whose nonces do not increase", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, _ := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+
+		vouchers := testPaymentVouchers(porcelainAPI, VoucherInterval, defaultAmountInc)
+		vouchers[1].Nonce = vouchers[0].Nonce
+		sig, err := paymentbroker.SignVoucher(vouchers[1], porcelainAPI.payerAddress, porcelainAPI.signer)
+		require.NoError(err)
+		vouchers[1].Signature = sig
+		proposal := testSignedDealProposal(porcelainAPI, vouchers, porcelainAPI.targetAddress)
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Contains(res.Message, "voucher nonces do not increase")
+	})
+
+	t.Run("Rejects proposals with hash-locked vouchers", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, _ := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+
+		vouchers := testPaymentVouchers(porcelainAPI, VoucherInterval, defaultAmountInc)
+		vouchers[0].HashLock = paymentbroker.NewHashLock([]byte("secret"))
+		sig, err := paymentbroker.SignVoucher(vouchers[0], porcelainAPI.payerAddress, porcelainAPI.signer)
+		require.NoError(err)
+		vouchers[0].Signature = sig
+		proposal := testSignedDealProposal(porcelainAPI, vouchers, porcelainAPI.targetAddress)
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Contains(res.Message, "voucher is hash-locked")
+	})
+
 	t.Run("Rejects proposals with when payments start too late", func(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
@@ -218,6 +269,153 @@ func TestReceiveStorageProposal(t *testing.T) {
 		assert.Equal(storagedeal.Rejected, res.State)
 		assert.Equal("invalid deal signature", res.Message)
 	})
+
+	t.Run("Rejects proposals with invalid deal terms signature", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		proposal.DealSignature = []byte{'0', '0', '0'}
+		proposal, err := proposal.Proposal.NewSignedProposal(porcelainAPI.payerAddress, porcelainAPI.signer)
+		require.NoError(err)
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("invalid deal terms signature", res.Message)
+	})
+}
+
+func TestDealPolicy(t *testing.T) {
+	t.Parallel()
+
+	receive := func(require *require.Assertions, setup func(*minerTestPorcelain)) *storagedeal.Response {
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		setup(porcelainAPI)
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+		return res
+	}
+
+	set := func(porcelainAPI *minerTestPorcelain, key, value string) {
+		porcelainAPI.require.NoError(porcelainAPI.config.Set("mining.dealPolicy."+key, value))
+	}
+
+	t.Run("Accepts proposals that pass the rules", func(t *testing.T) {
+		require := require.New(t)
+
+		res := receive(require, func(porcelainAPI *minerTestPorcelain) {
+			set(porcelainAPI, "allowedClients", fmt.Sprintf(`["%s"]`, porcelainAPI.payerAddress))
+			set(porcelainAPI, "maxPieceSize", "1000")
+			set(porcelainAPI, "minDuration", "10000")
+		})
+		assert.Equal(t, storagedeal.Accepted, res.State)
+	})
+
+	t.Run("Rejects clients not allowed", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res := receive(require, func(porcelainAPI *minerTestPorcelain) {
+			set(porcelainAPI, "allowedClients", fmt.Sprintf(`["%s"]`, porcelainAPI.targetAddress))
+		})
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Contains(res.Message, "is not allowed to make deals")
+	})
+
+	t.Run("Rejects denied clients", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res := receive(require, func(porcelainAPI *minerTestPorcelain) {
+			set(porcelainAPI, "deniedClients", fmt.Sprintf(`["%s"]`, porcelainAPI.payerAddress))
+		})
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Contains(res.Message, "is denied deals")
+	})
+
+	t.Run("Rejects pieces that are too big", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res := receive(require, func(porcelainAPI *minerTestPorcelain) {
+			set(porcelainAPI, "maxPieceSize", "999")
+		})
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("piece size (1000) is more than the maximum of 999", res.Message)
+	})
+
+	t.Run("Rejects deals that are too short", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res := receive(require, func(porcelainAPI *minerTestPorcelain) {
+			set(porcelainAPI, "minDuration", "10001")
+		})
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("duration (10000) is less than the minimum of 10001", res.Message)
+	})
+
+	t.Run("Keeps unsealed room for preferred clients", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		awaitingSeal := func(porcelainAPI *minerTestPorcelain) {
+			set(porcelainAPI, "maxUnsealedBytes", "1500")
+			require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+				Proposal: &storagedeal.Proposal{Size: types.NewBytesAmount(600)},
+				Response: &storagedeal.Response{State: storagedeal.Staged, ProposalCid: types.SomeCid()},
+			}))
+		}
+
+		res := receive(require, awaitingSeal)
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("not enough room for the piece: 600 of 1500 bytes awaiting seal", res.Message)
+
+		res = receive(require, func(porcelainAPI *minerTestPorcelain) {
+			awaitingSeal(porcelainAPI)
+			set(porcelainAPI, "preferredClients", fmt.Sprintf(`["%s"]`, porcelainAPI.payerAddress))
+		})
+		assert.Equal(storagedeal.Accepted, res.State)
+	})
+
+	t.Run("Asks the policy program", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dir, err := ioutil.TempDir("", "dealpolicy")
+		require.NoError(err)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		program := func(name, answer string) string {
+			path := filepath.Join(dir, name)
+			script := "#!/bin/sh\ncat > /dev/null\necho '" + answer + "'\n"
+			require.NoError(ioutil.WriteFile(path, []byte(script), 0755))
+			return path
+		}
+		rejecting := program("reject", `{"accept": false, "reason": "not today"}`)
+		accepting := program("accept", `{"accept": true}`)
+		failing := program("fail", `not json`)
+
+		res := receive(require, func(porcelainAPI *minerTestPorcelain) {
+			set(porcelainAPI, "program", fmt.Sprintf("%q", rejecting))
+		})
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("not today", res.Message)
+
+		res = receive(require, func(porcelainAPI *minerTestPorcelain) {
+			set(porcelainAPI, "program", fmt.Sprintf("%q", accepting))
+		})
+		assert.Equal(storagedeal.Accepted, res.State)
+
+		res = receive(require, func(porcelainAPI *minerTestPorcelain) {
+			set(porcelainAPI, "program", fmt.Sprintf("%q", failing))
+		})
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("deal policy program failed", res.Message)
+	})
 }
 
 func TestDealsAwaitingSeal(t *testing.T) {
@@ -348,10 +546,392 @@ func TestDealsAwaitingSeal(t *testing.T) {
 	})
 }
 
+func TestVoucherRedemption(t *testing.T) {
+	newRedemptionMiner := func(require *require.Assertions) (*minerTestPorcelain, *Miner, cid.Cid) {
+		porcelainAPI := newMinerTestPorcelain(require)
+		miner := newTestMiner(porcelainAPI)
+		miner.dealsAwaitingSealDs = repo.NewInMemoryRepo().DealsDatastore()
+		require.NoError(miner.loadVoucherRedemptions())
+
+		proposal := testSignedDealProposal(porcelainAPI, testPaymentVouchers(porcelainAPI, VoucherInterval, defaultAmountInc), porcelainAPI.targetAddress)
+		dealCid := types.NewCidForTestGetter()()
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Proposal: &proposal.Proposal,
+			Response: &storagedeal.Response{ProposalCid: dealCid, State: storagedeal.Posted},
+		}))
+
+		porcelainAPI.provingPeriodStart = types.NewBlockHeight(100)
+		require.NoError(miner.scheduleVoucherRedemption(dealCid))
+
+		return porcelainAPI, miner, dealCid
+	}
+
+	// vouchers are valid every VoucherInterval blocks from paymentStart
+	voucherValidAt := func(porcelainAPI *minerTestPorcelain, i uint64) *types.BlockHeight {
+		return porcelainAPI.paymentStart.Add(types.NewBlockHeight(i * VoucherInterval))
+	}
+
+	t.Run("waits for the sector to be proven", func(t *testing.T) {
+		assert := assert.New(t)
+		porcelainAPI, miner, _ := newRedemptionMiner(require.New(t))
+
+		miner.redeemVouchers(context.Background(), voucherValidAt(porcelainAPI, 3))
+		assert.Empty(porcelainAPI.messagesSent)
+	})
+
+	t.Run("redeems the latest valid voucher as the owner", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		porcelainAPI, miner, _ := newRedemptionMiner(require)
+		porcelainAPI.provingPeriodStart = types.NewBlockHeight(200)
+		porcelainAPI.workerAddress = address.NewForTestGetter()()
+
+		miner.redeemVouchers(context.Background(), voucherValidAt(porcelainAPI, 3))
+
+		require.Len(porcelainAPI.messagesSent, 1)
+		msg := porcelainAPI.messagesSent[0]
+		assert.Equal("redeem", msg.method)
+		assert.Equal(porcelainAPI.ownerAddress, msg.from)
+		assert.Equal(big.NewInt(3), msg.params[5])
+	})
+
+	t.Run("retries redemptions that do not land on chain", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		porcelainAPI, miner, dealCid := newRedemptionMiner(require)
+		porcelainAPI.provingPeriodStart = types.NewBlockHeight(200)
+
+		height := voucherValidAt(porcelainAPI, 3)
+		miner.redeemVouchers(context.Background(), height)
+		miner.redeemVouchers(context.Background(), height.Add(types.NewBlockHeight(1)))
+		require.Len(porcelainAPI.messagesSent, 1)
+
+		miner.redeemVouchers(context.Background(), height.Add(types.NewBlockHeight(redeemVoucherRetryBlocks)))
+		require.Len(porcelainAPI.messagesSent, 2)
+		assert.Equal(uint64(2), miner.voucherRedemptions.Redemptions[dealCid.String()].Attempts)
+	})
+
+	t.Run("closes the channel with the last voucher and drops the deal once redeemed", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		porcelainAPI, miner, dealCid := newRedemptionMiner(require)
+		porcelainAPI.provingPeriodStart = types.NewBlockHeight(200)
+
+		miner.redeemVouchers(context.Background(), voucherValidAt(porcelainAPI, 10))
+		require.Len(porcelainAPI.messagesSent, 1)
+		assert.Equal("close", porcelainAPI.messagesSent[0].method)
+
+		porcelainAPI.laneNonce = 10
+		miner.redeemVouchers(context.Background(), voucherValidAt(porcelainAPI, 10).Add(types.NewBlockHeight(1)))
+		assert.NotContains(miner.voucherRedemptions.Redemptions, dealCid.String())
+	})
+
+	t.Run("does not close a channel paying for a deal still being stored", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		porcelainAPI, miner, dealCid := newRedemptionMiner(require)
+		porcelainAPI.provingPeriodStart = types.NewBlockHeight(200)
+
+		staged := *porcelainAPI.DealGet(dealCid)
+		staged.Response = &storagedeal.Response{ProposalCid: types.SomeCid(), State: storagedeal.Staged}
+		require.NoError(porcelainAPI.DealPut(&staged))
+
+		miner.redeemVouchers(context.Background(), voucherValidAt(porcelainAPI, 10))
+		require.Len(porcelainAPI.messagesSent, 1)
+		assert.Equal("redeem", porcelainAPI.messagesSent[0].method)
+	})
+
+	t.Run("redeems in the background", func(t *testing.T) {
+		require := require.New(t)
+		porcelainAPI, miner, dealCid := newRedemptionMiner(require)
+		porcelainAPI.provingPeriodStart = types.NewBlockHeight(200)
+
+		miner.startVoucherRedemption(voucherValidAt(porcelainAPI, 3))
+
+		inProcess := func() bool {
+			miner.redeemInProcessLk.Lock()
+			defer miner.redeemInProcessLk.Unlock()
+			return miner.redeemInProcess
+		}
+		for deadline := time.Now().Add(time.Second); inProcess(); time.Sleep(10 * time.Millisecond) {
+			require.True(time.Now().Before(deadline), "redemption did not finish")
+		}
+
+		require.Len(porcelainAPI.messagesSent, 1)
+		require.Equal(uint64(3), miner.voucherRedemptions.Redemptions[dealCid.String()].SubmittedNonce)
+	})
+
+	t.Run("persists the schedule", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		porcelainAPI, miner, dealCid := newRedemptionMiner(require)
+		porcelainAPI.provingPeriodStart = types.NewBlockHeight(200)
+
+		miner.redeemVouchers(context.Background(), voucherValidAt(porcelainAPI, 3))
+
+		require.NoError(miner.loadVoucherRedemptions())
+		r := miner.voucherRedemptions.Redemptions[dealCid.String()]
+		require.NotNil(r)
+		assert.Equal(dealCid, r.ProposalCid)
+		assert.Equal(types.NewBlockHeight(100), r.ProvenAfter)
+		assert.Equal(uint64(3), r.SubmittedNonce)
+	})
+}
+
+func TestDealResumption(t *testing.T) {
+	t.Parallel()
+
+	type dealTest struct {
+		api           *minerTestPorcelain
+		ds            repo.Datastore
+		sectorBuilder *minerTestSectorBuilder
+		dealCid       cid.Cid
+		fetches       int
+	}
+
+	setup := func(require *require.Assertions) *dealTest {
+		porcelainAPI := newMinerTestPorcelain(require)
+		porcelainAPI.publishedDealID = 5
+		proposal := testSignedDealProposal(porcelainAPI, testPaymentVouchers(porcelainAPI, 10, defaultAmountInc), porcelainAPI.targetAddress)
+
+		dt := &dealTest{
+			api:           porcelainAPI,
+			ds:            repo.NewInMemoryRepo().DealsDatastore(),
+			sectorBuilder: &minerTestSectorBuilder{api: porcelainAPI},
+			dealCid:       types.SomeCid(),
+		}
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Proposal: &proposal.Proposal,
+			Response: &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: dt.dealCid},
+		}))
+		return dt
+	}
+
+	// start brings up a miner over the persisted state of the test, as after
+	// a restart.
+	start := func(require *require.Assertions, dt *dealTest) *Miner {
+		miner := newTestMiner(dt.api)
+		miner.node = &minerTestNode{sectorBuilder: dt.sectorBuilder, blockTime: 10 * time.Millisecond}
+		miner.dealsAwaitingSealDs = dt.ds
+		miner.dataFetcher = func(ctx context.Context, m *Miner, p *storagedeal.Proposal) error {
+			dt.fetches++
+			dt.api.crash("fetch")
+			return nil
+		}
+		require.NoError(miner.loadDealsAwaitingSeal())
+		require.NoError(miner.loadDealsInProcess())
+		return miner
+	}
+
+	// process runs the processing of the deal until it completes or crashes.
+	process := func(miner *Miner, dealCid cid.Cid) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			miner.processStorageDeal(dealCid)
+		}()
+		<-done
+	}
+
+	publishes := func(dt *dealTest) int {
+		count := 0
+		for _, msg := range dt.api.messagesSent {
+			if msg.method == "publishDeal" {
+				count++
+			}
+		}
+		return count
+	}
+
+	assertStaged := func(assert *assert.Assertions, require *require.Assertions, dt *dealTest) {
+		deal := dt.api.DealGet(dt.dealCid)
+		assert.Equal(storagedeal.Staged, deal.Response.State)
+		assert.Equal(uint64(5), deal.Response.DealID)
+
+		// the deal is handed over to sealing, and not resumed again
+		miner := start(require, dt)
+		assert.Equal([]cid.Cid{dt.dealCid}, miner.dealsAwaitingSeal.SectorsToDeals[42])
+		dealCids, err := miner.dealsToResume()
+		require.NoError(err)
+		assert.Empty(dealCids)
+	}
+
+	t.Run("processes a deal without crashing", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dt := setup(require)
+		process(start(require, dt), dt.dealCid)
+
+		assert.Equal(1, dt.fetches)
+		assert.Equal(1, publishes(dt))
+		assert.Len(dt.sectorBuilder.pieces, 1)
+		assertStaged(assert, require, dt)
+	})
+
+	t.Run("fetches the data again after crashing while fetching", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dt := setup(require)
+		dt.api.crashAt = "fetch"
+		process(start(require, dt), dt.dealCid)
+		assert.Equal(0, publishes(dt))
+
+		miner := start(require, dt)
+		dealCids, err := miner.dealsToResume()
+		require.NoError(err)
+		require.Equal([]cid.Cid{dt.dealCid}, dealCids)
+		process(miner, dt.dealCid)
+
+		assert.Equal(2, dt.fetches)
+		assert.Equal(1, publishes(dt))
+		assert.Len(dt.sectorBuilder.pieces, 1)
+		assertStaged(assert, require, dt)
+	})
+
+	t.Run("waits for the sent publish message after crashing while publishing", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dt := setup(require)
+		dt.api.crashAt = "messageWait"
+		process(start(require, dt), dt.dealCid)
+		assert.Equal(1, publishes(dt))
+		assert.Empty(dt.sectorBuilder.pieces)
+
+		miner := start(require, dt)
+		dealCids, err := miner.dealsToResume()
+		require.NoError(err)
+		require.Equal([]cid.Cid{dt.dealCid}, dealCids)
+		process(miner, dt.dealCid)
+
+		assert.Equal(1, dt.fetches)
+		assert.Equal(1, publishes(dt))
+		require.Len(dt.api.messagesWaited, 2)
+		assert.Equal(dt.api.messagesWaited[0], dt.api.messagesWaited[1])
+		assert.Len(dt.sectorBuilder.pieces, 1)
+		assertStaged(assert, require, dt)
+	})
+
+	t.Run("sends the publish message again if it is lost", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dt := setup(require)
+		dt.api.lostPublishes = 1
+		process(start(require, dt), dt.dealCid)
+
+		assert.Equal(2, publishes(dt))
+		require.Len(dt.api.messagesWaited, 2)
+		assert.NotEqual(dt.api.messagesWaited[0], dt.api.messagesWaited[1])
+		assertStaged(assert, require, dt)
+	})
+
+	t.Run("does not send a lost publish message again if the deal was published", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dt := setup(require)
+		dt.api.lostPublishes = 1
+		dt.api.lostPublishLanded = true
+		process(start(require, dt), dt.dealCid)
+
+		assert.Equal(1, publishes(dt))
+		assert.Len(dt.api.messagesWaited, 1)
+		assertStaged(assert, require, dt)
+	})
+
+	t.Run("does not add the piece again after crashing while adding it", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dt := setup(require)
+		dt.api.crashAt = "addPiece"
+		process(start(require, dt), dt.dealCid)
+		assert.Len(dt.sectorBuilder.pieces, 1)
+
+		miner := start(require, dt)
+		dealCids, err := miner.dealsToResume()
+		require.NoError(err)
+		require.Equal([]cid.Cid{dt.dealCid}, dealCids)
+		process(miner, dt.dealCid)
+
+		assert.Equal(1, publishes(dt))
+		assert.Len(dt.sectorBuilder.pieces, 1)
+		deal := dt.api.DealGet(dt.dealCid)
+		assert.Equal(storagedeal.Staged, deal.Response.State)
+
+		// the deal waits for a sector holding its piece
+		miner = start(require, dt)
+		assert.Empty(miner.dealsAwaitingSeal.SectorsToDeals)
+		piece := dt.sectorBuilder.pieces[0]
+		assert.Equal(dt.dealCid, miner.dealsAwaitingSeal.PiecesToDeals[piece.Ref.String()])
+		dealCids, err = miner.dealsToResume()
+		require.NoError(err)
+		assert.Empty(dealCids)
+
+		var committed []cid.Cid
+		miner.dealsAwaitingSeal.onSuccess = func(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata) {
+			committed = append(committed, dealCid)
+		}
+		sector := &sectorbuilder.SealedSectorMetadata{SectorID: 42, Pieces: []*sectorbuilder.PieceInfo{piece}}
+		assert.Equal([]uint64{5}, miner.SectorDeals(sector))
+		miner.dealsAwaitingSeal.success(sector)
+		assert.Equal([]cid.Cid{dt.dealCid}, committed)
+		assert.Empty(miner.dealsAwaitingSeal.PiecesToDeals)
+	})
+
+	t.Run("does not add the piece again after crashing while staging", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dt := setup(require)
+		dt.api.crashAt = "staged"
+		process(start(require, dt), dt.dealCid)
+		assert.Len(dt.sectorBuilder.pieces, 1)
+
+		// the deal is staged but was not handed over to sealing
+		miner := start(require, dt)
+		assert.Empty(miner.dealsAwaitingSeal.SectorsToDeals)
+		dealCids, err := miner.dealsToResume()
+		require.NoError(err)
+		require.Equal([]cid.Cid{dt.dealCid}, dealCids)
+		process(miner, dt.dealCid)
+
+		assert.Equal(1, dt.fetches)
+		assert.Equal(1, publishes(dt))
+		assert.Len(dt.sectorBuilder.pieces, 1)
+		assertStaged(assert, require, dt)
+	})
+
+	t.Run("only resumes accepted deals of the miner", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dt := setup(require)
+		newCid := types.NewCidForTestGetter()
+		posted, clientDeal := newCid(), newCid()
+		require.NoError(dt.api.DealPut(&storagedeal.Deal{
+			Response: &storagedeal.Response{State: storagedeal.Posted, ProposalCid: posted},
+		}))
+		require.NoError(dt.api.DealPut(&storagedeal.Deal{
+			Miner:    address.NewForTestGetter()(),
+			Response: &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: clientDeal},
+		}))
+
+		dealCids, err := start(require, dt).dealsToResume()
+		require.NoError(err)
+		assert.Equal([]cid.Cid{dt.dealCid}, dealCids)
+	})
+}
+
 type minerTestPorcelain struct {
 	config        *cfg.Config
 	payerAddress  address.Address
 	targetAddress address.Address
+	ownerAddress  address.Address
+	workerAddress address.Address
 	channelID     *types.ChannelID
 	messageCid    *cid.Cid
 	signer        types.MockSigner
@@ -361,9 +941,83 @@ type minerTestPorcelain struct {
 	paymentStart  *types.BlockHeight
 	deals         map[cid.Cid]*storagedeal.Deal
 
+	provingPeriodStart *types.BlockHeight
+	laneNonce          uint64
+	messagesSent       []minerTestMessage
+	messagesWaited     []cid.Cid
+	publishedDealID    uint64
+
+	// lk guards the chain state the miner polls while waiting for messages
+	lk     sync.Mutex
+	newCid func() cid.Cid
+	pool   map[cid.Cid]*types.SignedMessage
+	// lostPublishes is the number of publishDeal messages that leave the
+	// message pool without landing on chain, see MessageWait
+	lostPublishes int
+	// lostPublishLanded makes lost publishDeal messages land on chain
+	// unnoticed by MessageWait
+	lostPublishLanded bool
+	workerNonce       uint64
+	dealNonceUsed     bool
+
+	// crashAt names the step at which the miner stops, see crash.
+	crashAt string
+
 	require *require.Assertions
 }
 
+type minerTestMessage struct {
+	cid    cid.Cid
+	from   address.Address
+	method string
+	params []interface{}
+}
+
+func TestSectorDeals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	miner := newTestMiner(porcelainAPI)
+	miner.dealsAwaitingSeal = &dealsAwaitingSealStruct{
+		SectorsToDeals:    make(map[uint64][]cid.Cid),
+		SuccessfulSectors: make(map[uint64]*sectorbuilder.SealedSectorMetadata),
+		FailedSectors:     make(map[uint64]string),
+	}
+
+	newCid := types.NewCidForTestGetter()
+	addDeal := func(sectorID, dealID uint64) *sectorbuilder.PieceInfo {
+		piece := &sectorbuilder.PieceInfo{Ref: newCid(), Size: 100}
+
+		dealCid := newCid()
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Proposal: &storagedeal.Proposal{PieceRef: piece.Ref},
+			Response: &storagedeal.Response{ProposalCid: dealCid, DealID: dealID},
+		}))
+		miner.dealsAwaitingSeal.add(sectorID, dealCid)
+		return piece
+	}
+
+	t.Run("returns the published deals of the sector in the order of its pieces", func(t *testing.T) {
+		first := addDeal(3, 7)
+		second := addDeal(3, 9)
+
+		sector := &sectorbuilder.SealedSectorMetadata{SectorID: 3, Pieces: []*sectorbuilder.PieceInfo{second, first}}
+		assert.Equal([]uint64{9, 7}, miner.SectorDeals(sector))
+	})
+
+	t.Run("skips pieces without a published deal", func(t *testing.T) {
+		published := addDeal(4, 11)
+		unpublished := addDeal(4, 0)
+
+		sector := &sectorbuilder.SealedSectorMetadata{SectorID: 4, Pieces: []*sectorbuilder.PieceInfo{unpublished, published}}
+		assert.Equal([]uint64{11}, miner.SectorDeals(sector))
+
+		sector = &sectorbuilder.SealedSectorMetadata{SectorID: 4, Pieces: []*sectorbuilder.PieceInfo{unpublished}}
+		assert.Empty(miner.SectorDeals(sector))
+	})
+}
+
 func newMinerTestPorcelain(require *require.Assertions) *minerTestPorcelain {
 	ki := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
 	mockSigner := types.NewMockSigner(ki)
@@ -378,11 +1032,14 @@ func newMinerTestPorcelain(require *require.Assertions) *minerTestPorcelain {
 	config := cfg.NewConfig(repo.NewInMemoryRepo())
 	config.Set("mining.storagePrice", `".00025"`)
 
+	targetAddress := addressGetter()
 	blockHeight := types.NewBlockHeight(773)
 	return &minerTestPorcelain{
 		config:        config,
 		payerAddress:  payerAddr,
-		targetAddress: addressGetter(),
+		targetAddress: targetAddress,
+		ownerAddress:  targetAddress,
+		workerAddress: targetAddress,
 		channelID:     types.NewChannelID(73),
 		messageCid:    &messageCid,
 		signer:        mockSigner,
@@ -392,24 +1049,83 @@ func newMinerTestPorcelain(require *require.Assertions) *minerTestPorcelain {
 		paymentStart:  blockHeight,
 		require:       require,
 		deals:         make(map[cid.Cid]*storagedeal.Deal),
+		newCid:        cidGetter,
+		pool:          make(map[cid.Cid]*types.SignedMessage),
+
+		provingPeriodStart: types.NewBlockHeight(0),
 	}
 }
 
 func (mtp *minerTestPorcelain) MessageSend(ctx context.Context, from, to address.Address, val *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
-	return cid.Cid{}, nil
+	mtp.lk.Lock()
+	defer mtp.lk.Unlock()
+
+	msgCid := mtp.newCid()
+	mtp.messagesSent = append(mtp.messagesSent, minerTestMessage{cid: msgCid, from: from, method: method, params: params})
+	msg := types.NewMessage(from, to, mtp.workerNonce, val, method, nil)
+	mtp.workerNonce++
+	mtp.pool[msgCid] = &types.SignedMessage{Message: *msg}
+	return msgCid, nil
+}
+
+func (mtp *minerTestPorcelain) MessagePoolGet(msgCid cid.Cid) (*types.SignedMessage, bool) {
+	mtp.lk.Lock()
+	defer mtp.lk.Unlock()
+
+	msg, ok := mtp.pool[msgCid]
+	return msg, ok
+}
+
+func (mtp *minerTestPorcelain) ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error) {
+	mtp.lk.Lock()
+	defer mtp.lk.Unlock()
+
+	return &actor.Actor{Nonce: types.Uint64(mtp.workerNonce)}, nil
+}
+
+func (mtp *minerTestPorcelain) MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return mtp.ownerAddress, nil
+}
+
+func (mtp *minerTestPorcelain) MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return mtp.workerAddress, nil
 }
 
 func (mtp *minerTestPorcelain) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	if method == "getProvingPeriodStart" {
+		return [][]byte{mtp.provingPeriodStart.Bytes()}, nil, nil
+	}
+	if method == "getProvingPeriodEnd" {
+		return [][]byte{mtp.provingPeriodStart.Add(miner.ProvingPeriodBlocks).Bytes()}, nil, nil
+	}
+	if method == "getPublishedDealID" {
+		if !mtp.dealNonceUsed {
+			return [][]byte{big.NewInt(0).Bytes()}, nil, nil
+		}
+		return [][]byte{big.NewInt(0).SetUint64(mtp.publishedDealID).Bytes()}, nil, nil
+	}
+	if method == "getDeal" {
+		var deal *storagedeal.Deal
+		for _, d := range mtp.deals {
+			deal = d
+		}
+		dealBytes, err := actor.MarshalStorage(&storagemarket.Deal{PieceRef: deal.Proposal.PieceRef})
+		mtp.require.NoError(err)
+		return [][]byte{dealBytes}, nil, nil
+	}
+
 	channels := map[string]*paymentbroker.PaymentChannel{}
 
 	if !mtp.noChannels {
 		id := mtp.channelID.KeyString()
-		channels[id] = &paymentbroker.PaymentChannel{
+		channel := &paymentbroker.PaymentChannel{
 			Target:         mtp.targetAddress,
 			Amount:         types.NewAttoFILFromFIL(100000),
 			AmountRedeemed: types.NewAttoFILFromFIL(0),
 			Eol:            mtp.channelEol,
 		}
+		channel.Lane(0).Nonce = mtp.laneNonce
+		channels[id] = channel
 	}
 
 	channelsBytes, err := actor.MarshalStorage(channels)
@@ -422,17 +1138,51 @@ func (mtp *minerTestPorcelain) ConfigGet(dottedPath string) (interface{}, error)
 }
 
 func (mtp *minerTestPorcelain) ChainBlockHeight(ctx context.Context) (*types.BlockHeight, error) {
+	mtp.lk.Lock()
+	defer mtp.lk.Unlock()
+
 	return mtp.blockHeight, nil
 }
 
+// MessageWait calls back with a receipt carrying publishedDealID, unless the
+// message is one of the lostPublishes, which it waits on until the miner gives
+// up.
 func (mtp *minerTestPorcelain) MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error {
-	return nil
+	mtp.messagesWaited = append(mtp.messagesWaited, msgCid)
+	mtp.crash("messageWait")
+
+	mtp.lk.Lock()
+	if mtp.lostPublishes > 0 {
+		mtp.lostPublishes--
+		delete(mtp.pool, msgCid)
+		mtp.dealNonceUsed = mtp.lostPublishLanded
+		mtp.blockHeight = mtp.blockHeight.Add(types.NewBlockHeight(publishDealRetryBlocks))
+		mtp.lk.Unlock()
+
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	delete(mtp.pool, msgCid)
+	mtp.lk.Unlock()
+
+	return cb(nil, nil, &types.MessageReceipt{
+		Return: [][]byte{big.NewInt(0).SetUint64(mtp.publishedDealID).Bytes()},
+	})
+}
+
+// crash stops the goroutine calling it, as if the miner stopped at this point,
+// if the test set it to crash at the given step. It crashes only once.
+func (mtp *minerTestPorcelain) crash(step string) {
+	if mtp.crashAt == step {
+		mtp.crashAt = ""
+		runtime.Goexit()
+	}
 }
 
 func newTestMiner(api *minerTestPorcelain) *Miner {
 	return &Miner{
-		porcelainAPI:   api,
-		minerOwnerAddr: api.targetAddress,
+		events:       storagedeal.NewEventBus(),
+		porcelainAPI: api,
 		proposalAcceptor: func(m *Miner, p *storagedeal.Proposal) (*storagedeal.Response, error) {
 			return &storagedeal.Response{State: storagedeal.Accepted}, nil
 		},
@@ -459,17 +1209,18 @@ func testPaymentVouchers(porcelainAPI *minerTestPorcelain, voucherInterval int,
 	for i := 0; i < 10; i++ {
 		validAt := porcelainAPI.paymentStart.Add(types.NewBlockHeight(uint64((i + 1) * voucherInterval)))
 		amount := types.NewAttoFILFromFIL(uint64(i+1) * amountInc)
-		signature, err := paymentbroker.SignVoucher(porcelainAPI.channelID, amount, validAt, porcelainAPI.payerAddress, porcelainAPI.signer)
-		porcelainAPI.require.NoError(err, "could not sign valid proposal")
-
 		vouchers[i] = &paymentbroker.PaymentVoucher{
-			Channel:   *porcelainAPI.channelID,
-			Payer:     porcelainAPI.payerAddress,
-			Target:    porcelainAPI.targetAddress,
-			Amount:    *amount,
-			ValidAt:   *validAt,
-			Signature: signature,
+			Channel: *porcelainAPI.channelID,
+			Payer:   porcelainAPI.payerAddress,
+			Target:  porcelainAPI.targetAddress,
+			Amount:  *amount,
+			ValidAt: *validAt,
+			Nonce:   uint64(i + 1),
 		}
+
+		signature, err := paymentbroker.SignVoucher(vouchers[i], porcelainAPI.payerAddress, porcelainAPI.signer)
+		porcelainAPI.require.NoError(err, "could not sign valid proposal")
+		vouchers[i].Signature = signature
 	}
 	return vouchers
 
@@ -489,8 +1240,14 @@ func testSignedDealProposal(porcelainAPI *minerTestPorcelain, vouchers []*paymen
 			ChannelMsgCid: porcelainAPI.messageCid,
 			Vouchers:      vouchers,
 		},
+		PieceCommitment: make([]byte, proofs.CommitmentBytesLen),
+		PaddedSize:      types.NewBytesAmount(proofs.PaddedPieceSize(1000)),
 	}
 
+	dealSig, err := storagemarket.SignDeal(porcelainAPI.payerAddress, proposal.MinerAddress, proposal.PieceRef, proposal.Size, proposal.Duration, proposal.TotalPrice, proposal.ClientNonce, porcelainAPI.signer)
+	porcelainAPI.require.NoError(err)
+	proposal.DealSignature = dealSig
+
 	signedProposal, err := proposal.NewSignedProposal(porcelainAPI.payerAddress, porcelainAPI.signer)
 	porcelainAPI.require.NoError(err)
 	return signedProposal
@@ -515,5 +1272,51 @@ func (mtp *minerTestPorcelain) DealGet(dealCid cid.Cid) *storagedeal.Deal {
 
 func (mtp *minerTestPorcelain) DealPut(storageDeal *storagedeal.Deal) error {
 	mtp.deals[storageDeal.Response.ProposalCid] = storageDeal
+	if storageDeal.Response.State == storagedeal.Staged {
+		mtp.crash("staged")
+	}
 	return nil
 }
+
+type minerTestNode struct {
+	sectorBuilder *minerTestSectorBuilder
+	blockService  bserv.BlockService
+	blockTime     time.Duration
+}
+
+func (mtn *minerTestNode) BlockHeight() (*types.BlockHeight, error) {
+	return types.NewBlockHeight(0), nil
+}
+
+func (mtn *minerTestNode) GetBlockTime() time.Duration {
+	if mtn.blockTime != 0 {
+		return mtn.blockTime
+	}
+	return time.Second
+}
+
+func (mtn *minerTestNode) BlockService() bserv.BlockService {
+	return mtn.blockService
+}
+
+func (mtn *minerTestNode) Host() host.Host {
+	return nil
+}
+
+func (mtn *minerTestNode) SectorBuilder() sectorbuilder.SectorBuilder {
+	return mtn.sectorBuilder
+}
+
+type minerTestSectorBuilder struct {
+	sectorbuilder.SectorBuilder
+
+	api    *minerTestPorcelain
+	pieces []*sectorbuilder.PieceInfo
+}
+
+// AddPiece adds every piece to sector 42.
+func (mtsb *minerTestSectorBuilder) AddPiece(ctx context.Context, pi *sectorbuilder.PieceInfo) (uint64, error) {
+	mtsb.pieces = append(mtsb.pieces, pi)
+	mtsb.api.crash("addPiece")
+	return 42, nil
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	uio "gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs/io"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+)
+
+// pieceCommitment computes the commitment of the piece with the given root
+// and size, over the bytes of the file as the sector builder reads them.
+func pieceCommitment(ctx context.Context, dserv ipld.DAGService, c cid.Cid, size uint64) (proofs.CommP, error) {
+	root, err := dserv.Get(ctx, c)
+	if err != nil {
+		return proofs.CommP{}, err
+	}
+
+	r, err := uio.NewDagReader(ctx, root, dserv)
+	if err != nil {
+		return proofs.CommP{}, err
+	}
+
+	return proofs.GeneratePieceCommitment(r, size)
+}
+
+// validatePieceCommitment checks the proposal commits to a piece, padded to
+// the size its data takes in a sector.
+func validatePieceCommitment(p *storagedeal.Proposal) error {
+	if len(p.PieceCommitment) != int(proofs.CommitmentBytesLen) {
+		return errors.New("proposed deal has no valid piece commitment")
+	}
+	if p.PaddedSize == nil || p.Size == nil || p.PaddedSize.Uint64() != proofs.PaddedPieceSize(p.Size.Uint64()) {
+		return fmt.Errorf("proposed padded size %s does not match the size %s", p.PaddedSize, p.Size)
+	}
+	return nil
+}
+
+// checkPieceCommitment checks the data of the deal is the piece the client
+// committed to.
+func checkPieceCommitment(ctx context.Context, dserv ipld.DAGService, p *storagedeal.Proposal) error {
+	commP, err := pieceCommitment(ctx, dserv, p.PieceRef, p.Size.Uint64())
+	if err != nil {
+		return errors.Wrap(err, "failed to compute the piece commitment of the data")
+	}
+	if !bytes.Equal(commP[:], p.PieceCommitment) {
+		return fmt.Errorf("data does not match the piece commitment %x of the deal", p.PieceCommitment)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	imp "gx/ipfs/QmRDWTzVdbHXdtat7tVJ7YC7kRaW7rTZTEF79yykcLYa49/go-unixfs/importer"
+	ipld "gx/ipfs/QmRL22E4paat7ky7vx9MLpR97JHHbFPrg3ytFQw6qp1y1s/go-ipld-format"
+	chunk "gx/ipfs/QmXivYDjgMqNQXbEQVC7TMuZnRADCa71ABQUQxWPZPTLbd/go-ipfs-chunker"
+
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestPieceCommitment(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("piece data "), 50000)
+
+	// setup imports the data as the client does and returns a proposal for it
+	// committing to the data.
+	setup := func(require *require.Assertions) (ipld.DAGService, *storagedeal.Proposal) {
+		_, dserv := newTransferTestDAG()
+		bufds := ipld.NewBufferedDAG(ctx, dserv)
+		nd, err := imp.BuildDagFromReader(bufds, chunk.DefaultSplitter(bytes.NewReader(data)))
+		require.NoError(err)
+		require.NoError(bufds.Commit())
+
+		size, err := getFileSize(ctx, nd.Cid(), dserv)
+		require.NoError(err)
+		require.Equal(uint64(len(data)), size)
+
+		commP, err := pieceCommitment(ctx, dserv, nd.Cid(), size)
+		require.NoError(err)
+
+		return dserv, &storagedeal.Proposal{
+			PieceRef:        nd.Cid(),
+			Size:            types.NewBytesAmount(size),
+			PieceCommitment: commP[:],
+			PaddedSize:      types.NewBytesAmount(proofs.PaddedPieceSize(size)),
+		}
+	}
+
+	t.Run("commits to the bytes of the file", func(t *testing.T) {
+		require := require.New(t)
+
+		dserv, p := setup(require)
+		commP, err := proofs.GeneratePieceCommitment(bytes.NewReader(data), uint64(len(data)))
+		require.NoError(err)
+		assert.Equal(t, commP[:], p.PieceCommitment)
+
+		assert.NoError(t, validatePieceCommitment(p))
+		assert.NoError(t, checkPieceCommitment(ctx, dserv, p))
+	})
+
+	t.Run("rejects data that does not match the commitment", func(t *testing.T) {
+		require := require.New(t)
+
+		dserv, p := setup(require)
+		p.PieceCommitment[0] ^= 1
+
+		err := checkPieceCommitment(ctx, dserv, p)
+		require.Error(err)
+		assert.Contains(t, err.Error(), "data does not match the piece commitment")
+	})
+
+	t.Run("rejects proposals without a valid commitment", func(t *testing.T) {
+		require := require.New(t)
+
+		_, p := setup(require)
+		p.PaddedSize = p.Size
+		assert.Error(t, validatePieceCommitment(p))
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		proposal.PieceCommitment = nil
+		proposal, err := proposal.Proposal.NewSignedProposal(porcelainAPI.payerAddress, porcelainAPI.signer)
+		require.NoError(err)
+
+		res, err := miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(t, storagedeal.Rejected, res.State)
+		assert.Equal(t, "proposed deal has no valid piece commitment", res.Message)
+	})
+}
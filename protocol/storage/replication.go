@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// replicaProposal is the outcome of proposing a replica to a miner.
+type replicaProposal struct {
+	ask  porcelain.StorageAsk
+	resp *storagedeal.Response
+	err  error
+}
+
+// Store stores the data with the given number of miners. Miners are picked
+// from the live asks at or below the max price, cheapest first, and proposed
+// deals in parallel. Miners that reject or fail a proposal are replaced by
+// the next ones until enough accepted or no miner is left. Progress is kept
+// in the replication record of the data, so storing it again only makes up
+// for the replicas that were lost. The data can be stored by one call at a
+// time.
+func (smc *Client) Store(ctx context.Context, data cid.Cid, replicas uint64, maxPrice *types.AttoFIL, duration uint64) (*storagedeal.Replication, error) {
+	if replicas == 0 {
+		return nil, errors.New("must store at least one replica")
+	}
+
+	if !smc.startStoring(data) {
+		return nil, fmt.Errorf("%s is already being stored", data)
+	}
+	defer smc.stopStoring(data)
+
+	// miners may have failed deals since they were last heard of
+	if err := smc.refreshReplicas(ctx, data); err != nil {
+		return nil, err
+	}
+
+	// record the piece before proposing, not to compute its commitment for
+	// each proposal
+	if _, err := smc.piece(ctx, data); err != nil {
+		return nil, err
+	}
+
+	r, err := smc.updateReplication(data, func(r *storagedeal.Replication) {
+		r.Replicas = replicas
+		r.MaxPrice = maxPrice
+		r.Duration = duration
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	asks, err := smc.api.StorageMarketAsks(ctx, porcelain.AskFilter{MaxPrice: maxPrice})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get asks")
+	}
+
+	// asks come cheapest first, keep the cheapest of each miner
+	var candidates []porcelain.StorageAsk
+	for _, ask := range asks {
+		if r.Tried(ask.Miner) {
+			continue
+		}
+		picked := false
+		for _, c := range candidates {
+			if c.Miner == ask.Miner {
+				picked = true
+				break
+			}
+		}
+		if !picked {
+			candidates = append(candidates, ask)
+		}
+	}
+
+	for r.LiveReplicas() < replicas {
+		needed := int(replicas - r.LiveReplicas())
+		if len(candidates) == 0 {
+			if maxPrice == nil {
+				return nil, fmt.Errorf("stored %d of %d replicas, no miner left with a live ask", r.LiveReplicas(), replicas)
+			}
+			return nil, fmt.Errorf("stored %d of %d replicas, no miner left with an ask at or below %s", r.LiveReplicas(), replicas, maxPrice)
+		}
+		if needed > len(candidates) {
+			needed = len(candidates)
+		}
+
+		proposals := smc.proposeReplicas(ctx, data, candidates[:needed], duration)
+		candidates = candidates[needed:]
+
+		r, err = smc.updateReplication(data, func(r *storagedeal.Replication) {
+			for _, p := range proposals {
+				if p.err != nil {
+					log.Infof("miner %s did not take a replica of %s: %s", p.ask.Miner, data, p.err)
+					r.Failures = append(r.Failures, storagedeal.ReplicaFailure{Miner: p.ask.Miner, Error: p.err.Error()})
+					continue
+				}
+				r.Deals = append(r.Deals, storagedeal.Replica{Miner: p.ask.Miner, ProposalCid: p.resp.ProposalCid, State: p.resp.State})
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// startStoring marks the data as being stored, returning false if it already
+// is.
+func (smc *Client) startStoring(data cid.Cid) bool {
+	smc.replicationsLk.Lock()
+	defer smc.replicationsLk.Unlock()
+
+	if smc.storing == nil {
+		smc.storing = make(map[string]bool)
+	}
+	if smc.storing[data.String()] {
+		return false
+	}
+	smc.storing[data.String()] = true
+	return true
+}
+
+func (smc *Client) stopStoring(data cid.Cid) {
+	smc.replicationsLk.Lock()
+	defer smc.replicationsLk.Unlock()
+
+	delete(smc.storing, data.String())
+}
+
+// refreshReplicas queries the miners of the live replicas of the data for
+// the states of their deals, which are recorded in the deal store. Miners
+// that cannot be reached keep the last known state.
+func (smc *Client) refreshReplicas(ctx context.Context, data cid.Cid) error {
+	r, err := smc.replication(data)
+	if err != nil || r == nil {
+		return err
+	}
+	for _, d := range r.Deals {
+		if !d.Live() {
+			continue
+		}
+		if _, err := smc.QueryDeal(ctx, d.ProposalCid); err != nil {
+			log.Warningf("failed to query the deal of miner %s for %s: %s", d.Miner, data, err)
+		}
+	}
+	return nil
+}
+
+// updateReplication applies f to the replication record of the data,
+// creating it if needed, and stores it. The lock is held only meanwhile, not
+// while deals are proposed.
+func (smc *Client) updateReplication(data cid.Cid, f func(*storagedeal.Replication)) (*storagedeal.Replication, error) {
+	smc.replicationsLk.Lock()
+	defer smc.replicationsLk.Unlock()
+
+	r, err := smc.replication(data)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		r = &storagedeal.Replication{PieceRef: data}
+	}
+	f(r)
+
+	if err := smc.api.ReplicationPut(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// proposeReplicas proposes a deal for the data to the miner of each ask in
+// parallel.
+func (smc *Client) proposeReplicas(ctx context.Context, data cid.Cid, asks []porcelain.StorageAsk, duration uint64) []replicaProposal {
+	proposals := make([]replicaProposal, len(asks))
+
+	var wg sync.WaitGroup
+	for i, ask := range asks {
+		wg.Add(1)
+		go func(i int, ask porcelain.StorageAsk) {
+			defer wg.Done()
+			resp, err := smc.ProposeDeal(ctx, ask.Miner, data, ask.ID, duration, storagedeal.TransferPull, false)
+			proposals[i] = replicaProposal{ask: ask, resp: resp, err: err}
+		}(i, ask)
+	}
+	wg.Wait()
+
+	return proposals
+}
+
+// QueryReplication returns the replication record of the data, with the
+// states of its deals as last known by the client.
+func (smc *Client) QueryReplication(data cid.Cid) (*storagedeal.Replication, error) {
+	r, err := smc.replication(data)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, fmt.Errorf("no replication of %s", data)
+	}
+	return r, nil
+}
+
+// replication loads the replication record of the data, refreshing the
+// states of its deals from the deal store. It returns nil if there is none.
+func (smc *Client) replication(data cid.Cid) (*storagedeal.Replication, error) {
+	r, err := smc.api.ReplicationGet(data)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	for i, d := range r.Deals {
+		if deal := smc.api.DealGet(d.ProposalCid); deal != nil {
+			r.Deals[i].State = deal.Response.State
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/util/convert"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	assert := assert.New(t)
+
+	addressCreator := address.NewForTestGetter()
+	cheap, rejecting, pricier, expensive := addressCreator(), addressCreator(), addressCreator(), addressCreator()
+
+	// deals the miners report failed when queried
+	failed := make(map[string]bool)
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		if q, ok := request.(storagedeal.QueryRequest); ok {
+			if failed[q.Cid.String()] {
+				return &storagedeal.Response{State: storagedeal.Failed, Message: "sealing failed", ProposalCid: q.Cid}, nil
+			}
+			return &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: q.Cid}, nil
+		}
+
+		p := request.(*storagedeal.SignedDealProposal)
+		pcid, err := convert.ToCid(p.Proposal)
+		require.NoError(err)
+
+		if p.MinerAddress == rejecting {
+			return &storagedeal.Response{State: storagedeal.Rejected, Message: "no room", ProposalCid: pcid}, nil
+		}
+		return &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: pcid}, nil
+	})
+
+	testAPI := newTestClientAPI(require)
+	testAPI.asks = []porcelain.StorageAsk{
+		{Miner: cheap, ID: 1, Price: types.NewAttoFILFromFIL(1)},
+		{Miner: cheap, ID: 2, Price: types.NewAttoFILFromFIL(2)},
+		{Miner: rejecting, ID: 1, Price: types.NewAttoFILFromFIL(2)},
+		{Miner: pricier, ID: 1, Price: types.NewAttoFILFromFIL(3)},
+		{Miner: expensive, ID: 1, Price: types.NewAttoFILFromFIL(9)},
+	}
+
+	client, err := NewClient(testNode, testAPI)
+	require.NoError(err)
+
+	ctx := context.Background()
+	dataCid := types.SomeCid()
+	miners := func(r *storagedeal.Replication) []address.Address {
+		var addrs []address.Address
+		for _, d := range r.Deals {
+			addrs = append(addrs, d.Miner)
+		}
+		return addrs
+	}
+
+	t.Run("replaces miners that reject the proposal", func(t *testing.T) {
+		r, err := client.Store(ctx, dataCid, 2, types.NewAttoFILFromFIL(5), 10000)
+		require.NoError(err)
+
+		assert.Equal(uint64(2), r.LiveReplicas())
+		assert.Len(r.Deals, 2)
+		assert.Contains(miners(r), cheap)
+		assert.Contains(miners(r), pricier)
+		require.Len(r.Failures, 1)
+		assert.Equal(rejecting, r.Failures[0].Miner)
+		assert.Contains(r.Failures[0].Error, "no room")
+
+		stored, err := client.QueryReplication(dataCid)
+		require.NoError(err)
+		assert.Equal(r, stored)
+
+		// once for all the proposals
+		assert.Equal(int32(1), atomic.LoadInt32(&testNode.commitments))
+	})
+
+	t.Run("fails when no miner is left under the max price", func(t *testing.T) {
+		_, err := client.Store(ctx, dataCid, 3, types.NewAttoFILFromFIL(5), 10000)
+		require.Error(err)
+		assert.Contains(err.Error(), "stored 2 of 3 replicas")
+
+		r, err := client.QueryReplication(dataCid)
+		require.NoError(err)
+		assert.Equal(uint64(3), r.Replicas)
+	})
+
+	t.Run("makes up for deals the miners report failed", func(t *testing.T) {
+		r, err := client.QueryReplication(dataCid)
+		require.NoError(err)
+		failed[r.Deals[0].ProposalCid.String()] = true
+
+		r, err = client.Store(ctx, dataCid, 2, nil, 10000)
+		require.NoError(err)
+
+		assert.Equal(uint64(2), r.LiveReplicas())
+		assert.Len(r.Deals, 3)
+		assert.Equal(expensive, r.Deals[2].Miner)
+		assert.Equal(storagedeal.Failed, r.Deals[0].State)
+	})
+
+	t.Run("fails for unknown data", func(t *testing.T) {
+		_, err := client.QueryReplication(types.NewCidForTestGetter()())
+		assert.Error(err)
+	})
+}
+
+func TestStoreConcurrently(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	assert := assert.New(t)
+
+	getCid := types.NewCidForTestGetter()
+	slowData, otherData := getCid(), getCid()
+
+	// proposals for slowData are answered once released
+	proposed := make(chan struct{}, 1)
+	release := make(chan struct{})
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		p := request.(*storagedeal.SignedDealProposal)
+		pcid, err := convert.ToCid(p.Proposal)
+		require.NoError(err)
+
+		if p.PieceRef.Equals(slowData) {
+			proposed <- struct{}{}
+			<-release
+		}
+		return &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: pcid}, nil
+	})
+
+	testAPI := newTestClientAPI(require)
+	testAPI.asks = []porcelain.StorageAsk{
+		{Miner: address.NewForTestGetter()(), ID: 1, Price: types.NewAttoFILFromFIL(1)},
+	}
+
+	client, err := NewClient(testNode, testAPI)
+	require.NoError(err)
+
+	ctx := context.Background()
+	done := make(chan error)
+	go func() {
+		_, err := client.Store(ctx, slowData, 1, nil, 10000)
+		done <- err
+	}()
+	<-proposed
+
+	_, err = client.Store(ctx, slowData, 1, nil, 10000)
+	require.Error(err)
+	assert.Contains(err.Error(), "already being stored")
+
+	// other data is stored while the proposal is pending
+	r, err := client.Store(ctx, otherData, 1, nil, 10000)
+	require.NoError(err)
+	assert.Equal(uint64(1), r.LiveReplicas())
+
+	close(release)
+	require.NoError(<-done)
+
+	r, err = client.QueryReplication(slowData)
+	require.NoError(err)
+	assert.Equal(uint64(1), r.LiveReplicas())
+}
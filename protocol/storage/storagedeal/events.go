@@ -0,0 +1,178 @@
+package storagedeal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Event{})
+	cbor.RegisterCborType(EventsRequest{})
+}
+
+// EventKind is the kind of a change in the life of a deal.
+type EventKind int
+
+const (
+	// StateChanged means the deal moved to a new State
+	StateChanged = EventKind(iota)
+
+	// SectorAssigned means the piece of the deal was added to a sector
+	SectorAssigned
+
+	// Committed means the sector holding the piece was committed on chain
+	Committed
+
+	// PoStProven means a proof of spacetime covering the sector holding the
+	// piece landed on chain
+	PoStProven
+
+	// PaymentRedeemed means the miner redeemed a payment voucher of the deal
+	PaymentRedeemed
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case StateChanged:
+		return "state changed"
+	case SectorAssigned:
+		return "sector assigned"
+	case Committed:
+		return "committed"
+	case PoStProven:
+		return "post proven"
+	case PaymentRedeemed:
+		return "payment redeemed"
+	default:
+		return fmt.Sprintf("<unrecognized %d>", k)
+	}
+}
+
+// Event is a change in the life of a deal.
+type Event struct {
+	// ProposalCid is the cid of the proposal of the deal
+	ProposalCid cid.Cid
+
+	Kind EventKind
+
+	// State is the state of the deal after the event
+	State State
+
+	// Message is the message of the deal response, if any
+	Message string
+
+	// SectorID is the sector holding the piece of the deal, once assigned
+	SectorID uint64
+
+	// Amount is the total amount redeemed for the deal, for PaymentRedeemed
+	Amount *types.AttoFIL
+}
+
+// EventsRequest asks the miner of a deal for its events. It is signed by the
+// client of the deal, as the events reveal the progress of the deal.
+type EventsRequest struct {
+	ProposalCid cid.Cid
+	Signature   types.Signature
+}
+
+// NewEventsRequest returns a request for the events of the deal signed by
+// client.
+func NewEventsRequest(proposalCid cid.Cid, client address.Address, signer types.Signer) (*EventsRequest, error) {
+	sig, err := signer.SignBytes(eventsRequestData(proposalCid), client)
+	if err != nil {
+		return nil, err
+	}
+	return &EventsRequest{ProposalCid: proposalCid, Signature: sig}, nil
+}
+
+// Verify returns whether the request is signed by client.
+func (r *EventsRequest) Verify(client address.Address) bool {
+	return types.IsValidSignature(eventsRequestData(r.ProposalCid), client, r.Signature)
+}
+
+func eventsRequestData(proposalCid cid.Cid) []byte {
+	return append([]byte("deal events:"), proposalCid.Bytes()...)
+}
+
+// eventBusCapacity is the number of events buffered for each subscriber.
+const eventBusCapacity = 128
+
+// EventBus publishes the events of deals to their subscribers. Publishing
+// never blocks: a subscriber that falls eventBusCapacity events behind is
+// dropped, its channel closed before its context is done.
+type EventBus struct {
+	lk   sync.Mutex
+	subs map[*eventSubscription]struct{}
+}
+
+// eventSubscription receives the events of the deal with the proposal cid, or
+// of all deals if it is cid.Undef.
+type eventSubscription struct {
+	proposalCid cid.Cid
+	ch          chan *Event
+	// dropped is closed with ch
+	dropped chan struct{}
+}
+
+// NewEventBus returns a new EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*eventSubscription]struct{})}
+}
+
+// Publish sends the event to the subscribers of its deal and of all deals.
+func (eb *EventBus) Publish(e *Event) {
+	eb.lk.Lock()
+	defer eb.lk.Unlock()
+
+	for sub := range eb.subs {
+		if sub.proposalCid.Defined() && !sub.proposalCid.Equals(e.ProposalCid) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			eb.unsubscribe(sub)
+		}
+	}
+}
+
+// Subscribe returns the events of the deal with the proposal cid, or of all
+// deals if it is cid.Undef, until the context is done or the subscriber falls
+// behind.
+func (eb *EventBus) Subscribe(ctx context.Context, proposalCid cid.Cid) <-chan *Event {
+	sub := &eventSubscription{proposalCid: proposalCid, ch: make(chan *Event, eventBusCapacity), dropped: make(chan struct{})}
+
+	eb.lk.Lock()
+	eb.subs[sub] = struct{}{}
+	eb.lk.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-sub.dropped:
+			return
+		}
+
+		eb.lk.Lock()
+		defer eb.lk.Unlock()
+		eb.unsubscribe(sub)
+	}()
+	return sub.ch
+}
+
+// unsubscribe closes the channel of the subscription if it was not already.
+// The lock must be held.
+func (eb *EventBus) unsubscribe(sub *eventSubscription) {
+	if _, ok := eb.subs[sub]; ok {
+		delete(eb.subs, sub)
+		close(sub.ch)
+		close(sub.dropped)
+	}
+}
@@ -0,0 +1,52 @@
+package storagedeal
+
+import (
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+// MinerDeal is a deal as the storage miner that accepted it sees it.
+type MinerDeal struct {
+	Deal
+
+	// Stage is how far the processing of the accepted deal got, empty once
+	// the deal is no longer processed
+	Stage string `json:",omitempty"`
+
+	// Sector is the sector holding the piece of the deal, nil until the piece
+	// was added to one
+	Sector *uint64 `json:",omitempty"`
+}
+
+// DealFilter restricts the deals a miner lists. Zero values mean no
+// restriction.
+type DealFilter struct {
+	// States keeps the deals in one of the states.
+	States []State
+	// Client keeps the deals paid by the client address.
+	Client address.Address
+	// Sector keeps the deals with their piece in the sector.
+	Sector *uint64
+}
+
+// Match returns true if the deal passes the filter.
+func (f DealFilter) Match(d *MinerDeal) bool {
+	if len(f.States) > 0 {
+		found := false
+		for _, s := range f.States {
+			if d.Response.State == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.Client.Empty() && d.Proposal.Payment.Payer != f.Client {
+		return false
+	}
+	if f.Sector != nil && (d.Sector == nil || *d.Sector != *f.Sector) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package storagedeal
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Piece{})
+}
+
+// Piece is the client's record of data imported for storage. Its commitment
+// is computed once, at import, and used in every deal for the piece.
+type Piece struct {
+	// Ref is the cid of the root of the piece
+	Ref cid.Cid
+
+	// Size is the size of the data of the piece
+	Size *types.BytesAmount
+
+	// Commitment is the commitment (CommP) to the piece
+	Commitment []byte
+}
@@ -0,0 +1,84 @@
+package storagedeal
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Replication{})
+	cbor.RegisterCborType(Replica{})
+	cbor.RegisterCborType(ReplicaFailure{})
+}
+
+// Replication is the client's record of storing a piece with several miners.
+type Replication struct {
+	// PieceRef is the cid of the piece being stored
+	PieceRef cid.Cid
+
+	// Replicas is the number of miners the piece should be stored with
+	Replicas uint64
+
+	// MaxPrice is the highest ask price a miner was picked at
+	MaxPrice *types.AttoFIL
+
+	// Duration is the number of blocks the deals are made for
+	Duration uint64
+
+	// Deals are the deals miners accepted for the piece
+	Deals []Replica
+
+	// Failures are the miners that rejected or failed a proposal of the
+	// piece, they are not picked again
+	Failures []ReplicaFailure
+}
+
+// Replica is a deal holding one replica of a piece.
+type Replica struct {
+	Miner       address.Address
+	ProposalCid cid.Cid
+
+	// State is the state of the deal, as last known by the client
+	State State
+}
+
+// Live returns true if the deal may still end up holding the replica.
+func (r Replica) Live() bool {
+	return r.State != Rejected && r.State != Failed
+}
+
+// ReplicaFailure is a miner that could not take a replica of a piece.
+type ReplicaFailure struct {
+	Miner address.Address
+	Error string
+}
+
+// LiveReplicas returns the number of deals that may still end up holding a
+// replica of the piece.
+func (r *Replication) LiveReplicas() uint64 {
+	var n uint64
+	for _, d := range r.Deals {
+		if d.Live() {
+			n++
+		}
+	}
+	return n
+}
+
+// Tried returns true if the piece was already proposed to the miner.
+func (r *Replication) Tried(miner address.Address) bool {
+	for _, d := range r.Deals {
+		if d.Miner == miner {
+			return true
+		}
+	}
+	for _, f := range r.Failures {
+		if f.Miner == miner {
+			return true
+		}
+	}
+	return false
+}
@@ -56,3 +56,16 @@ func (s State) String() string {
 		return fmt.Sprintf("<unrecognized %d>", s)
 	}
 }
+
+// states lists every state a deal can be in.
+var states = []State{Unknown, Rejected, Accepted, Started, Failed, Posted, Complete, Staged}
+
+// ParseState returns the state with the given name.
+func ParseState(s string) (State, error) {
+	for _, state := range states {
+		if state.String() == s {
+			return state, nil
+		}
+	}
+	return Unknown, fmt.Errorf("unknown deal state %q", s)
+}
@@ -0,0 +1,51 @@
+package storagedeal
+
+import (
+	"fmt"
+)
+
+// TransferMode is how the data of a deal gets to the miner.
+type TransferMode int
+
+const (
+	// TransferPull means the miner pulls the data from the client
+	TransferPull = TransferMode(iota)
+
+	// TransferPush means the client pushes the data to the miner
+	TransferPush
+
+	// TransferManual means the data goes to the miner out of band, say on a
+	// disk, and the miner imports it
+	TransferManual
+)
+
+func (m TransferMode) String() string {
+	switch m {
+	case TransferPull:
+		return "pull"
+	case TransferPush:
+		return "push"
+	case TransferManual:
+		return "manual"
+	default:
+		return fmt.Sprintf("<unrecognized %d>", m)
+	}
+}
+
+// TransferProgress is how far the transfer of the data of a deal got.
+type TransferProgress struct {
+	// Blocks is the number of blocks of the piece the miner received
+	Blocks uint64
+
+	// TotalBlocks is the number of blocks in the piece, zero until the
+	// transfer started
+	TotalBlocks uint64
+
+	// Bytes is the number of bytes the miner received
+	Bytes uint64
+}
+
+// Complete returns true if the miner received every block of the piece.
+func (tp *TransferProgress) Complete() bool {
+	return tp.TotalBlocks > 0 && tp.Blocks >= tp.TotalBlocks
+}
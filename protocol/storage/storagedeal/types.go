@@ -17,6 +17,7 @@ func init() {
 	cbor.RegisterCborType(ProofInfo{})
 	cbor.RegisterCborType(QueryRequest{})
 	cbor.RegisterCborType(Deal{})
+	cbor.RegisterCborType(TransferProgress{})
 }
 
 // PaymentInfo contains all the payment related information for a storage deal.
@@ -62,6 +63,26 @@ type Proposal struct {
 	// will use to pay the miner. It should be verifiable by the
 	// miner using on-chain information.
 	Payment PaymentInfo
+
+	// DealSignature is the payer's signature over the deal terms the miner
+	// publishes to the storage market (see storagemarket.SignDeal).
+	DealSignature types.Signature
+
+	// ClientNonce is the nonce the payer signed the deal terms with, the
+	// storage market accepts a deal only once per nonce
+	ClientNonce uint64
+
+	// TransferMode is how the data of the deal gets to the miner
+	TransferMode TransferMode
+
+	// PieceCommitment is the commitment (CommP) to the piece the client
+	// computed, the miner checks the data against it before adding the piece
+	// to a sector
+	PieceCommitment []byte
+
+	// PaddedSize is the number of bytes the piece takes in a sector once
+	// padded
+	PaddedSize *types.BytesAmount
 }
 
 // Unmarshal a Proposal from bytes.
@@ -113,6 +134,14 @@ type Response struct {
 	// the miner has sealed the data into a sector.
 	ProofInfo *ProofInfo
 
+	// DealID is the id of the deal in the storage market actor once the
+	// miner has published it, zero before.
+	DealID uint64
+
+	// Transfer is how far the miner got receiving the data of the deal, nil
+	// until the transfer started.
+	Transfer *TransferProgress
+
 	// Signature is a signature from the miner over the response
 	Signature types.Signature
 }
@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+const voucherRedemptionsDatastorePrefix = "voucherRedemptions"
+
+// TODO: replace this with a queries to pick reasonable gas price and limits.
+const redeemVoucherGasPrice = 0
+const redeemVoucherGasLimit = 300
+
+// redeemVoucherRetryBlocks is the number of blocks a redemption message has
+// to make it into the chain before it is sent again.
+const redeemVoucherRetryBlocks = 10
+
+// channelEolWarningBlocks is how close to its eol a payment channel with
+// vouchers left to redeem gets before the miner warns about it.
+const channelEolWarningBlocks = ChannelExpiryInterval / 2
+
+// voucherRedemption tracks the redemption of the payment vouchers of a deal.
+type voucherRedemption struct {
+	ProposalCid cid.Cid
+	// ProvenAfter is the proving period start in effect when the sector of
+	// the deal was committed. The sector has been proven once the proving
+	// period of the miner moves past it.
+	ProvenAfter *types.BlockHeight
+	// SubmittedNonce is the nonce of the last voucher a redemption was sent for.
+	SubmittedNonce uint64
+	// RetryAt is the block height from which the redemption of the voucher
+	// with SubmittedNonce is sent again if it has not landed on chain.
+	RetryAt *types.BlockHeight
+	// Attempts counts the redemptions sent for the voucher with SubmittedNonce.
+	Attempts uint64
+	// EolWarned is set once the miner warned that the channel nears its eol.
+	EolWarned bool
+	// RedeemedNonce is the nonce of the last voucher seen redeemed on chain.
+	RedeemedNonce uint64
+}
+
+// voucherRedemptionSchedule holds the deals whose vouchers the miner still
+// has to redeem, keyed by proposal cid.
+type voucherRedemptionSchedule struct {
+	l           sync.Mutex
+	Redemptions map[string]*voucherRedemption
+}
+
+func (sm *Miner) loadVoucherRedemptions() error {
+	sm.voucherRedemptions = &voucherRedemptionSchedule{
+		Redemptions: make(map[string]*voucherRedemption),
+	}
+
+	key := datastore.KeyWithNamespaces([]string{voucherRedemptionsDatastorePrefix})
+	result, notFound := sm.dealsAwaitingSealDs.Get(key)
+	if notFound == nil {
+		if err := json.Unmarshal(result, &sm.voucherRedemptions); err != nil {
+			return errors.Wrap(err, "failed to unmarshal voucher redemptions from datastore")
+		}
+	}
+
+	return nil
+}
+
+// saveVoucherRedemptions persists the schedule. Callers must hold its lock.
+func (sm *Miner) saveVoucherRedemptions() error {
+	marshalledRedemptions, err := json.Marshal(sm.voucherRedemptions)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal voucher redemptions")
+	}
+	key := datastore.KeyWithNamespaces([]string{voucherRedemptionsDatastorePrefix})
+	err = sm.dealsAwaitingSealDs.Put(key, marshalledRedemptions)
+	if err != nil {
+		return errors.Wrap(err, "could not save voucher redemptions to disk, in-memory schedule differs from persisted schedule!")
+	}
+
+	return nil
+}
+
+// scheduleVoucherRedemption adds the deal to the redemption schedule once its
+// sector has been committed.
+func (sm *Miner) scheduleVoucherRedemption(dealCid cid.Cid) error {
+	provingPeriodStart, err := sm.getProvingPeriodStart()
+	if err != nil {
+		return errors.Wrap(err, "failed to get proving period start")
+	}
+
+	sm.voucherRedemptions.l.Lock()
+	defer sm.voucherRedemptions.l.Unlock()
+
+	sm.voucherRedemptions.Redemptions[dealCid.String()] = &voucherRedemption{
+		ProposalCid: dealCid,
+		ProvenAfter: provingPeriodStart,
+	}
+	return sm.saveVoucherRedemptions()
+}
+
+// startVoucherRedemption redeems vouchers at the given height in the
+// background, so sending the redemptions does not hold up the processing of
+// the new head. A height that arrives while a redemption run is still going
+// is skipped, the next one catches up on it.
+func (sm *Miner) startVoucherRedemption(height *types.BlockHeight) {
+	sm.redeemInProcessLk.Lock()
+	defer sm.redeemInProcessLk.Unlock()
+
+	if sm.redeemInProcess {
+		return
+	}
+	sm.redeemInProcess = true
+
+	go func() {
+		defer func() {
+			sm.redeemInProcessLk.Lock()
+			defer sm.redeemInProcessLk.Unlock()
+			sm.redeemInProcess = false
+		}()
+
+		// TODO: figure out a more sensible timeout
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		sm.redeemVouchers(ctx, height)
+	}()
+}
+
+// redeemVouchers redeems the latest valid voucher of every scheduled deal
+// whose sector has been proven, and drops deals with no vouchers left. The
+// schedule is only locked to copy the redemptions and to store their
+// progress, not while querying the chain and sending messages.
+func (sm *Miner) redeemVouchers(ctx context.Context, height *types.BlockHeight) {
+	sm.voucherRedemptions.l.Lock()
+	redemptions := make(map[string]*voucherRedemption, len(sm.voucherRedemptions.Redemptions))
+	for key, r := range sm.voucherRedemptions.Redemptions {
+		rCopy := *r
+		redemptions[key] = &rCopy
+	}
+	sm.voucherRedemptions.l.Unlock()
+
+	if len(redemptions) == 0 {
+		return
+	}
+
+	provingPeriodStart, err := sm.getProvingPeriodStart()
+	if err != nil {
+		log.Errorf("failed to get proving period start to redeem vouchers: %s", err)
+		return
+	}
+
+	// closing a channel reclaims the funds of any other deal paid through
+	// it, so every deal not finished yet counts: the scheduled ones and the
+	// ones still being stored and sealed
+	deals := make(map[string]*storagedeal.Deal)
+	channelDeals := make(map[string]int)
+	finished := make(map[string]bool)
+	for key, r := range redemptions {
+		deal := sm.porcelainAPI.DealGet(r.ProposalCid)
+		if deal == nil {
+			log.Errorf("could not retrieve deal with proposal CID %s, dropping its voucher redemptions", r.ProposalCid)
+			finished[key] = true
+			continue
+		}
+		deals[key] = deal
+		channelDeals[paymentChannelKey(deal.Proposal.Payment)]++
+	}
+
+	allDeals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		log.Errorf("failed to list deals to redeem vouchers: %s", err)
+		return
+	}
+	for _, deal := range allDeals {
+		if deal.Miner != sm.minerAddr || deal.Proposal == nil || deal.Proposal.Payment.Channel == nil {
+			continue
+		}
+		switch deal.Response.State {
+		case storagedeal.Accepted, storagedeal.Started, storagedeal.Staged:
+			channelDeals[paymentChannelKey(deal.Proposal.Payment)]++
+		}
+	}
+
+	for key, deal := range deals {
+		r := redemptions[key]
+		shared := channelDeals[paymentChannelKey(deal.Proposal.Payment)] > 1
+
+		done, err := sm.redeemDealVouchers(ctx, deal, r, height, provingPeriodStart, shared)
+		if err != nil {
+			log.Errorf("failed to redeem vouchers of deal %s: %s", r.ProposalCid, err)
+		}
+		if done {
+			finished[key] = true
+		}
+	}
+
+	sm.voucherRedemptions.l.Lock()
+	defer sm.voucherRedemptions.l.Unlock()
+
+	for key, r := range redemptions {
+		if finished[key] {
+			delete(sm.voucherRedemptions.Redemptions, key)
+		} else {
+			sm.voucherRedemptions.Redemptions[key] = r
+		}
+	}
+
+	if err := sm.saveVoucherRedemptions(); err != nil {
+		log.Errorf("failed persisting voucher redemptions: %s", err)
+	}
+}
+
+// redeemDealVouchers sends the redemption of the latest valid voucher of the
+// deal, if its sector has been proven. It returns true once no voucher of the
+// deal is left to redeem.
+func (sm *Miner) redeemDealVouchers(ctx context.Context, deal *storagedeal.Deal, r *voucherRedemption, height, provingPeriodStart *types.BlockHeight, sharedChannel bool) (bool, error) {
+	payment := deal.Proposal.Payment
+	if len(payment.Vouchers) == 0 {
+		return true, nil
+	}
+
+	if !provingPeriodStart.GreaterThan(r.ProvenAfter) {
+		// the sector has not been proven yet
+		return false, nil
+	}
+
+	channel, err := sm.paymentChannel(ctx, payment.Payer, payment.Channel)
+	if err != nil {
+		return false, err
+	}
+
+	last := payment.Vouchers[len(payment.Vouchers)-1]
+	if channel == nil {
+		if r.SubmittedNonce != last.Nonce {
+			log.Warningf("payment channel %s of deal %s is gone with vouchers left to redeem", payment.Channel, r.ProposalCid)
+		} else {
+			// closed by the last voucher
+			sm.publishRedeemedVouchers(deal, r, last.Nonce)
+		}
+		return true, nil
+	}
+
+	var laneNonce uint64
+	if lane, ok := channel.Lanes[strconv.FormatUint(last.Lane, 10)]; ok {
+		laneNonce = lane.Nonce
+	}
+	sm.publishRedeemedVouchers(deal, r, laneNonce)
+	if laneNonce >= last.Nonce {
+		return true, nil
+	}
+
+	if !height.LessThan(channel.Eol) {
+		log.Errorf("payment channel %s of deal %s expired at %s with vouchers left to redeem", payment.Channel, r.ProposalCid, channel.Eol)
+		return true, nil
+	}
+	if !r.EolWarned && height.Add(types.NewBlockHeight(channelEolWarningBlocks)).GreaterEqual(channel.Eol) {
+		log.Warningf("payment channel %s of deal %s reaches its eol at %s with vouchers left to redeem", payment.Channel, r.ProposalCid, channel.Eol)
+		r.EolWarned = true
+	}
+
+	// the latest valid voucher pays for all the ones before it
+	var voucher *paymentbroker.PaymentVoucher
+	for _, v := range payment.Vouchers {
+		if v.Nonce > laneNonce && !height.LessThan(&v.ValidAt) {
+			voucher = v
+		}
+	}
+	if voucher == nil {
+		return false, nil
+	}
+
+	if voucher.Nonce == r.SubmittedNonce {
+		if height.LessThan(r.RetryAt) {
+			// give the redemption sent for it time to land on chain
+			return false, nil
+		}
+		r.Attempts++
+		log.Warningf("retrying redemption of voucher %d of deal %s, attempt %d", voucher.Nonce, r.ProposalCid, r.Attempts)
+	} else {
+		r.Attempts = 1
+	}
+	r.SubmittedNonce = voucher.Nonce
+	r.RetryAt = height.Add(types.NewBlockHeight(redeemVoucherRetryBlocks))
+
+	// the last voucher settles the deal, so the channel can be closed unless
+	// other deals are paid through it
+	method := "redeem"
+	if voucher == last && !sharedChannel {
+		method = "close"
+	}
+
+	params, err := voucher.RedeemParams(nil)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to encode voucher")
+	}
+
+	// only the channel's target, the miner owner, can redeem its vouchers
+	minerOwnerAddr, err := sm.porcelainAPI.MinerGetOwnerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get miner owner")
+	}
+
+	_, err = sm.porcelainAPI.MessageSend(
+		ctx,
+		minerOwnerAddr,
+		address.PaymentBrokerAddress,
+		types.ZeroAttoFIL,
+		types.NewGasPrice(redeemVoucherGasPrice),
+		types.NewGasUnits(redeemVoucherGasLimit),
+		method,
+		params...,
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to send %s message", method)
+	}
+
+	log.Debugf("sent %s of voucher %d of deal %s", method, voucher.Nonce, r.ProposalCid)
+	return false, nil
+}
+
+// publishRedeemedVouchers publishes a PaymentRedeemed event once the vouchers
+// of the deal up to the nonce are seen redeemed on chain.
+func (sm *Miner) publishRedeemedVouchers(deal *storagedeal.Deal, r *voucherRedemption, nonce uint64) {
+	if nonce <= r.RedeemedNonce {
+		return
+	}
+
+	var amount *types.AttoFIL
+	for _, v := range deal.Proposal.Payment.Vouchers {
+		if v.Nonce <= nonce {
+			amount = &v.Amount
+		}
+	}
+	if amount == nil {
+		return
+	}
+
+	r.RedeemedNonce = nonce
+	sm.publishDealEvent(&storagedeal.Event{ProposalCid: r.ProposalCid, Kind: storagedeal.PaymentRedeemed, Amount: amount})
+}
+
+func paymentChannelKey(payment storagedeal.PaymentInfo) string {
+	return payment.Payer.String() + "/" + payment.Channel.KeyString()
+}
@@ -48,7 +48,20 @@ const (
 		"minerAddress": "",
 		"blockSignerAddress": "",
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"dealCollateral": "0",
+		"dealPolicy": {
+			"allowedClients": [],
+			"deniedClients": [],
+			"preferredClients": [],
+			"minPieceSize": 0,
+			"maxPieceSize": 0,
+			"minDuration": 0,
+			"maxDuration": 0,
+			"maxUnsealedBytes": 0,
+			"program": "",
+			"programTimeout": "10s"
+		}
 	},
 	"wallet": {
 		"defaultAddress": ""
@@ -58,6 +71,9 @@ const (
 		"beatPeriod": "3s",
 		"reconnectPeriod": "10s",
 		"nickname": ""
+	},
+	"network": {
+		"upgrades": []
 	}
 }`
 )
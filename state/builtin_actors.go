@@ -0,0 +1,41 @@
+package state
+
+import (
+	"fmt"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/exec"
+)
+
+// builtinActorsTree is a state tree that resolves actor code through its own
+// registry of builtin actors and delegates everything else to the underlying
+// tree.
+type builtinActorsTree struct {
+	Tree
+	builtinActors map[cid.Cid]exec.ExecutableActor
+}
+
+// WithBuiltinActors returns a view of st that executes actor code from
+// builtinActors instead of the registry st was loaded with. Writes go through
+// to st. It is used to run messages under the actor code in effect at a given
+// block height.
+func WithBuiltinActors(st Tree, builtinActors map[cid.Cid]exec.ExecutableActor) Tree {
+	return &builtinActorsTree{
+		Tree:          st,
+		builtinActors: builtinActors,
+	}
+}
+
+// GetBuiltinActorCode looks up the code in the tree's own registry.
+func (t *builtinActorsTree) GetBuiltinActorCode(codePointer cid.Cid) (exec.ExecutableActor, error) {
+	if !codePointer.Defined() {
+		return nil, fmt.Errorf("missing code")
+	}
+	actor, ok := t.builtinActors[codePointer]
+	if !ok {
+		return nil, fmt.Errorf("unknown code: %s", codePointer.String())
+	}
+
+	return actor, nil
+}
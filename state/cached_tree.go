@@ -14,6 +14,18 @@ import (
 type CachedTree struct {
 	st    Tree
 	cache map[address.Address]*actor.Actor
+
+	// snapshots holds the cached actors at each outstanding snapshot,
+	// indexed by RevID.
+	snapshots []map[address.Address]cachedActor
+}
+
+// cachedActor records the value a cached actor had when a snapshot was taken.
+// Callers hold on to cached actors and mutate them in place, so reverting
+// writes the value back into the same actor.
+type cachedActor struct {
+	ptr *actor.Actor
+	val actor.Actor
 }
 
 // NewCachedStateTree returns a initialized empty CachedTree
@@ -59,7 +71,50 @@ func (t *CachedTree) GetOrCreateActor(ctx context.Context, address address.Addre
 	return actor, nil
 }
 
+// Snapshot records the current values of the cached actors. The underlying
+// tree is not touched until Commit, so no flush is needed.
+func (t *CachedTree) Snapshot(ctx context.Context) (RevID, error) {
+	snap := make(map[address.Address]cachedActor, len(t.cache))
+	for addr, act := range t.cache {
+		snap[addr] = cachedActor{ptr: act, val: *act}
+	}
+	t.snapshots = append(t.snapshots, snap)
+	return RevID(len(t.snapshots) - 1), nil
+}
+
+// Revert restores the cached actors to the values they had when snapshot id
+// was taken. Actors cached after the snapshot are dropped from the cache. The
+// snapshot and all snapshots taken after it are discarded.
+func (t *CachedTree) Revert(ctx context.Context, id RevID) error {
+	if id < 0 || int(id) >= len(t.snapshots) {
+		return errors.NewFaultErrorf("unknown state tree snapshot %d", id)
+	}
+	snap := t.snapshots[id]
+	for addr := range t.cache {
+		if _, ok := snap[addr]; !ok {
+			delete(t.cache, addr)
+		}
+	}
+	for addr, ca := range snap {
+		*ca.ptr = ca.val
+		t.cache[addr] = ca.ptr
+	}
+	t.snapshots = t.snapshots[:id]
+	return nil
+}
+
+// Release discards snapshot id and all snapshots taken after it, keeping the
+// cached actors as they are.
+func (t *CachedTree) Release(ctx context.Context, id RevID) error {
+	if id < 0 || int(id) >= len(t.snapshots) {
+		return errors.NewFaultErrorf("unknown state tree snapshot %d", id)
+	}
+	t.snapshots = t.snapshots[:id]
+	return nil
+}
+
 // Commit takes all the cached actors and sets them into the underlying cache.
+// Outstanding snapshots are discarded.
 func (t *CachedTree) Commit(ctx context.Context) error {
 	for addr, actor := range t.cache {
 		err := t.st.SetActor(ctx, addr, actor)
@@ -68,5 +123,6 @@ func (t *CachedTree) Commit(ctx context.Context) error {
 		}
 	}
 	t.cache = make(map[address.Address]*actor.Actor)
+	t.snapshots = nil
 	return nil
 }
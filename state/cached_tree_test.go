@@ -117,3 +117,52 @@ func requireCid(t *testing.T, data string) cid.Cid {
 	require.NoError(t, err)
 	return id
 }
+
+func TestCachedStateSnapshotRevert(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	cst := hamt.NewCborStore()
+	ctx := context.Background()
+
+	underlying := NewEmptyStateTree(cst)
+	tree := NewCachedStateTree(underlying)
+
+	addrGetter := address.NewForTestGetter()
+	addr1, addr2 := addrGetter(), addrGetter()
+	require.NoError(underlying.SetActor(ctx, addr1, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(10))))
+
+	cAct1, err := tree.GetActor(ctx, addr1)
+	require.NoError(err)
+
+	outer, err := tree.Snapshot(ctx)
+	require.NoError(err)
+
+	cAct1.Balance = types.NewAttoFILFromFIL(5)
+
+	inner, err := tree.Snapshot(ctx)
+	require.NoError(err)
+
+	cAct1.IncNonce()
+	cAct2, err := tree.GetOrCreateActor(ctx, addr2, func() (*actor.Actor, error) {
+		return actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(5)), nil
+	})
+	require.NoError(err)
+	cAct2.IncNonce()
+
+	// Reverting restores the instances callers hold and forgets new actors.
+	require.NoError(tree.Revert(ctx, inner))
+	assert.Equal(uint64(0), uint64(cAct1.Nonce))
+	assert.Equal(types.NewAttoFILFromFIL(5), cAct1.Balance)
+	cAct1Again, err := tree.GetActor(ctx, addr1)
+	require.NoError(err)
+	assert.True(cAct1 == cAct1Again)
+
+	require.NoError(tree.Revert(ctx, outer))
+	assert.True(types.NewAttoFILFromFIL(10).Equal(cAct1.Balance))
+	assert.Error(tree.Revert(ctx, inner))
+
+	// Nothing created after the snapshot reaches the underlying tree.
+	require.NoError(tree.Commit(ctx))
+	_, err = underlying.GetActor(ctx, addr2)
+	assert.True(IsActorNotFoundError(err))
+}
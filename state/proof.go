@@ -0,0 +1,280 @@
+package state
+
+import (
+	"context"
+	"fmt"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	block "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+// ActorProof proves that an actor, and optionally one field of its storage,
+// is part of the state tree with a given root. It can be checked with
+// VerifyActorProof knowing nothing but the root.
+type ActorProof struct {
+	// Path holds the cbor encoded HAMT nodes leading from the state root to
+	// the node holding the actor.
+	Path [][]byte `json:"path"`
+	// Field is the name of the storage field the proof covers, if any.
+	Field string `json:"field,omitempty"`
+	// Storage holds the cbor encoded actor storage head followed, when
+	// Field links to other nodes, by every node of the subtree under it.
+	Storage [][]byte `json:"storage,omitempty"`
+}
+
+// ProveActor returns a proof that the actor at addr is in the state tree
+// rooted at root. If field is not empty the proof also covers the actor's
+// storage head and the subtree the named field of the head links to.
+func ProveActor(ctx context.Context, cst *hamt.CborIpldStore, root cid.Cid, addr address.Address, field string) (*ActorProof, error) {
+	proof := &ActorProof{Field: field}
+	value, err := proveKey(ctx, cst, root, addr.String(), proof)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, &actorNotFoundError{}
+	}
+
+	if field == "" {
+		return proof, nil
+	}
+
+	var act actor.Actor
+	if err := hackTransferObject(value, &act); err != nil {
+		return nil, errors.Wrap(err, "malformed actor")
+	}
+	if !act.Head.Defined() {
+		return nil, fmt.Errorf("actor %s has no storage", addr)
+	}
+	head, err := cst.Blocks.GetBlock(ctx, act.Head)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load storage head %s", act.Head)
+	}
+	proof.Storage = append(proof.Storage, head.RawData())
+
+	link, err := storageField(head.RawData(), field)
+	if err != nil {
+		return nil, err
+	}
+	if link.Defined() {
+		if err := proveSubtree(ctx, cst, link, cid.NewSet(), proof); err != nil {
+			return nil, err
+		}
+	}
+	return proof, nil
+}
+
+// proveKey looks key up in the HAMT rooted at root and appends the nodes the
+// lookup loads, the ones along the key's hash bits, to proof.Path. It returns
+// nil if key is not found, leaving proof.Path as it found it.
+func proveKey(ctx context.Context, cst *hamt.CborIpldStore, root cid.Cid, key string, proof *ActorProof) (interface{}, error) {
+	rec := &recordingBlocks{blocks: cst.Blocks}
+	nd, err := hamt.LoadNode(ctx, &hamt.CborIpldStore{Blocks: rec, Atlas: cst.Atlas}, root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load state root %s", root)
+	}
+	value, err := nd.Find(ctx, key)
+	if err == hamt.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up %s", key)
+	}
+
+	proof.Path = append(proof.Path, rec.loaded...)
+	return value, nil
+}
+
+// blockStore is the block access a hamt.CborIpldStore needs.
+type blockStore interface {
+	GetBlock(ctx context.Context, c cid.Cid) (block.Block, error)
+	AddBlock(b block.Block) error
+}
+
+// recordingBlocks keeps the raw data of every block loaded through it, in
+// the order they are loaded.
+type recordingBlocks struct {
+	blocks blockStore
+	loaded [][]byte
+}
+
+// GetBlock gets a block from the underlying blocks and records it.
+func (rb *recordingBlocks) GetBlock(ctx context.Context, c cid.Cid) (block.Block, error) {
+	blk, err := rb.blocks.GetBlock(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	rb.loaded = append(rb.loaded, blk.RawData())
+	return blk, nil
+}
+
+// AddBlock adds a block to the underlying blocks.
+func (rb *recordingBlocks) AddBlock(b block.Block) error {
+	return rb.blocks.AddBlock(b)
+}
+
+// proveSubtree appends the node with cid c and everything it links to, each
+// node once, to proof.Storage.
+func proveSubtree(ctx context.Context, cst *hamt.CborIpldStore, c cid.Cid, seen *cid.Set, proof *ActorProof) error {
+	if !seen.Visit(c) {
+		return nil
+	}
+	blk, err := cst.Blocks.GetBlock(ctx, c)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load storage node %s", c)
+	}
+	nd, err := cbor.DecodeBlock(blk)
+	if err != nil {
+		return errors.Wrapf(err, "malformed storage node %s", c)
+	}
+
+	proof.Storage = append(proof.Storage, blk.RawData())
+	for _, l := range nd.Links() {
+		if err := proveSubtree(ctx, cst, l.Cid, seen, proof); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storageField returns the link the named field of the cbor encoded storage
+// head holds, or cid.Undef if the field holds a plain value.
+func storageField(head []byte, field string) (cid.Cid, error) {
+	var fields map[string]interface{}
+	if err := cbor.DecodeInto(head, &fields); err != nil {
+		return cid.Undef, errors.Wrap(err, "storage head is not a map")
+	}
+	v, ok := fields[field]
+	if !ok {
+		return cid.Undef, fmt.Errorf("storage has no field %q", field)
+	}
+	if link, ok := v.(cid.Cid); ok {
+		return link, nil
+	}
+	return cid.Undef, nil
+}
+
+// VerifyActorProof checks that proof shows the actor at addr to be in the
+// state tree with root root and returns the actor. If the proof covers a
+// storage field, the storage head and the subtree under the field are
+// checked against the actor's Head as well.
+func VerifyActorProof(root cid.Cid, addr address.Address, proof *ActorProof) (*actor.Actor, error) {
+	if len(proof.Path) == 0 {
+		return nil, fmt.Errorf("empty proof")
+	}
+
+	key := addr.String()
+	expected := []cid.Cid{root}
+	for i, raw := range proof.Path {
+		c, err := root.Prefix().Sum(raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to hash state node")
+		}
+		if !containsCid(expected, c) {
+			return nil, fmt.Errorf("state node %d (%s) is not linked from its parent", i, c)
+		}
+		var nd hamt.Node
+		if err := cbor.DecodeInto(raw, &nd); err != nil {
+			return nil, errors.Wrapf(err, "malformed state node %d", i)
+		}
+
+		expected = expected[:0]
+		for _, p := range nd.Pointers {
+			if p.Link.Defined() {
+				expected = append(expected, p.Link)
+			}
+			if i < len(proof.Path)-1 {
+				continue
+			}
+			for _, kv := range p.KVs {
+				if kv.Key != key {
+					continue
+				}
+				var act actor.Actor
+				if err := hackTransferObject(kv.Value, &act); err != nil {
+					return nil, errors.Wrap(err, "malformed actor")
+				}
+				if err := verifyStorage(&act, proof); err != nil {
+					return nil, err
+				}
+				return &act, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("proof does not reach actor %s", addr)
+}
+
+// verifyStorage checks the storage part of proof against the head of act.
+func verifyStorage(act *actor.Actor, proof *ActorProof) error {
+	if proof.Field == "" {
+		if len(proof.Storage) != 0 {
+			return fmt.Errorf("proof has storage but no field")
+		}
+		return nil
+	}
+	if len(proof.Storage) == 0 {
+		return fmt.Errorf("proof for field %q has no storage", proof.Field)
+	}
+	if !act.Head.Defined() {
+		return fmt.Errorf("actor has no storage")
+	}
+
+	c, err := act.Head.Prefix().Sum(proof.Storage[0])
+	if err != nil {
+		return errors.Wrap(err, "failed to hash storage head")
+	}
+	if !c.Equals(act.Head) {
+		return fmt.Errorf("storage head has cid %s, expected %s", c, act.Head)
+	}
+	link, err := storageField(proof.Storage[0], proof.Field)
+	if err != nil {
+		return err
+	}
+
+	// Every other node must be linked from the field or from a node already
+	// checked, and every node the field reaches must be present.
+	if !link.Defined() {
+		if len(proof.Storage) > 1 {
+			return fmt.Errorf("field %q holds no link but proof has storage nodes", proof.Field)
+		}
+		return nil
+	}
+	pending := cid.NewSet()
+	pending.Add(link)
+	done := cid.NewSet()
+	for i, raw := range proof.Storage[1:] {
+		nd, err := cbor.Decode(raw, link.Prefix().MhType, -1)
+		if err != nil {
+			return errors.Wrapf(err, "malformed storage node %d", i+1)
+		}
+		if !pending.Has(nd.Cid()) {
+			return fmt.Errorf("storage node %d (%s) is not linked from the field", i+1, nd.Cid())
+		}
+		pending.Remove(nd.Cid())
+		done.Add(nd.Cid())
+		for _, l := range nd.Links() {
+			if !done.Has(l.Cid) {
+				pending.Add(l.Cid)
+			}
+		}
+	}
+	if pending.Len() > 0 {
+		return fmt.Errorf("proof is missing %d nodes under field %q", pending.Len(), proof.Field)
+	}
+	return nil
+}
+
+func containsCid(cids []cid.Cid, c cid.Cid) bool {
+	for _, other := range cids {
+		if other.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
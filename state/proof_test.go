@@ -0,0 +1,130 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestProveAndVerifyActor(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	tree := NewEmptyStateTree(cst)
+
+	// The actor's storage has a plain field and a field linking to a list
+	// of two more nodes.
+	leaf1, err := cst.Put(ctx, map[string]interface{}{"value": 1})
+	require.NoError(err)
+	leaf2, err := cst.Put(ctx, map[string]interface{}{"value": 2})
+	require.NoError(err)
+	list, err := cst.Put(ctx, []cid.Cid{leaf1, leaf2})
+	require.NoError(err)
+	head, err := cst.Put(ctx, map[string]interface{}{"Count": 2, "Items": list})
+	require.NoError(err)
+
+	// Enough actors for the state tree to grow below its root.
+	addrGetter := address.NewForTestGetter()
+	var addrs []address.Address
+	var addr address.Address
+	for i := 0; i < 200; i++ {
+		addr = addrGetter()
+		addrs = append(addrs, addr)
+		act := actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(uint64(i)))
+		act.Head = head
+		require.NoError(tree.SetActor(ctx, addr, act))
+	}
+	root, err := tree.Flush(ctx)
+	require.NoError(err)
+
+	t.Run("actor alone", func(t *testing.T) {
+		proof, err := ProveActor(ctx, cst, root, addr, "")
+		require.NoError(err)
+		assert.True(len(proof.Path) > 1)
+		assert.Empty(proof.Storage)
+
+		act, err := VerifyActorProof(root, addr, proof)
+		require.NoError(err)
+		assert.True(types.NewAttoFILFromFIL(199).Equal(act.Balance))
+	})
+
+	t.Run("every actor", func(t *testing.T) {
+		for i, a := range addrs {
+			proof, err := ProveActor(ctx, cst, root, a, "")
+			require.NoError(err)
+
+			act, err := VerifyActorProof(root, a, proof)
+			require.NoError(err)
+			assert.True(types.NewAttoFILFromFIL(uint64(i)).Equal(act.Balance))
+		}
+	})
+
+	t.Run("plain field", func(t *testing.T) {
+		proof, err := ProveActor(ctx, cst, root, addr, "Count")
+		require.NoError(err)
+		assert.Len(proof.Storage, 1)
+
+		_, err = VerifyActorProof(root, addr, proof)
+		assert.NoError(err)
+	})
+
+	t.Run("linked field", func(t *testing.T) {
+		proof, err := ProveActor(ctx, cst, root, addr, "Items")
+		require.NoError(err)
+		assert.Len(proof.Storage, 4)
+
+		_, err = VerifyActorProof(root, addr, proof)
+		assert.NoError(err)
+
+		missing := *proof
+		missing.Storage = proof.Storage[:3]
+		_, err = VerifyActorProof(root, addr, &missing)
+		assert.Error(err)
+
+		foreign := *proof
+		foreign.Storage = append(append([][]byte{}, proof.Storage...), proof.Path[0])
+		_, err = VerifyActorProof(root, addr, &foreign)
+		assert.Error(err)
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		_, err := ProveActor(ctx, cst, root, addr, "Nope")
+		assert.Error(err)
+	})
+
+	t.Run("missing actor", func(t *testing.T) {
+		_, err := ProveActor(ctx, cst, root, addrGetter(), "")
+		assert.True(IsActorNotFoundError(err))
+	})
+
+	t.Run("proof for another actor", func(t *testing.T) {
+		proof, err := ProveActor(ctx, cst, root, addr, "")
+		require.NoError(err)
+		_, err = VerifyActorProof(root, addrGetter(), proof)
+		assert.Error(err)
+	})
+
+	t.Run("proof for another root", func(t *testing.T) {
+		proof, err := ProveActor(ctx, cst, root, addr, "")
+		require.NoError(err)
+		_, err = VerifyActorProof(types.SomeCid(), addr, proof)
+		assert.Error(err)
+	})
+
+	t.Run("truncated proof", func(t *testing.T) {
+		proof, err := ProveActor(ctx, cst, root, addr, "")
+		require.NoError(err)
+		proof.Path = proof.Path[:len(proof.Path)-1]
+		_, err = VerifyActorProof(root, addr, proof)
+		assert.Error(err)
+	})
+}
@@ -106,6 +106,37 @@ func (m *MockStateTree) Debug() {
 	panic("do not call me")
 }
 
+// Snapshot implements StateTree.Snapshot
+func (m *MockStateTree) Snapshot(ctx context.Context) (id RevID, err error) {
+	if m.NoMocks {
+		return
+	}
+	args := m.Called(ctx)
+	if args.Get(0) != nil {
+		id = args.Get(0).(RevID)
+	}
+	err = args.Error(1)
+	return
+}
+
+// Revert implements StateTree.Revert
+func (m *MockStateTree) Revert(ctx context.Context, id RevID) error {
+	if m.NoMocks {
+		return nil
+	}
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// Release implements StateTree.Release
+func (m *MockStateTree) Release(ctx context.Context, id RevID) error {
+	if m.NoMocks {
+		return nil
+	}
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
 // GetBuiltinActorCode implements StateTree.GetBuiltinActorCode
 func (m *MockStateTree) GetBuiltinActorCode(c cid.Cid) (exec.ExecutableActor, error) {
 	a, ok := m.BuiltinActors[c]
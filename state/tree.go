@@ -23,6 +23,10 @@ type tree struct {
 	store *hamt.CborIpldStore
 
 	builtinActors map[cid.Cid]exec.ExecutableActor
+
+	// snapshots holds the root of the tree at each outstanding snapshot,
+	// indexed by RevID.
+	snapshots []cid.Cid
 }
 
 // RevID identifies a snapshot of the StateTree.
@@ -43,6 +47,15 @@ type Tree interface {
 	ForEachActor(ctx context.Context, walkFn ActorWalkFn) error
 
 	GetBuiltinActorCode(c cid.Cid) (exec.ExecutableActor, error)
+
+	// Snapshot records the current state of the tree. Snapshots nest.
+	Snapshot(ctx context.Context) (RevID, error)
+	// Revert returns the tree to the state it was in when the given snapshot
+	// was taken, discarding that snapshot and all snapshots taken after it.
+	Revert(ctx context.Context, id RevID) error
+	// Release discards the given snapshot and all snapshots taken after it,
+	// keeping the current state of the tree.
+	Release(ctx context.Context, id RevID) error
 }
 
 var _ Tree = &tree{}
@@ -91,6 +104,44 @@ func (t *tree) Flush(ctx context.Context) (cid.Cid, error) {
 	return t.store.Put(ctx, t.root)
 }
 
+// Snapshot records the current state of the tree and returns an identifier
+// Revert accepts to return to it. Taking a snapshot flushes the tree to its
+// store, so it costs no more than writing the nodes changed since the last
+// flush.
+func (t *tree) Snapshot(ctx context.Context) (RevID, error) {
+	c, err := t.Flush(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to flush state tree for snapshot")
+	}
+	t.snapshots = append(t.snapshots, c)
+	return RevID(len(t.snapshots) - 1), nil
+}
+
+// Revert returns the tree to the state it was in when snapshot id was taken.
+// The snapshot and all snapshots taken after it are discarded.
+func (t *tree) Revert(ctx context.Context, id RevID) error {
+	if id < 0 || int(id) >= len(t.snapshots) {
+		return fmt.Errorf("unknown state tree snapshot %d", id)
+	}
+	root, err := hamt.LoadNode(ctx, t.store, t.snapshots[id])
+	if err != nil {
+		return errors.Wrap(err, "failed to load state tree snapshot")
+	}
+	t.root = root
+	t.snapshots = t.snapshots[:id]
+	return nil
+}
+
+// Release discards snapshot id and all snapshots taken after it. The changes
+// made since the snapshot stay in the tree.
+func (t *tree) Release(ctx context.Context, id RevID) error {
+	if id < 0 || int(id) >= len(t.snapshots) {
+		return fmt.Errorf("unknown state tree snapshot %d", id)
+	}
+	t.snapshots = t.snapshots[:id]
+	return nil
+}
+
 // IsActorNotFoundError is true of the error returned by
 // GetActor when no actor was found at the given address.
 func IsActorNotFoundError(err error) bool {
@@ -143,3 +143,71 @@ func TestGetAllActors(t *testing.T) {
 	assert.Equal(actor.Nonce, found.Nonce)
 	assert.Equal(actor.Balance, found.Balance)
 }
+
+func TestStateSnapshotRevert(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	tree := NewEmptyStateTree(cst)
+
+	addrGetter := address.NewForTestGetter()
+	addr1, addr2 := addrGetter(), addrGetter()
+
+	act1 := actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(1))
+	require.NoError(tree.SetActor(ctx, addr1, act1))
+
+	outer, err := tree.Snapshot(ctx)
+	require.NoError(err)
+
+	act1.IncNonce()
+	require.NoError(tree.SetActor(ctx, addr1, act1))
+
+	inner, err := tree.Snapshot(ctx)
+	require.NoError(err)
+
+	require.NoError(tree.SetActor(ctx, addr2, actor.NewActor(types.AccountActorCodeCid, nil)))
+
+	// Reverting the inner snapshot drops addr2 but keeps the nonce change.
+	require.NoError(tree.Revert(ctx, inner))
+	_, err = tree.GetActor(ctx, addr2)
+	assert.True(IsActorNotFoundError(err))
+	act1out, err := tree.GetActor(ctx, addr1)
+	require.NoError(err)
+	assert.Equal(uint64(1), uint64(act1out.Nonce))
+
+	// The inner snapshot is gone once reverted.
+	assert.Error(tree.Revert(ctx, inner))
+
+	require.NoError(tree.Revert(ctx, outer))
+	act1out, err = tree.GetActor(ctx, addr1)
+	require.NoError(err)
+	assert.Equal(uint64(0), uint64(act1out.Nonce))
+
+	assert.Error(tree.Revert(ctx, outer))
+}
+
+func TestStateSnapshotRelease(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	tree := NewEmptyStateTree(cst)
+
+	addr := address.NewForTestGetter()()
+
+	outer, err := tree.Snapshot(ctx)
+	require.NoError(err)
+	inner, err := tree.Snapshot(ctx)
+	require.NoError(err)
+
+	require.NoError(tree.SetActor(ctx, addr, actor.NewActor(types.AccountActorCodeCid, nil)))
+
+	// Releasing the outer snapshot keeps the changes and discards both.
+	require.NoError(tree.Release(ctx, outer))
+	_, err = tree.GetActor(ctx, addr)
+	assert.NoError(err)
+
+	assert.Error(tree.Revert(ctx, inner))
+	assert.Error(tree.Release(ctx, outer))
+}
@@ -124,7 +124,7 @@ type TestBlockRewarder struct{}
 var _ consensus.BlockRewarder = (*TestBlockRewarder)(nil)
 
 // BlockReward is a noop
-func (tbr *TestBlockRewarder) BlockReward(ctx context.Context, st state.Tree, minerAddr address.Address) error {
+func (tbr *TestBlockRewarder) BlockReward(ctx context.Context, st state.Tree, minerAddr address.Address, bh *types.BlockHeight) error {
 	// do nothing to keep state root the same
 	return nil
 }
@@ -137,7 +137,7 @@ func (tbr *TestBlockRewarder) GasReward(ctx context.Context, st state.Tree, mine
 
 // NewTestProcessor creates a processor with a test validator and test rewarder
 func NewTestProcessor() *consensus.DefaultProcessor {
-	return consensus.NewConfiguredProcessor(&TestSignedMessageValidator{}, &TestBlockRewarder{})
+	return consensus.NewConfiguredProcessor(&TestSignedMessageValidator{}, &TestBlockRewarder{}, consensus.DefaultUpgrades())
 }
 
 type testSigner struct{}
@@ -165,7 +165,7 @@ func ApplyTestMessageWithGas(st state.Tree, store vm.StorageMap, msg *types.Mess
 	if err != nil {
 		panic(err)
 	}
-	applier := consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), consensus.NewDefaultBlockRewarder())
+	applier := consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), consensus.NewDefaultBlockRewarder(), consensus.DefaultUpgrades())
 	return newMessageApplier(smsg, applier, st, store, bh, minerOwner)
 }
 
@@ -190,5 +190,5 @@ func CreateAndApplyTestMessage(t *testing.T, st state.Tree, vms vm.StorageMap, t
 }
 
 func newTestApplier() *consensus.DefaultProcessor {
-	return consensus.NewConfiguredProcessor(&TestSignedMessageValidator{}, &TestBlockRewarder{})
+	return consensus.NewConfiguredProcessor(&TestSignedMessageValidator{}, &TestBlockRewarder{}, consensus.DefaultUpgrades())
 }
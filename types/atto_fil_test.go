@@ -174,6 +174,16 @@ func TestMulInt(t *testing.T) {
 	})
 }
 
+func TestDivInt(t *testing.T) {
+	attoFIL := AttoFIL{val: big.NewInt(1000)}
+
+	t.Run("correctly divides the values and rounds down", func(t *testing.T) {
+		assert := assert.New(t)
+		expected := AttoFIL{val: big.NewInt(333)}
+		assert.Equal(attoFIL.DivBigInt(big.NewInt(3)), &expected)
+	})
+}
+
 func TestDivCeil(t *testing.T) {
 	x := AttoFIL{val: big.NewInt(200)}
 
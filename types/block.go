@@ -40,16 +40,17 @@ type Block struct {
 	// Nonce is a temporary field used to differentiate blocks for testing
 	Nonce Uint64 `json:"nonce"`
 
-	// Messages is the set of messages included in this block
-	// TODO: should be a merkletree-ish thing
-	Messages []*SignedMessage `json:"messages"`
+	// Messages is the root of the array of messages included in this block.
+	// An undefined root stands for an empty array.
+	Messages cid.Cid `json:"messages,omitempty" refmt:",omitempty"`
 
 	// StateRoot is a cid pointer to the state tree after application of the
 	// transactions state transitions.
 	StateRoot cid.Cid `json:"stateRoot,omitempty" refmt:",omitempty"`
 
-	// MessageReceipts is a set of receipts matching to the sending of the `Messages`.
-	MessageReceipts []*MessageReceipt `json:"messageReceipts"`
+	// MessageReceipts is the root of the array of receipts matching to the
+	// sending of the `Messages`. An undefined root stands for an empty array.
+	MessageReceipts cid.Cid `json:"messageReceipts,omitempty" refmt:",omitempty"`
 
 	// Proof is a proof of spacetime generated using the hash of the previous ticket as
 	// a challenge
@@ -154,3 +155,17 @@ func SortBlocks(blks []*Block) {
 		return bytes.Compare(blks[i].Ticket, blks[j].Ticket) == -1
 	})
 }
+
+// CanonicalOrder returns the indices of blks in the canonical order SortBlocks
+// puts them in, leaving blks untouched. It lets callers walk data kept
+// alongside the blocks in that order.
+func CanonicalOrder(blks []*Block) []int {
+	order := make([]int, len(blks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(blks[order[i]].Ticket, blks[order[j]].Ticket) == -1
+	})
+	return order
+}
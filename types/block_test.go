@@ -94,8 +94,8 @@ func TestTriangleEncoding(t *testing.T) {
 			Ticket:          []byte{0x01, 0x02, 0x03},
 			Height:          Uint64(2),
 			Nonce:           3,
-			Messages:        []*SignedMessage{newSignedMessage()},
-			MessageReceipts: []*MessageReceipt{{ExitCode: 1}},
+			Messages:        SomeCid(),
+			MessageReceipts: SomeCid(),
 			Parents:         NewSortedCidSet(SomeCid()),
 			ParentWeight:    Uint64(1000),
 			Proof:           NewTestPoSt(),
@@ -161,18 +161,19 @@ func TestDecodeBlock(t *testing.T) {
 		assert.NoError(err)
 		c2, err := cidFromString("b")
 		assert.NoError(err)
+		c3, err := cidFromString("c")
+		assert.NoError(err)
+		c4, err := cidFromString("d")
+		assert.NoError(err)
 
 		before := &Block{
-			Miner:     addrGetter(),
-			Ticket:    []uint8{},
-			Parents:   NewSortedCidSet(c1),
-			Height:    2,
-			Messages:  []*SignedMessage{newSignedMessage(), newSignedMessage()},
-			StateRoot: c2,
-			MessageReceipts: []*MessageReceipt{
-				{ExitCode: 1, Return: [][]byte{{1, 2}}},
-				{ExitCode: 1, Return: [][]byte{{1, 2, 3}}},
-			},
+			Miner:           addrGetter(),
+			Ticket:          []uint8{},
+			Parents:         NewSortedCidSet(c1),
+			Height:          2,
+			Messages:        c3,
+			StateRoot:       c2,
+			MessageReceipts: c4,
 		}
 
 		after, err := DecodeBlock(before.ToNode().RawData())
@@ -235,23 +236,20 @@ func TestBlockJsonMarshal(t *testing.T) {
 	child.Parents = NewSortedCidSet(parent.Cid())
 	child.StateRoot = parent.Cid()
 
-	message := newSignedMessage()
-
-	retVal := []byte{1, 2, 3}
-	receipt := &MessageReceipt{
-		ExitCode: 123,
-		Return:   [][]byte{retVal},
-	}
-	child.Messages = []*SignedMessage{message}
-	child.MessageReceipts = []*MessageReceipt{receipt}
+	msgsRoot, err := cidFromString("messages")
+	assert.NoError(err)
+	receiptsRoot, err := cidFromString("receipts")
+	assert.NoError(err)
+	child.Messages = msgsRoot
+	child.MessageReceipts = receiptsRoot
 
 	marshalled, e1 := json.Marshal(child)
 	assert.NoError(e1)
 	str := string(marshalled)
 
 	assert.Contains(str, parent.Cid().String())
-	assert.Contains(str, message.From.String())
-	assert.Contains(str, message.To.String())
+	assert.Contains(str, msgsRoot.String())
+	assert.Contains(str, receiptsRoot.String())
 
 	// marshal/unmarshal symmetry
 	var unmarshalled Block
@@ -261,6 +259,6 @@ func TestBlockJsonMarshal(t *testing.T) {
 	AssertHaveSameCid(assert, &child, &unmarshalled)
 	assert.True(child.Equals(&unmarshalled))
 
-	assert.Equal(uint8(123), unmarshalled.MessageReceipts[0].ExitCode)
-	assert.Equal([][]byte{{1, 2, 3}}, unmarshalled.MessageReceipts[0].Return)
+	assert.True(msgsRoot.Equals(unmarshalled.Messages))
+	assert.True(receiptsRoot.Equals(unmarshalled.MessageReceipts))
 }
@@ -40,6 +40,31 @@ var BootstrapMinerActorCodeObj ipld.Node
 // BootstrapMinerActorCodeCid is the cid of the above object
 var BootstrapMinerActorCodeCid cid.Cid
 
+// MultisigActorCodeObj is the code representation of the builtin multisig actor.
+var MultisigActorCodeObj ipld.Node
+
+// MultisigActorCodeCid is the cid of the above object
+var MultisigActorCodeCid cid.Cid
+
+// MultisigFactoryActorCodeObj is the code representation of the builtin
+// actor creating multisig actors.
+var MultisigFactoryActorCodeObj ipld.Node
+
+// MultisigFactoryActorCodeCid is the cid of the above object
+var MultisigFactoryActorCodeCid cid.Cid
+
+// VestingActorCodeObj is the code representation of the builtin vesting actor.
+var VestingActorCodeObj ipld.Node
+
+// VestingActorCodeCid is the cid of the above object
+var VestingActorCodeCid cid.Cid
+
+// GasScheduleActorCodeObj is the code representation of the builtin gas schedule actor.
+var GasScheduleActorCodeObj ipld.Node
+
+// GasScheduleActorCodeCid is the cid of the above object
+var GasScheduleActorCodeCid cid.Cid
+
 // ActorCodeCidTypeNames maps Actor codeCid's to the name of the associated Actor type.
 var ActorCodeCidTypeNames = make(map[cid.Cid]string)
 
@@ -54,6 +79,14 @@ func init() {
 	MinerActorCodeCid = MinerActorCodeObj.Cid()
 	BootstrapMinerActorCodeObj = dag.NewRawNode([]byte("bootstrapmineractor"))
 	BootstrapMinerActorCodeCid = BootstrapMinerActorCodeObj.Cid()
+	MultisigActorCodeObj = dag.NewRawNode([]byte("multisig"))
+	MultisigActorCodeCid = MultisigActorCodeObj.Cid()
+	MultisigFactoryActorCodeObj = dag.NewRawNode([]byte("multisigfactory"))
+	MultisigFactoryActorCodeCid = MultisigFactoryActorCodeObj.Cid()
+	VestingActorCodeObj = dag.NewRawNode([]byte("vesting"))
+	VestingActorCodeCid = VestingActorCodeObj.Cid()
+	GasScheduleActorCodeObj = dag.NewRawNode([]byte("gasschedule"))
+	GasScheduleActorCodeCid = GasScheduleActorCodeObj.Cid()
 
 	// New Actors need to be added here.
 	// TODO: Make this work with reflection -- but note that nasty import cycles lie on that path.
@@ -63,6 +96,10 @@ func init() {
 	ActorCodeCidTypeNames[PaymentBrokerActorCodeCid] = "PaymentBrokerActor"
 	ActorCodeCidTypeNames[MinerActorCodeCid] = "MinerActor"
 	ActorCodeCidTypeNames[BootstrapMinerActorCodeCid] = "MinerActor"
+	ActorCodeCidTypeNames[MultisigActorCodeCid] = "MultisigActor"
+	ActorCodeCidTypeNames[MultisigFactoryActorCodeCid] = "MultisigFactoryActor"
+	ActorCodeCidTypeNames[VestingActorCodeCid] = "VestingActor"
+	ActorCodeCidTypeNames[GasScheduleActorCodeCid] = "GasScheduleActor"
 }
 
 // ActorCodeTypeName returns the (string) name of the Go type of the actor with cid, code.
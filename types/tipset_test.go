@@ -38,16 +38,18 @@ func block(require *require.Assertions, height int, parentCid cid.Cid, parentWei
 	m1 := NewMessage(mockSignerForTest.Addresses[0], addrGetter(), 0, NewAttoFILFromFIL(10), "hello", []byte(msg))
 	sm1, err := NewSignedMessage(*m1, &mockSignerForTest, NewGasPrice(0), NewGasUnits(0))
 	require.NoError(err)
-	ret := []byte{1, 2}
+	// Stand-in for the root of a collection holding sm1.
+	msgsRoot, err := sm1.Cid()
+	require.NoError(err)
 
 	return &Block{
 		Parents:         NewSortedCidSet(parentCid),
 		ParentWeight:    Uint64(parentWeight),
 		Height:          Uint64(42 + uint64(height)),
 		Nonce:           7,
-		Messages:        []*SignedMessage{sm1},
+		Messages:        msgsRoot,
 		StateRoot:       SomeCid(),
-		MessageReceipts: []*MessageReceipt{{ExitCode: 1, Return: [][]byte{ret}}},
+		MessageReceipts: SomeCid(),
 	}
 }
 
@@ -75,8 +77,8 @@ func TestTipSet(t *testing.T) {
 	assert.Equal(ts2, ts)
 	ts2[b1.Cid()] = b3
 	assert.NotEqual(ts2, ts)
-	assert.Equal([]byte("3"), ts2[b1.Cid()].Messages[0].Params)
-	assert.Equal([]byte("1"), ts[b1.Cid()].Messages[0].Params)
+	assert.Equal(b3.Messages, ts2[b1.Cid()].Messages)
+	assert.Equal(b1.Messages, ts[b1.Cid()].Messages)
 
 	// The actual values inside the TipSets are not copied - we assume they are used immutably.
 	ts2 = ts.Clone()
@@ -68,7 +68,10 @@ var _ exec.VMContext = (*Context)(nil)
 
 // Storage returns an implementation of the storage module for this context.
 func (ctx *Context) Storage() exec.Storage {
-	return ctx.storageMap.NewStorage(ctx.message.To, ctx.to)
+	return &meteredStorage{
+		Storage:    ctx.storageMap.NewStorage(ctx.message.To, ctx.to),
+		gasTracker: ctx.gasTracker,
+	}
 }
 
 // Message retrieves the message associated with this context.
@@ -99,11 +102,22 @@ func (ctx *Context) Charge(cost types.GasUnits) error {
 	return ctx.gasTracker.Charge(cost)
 }
 
+// ChargeOp attempts to add the scheduled price of count occurrences of op to
+// the accrued gas cost of this transaction
+func (ctx *Context) ChargeOp(op exec.GasOp, count uint64) error {
+	return ctx.gasTracker.ChargeOp(op, count)
+}
+
 // GasUnits retrieves the gas cost so far
 func (ctx *Context) GasUnits() types.GasUnits {
 	return ctx.gasTracker.gasConsumedByMessage
 }
 
+// GasBreakdown retrieves the gas cost so far grouped by operation
+func (ctx *Context) GasBreakdown() GasBreakdown {
+	return ctx.gasTracker.MessageBreakdown()
+}
+
 // WriteStorage writes to the storage of the associated to actor.
 func (ctx *Context) WriteStorage(memory interface{}) error {
 	stage := ctx.Storage()
@@ -126,6 +140,11 @@ func (ctx *Context) BlockHeight() *types.BlockHeight {
 	return ctx.blockHeight
 }
 
+// MyBalance returns the balance of the actor the message is sent to.
+func (ctx *Context) MyBalance() *types.AttoFIL {
+	return ctx.to.Balance
+}
+
 // IsFromAccountActor returns true if the message is being sent by an account actor.
 func (ctx *Context) IsFromAccountActor() bool {
 	return account.IsAccount(ctx.from)
@@ -136,6 +155,10 @@ func (ctx *Context) IsFromAccountActor() bool {
 func (ctx *Context) Send(to address.Address, method string, value *types.AttoFIL, params []interface{}) ([][]byte, uint8, error) {
 	deps := ctx.deps
 
+	if err := ctx.ChargeOp(exec.GasOpSend, 1); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
 	// the message sender is the `to` actor, so this is what we set as `from` in the new message
 	from := ctx.Message().To
 	fromActor := ctx.to
@@ -156,10 +179,20 @@ func (ctx *Context) Send(to address.Address, method string, value *types.AttoFIL
 		return nil, 1, errors.NewFaultErrorf("unhandled: sending to self (%s)", msg.From)
 	}
 
+	// Snapshot the state so that a send that reverts leaves no trace other
+	// than the gas it consumed, even if the calling actor carries on.
+	snapshot, err := ctx.state.Snapshot(context.TODO())
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "failed to snapshot state")
+	}
+
 	toActor, err := deps.GetOrCreateActor(context.TODO(), msg.To, func() (*actor.Actor, error) {
 		return &actor.Actor{}, nil
 	})
 	if err != nil {
+		if releaseErr := ctx.state.Release(context.TODO(), snapshot); releaseErr != nil {
+			return nil, 1, errors.FaultErrorWrap(releaseErr, "failed to release state snapshot")
+		}
 		return nil, 1, errors.FaultErrorWrapf(err, "failed to get or create To actor %s", msg.To)
 	}
 	// TODO(fritz) de-dup some of the logic between here and core.Send
@@ -177,9 +210,24 @@ func (ctx *Context) Send(to address.Address, method string, value *types.AttoFIL
 
 	out, ret, err := deps.Send(context.Background(), innerCtx)
 	if err != nil {
+		// A send that reverts is rolled back. Any other error leaves its
+		// changes for the caller to deal with, so the snapshot is dropped.
+		if errors.ShouldRevert(err) {
+			if revertErr := ctx.state.Revert(context.TODO(), snapshot); revertErr != nil {
+				return nil, 1, errors.FaultErrorWrap(revertErr, "failed to revert state")
+			}
+		} else if releaseErr := ctx.state.Release(context.TODO(), snapshot); releaseErr != nil {
+			return nil, 1, errors.FaultErrorWrap(releaseErr, "failed to release state snapshot")
+		}
 		return nil, ret, err
 	}
 
+	// The send went through, so its changes are kept and the snapshot is no
+	// longer needed.
+	if err := ctx.state.Release(context.TODO(), snapshot); err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "failed to release state snapshot")
+	}
+
 	return out, ret, nil
 }
 
@@ -210,6 +258,10 @@ func computeActorAddress(creator address.Address, nonce uint64) (address.Address
 // CreateNewActor creates and initializes an actor at the given address.
 // If the address is occupied by a non-empty actor, this method will fail.
 func (ctx *Context) CreateNewActor(addr address.Address, code cid.Cid, initializerData interface{}) error {
+	if err := ctx.ChargeOp(exec.GasOpCreateActor, 1); err != nil {
+		return errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
 	// Check existing address. If nothing there, create empty actor.
 	newActor, err := ctx.state.GetOrCreateActor(context.TODO(), addr, func() (*actor.Actor, error) {
 		return &actor.Actor{}, nil
@@ -226,7 +278,10 @@ func (ctx *Context) CreateNewActor(addr address.Address, code cid.Cid, initializ
 	// make this the right 'type' of actor
 	newActor.Code = code
 
-	childStorage := ctx.storageMap.NewStorage(addr, newActor)
+	childStorage := &meteredStorage{
+		Storage:    ctx.storageMap.NewStorage(addr, newActor),
+		gasTracker: ctx.gasTracker,
+	}
 	execActor, err := ctx.state.GetBuiltinActorCode(code)
 	if err != nil {
 		return errors.NewRevertErrorf("attempt to create executable actor from non-existent code %s", code.String())
@@ -284,6 +339,27 @@ func (ctx *Context) Rand(sampleHeight *types.BlockHeight) ([]byte, error) {
 	return ctx.ancestors[lookBackIndex].MinTicket()
 }
 
+// meteredStorage charges the gas schedule's per byte storage price for every
+// chunk an actor puts into its storage.
+type meteredStorage struct {
+	Storage
+	gasTracker *GasTracker
+}
+
+var _ exec.Storage = (*meteredStorage)(nil)
+
+// Put adds a node to temporary storage and charges for the bytes written.
+func (s *meteredStorage) Put(v interface{}) (cid.Cid, error) {
+	nd, err := s.Storage.put(v)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := s.gasTracker.ChargeOp(exec.GasOpStoragePutByte, uint64(len(nd.RawData()))); err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
 // Dependency injection setup.
 
 // makeDeps returns a VMContext's external dependencies with their standard values set.
@@ -87,6 +87,15 @@ func TestVMContextSendFailures(t *testing.T) {
 	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
 	vms := NewStorageMap(bs)
 
+	// assertSnapshotsReleased checks that Send left no snapshot of the state
+	// behind: the next snapshot taken is the first one.
+	assertSnapshotsReleased := func(assert *assert.Assertions) {
+		rev, err := tree.Snapshot(context.Background())
+		assert.NoError(err)
+		assert.Equal(state.RevID(0), rev)
+		assert.NoError(tree.Release(context.Background(), rev))
+	}
+
 	vmCtxParams := NewContextParams{
 		From:        actor1,
 		To:          actor2,
@@ -206,6 +215,7 @@ func TestVMContextSendFailures(t *testing.T) {
 		assert.Equal(1, int(code))
 		assert.True(errors.IsFault(err))
 		assert.Equal([]string{"ToValues", "EncodeValues", "GetOrCreateActor"}, calls)
+		assertSnapshotsReleased(assert)
 	})
 
 	t.Run("propagates any error returned from Send", func(t *testing.T) {
@@ -242,6 +252,7 @@ func TestVMContextSendFailures(t *testing.T) {
 		assert.Equal(123, int(code))
 		assert.Equal(expectedVMSendErr, err)
 		assert.Equal([]string{"ToValues", "EncodeValues", "GetOrCreateActor", "Send"}, calls)
+		assertSnapshotsReleased(assert)
 	})
 
 	t.Run("creates new actor from cid", func(t *testing.T) {
@@ -0,0 +1,53 @@
+package vm
+
+import (
+	"context"
+
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+// GasBreakdown records the gas charged for each kind of operation.
+type GasBreakdown map[exec.GasOp]types.GasUnits
+
+// InstallGasSchedule creates the gas schedule actor holding gs at
+// address.GasScheduleAddress. It is meant to be called while building a
+// genesis state.
+func InstallGasSchedule(ctx context.Context, st state.Tree, storageMap StorageMap, gs *gasschedule.Schedule) error {
+	a := gasschedule.NewActor()
+	if err := (&gasschedule.Actor{}).InitializeState(storageMap.NewStorage(address.GasScheduleAddress, a), gs); err != nil {
+		return err
+	}
+	return st.SetActor(ctx, address.GasScheduleAddress, a)
+}
+
+// LoadGasSchedule reads the gas schedule in effect for the given state. If no
+// schedule was installed at genesis the default schedule is returned.
+func LoadGasSchedule(ctx context.Context, st state.Tree, storageMap StorageMap) (*gasschedule.Schedule, error) {
+	a, err := st.GetActor(ctx, address.GasScheduleAddress)
+	if state.IsActorNotFoundError(err) {
+		return gasschedule.DefaultSchedule(), nil
+	} else if err != nil {
+		return nil, errors.FaultErrorWrap(err, "failed to get gas schedule actor")
+	}
+	if !a.Code.Equals(types.GasScheduleActorCodeCid) {
+		return nil, errors.NewFaultErrorf("actor at gas schedule address has code %s", a.Code)
+	}
+
+	chunk, err := storageMap.NewStorage(address.GasScheduleAddress, a).Get(a.Head)
+	if err != nil {
+		return nil, errors.FaultErrorWrap(err, "failed to read gas schedule")
+	}
+
+	var gs gasschedule.Schedule
+	if err := cbor.DecodeInto(chunk, &gs); err != nil {
+		return nil, errors.FaultErrorWrap(err, "failed to decode gas schedule")
+	}
+	return &gs, nil
+}
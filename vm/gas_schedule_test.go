@@ -0,0 +1,103 @@
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+func TestGasTrackerChargeOp(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	gasTracker := NewGasTracker()
+	gasTracker.Schedule = &gasschedule.Schedule{
+		MethodCall:        types.NewGasUnits(100),
+		StoragePutPerByte: types.NewGasUnits(1),
+	}
+	gasTracker.ResetForNewMessage(types.MeteredMessage{GasLimit: types.NewGasUnits(150)})
+
+	require.NoError(gasTracker.ChargeOp(exec.GasOpMethodCall, 1))
+	require.NoError(gasTracker.ChargeOp(exec.GasOpStoragePutByte, 30))
+	// Free operations do not show up in the breakdown.
+	require.NoError(gasTracker.ChargeOp(exec.GasOpSend, 1))
+
+	assert.Equal(GasBreakdown{
+		exec.GasOpMethodCall:     types.NewGasUnits(100),
+		exec.GasOpStoragePutByte: types.NewGasUnits(30),
+	}, gasTracker.MessageBreakdown())
+
+	err := gasTracker.ChargeOp(exec.GasOpStoragePutByte, 30)
+	require.Error(err)
+	assert.True(errors.ShouldRevert(err))
+	assert.Equal(types.NewGasUnits(50), gasTracker.MessageBreakdown()[exec.GasOpStoragePutByte])
+
+	gasTracker.ResetForNewMessage(types.MeteredMessage{GasLimit: types.NewGasUnits(150)})
+	assert.Empty(gasTracker.MessageBreakdown())
+}
+
+func TestInstallAndLoadGasSchedule(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	storageMap := NewStorageMap(bs)
+	st := state.NewEmptyStateTree(hamt.NewCborStore())
+
+	gs, err := LoadGasSchedule(ctx, st, storageMap)
+	require.NoError(err)
+	assert.Equal(gasschedule.DefaultSchedule(), gs)
+
+	custom := &gasschedule.Schedule{
+		MethodCall:      types.NewGasUnits(10),
+		Send:            types.NewGasUnits(20),
+		VerifySignature: types.NewGasUnits(30),
+	}
+	require.NoError(InstallGasSchedule(ctx, st, storageMap, custom))
+
+	gs, err = LoadGasSchedule(ctx, st, storageMap)
+	require.NoError(err)
+	assert.Equal(custom, gs)
+
+	a, err := st.GetActor(ctx, address.GasScheduleAddress)
+	require.NoError(err)
+	assert.Equal(types.GasScheduleActorCodeCid, a.Code)
+}
+
+func TestMeteredStoragePut(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	gasTracker := NewGasTracker()
+	gasTracker.Schedule = &gasschedule.Schedule{StoragePutPerByte: types.NewGasUnits(1)}
+	gasTracker.ResetForNewMessage(types.MeteredMessage{GasLimit: types.NewGasUnits(1000)})
+
+	storageMap := NewStorageMap(blockstore.NewBlockstore(datastore.NewMapDatastore()))
+	s := &meteredStorage{
+		Storage:    storageMap.NewStorage(address.TestAddress, &actor.Actor{}),
+		gasTracker: gasTracker,
+	}
+
+	value := []string{"metered", "storage"}
+	encoded, err := cbor.DumpObject(value)
+	require.NoError(err)
+
+	_, err = s.Put(value)
+	require.NoError(err)
+	assert.Equal(types.NewGasUnits(uint64(len(encoded))), gasTracker.MessageBreakdown()[exec.GasOpStoragePutByte])
+}
@@ -1,23 +1,30 @@
 package vm
 
 import (
+	"github.com/filecoin-project/go-filecoin/actor/builtin/gasschedule"
+	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm/errors"
 )
 
 // GasTracker maintains the state of gas usage throughout the execution of a block and a message
 type GasTracker struct {
-	MsgGasLimit          types.GasUnits
+	MsgGasLimit types.GasUnits
+	// Schedule prices the operations charged through ChargeOp.
+	Schedule             *gasschedule.Schedule
 	gasConsumedByBlock   types.GasUnits
 	gasConsumedByMessage types.GasUnits
+	messageBreakdown     GasBreakdown
 }
 
-// NewGasTracker initializes a new empty gas tracker
+// NewGasTracker initializes a new empty gas tracker using the default gas schedule
 func NewGasTracker() *GasTracker {
 	return &GasTracker{
 		MsgGasLimit:          types.NewGasUnits(0),
+		Schedule:             gasschedule.DefaultSchedule(),
 		gasConsumedByBlock:   types.NewGasUnits(0),
 		gasConsumedByMessage: types.NewGasUnits(0),
+		messageBreakdown:     GasBreakdown{},
 	}
 }
 
@@ -25,21 +32,46 @@ func NewGasTracker() *GasTracker {
 func (gasTracker *GasTracker) ResetForNewMessage(message types.MeteredMessage) {
 	gasTracker.MsgGasLimit = message.GasLimit
 	gasTracker.gasConsumedByMessage = types.NewGasUnits(0)
+	gasTracker.messageBreakdown = GasBreakdown{}
 }
 
 // Charge will add the gas charge to the current method gas context.
 func (gasTracker *GasTracker) Charge(cost types.GasUnits) error {
-	if gasTracker.gasConsumedByMessage+cost > gasTracker.MsgGasLimit {
+	return gasTracker.charge(exec.GasOpOther, cost)
+}
+
+// ChargeOp will add the scheduled price of count occurrences of op to the
+// current method gas context.
+func (gasTracker *GasTracker) ChargeOp(op exec.GasOp, count uint64) error {
+	return gasTracker.charge(op, gasTracker.Schedule.Cost(op, count))
+}
+
+func (gasTracker *GasTracker) charge(op exec.GasOp, cost types.GasUnits) error {
+	remaining := gasTracker.MsgGasLimit - gasTracker.gasConsumedByMessage
+	if cost > remaining {
+		gasTracker.messageBreakdown[op] += remaining
 		gasTracker.gasConsumedByMessage = gasTracker.MsgGasLimit
 		gasTracker.gasConsumedByBlock += gasTracker.MsgGasLimit
 		return errors.NewRevertError("gas cost exceeds gas limit")
 	}
 
+	gasTracker.messageBreakdown[op] += cost
 	gasTracker.gasConsumedByMessage += cost
 	gasTracker.gasConsumedByBlock += cost
 	return nil
 }
 
+// MessageBreakdown returns the gas consumed by the current message grouped by operation.
+func (gasTracker *GasTracker) MessageBreakdown() GasBreakdown {
+	out := GasBreakdown{}
+	for op, units := range gasTracker.messageBreakdown {
+		if units > 0 {
+			out[op] = units
+		}
+	}
+	return out
+}
+
 // GasAboveBlockLimit will return true if the MsgGasLimit of the current message is greater than the block gas limit.
 func (gasTracker *GasTracker) GasAboveBlockLimit() bool {
 	return gasTracker.MsgGasLimit > types.BlockGasLimit
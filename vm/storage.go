@@ -104,6 +104,15 @@ func NewStorage(bs blockstore.Blockstore, act *actor.Actor) Storage {
 
 // Put adds a node to temporary storage by id.
 func (s Storage) Put(v interface{}) (cid.Cid, error) {
+	nd, err := s.put(v)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
+// put adds a node to temporary storage and returns it.
+func (s Storage) put(v interface{}) (format.Node, error) {
 	var nd format.Node
 	var err error
 	if blk, ok := v.(blocks.Block); ok {
@@ -115,13 +124,11 @@ func (s Storage) Put(v interface{}) (cid.Cid, error) {
 		nd, err = cbor.WrapObject(v, types.DefaultHashFunction, -1)
 	}
 	if err != nil {
-		return cid.Undef, exec.Errors[exec.ErrDecode]
+		return nil, exec.Errors[exec.ErrDecode]
 	}
 
-	c := nd.Cid()
-	s.chunks[c] = nd
-
-	return c, nil
+	s.chunks[nd.Cid()] = nd
+	return nd, nil
 }
 
 // Get retrieves a chunk from either temporary storage or its backing store.